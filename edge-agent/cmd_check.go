@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/certs"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+
+	certExpiryWarning = 14 * 24 * time.Hour
+	clockSkewWarning  = 5 * time.Second
+	clockSkewFailure  = 30 * time.Second
+)
+
+type checkResult struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+}
+
+// checkCommand verifies the whole path to the control plane: DNS, TLS, auth,
+// the WebSocket upgrade and clock skew.
+func checkCommand(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to configuration file")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *configPath, err)
+	}
+
+	u, err := url.Parse(cfg.ControlPlane.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid control plane URL %q", cfg.ControlPlane.URL)
+	}
+
+	var store *certs.Store
+	if cfg.ControlPlane.TLS.Enabled {
+		store = certs.NewStore(cfg.ControlPlane.TLS.CertPath, cfg.ControlPlane.TLS.KeyPath)
+		if err := store.Load(); err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	}
+	tlsConfig, err := certs.ClientTLSConfig(cfg.ControlPlane, store)
+	if err != nil {
+		return err
+	}
+
+	results := []checkResult{checkDNS(u)}
+	if u.Scheme == "https" {
+		results = append(results, checkTLS(u, tlsConfig))
+	}
+
+	auth, skew := checkAuth(cfg.ControlPlane, tlsConfig)
+	results = append(results, auth, checkWebSocket(cfg.ControlPlane, tlsConfig), skew)
+
+	failed := 0
+	for _, r := range results {
+		if r.Result == checkFail {
+			failed++
+		}
+	}
+
+	err = render(map[string]interface{}{"checks": results, "failed": failed}, func() {
+		fmt.Printf("%-10s %-6s %s\n", "CHECK", "RESULT", "DETAIL")
+		for _, r := range results {
+			fmt.Printf("%-10s %-6s %s\n", r.Name, r.Result, r.Detail)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func checkDNS(u *url.URL) checkResult {
+	start := time.Now()
+	addrs, err := net.LookupHost(u.Hostname())
+	if err != nil {
+		return checkResult{"dns", checkFail, err.Error()}
+	}
+	return checkResult{"dns", checkPass, fmt.Sprintf("%s -> %s (%s)",
+		u.Hostname(), strings.Join(addrs, ", "), time.Since(start).Round(time.Millisecond))}
+}
+
+func checkTLS(u *url.URL, tlsConfig *tls.Config) checkResult {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	conf := tlsConfig.Clone()
+	conf.ServerName = u.Hostname()
+	// Verify the chain ourselves so a skip_verify config still reports problems.
+	conf.InsecureSkipVerify = true
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", net.JoinHostPort(u.Hostname(), port), conf)
+	if err != nil {
+		return checkResult{"tls", checkFail, err.Error()}
+	}
+	defer conn.Close()
+
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return checkResult{"tls", checkFail, "server sent no certificate"}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range peers[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verifyErr := peers[0].Verify(x509.VerifyOptions{
+		DNSName:       u.Hostname(),
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+	})
+
+	expiry := peers[0].NotAfter
+	for _, c := range peers[1:] {
+		if c.NotAfter.Before(expiry) {
+			expiry = c.NotAfter
+		}
+	}
+	remaining := time.Until(expiry)
+	detail := fmt.Sprintf("chain of %d, expires %s (%d days)", len(peers), expiry.Format("2006-01-02"), int(remaining.Hours()/24))
+
+	switch {
+	case verifyErr != nil:
+		return checkResult{"tls", checkFail, verifyErr.Error()}
+	case remaining <= 0:
+		return checkResult{"tls", checkFail, detail}
+	case remaining < certExpiryWarning:
+		return checkResult{"tls", checkWarn, detail}
+	}
+	return checkResult{"tls", checkPass, detail}
+}
+
+// checkAuth makes an authenticated read-only request. The response's Date
+// header doubles as the reference for the clock skew check.
+func checkAuth(cfg config.ControlPlaneConfig, tlsConfig *tls.Config) (checkResult, checkResult) {
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           cfg.ProxyFunc(),
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(cfg.URL, "/")+"/api/agent/update", nil)
+	if err != nil {
+		return checkResult{"auth", checkFail, err.Error()}, checkResult{"clock", checkFail, "no response"}
+	}
+	if cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	}
+
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return checkResult{"auth", checkFail, err.Error()}, checkResult{"clock", checkFail, "no response"}
+	}
+	resp.Body.Close()
+	received := time.Now()
+
+	var auth checkResult
+	switch {
+	case cfg.AuthToken == "":
+		auth = checkResult{"auth", checkFail, "no auth token configured, node not enrolled"}
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		auth = checkResult{"auth", checkFail, fmt.Sprintf("token rejected (HTTP %d)", resp.StatusCode)}
+	case resp.StatusCode >= 500:
+		auth = checkResult{"auth", checkWarn, fmt.Sprintf("control plane error (HTTP %d)", resp.StatusCode)}
+	default:
+		auth = checkResult{"auth", checkPass, "token accepted"}
+	}
+
+	return auth, checkClockSkew(resp.Header.Get("Date"), sent, received)
+}
+
+func checkClockSkew(dateHeader string, sent, received time.Time) checkResult {
+	serverTime, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return checkResult{"clock", checkWarn, "control plane sent no Date header"}
+	}
+
+	// Date has one second resolution, compare against the request midpoint.
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(serverTime)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	detail := fmt.Sprintf("local clock is %s off", skew.Round(time.Second))
+	switch {
+	case abs > clockSkewFailure:
+		return checkResult{"clock", checkFail, detail}
+	case abs > clockSkewWarning:
+		return checkResult{"clock", checkWarn, detail}
+	}
+	return checkResult{"clock", checkPass, detail}
+}
+
+func checkWebSocket(cfg config.ControlPlaneConfig, tlsConfig *tls.Config) checkResult {
+	dialer := websocket.Dialer{
+		Proxy:            cfg.ProxyFunc(),
+		HandshakeTimeout: 15 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+cfg.AuthToken)
+
+	conn, resp, err := dialer.Dial(agent.CommandChannelURL(cfg.URL), header)
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return checkResult{"websocket", checkFail, fmt.Sprintf("upgrade refused (HTTP %d)", resp.StatusCode)}
+		}
+		return checkResult{"websocket", checkFail, err.Error()}
+	}
+	conn.Close()
+
+	return checkResult{"websocket", checkPass, "upgrade succeeded"}
+}
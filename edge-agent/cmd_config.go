@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return fmt.Errorf("usage: hosting-edge-agent config validate [--config path]")
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to configuration file")
+	fs.Parse(args[1:])
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *configPath, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	return render(map[string]interface{}{"path": *configPath, "valid": true}, func() {
+		fmt.Printf("%s is valid\n", *configPath)
+	})
+}
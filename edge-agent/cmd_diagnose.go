@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+)
+
+type diagnosis struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+func diagnoseCommand(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to configuration file")
+	bundle := fs.Bool("bundle", false, "Have the running agent write a diagnostics tar.gz for support")
+	upload := fs.Bool("upload", false, "With -bundle, also upload it to the control plane")
+	fs.Parse(args)
+
+	if *bundle {
+		return diagnosticsBundle(socketPathFor(*configPath, ""), *upload)
+	}
+
+	var results []diagnosis
+	add := func(name string, err error, detail string) {
+		d := diagnosis{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			d.Detail = err.Error()
+		}
+		results = append(results, d)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	add("config", err, *configPath)
+
+	kind := ""
+	if cfg != nil {
+		kind = cfg.Agent.ServiceManager
+	}
+	services, err := service.New(kind)
+	if err != nil {
+		return err
+	}
+
+	if cfg != nil {
+		add("data dir", checkWritable(cfg.Agent.DataDir), cfg.Agent.DataDir)
+		for _, u := range cfg.ControlPlane.Endpoints() {
+			add("control plane", checkControlPlane(cfg.ControlPlane, u), u)
+		}
+
+		unit := cfg.Wings.SystemdUnit
+		var inactive error
+		if !services.IsActive(unit) {
+			inactive = fmt.Errorf("%s is not running (%s)", unit, services.Kind())
+		}
+		add("wings service", inactive, unit+" is active")
+		add("agent api", api.NewClient(socketPathFor(*configPath, "")).Get("/status", &api.Status{}), "running")
+	}
+
+	conn, err := net.DialTimeout("unix", "/var/run/docker.sock", 2*time.Second)
+	if err == nil {
+		conn.Close()
+	}
+	add("docker", err, "/var/run/docker.sock reachable")
+
+	timeSettings := system.GetTimeSettings(services)
+	var ntpErr error
+	if !timeSettings.NTPSynchronized {
+		ntpErr = fmt.Errorf("clock not synchronized (timezone %s)", timeSettings.Timezone)
+	}
+	add("time sync", ntpErr, fmt.Sprintf("synchronized via %s, timezone %s", timeSettings.NTPService, timeSettings.Timezone))
+
+	virt := system.DetectVirtualization()
+	add("virtualization", nil, fmt.Sprintf("hypervisor=%s container=%s kvm=%t", virt.Hypervisor, virt.Container, virt.KVMAvailable))
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+
+	var stats []api.EndpointStats
+	if cfg != nil {
+		stats = endpointStats(socketPathFor(*configPath, ""))
+	}
+
+	summary := map[string]interface{}{"checks": results, "failed": failed, "endpoints": stats}
+	err = render(summary, func() {
+		for _, r := range results {
+			mark := "OK  "
+			if !r.OK {
+				mark = "FAIL"
+			}
+			fmt.Printf("[%s] %-15s %s\n", mark, r.Name, r.Detail)
+		}
+		printEndpointStats(stats)
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func diagnosticsBundle(socketPath string, upload bool) error {
+	var bundle api.DiagnosticsBundle
+	path := "/diagnostics"
+	if upload {
+		path += "?upload=true"
+	}
+	if err := api.NewClient(socketPath).Post(path, nil, &bundle); err != nil {
+		return fmt.Errorf("failed to create diagnostics bundle (is the agent running?): %w", err)
+	}
+	return render(bundle, func() {
+		fmt.Printf("Wrote %s (%d bytes, %d files)\n", bundle.Path, bundle.Size, len(bundle.Files))
+		if bundle.UploadID != "" {
+			fmt.Printf("Uploaded to the control plane as %s\n", bundle.UploadID)
+		}
+	})
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".diagnose-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(filepath.Clean(name))
+}
+
+// checkControlPlane only verifies the control plane answers HTTP at all,
+// any status code counts as reachable.
+func checkControlPlane(cfg config.ControlPlaneConfig, url string) error {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           cfg.ProxyFunc(),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.TLSSkipVerify},
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// endpointStats fetches per-endpoint latency from the running agent, so a
+// slow panel can be pinned on one endpoint or the whole path.
+func endpointStats(socketPath string) []api.EndpointStats {
+	var stats []api.EndpointStats
+	if err := api.NewClient(socketPath).Get("/endpoints", &stats); err != nil {
+		return nil
+	}
+	return stats
+}
+
+func printEndpointStats(stats []api.EndpointStats) {
+	if len(stats) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("%-32s %8s %8s %8s %9s %9s %9s\n", "ENDPOINT", "REQS", "OK%", "RETRIES", "P50", "P90", "P99")
+	for _, s := range stats {
+		fmt.Printf("%-32s %8d %7.1f%% %8d %7.0fms %7.0fms %7.0fms\n",
+			s.Endpoint, s.Requests, s.SuccessRate*100, s.Retries, s.P50Ms, s.P90Ms, s.P99Ms)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+)
+
+func enrollCommand(args []string) error {
+	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
+	var (
+		configPath      = fs.String("config", defaultConfigPath, "Path to configuration file")
+		logLevel        = fs.String("log-level", "info", "Log level (debug, info, warn, error)")
+		token           = fs.String("token", "", "Enrollment token issued by the control plane")
+		controlPlaneURL = fs.String("control-plane", "", "Control plane URL")
+		nodeID          = fs.String("node-id", "", "ID the control plane pre-registered this node as")
+		activationToken = fs.String("activation-token", "", "Token issued for the pre-registered node, instead of --token")
+	)
+	fs.Parse(args)
+
+	switch {
+	case *activationToken != "" && *token != "":
+		return fmt.Errorf("--token and --activation-token are mutually exclusive")
+	case *activationToken != "" && *nodeID == "":
+		return fmt.Errorf("--activation-token needs --node-id")
+	case *activationToken == "" && *token == "":
+		return fmt.Errorf("--token or --node-id with --activation-token is required")
+	}
+
+	logger, err := setupLogging(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	// Keep any settings already on disk, e.g. written by the installer.
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load existing configuration: %w", err)
+		}
+		cfg = &config.Config{}
+	}
+
+	if *controlPlaneURL != "" {
+		cfg.ControlPlane.URL = *controlPlaneURL
+	}
+	if cfg.ControlPlane.URL == "" {
+		return fmt.Errorf("--control-plane is required")
+	}
+	cfg.ControlPlane.EnrollToken = *token
+	cfg.ControlPlane.ActivationToken = *activationToken
+	cfg.ControlPlane.AuthToken = ""
+	if *nodeID != "" {
+		cfg.Agent.NodeID = *nodeID
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := config.Save(*configPath, cfg); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	// Reload so defaults are applied the same way as on a normal start
+	if cfg, err = config.Load(*configPath); err != nil {
+		return err
+	}
+
+	agent.Version = Version
+	a, err := agent.New(cfg, *configPath, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer a.Stop()
+
+	if err := a.Enroll(); err != nil {
+		return err
+	}
+
+	if *activationToken != "" {
+		fmt.Printf("Node activated as %s\n", cfg.Agent.NodeID)
+	} else {
+		fmt.Printf("Node enrolled as %s\n", cfg.Agent.NodeID)
+	}
+	if services, err := service.New(cfg.Agent.ServiceManager); err == nil {
+		fmt.Printf("Start the agent with: %s\n", service.StartCommand(services, cfg.Agent.SystemdUnit))
+	}
+	return nil
+}
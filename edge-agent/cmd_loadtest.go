@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/loadtest"
+)
+
+// loadtestCommand runs simulated agents against a control plane. It's a
+// developer tool: point it at a staging panel, never production, since
+// every simulated agent enrolls as a node.
+func loadtestCommand(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	var (
+		opts     loadtest.Options
+		logLevel = fs.String("log-level", "info", "Log level (debug, info, warn, error)")
+	)
+	fs.StringVar(&opts.ControlPlane, "url", "", "Control plane base URL")
+	fs.StringVar(&opts.EnrollToken, "enroll-token", "", "Enroll every simulated agent with this token")
+	fs.StringVar(&opts.AuthToken, "auth-token", "", "Share one enrolled node's auth token instead of enrolling")
+	fs.IntVar(&opts.Agents, "agents", 100, "Number of simulated agents")
+	fs.DurationVar(&opts.Interval, "interval", 30*time.Second, "Heartbeat interval per agent")
+	fs.DurationVar(&opts.Ramp, "ramp", time.Minute, "Spread agent start-up over this long")
+	fs.DurationVar(&opts.Duration, "duration", 5*time.Minute, "How long to run once every agent is up")
+	fs.DurationVar(&opts.Timeout, "timeout", 30*time.Second, "Per-request timeout")
+	fs.BoolVar(&opts.Insecure, "insecure", false, "Skip TLS certificate verification")
+	fs.Float64Var(&opts.MalformedRate, "malformed-rate", 0, "Fraction of heartbeats sent with a truncated body")
+	fs.Float64Var(&opts.OutageRate, "outage-rate", 0, "Chance per heartbeat that an agent goes offline")
+	fs.DurationVar(&opts.OutageLength, "outage-length", 5*time.Minute, "How long an offline agent stays away before replaying missed heartbeats")
+	fs.Parse(args)
+
+	logger, err := setupLogging(*logLevel)
+	if err != nil {
+		return err
+	}
+	agent.Version = Version
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		logger.Info("Stopping load test")
+		cancel()
+	}()
+
+	logger.WithField("agents", opts.Agents).WithField("url", opts.ControlPlane).Info("Starting load test")
+	report, err := loadtest.Run(ctx, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	return render(report, func() {
+		fmt.Printf("Agents:   %d (%d enrolled)\n", report.Agents, report.Enrolled)
+		fmt.Printf("Elapsed:  %s\n", report.Elapsed)
+		fmt.Printf("Outages:  %d\n", report.Outages)
+		fmt.Println()
+
+		kinds := make([]string, 0, len(report.Requests))
+		for kind := range report.Requests {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		fmt.Printf("%-20s %9s %9s %8s %9s %9s %9s %9s\n", "REQUESTS", "TOTAL", "FAILED", "PER SEC", "P50", "P90", "P99", "MAX")
+		for _, kind := range kinds {
+			s := report.Requests[kind]
+			fmt.Printf("%-20s %9d %9d %8.1f %7.0fms %7.0fms %7.0fms %7.0fms\n",
+				kind, s.Requests, s.Failures, s.PerSec, s.P50Ms, s.P90Ms, s.P99Ms, s.MaxMs)
+		}
+	})
+}
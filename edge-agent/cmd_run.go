@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/bootstrap"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/logging"
+)
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		configPath      = fs.String("config", defaultConfigPath, "Path to configuration file")
+		logLevel        = fs.String("log-level", "info", "Log level (debug, info, warn, error)")
+		version         = fs.Bool("version", false, "Show version information")
+		installMode     = fs.Bool("install", false, "Install mode for initial setup (deprecated, use enroll)")
+		enrollToken     = fs.String("enroll-token", "", "Enrollment token for registration")
+		controlPlaneURL = fs.String("control-plane", "", "Control plane URL")
+
+		bootstrapMode    = fs.String("bootstrap", "auto", "Where an unconfigured node finds enrollment settings (auto, file, ec2, hetzner, digitalocean, a file path, or off)")
+		bootstrapFile    = fs.String("bootstrap-file", bootstrap.DefaultFile, "Bootstrap settings file checked by --bootstrap auto and file")
+		bootstrapTimeout = fs.Duration("bootstrap-timeout", 2*time.Minute, "How long to wait for a metadata service on first boot")
+	)
+	fs.Parse(args)
+
+	if *version {
+		return versionCommand(nil)
+	}
+
+	logger, err := setupLogging(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Starting Pterodactyl Control Plane Edge Agent")
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+
+	// A node that has never been configured looks for enrollment settings
+	// in a bootstrap file or its cloud user-data, so images can enroll
+	// themselves on first boot.
+	var settings *bootstrap.Settings
+	unconfigured := os.IsNotExist(err) || (err == nil && cfg.ControlPlane.AuthToken == "" && cfg.ControlPlane.EnrollToken == "" && cfg.ControlPlane.ActivationToken == "")
+	if unconfigured && !*installMode && *bootstrapMode != "off" {
+		sources, srcErr := bootstrap.Sources(*bootstrapMode, *bootstrapFile)
+		if srcErr != nil {
+			logger.WithError(srcErr).Fatal("Invalid bootstrap source")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *bootstrapTimeout)
+		found, findErr := bootstrap.Discover(ctx, sources, logger)
+		cancel()
+		if findErr == nil {
+			settings = &found
+		} else {
+			logger.WithError(findErr).Warn("Node is not configured and no bootstrap settings were found")
+		}
+	}
+
+	if settings != nil && err == nil {
+		cfg.ControlPlane.URL = settings.ControlPlaneURL
+		cfg.ControlPlane.EnrollToken = settings.EnrollToken
+		cfg.ControlPlane.ActivationToken = settings.ActivationToken
+		if settings.NodeID != "" {
+			cfg.Agent.NodeID = settings.NodeID
+		}
+		if err := config.Save(*configPath, cfg); err != nil {
+			logger.WithError(err).Fatal("Failed to save bootstrap configuration")
+		}
+		if cfg, err = config.Load(*configPath); err != nil {
+			logger.WithError(err).Fatal("Failed to reload bootstrap configuration")
+		}
+	}
+
+	// Pre-registered nodes only get these from bootstrap settings.
+	var nodeID, activationToken string
+	if settings != nil && err != nil {
+		*installMode = true
+		*enrollToken = settings.EnrollToken
+		*controlPlaneURL = settings.ControlPlaneURL
+		nodeID, activationToken = settings.NodeID, settings.ActivationToken
+	}
+
+	if err != nil {
+		if *installMode && ((*enrollToken == "" && activationToken == "") || *controlPlaneURL == "") {
+			logger.Fatal("Install mode requires --enroll-token and --control-plane flags")
+		} else if *installMode {
+			// Create initial configuration for enrollment
+			cfg = &config.Config{
+				ControlPlane: config.ControlPlaneConfig{
+					URL:             *controlPlaneURL,
+					EnrollToken:     *enrollToken,
+					ActivationToken: activationToken,
+				},
+				Agent: config.AgentConfig{
+					NodeID:            nodeID,
+					LogLevel:          *logLevel,
+					HeartbeatInterval: 30,
+					MetricsInterval:   60,
+				},
+			}
+
+			// Create config directory
+			if err := os.MkdirAll(filepath.Dir(*configPath), 0755); err != nil {
+				logger.WithError(err).Fatal("Failed to create config directory")
+			}
+
+			// Save initial config
+			if err := config.Save(*configPath, cfg); err != nil {
+				logger.WithError(err).Fatal("Failed to save initial configuration")
+			}
+			logger.Info("Initial configuration saved")
+
+			// Reload so defaults are applied the same way as on a normal start
+			if cfg, err = config.Load(*configPath); err != nil {
+				logger.WithError(err).Fatal("Failed to reload initial configuration")
+			}
+		} else {
+			logger.WithError(err).Fatal("Failed to load configuration")
+		}
+	}
+
+	if settings != nil {
+		if err := bootstrap.Consume(*settings); err != nil {
+			logger.WithError(err).Warn("Failed to remove bootstrap settings")
+		}
+	}
+
+	if err := logging.Configure(cfg.Logging); err != nil {
+		logger.WithError(err).Warn("Failed to apply logging settings, logging to stderr")
+	}
+
+	// Create and start agent
+	agent.Version = Version
+	a, err := agent.New(cfg, *configPath, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create agent")
+	}
+
+	// Handle shutdown gracefully
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigChan
+		logger.WithField("signal", sig).Info("Received shutdown signal")
+		a.Stop()
+	}()
+
+	// SIGHUP (systemctl reload) re-reads the config without restarting
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	go func() {
+		for range hupChan {
+			logger.Info("Received SIGHUP, reloading configuration")
+			if err := a.Reload(); err != nil {
+				logger.WithError(err).Error("Configuration reload failed")
+			}
+		}
+	}()
+
+	// Start the agent
+	if err := a.Start(); err != nil {
+		logger.WithError(err).Fatal("Agent failed to start")
+	}
+
+	logger.Info("Agent stopped")
+	return nil
+}
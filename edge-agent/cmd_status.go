@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+// socketPathFor resolves the local API socket the same way the agent does.
+func socketPathFor(configPath, override string) string {
+	if override != "" {
+		return override
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return defaultSocketPath
+	}
+	if cfg.Agent.AdminSocket != "" {
+		return cfg.Agent.AdminSocket
+	}
+	return filepath.Join(cfg.Agent.DataDir, "agent.sock")
+}
+
+func statusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", defaultConfigPath, "Path to configuration file")
+		socketPath = fs.String("socket", "", "Path to the agent's local API socket")
+	)
+	fs.Parse(args)
+
+	client := api.NewClient(socketPathFor(*configPath, *socketPath))
+
+	var status api.Status
+	if err := client.Get("/status", &status); err != nil {
+		return fmt.Errorf("agent is not reachable: %w", err)
+	}
+
+	return render(status, func() { printStatus(status) })
+}
+
+func printStatus(status api.Status) {
+	fmt.Printf("Version:             %s\n", status.Version)
+	fmt.Printf("Node ID:             %s\n", status.NodeID)
+	fmt.Printf("Session:             %s\n", status.SessionID)
+	fmt.Printf("Uptime:              %s\n", status.Uptime)
+	fmt.Printf("Log level:           %s\n", status.LogLevel)
+	fmt.Printf("Update state:        %s\n", status.Update.State)
+	fmt.Printf("Buffered heartbeats: %d\n", status.BufferedHeartbeats)
+
+	hb := status.LastHeartbeat
+	switch {
+	case hb.Time.IsZero():
+		fmt.Println("Last heartbeat:      never")
+	case hb.Error != "":
+		fmt.Printf("Last heartbeat:      %s (failed: %s)\n", hb.Time.Format("2006-01-02 15:04:05"), hb.Error)
+	default:
+		fmt.Printf("Last heartbeat:      %s (ok)\n", hb.Time.Format("2006-01-02 15:04:05"))
+	}
+
+	if status.Auth.State == "rejected" {
+		fmt.Printf("Credentials:         REJECTED (HTTP %d since %s)\n", status.Auth.Status, status.Auth.Since.Format("2006-01-02 15:04:05"))
+	}
+
+	if d := status.Drain; d.State != "" && d.State != "active" {
+		fmt.Printf("Maintenance:         %s since %s (%d servers running) %s\n", d.State, d.Since.Format("2006-01-02 15:04:05"), d.RunningServers, d.Reason)
+	}
+
+	if sb := status.Standby; sb != nil {
+		ready := 0
+		for _, err := range sb.Images {
+			if err == "" {
+				ready++
+			}
+		}
+		fmt.Printf("Standby:             since %s (%d/%d images ready)\n", sb.Since.Format("2006-01-02 15:04:05"), ready, len(sb.Images))
+	}
+
+	for _, l := range status.Locks {
+		fmt.Printf("Lock %-15s held by %s since %s (%d waiting)\n", l.Resource+":", l.Owner, l.Since.Format("2006-01-02 15:04:05"), l.Waiting)
+	}
+
+	if bw := status.Bandwidth; bw != nil {
+		names := make([]string, 0, len(bw.Interfaces))
+		for name := range bw.Interfaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := bw.Interfaces[name]
+			fmt.Printf("Transfer %s:   %-12s rx %.2f GiB, tx %.2f GiB\n", bw.Month, name, float64(t.RxBytes)/(1<<30), float64(t.TxBytes)/(1<<30))
+		}
+	}
+
+	for _, cp := range status.ControlPlanes {
+		state := "healthy"
+		if !cp.Healthy {
+			state = "cooling down: " + cp.LastError
+		}
+		if cp.Region != "" {
+			state = cp.Region + ", " + state
+		}
+		marker := ""
+		if cp.Active {
+			marker = " *"
+		}
+		fmt.Printf("Control plane:       %s%s (%s, %d served, %.0fms)\n", cp.URL, marker, state, cp.Served, cp.LatencyMs)
+	}
+}
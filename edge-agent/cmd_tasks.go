@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+func tasksCommand(args []string) error {
+	if len(args) == 0 || args[0] != "history" {
+		return fmt.Errorf("usage: hosting-edge-agent tasks history [--type t] [--status s] [--since 24h] [-q text] [--limit n]")
+	}
+
+	fs := flag.NewFlagSet("tasks history", flag.ExitOnError)
+	var (
+		configPath  = fs.String("config", defaultConfigPath, "Path to configuration file")
+		socketPath  = fs.String("socket", "", "Path to the agent's local API socket")
+		taskType    = fs.String("type", "", "Only tasks of this type")
+		status      = fs.String("status", "", "Only tasks that ended with this status, e.g. failed")
+		requestedBy = fs.String("requested-by", "", "Only tasks requested by this user or schedule")
+		since       = fs.String("since", "", "Only tasks finished since this RFC 3339 time or duration ago")
+		search      = fs.String("q", "", "Only tasks whose type, requester, output or error contains this text")
+		limit       = fs.Int("limit", 50, "Maximum number of tasks to show")
+		showOutput  = fs.Bool("show-output", false, "Print each task's output below it")
+	)
+	fs.Parse(args[1:])
+
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"type": *taskType, "status": *status, "requested_by": *requestedBy, "since": *since, "q": *search,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	query.Set("limit", strconv.Itoa(*limit))
+
+	client := api.NewClient(socketPathFor(*configPath, *socketPath))
+
+	var entries []tasks.HistoryEntry
+	if err := client.Get("/tasks/history?"+query.Encode(), &entries); err != nil {
+		return fmt.Errorf("agent is not reachable: %w", err)
+	}
+
+	return render(entries, func() {
+		if len(entries) == 0 {
+			fmt.Println("No matching tasks")
+			return
+		}
+		fmt.Printf("%-19s %-24s %-10s %9s %-24s %s\n", "FINISHED", "TYPE", "STATUS", "DURATION", "REQUESTED BY", "TASK")
+		for _, e := range entries {
+			duration := (time.Duration(e.DurationMs) * time.Millisecond).Round(time.Millisecond)
+			fmt.Printf("%-19s %-24s %-10s %9s %-24s %s\n",
+				e.FinishedAt.Local().Format("2006-01-02 15:04:05"), e.Type, e.Status, duration, e.RequestedBy, e.TaskID)
+			if *showOutput {
+				if e.Error != "" {
+					fmt.Printf("  error: %s\n", e.Error)
+				}
+				if e.Output != "" {
+					if e.Truncated {
+						fmt.Println("  ...")
+					}
+					fmt.Println(e.Output)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+)
+
+// unenrollCommand decommissions the node: it's removed from the control
+// plane, and the agent's credentials and state are wiped. Unlike uninstall
+// the binary and service definition stay, ready for a fresh enrollment.
+func unenrollCommand(args []string) error {
+	fs := flag.NewFlagSet("unenroll", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", defaultConfigPath, "Path to configuration file")
+		logLevel   = fs.String("log-level", "warn", "Log level (debug, info, warn, error)")
+		reason     = fs.String("reason", "", "Reason recorded by the control plane")
+		stopWings  = fs.Bool("stop-wings", false, "Also stop and disable Wings")
+		keepData   = fs.Bool("keep-data", false, "Keep the agent's data directory")
+		force      = fs.Bool("force", false, "Wipe local credentials even if the control plane can't be reached")
+	)
+	fs.Parse(args)
+
+	logger, err := setupLogging(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.Agent.NodeID == "" && !*force {
+		return fmt.Errorf("node is not enrolled")
+	}
+
+	// The running agent would otherwise keep using the tokens until the
+	// control plane rejects them, and be restarted without any.
+	if services, err := service.New(cfg.Agent.ServiceManager); err == nil {
+		if path, err := services.DefinitionPath(cfg.Agent.SystemdUnit); err == nil && path != "" {
+			ctx := context.Background()
+			if err := services.Stop(ctx, cfg.Agent.SystemdUnit); err != nil {
+				return fmt.Errorf("failed to stop %s: %w", cfg.Agent.SystemdUnit, err)
+			}
+			if err := services.Disable(ctx, cfg.Agent.SystemdUnit); err != nil {
+				return fmt.Errorf("failed to disable %s: %w", cfg.Agent.SystemdUnit, err)
+			}
+			fmt.Printf("  %-28s done\n", "stop "+cfg.Agent.SystemdUnit)
+		}
+	}
+
+	agent.Version = Version
+	a, err := agent.New(cfg, *configPath, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer a.Stop()
+
+	steps, err := a.Decommission(context.Background(), agent.DecommissionOptions{
+		Reason:    *reason,
+		StopWings: *stopWings,
+		KeepData:  *keepData,
+		Force:     *force,
+	})
+	for _, s := range steps {
+		if s.Error != "" {
+			fmt.Printf("  %-28s FAILED: %s\n", s.Name, s.Error)
+		} else {
+			fmt.Printf("  %-28s done\n", s.Name)
+		}
+	}
+	if err != nil {
+		if !*force && len(steps) == 1 {
+			fmt.Printf("Nothing was wiped locally and %s stays stopped, run again with --force to wipe anyway\n", cfg.Agent.SystemdUnit)
+		}
+		return err
+	}
+
+	fmt.Println("Node unenrolled.")
+	if services, err := service.New(cfg.Agent.ServiceManager); err == nil {
+		fmt.Printf("Enroll it again with `hosting-edge-agent enroll`, then: %s\n", service.StartCommand(services, cfg.Agent.SystemdUnit))
+	}
+	return nil
+}
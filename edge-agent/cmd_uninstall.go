@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+)
+
+// uninstallCommand removes the agent's service. Wings, Docker and the game
+// servers are left alone; only what the agent installed goes.
+func uninstallCommand(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", defaultConfigPath, "Path to configuration file")
+		logLevel   = fs.String("log-level", "warn", "Log level (debug, info, warn, error)")
+		deregister = fs.Bool("deregister", false, "Remove the node from the control plane")
+		purge      = fs.Bool("purge", false, "Also delete the configuration, credentials and data directory")
+	)
+	fs.Parse(args)
+
+	logger, err := setupLogging(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	// A broken or missing config shouldn't stop the service being removed.
+	cfg, loadErr := config.Load(*configPath)
+	if loadErr != nil {
+		fmt.Printf("Could not load %s (%v), using default paths\n", *configPath, loadErr)
+		cfg = &config.Config{}
+	}
+	unit := cfg.Agent.SystemdUnit
+	if unit == "" {
+		unit = "hosting-edge-agent.service"
+	}
+	dataDir := cfg.Agent.DataDir
+	if dataDir == "" {
+		dataDir = filepath.Dir(defaultSocketPath)
+	}
+
+	var failed []string
+	step := func(name string, err error) {
+		if err != nil {
+			fmt.Printf("  %-28s FAILED: %v\n", name, err)
+			failed = append(failed, name)
+			return
+		}
+		fmt.Printf("  %-28s done\n", name)
+	}
+
+	if *deregister {
+		if loadErr != nil {
+			step("deregister", fmt.Errorf("no configuration to authenticate with"))
+		} else {
+			agent.Version = Version
+			a, err := agent.New(cfg, *configPath, logger)
+			if err == nil {
+				err = a.Deregister()
+				a.Stop()
+			}
+			step("deregister", err)
+		}
+	}
+
+	// Running again after a partial uninstall finds the service already gone.
+	if services, err := service.New(cfg.Agent.ServiceManager); err != nil {
+		step("find "+unit, err)
+	} else if path, err := services.DefinitionPath(unit); err != nil {
+		step("find "+unit, err)
+	} else if path != "" {
+		ctx := context.Background()
+		step("stop "+unit, services.Stop(ctx, unit))
+		step("disable "+unit, services.Disable(ctx, unit))
+		step("remove "+path, services.Remove(unit))
+	}
+
+	if *purge {
+		if loadErr == nil {
+			step("delete credentials", config.DeleteSecrets(cfg))
+		}
+		for _, path := range []string{cfg.ControlPlane.TLS.CertPath, cfg.ControlPlane.TLS.KeyPath} {
+			if path != "" {
+				step("remove "+path, removeFile(path))
+			}
+		}
+		step("remove "+dataDir, removeDataDir(dataDir))
+		step("remove "+*configPath, removeConfig(*configPath))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("uninstall incomplete, failed steps: %s", strings.Join(failed, ", "))
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		fmt.Printf("Agent uninstalled. Remove the binary with: rm %s\n", exe)
+	} else {
+		fmt.Println("Agent uninstalled.")
+	}
+	if !*purge {
+		fmt.Printf("Configuration and data were kept, run again with --purge to delete %s and %s\n", *configPath, dataDir)
+	}
+	return nil
+}
+
+// systemDirs are never deleted by --purge, whatever data_dir or --config
+// point at.
+var systemDirs = map[string]bool{
+	"/": true, "/etc": true, "/var": true, "/var/lib": true, "/var/log": true,
+	"/usr": true, "/usr/local": true, "/opt": true, "/srv": true,
+	"/home": true, "/root": true, "/tmp": true,
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeDataDir deletes the data directory only if the agent created it,
+// which it marks with agent.DataDirMarker. Anything else is left for the
+// operator.
+func removeDataDir(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if systemDirs[dir] {
+		return fmt.Errorf("refusing to delete system directory %s", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, agent.DataDirMarker)); err != nil {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("%s was not created by the agent, delete it by hand", dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+// removeConfig deletes the config file and its conf.d fragments, then the
+// directories holding them if that left them empty.
+func removeConfig(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	fragments, err := config.Fragments(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range append(fragments, path) {
+		if err := removeFile(file); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{filepath.Join(filepath.Dir(path), "conf.d"), filepath.Dir(path)} {
+		if !systemDirs[dir] {
+			// Fails, and is meant to, when something else is still in there.
+			os.Remove(dir)
+		}
+	}
+	return nil
+}
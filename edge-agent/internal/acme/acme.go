@@ -0,0 +1,393 @@
+// Package acme obtains certificates from an ACME server such as Let's
+// Encrypt (RFC 8555), proving control of the names with an HTTP-01 or
+// DNS-01 challenge.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	pollTimeout  = 3 * time.Minute
+)
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *problem `json:"error"`
+}
+
+// problem is an RFC 7807 error document.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// Client talks to one ACME directory with one account key. Orders are
+// serialized, the HTTP-01 solver can only serve one at a time.
+type Client struct {
+	directoryURL string
+	email        string
+	key          *ecdsa.PrivateKey
+	solver       Solver
+	http         *http.Client
+	logger       *logrus.Entry
+
+	mu     sync.Mutex
+	dir    *directory
+	kid    string
+	nonces []string
+}
+
+// New loads the account key from dataDir, creating it on first use. The
+// account itself is registered lazily, on the first order.
+func New(cfg config.ACMEConfig, dataDir string, proxy func(*http.Request) (*url.URL, error), logger *logrus.Entry) (*Client, error) {
+	key, err := loadAccountKey(filepath.Join(dataDir, "acme-account.key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME account key: %w", err)
+	}
+
+	logger = logger.WithField("component", "acme")
+	solver, err := newSolver(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &Client{
+		directoryURL: cfg.Directory,
+		email:        cfg.Email,
+		key:          key,
+		solver:       solver,
+		http:         &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		logger:       logger,
+	}, nil
+}
+
+func loadAccountKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Obtain orders a certificate for the names in csrPEM, solves every pending
+// authorization and returns the issued chain as PEM.
+func (c *Client) Obtain(ctx context.Context, dnsNames []string, csrPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, errors.New("invalid CSR")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.register(ctx); err != nil {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	ids := make([]identifier, len(dnsNames))
+	for i, name := range dnsNames {
+		ids[i] = identifier{Type: "dns", Value: name}
+	}
+	var o order
+	resp, err := c.post(ctx, c.dir.NewOrder, map[string]interface{}{"identifiers": ids}, &o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.pollOrder(ctx, orderURL, &o, "ready"); err != nil {
+		return nil, err
+	}
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64.EncodeToString(block.Bytes)}, &o); err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+	if err := c.pollOrder(ctx, orderURL, &o, "valid"); err != nil {
+		return nil, err
+	}
+
+	resp, err = c.post(ctx, o.Certificate, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// register creates the account, or looks up the existing one for the key.
+func (c *Client) register(ctx context.Context) error {
+	if c.dir == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.directoryURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var dir directory
+		if err := json.NewDecoder(resp.Body).Decode(&dir); err != nil {
+			return fmt.Errorf("invalid directory: %w", err)
+		}
+		c.dir = &dir
+	}
+	if c.kid != "" {
+		return nil
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if c.email != "" {
+		account["contact"] = []string{"mailto:" + c.email}
+	}
+	resp, err := c.post(ctx, c.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.kid = resp.Header.Get("Location")
+	return nil
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string) error {
+	var authz authorization
+	if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return fmt.Errorf("failed to fetch authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == c.solver.Type() {
+			chal = &authz.Challenges[i]
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("%s isn't offered for %s", c.solver.Type(), authz.Identifier.Value)
+	}
+
+	domain := authz.Identifier.Value
+	keyAuth := chal.Token + "." + thumbprint(c.key)
+	if err := c.solver.Present(ctx, domain, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("failed to present %s challenge for %s: %w", chal.Type, domain, err)
+	}
+	defer func() {
+		if err := c.solver.CleanUp(ctx, domain, chal.Token, keyAuth); err != nil {
+			c.logger.WithError(err).WithField("domain", domain).Warn("Failed to clean up ACME challenge")
+		}
+	}()
+
+	resp, err := c.post(ctx, chal.URL, struct{}{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	resp.Body.Close()
+
+	return c.poll(ctx, func() (bool, error) {
+		if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+			return false, err
+		}
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Error != nil {
+				return false, fmt.Errorf("validation of %s failed: %w", domain, ch.Error)
+			}
+		}
+		return false, fmt.Errorf("authorization for %s is %s", domain, authz.Status)
+	})
+}
+
+func (c *Client) pollOrder(ctx context.Context, orderURL string, o *order, want string) error {
+	return c.poll(ctx, func() (bool, error) {
+		if o.Status == want || (want == "ready" && o.Status == "valid") {
+			return true, nil
+		}
+		if o.Status == "invalid" {
+			if o.Error != nil {
+				return false, fmt.Errorf("order failed: %w", o.Error)
+			}
+			return false, errors.New("order failed")
+		}
+		_, err := c.post(ctx, orderURL, nil, o)
+		return false, err
+	})
+}
+
+func (c *Client) poll(ctx context.Context, check func() (bool, error)) error {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		done, err := check()
+		if done || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the ACME server")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// post sends a signed request, retrying once when the server rejects the
+// nonce. out is decoded from JSON responses; when nil the caller owns the
+// body.
+func (c *Client) post(ctx context.Context, url string, payload, out interface{}) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		body, err := signJWS(c.key, c.kid, nonce, url, payload)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if n := resp.Header.Get("Replay-Nonce"); n != "" {
+			c.nonces = append(c.nonces, n)
+		}
+
+		if resp.StatusCode >= 400 {
+			var p problem
+			json.NewDecoder(resp.Body).Decode(&p)
+			resp.Body.Close()
+			if p.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			if p.Type == "" {
+				return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+			return nil, &p
+		}
+
+		if out != nil {
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return nil, fmt.Errorf("invalid response: %w", err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %w", err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("no nonce from %s (status %d)", c.dir.NewNonce, resp.StatusCode)
+	}
+	return nonce, nil
+}
@@ -0,0 +1,78 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+var b64 = base64.RawURLEncoding
+
+type jwk struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func publicJWK(key *ecdsa.PrivateKey) jwk {
+	return jwk{
+		Crv: "P-256",
+		Kty: "EC",
+		X:   b64.EncodeToString(pad32(key.X)),
+		Y:   b64.EncodeToString(pad32(key.Y)),
+	}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the account key. The struct
+// fields are already in the lexical order the RFC requires.
+func thumbprint(key *ecdsa.PrivateKey) string {
+	data, _ := json.Marshal(publicJWK(key))
+	sum := sha256.Sum256(data)
+	return b64.EncodeToString(sum[:])
+}
+
+// signJWS builds the flattened JWS ACME expects. Until the account exists
+// requests carry the public key, afterwards its URL (kid). A nil payload is
+// a POST-as-GET.
+func signJWS(key *ecdsa.PrivateKey, kid, nonce, url string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if kid != "" {
+		protected["kid"] = kid
+	} else {
+		protected["jwk"] = publicJWK(key)
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if payload != nil {
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString(body)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return json.Marshal(map[string]string{
+		"protected": b64.EncodeToString(header),
+		"payload":   b64.EncodeToString(body),
+		"signature": b64.EncodeToString(append(pad32(r), pad32(s)...)),
+	})
+}
+
+func pad32(n *big.Int) []byte {
+	out := make([]byte, 32)
+	return n.FillBytes(out)
+}
@@ -0,0 +1,150 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Solver proves control of a domain for one challenge type.
+type Solver interface {
+	Type() string
+	Present(ctx context.Context, domain, token, keyAuth string) error
+	CleanUp(ctx context.Context, domain, token, keyAuth string) error
+}
+
+func newSolver(cfg config.ACMEConfig, logger *logrus.Entry) (Solver, error) {
+	switch cfg.Challenge {
+	case "http-01":
+		return &httpSolver{addr: cfg.HTTPListen, tokens: make(map[string]string), logger: logger}, nil
+	case "dns-01":
+		return &dnsHookSolver{
+			path:        cfg.DNSHook,
+			propagation: time.Duration(cfg.DNSPropagation) * time.Second,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported ACME challenge %q", cfg.Challenge)
+}
+
+// httpSolver answers HTTP-01 challenges on port 80 only while an order is
+// in flight, so nothing is left listening between renewals.
+type httpSolver struct {
+	addr   string
+	logger *logrus.Entry
+
+	mu     sync.Mutex
+	tokens map[string]string
+	server *http.Server
+}
+
+func (s *httpSolver) Type() string { return "http-01" }
+
+func (s *httpSolver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = keyAuth
+	if s.server != nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		delete(s.tokens, token)
+		return err
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serve), ReadHeaderTimeout: 10 * time.Second}
+	go func(server *http.Server) {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithError(err).Warn("ACME challenge server stopped")
+		}
+	}(s.server)
+	return nil
+}
+
+func (s *httpSolver) serve(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+	s.mu.Lock()
+	keyAuth, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || token == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+func (s *httpSolver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+	if len(s.tokens) > 0 || s.server == nil {
+		return nil
+	}
+	server := s.server
+	s.server = nil
+	return server.Close()
+}
+
+// dnsHookSolver leaves the TXT record to an operator script, since every
+// DNS provider has its own API. The script is called as
+//
+//	<hook> present|cleanup <record name> <value>
+//
+// and gets the same values as EDGE_AGENT_ACME_* environment variables.
+type dnsHookSolver struct {
+	path        string
+	propagation time.Duration
+}
+
+func (s *dnsHookSolver) Type() string { return "dns-01" }
+
+func (s *dnsHookSolver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	if err := s.run(ctx, "present", domain, keyAuth); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.propagation):
+		return nil
+	}
+}
+
+func (s *dnsHookSolver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	return s.run(ctx, "cleanup", domain, keyAuth)
+}
+
+func (s *dnsHookSolver) run(ctx context.Context, action, domain, keyAuth string) error {
+	record := "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+	sum := sha256.Sum256([]byte(keyAuth))
+	value := b64.EncodeToString(sum[:])
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.path, action, record, value)
+	cmd.Env = append(os.Environ(),
+		"EDGE_AGENT_ACME_ACTION="+action,
+		"EDGE_AGENT_ACME_DOMAIN="+domain,
+		"EDGE_AGENT_ACME_RECORD="+record,
+		"EDGE_AGENT_ACME_VALUE="+value,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("DNS hook failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+)
+
+const addressPoolCheckInterval = 5 * time.Minute
+
+// addressPoolState is the address pool last reported, kept in DataDir so
+// changes made while the agent was down are reported too.
+type addressPoolState struct {
+	mu     sync.Mutex
+	path   string
+	blocks []system.AddressBlock
+	known  bool // blocks were reported, possibly as none
+}
+
+func loadAddressPoolState(dataDir string) *addressPoolState {
+	s := &addressPoolState{path: filepath.Join(dataDir, "address-pool.json")}
+	if data, err := os.ReadFile(s.path); err == nil {
+		if json.Unmarshal(data, &s.blocks) == nil {
+			s.known = true
+		}
+	}
+	return s
+}
+
+// swap stores blocks and returns the previous ones, and whether there
+// were any on record.
+func (s *addressPoolState) swap(blocks []system.AddressBlock) ([]system.AddressBlock, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, known := s.blocks, s.known
+	s.blocks, s.known = blocks, true
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return prev, known, err
+	}
+	return prev, known, os.WriteFile(s.path, data, 0644)
+}
+
+func (a *Agent) registerAddressPoolCommands() {
+	a.commands.Register("address_pool", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return system.AddressBlocks()
+	})
+}
+
+// runAddressPoolLoop reports the node's address blocks whenever they
+// change, e.g. when the provider routes an additional /29 to it, so the
+// panel can add allocations without anyone typing them in.
+func (a *Agent) runAddressPoolLoop() {
+	ticker := time.NewTicker(addressPoolCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.checkAddressPool()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) checkAddressPool() {
+	blocks, err := system.AddressBlocks()
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to list address blocks")
+		return
+	}
+	prev, known, err := a.addressPool.swap(blocks)
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to save address pool")
+	}
+	if known && reflect.DeepEqual(normalizeBlocks(prev), normalizeBlocks(blocks)) {
+		return
+	}
+
+	added, removed := diffBlocks(prev, blocks)
+	a.logger.WithField("added", added).WithField("removed", removed).Info("Address pool changed")
+	a.reportEvent("address_pool_changed", map[string]interface{}{
+		"blocks":  blocks,
+		"added":   added,
+		"removed": removed,
+	})
+}
+
+// normalizeBlocks makes a freshly listed pool and one read back from disk
+// compare equal.
+func normalizeBlocks(blocks []system.AddressBlock) []system.AddressBlock {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return blocks
+}
+
+// diffBlocks returns the CIDRs that appeared and disappeared between two
+// pools.
+func diffBlocks(prev, next []system.AddressBlock) (added, removed []string) {
+	before := make(map[string]bool, len(prev))
+	for _, b := range prev {
+		before[b.CIDR] = true
+	}
+	after := make(map[string]bool, len(next))
+	for _, b := range next {
+		after[b.CIDR] = true
+		if !before[b.CIDR] {
+			added = append(added, b.CIDR)
+		}
+	}
+	for _, b := range prev {
+		if !after[b.CIDR] {
+			removed = append(removed, b.CIDR)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "REDACTED"
+
+func (a *Agent) runAdminAPI() {
+	socketPath := a.config.Agent.AdminSocket
+	if socketPath == "" {
+		socketPath = filepath.Join(a.config.Agent.DataDir, "agent.sock")
+	}
+
+	server := api.New(a, a.config.Agent.AdminAuth, a.logger)
+	if err := server.Serve(a.ctx, socketPath, a.config.Agent.AdminListen); err != nil {
+		a.logger.WithError(err).Error("Local API stopped")
+	}
+}
+
+func (a *Agent) recordHeartbeat(heartbeat HeartbeatRequest, err error) {
+	result := api.HeartbeatResult{
+		Time:    time.Now(),
+		Payload: heartbeat,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	a.stateMu.Lock()
+	a.lastHeartbeat = result
+	if err != nil {
+		a.heartbeatsFailed++
+	} else {
+		a.heartbeatsSent++
+	}
+	a.stateMu.Unlock()
+
+	if err != nil {
+		a.events.Publish("heartbeat_failed", map[string]string{"error": err.Error()})
+	} else {
+		a.events.Publish("heartbeat_sent", map[string]interface{}{"timestamp": heartbeat.Timestamp})
+	}
+}
+
+func (a *Agent) LastHeartbeat() api.HeartbeatResult {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	return a.lastHeartbeat
+}
+
+func (a *Agent) Status() api.Status {
+	auth := api.AuthStatus{State: "ok"}
+	if rejected, since, status := a.auth.state(); rejected {
+		auth = api.AuthStatus{State: "rejected", Since: since, Status: status}
+	}
+
+	return api.Status{
+		Version:            Version,
+		NodeID:             a.config.Agent.NodeID,
+		SessionID:          a.session.SessionID,
+		StartedAt:          a.startedAt,
+		Uptime:             time.Since(a.startedAt).Round(time.Second).String(),
+		LogLevel:           logrus.GetLevel().String(),
+		LastHeartbeat:      a.LastHeartbeat(),
+		BufferedHeartbeats: a.heartbeats.Len(),
+		Update:             a.updater.Status(),
+		ControlPlanes:      a.controlPlanes.status(),
+		Auth:               auth,
+		Drain:              a.drain.get(),
+		Standby:            a.standby.get(),
+		ResponseCache:      a.responseCache.status(),
+		Bandwidth:          a.bandwidth.get(),
+		Locks:              a.locks.Held(),
+	}
+}
+
+func (a *Agent) AgentMetrics() api.AgentMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m := api.AgentMetrics{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapBytes:      mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		GCRuns:         mem.NumGC,
+		UptimeSeconds:  int64(time.Since(a.startedAt).Seconds()),
+		LastEnrollment: a.config.Agent.EnrolledAt,
+		Queues: map[string]int{
+			"tasks":      a.tasks.Queued(),
+			"events":     a.eventReporter.Len(),
+			"heartbeats": a.heartbeats.Len(),
+		},
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		m.OpenFDs = len(fds)
+	}
+
+	a.stateMu.Lock()
+	m.HeartbeatsSent = a.heartbeatsSent
+	m.HeartbeatsFailed = a.heartbeatsFailed
+	a.stateMu.Unlock()
+	if total := m.HeartbeatsSent + m.HeartbeatsFailed; total > 0 {
+		m.HeartbeatSuccessRate = float64(m.HeartbeatsSent) / float64(total)
+	}
+
+	m.RequestP50Ms, m.RequestP90Ms, m.RequestP99Ms = a.endpointStats.overall()
+	return m
+}
+
+func (a *Agent) RedactedConfig() config.Config {
+	a.tokenMu.RLock()
+	cfg := *a.config
+	a.tokenMu.RUnlock()
+	if cfg.ControlPlane.AuthToken != "" {
+		cfg.ControlPlane.AuthToken = redacted
+	}
+	if cfg.ControlPlane.EnrollToken != "" {
+		cfg.ControlPlane.EnrollToken = redacted
+	}
+	if cfg.ControlPlane.ActivationToken != "" {
+		cfg.ControlPlane.ActivationToken = redacted
+	}
+	if u, err := url.Parse(cfg.ControlPlane.Proxy); err == nil && u.User != nil {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+		cfg.ControlPlane.Proxy = u.String()
+	}
+	return cfg
+}
+
+func (a *Agent) ForceHeartbeat() error {
+	return a.sendHeartbeat()
+}
+
+func (a *Agent) EndpointStats() []api.EndpointStats {
+	return a.endpointStats.summary()
+}
+
+func (a *Agent) TaskHistory(q tasks.HistoryQuery) ([]tasks.HistoryEntry, error) {
+	return a.tasks.History(q)
+}
+
+func (a *Agent) Subscribe() (<-chan events.Event, func()) {
+	return a.events.Subscribe()
+}
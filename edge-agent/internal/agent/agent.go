@@ -3,75 +3,418 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/pterodactyl-cp/edge-agent/internal/acme"
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/attest"
+	"github.com/pterodactyl-cp/edge-agent/internal/backups"
+	"github.com/pterodactyl-cp/edge-agent/internal/buffer"
+	"github.com/pterodactyl-cp/edge-agent/internal/certs"
 	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/diskusage"
+	"github.com/pterodactyl-cp/edge-agent/internal/downloader"
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+	"github.com/pterodactyl-cp/edge-agent/internal/firewall"
+	"github.com/pterodactyl-cp/edge-agent/internal/health"
+	"github.com/pterodactyl-cp/edge-agent/internal/hooks"
+	"github.com/pterodactyl-cp/edge-agent/internal/incident"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/logship"
 	"github.com/pterodactyl-cp/edge-agent/internal/metrics"
+	"github.com/pterodactyl-cp/edge-agent/internal/netdial"
+	"github.com/pterodactyl-cp/edge-agent/internal/rpc"
+	"github.com/pterodactyl-cp/edge-agent/internal/schedule"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+	"github.com/pterodactyl-cp/edge-agent/internal/shaping"
+	"github.com/pterodactyl-cp/edge-agent/internal/shell"
+	"github.com/pterodactyl-cp/edge-agent/internal/signing"
+	"github.com/pterodactyl-cp/edge-agent/internal/snapshot"
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/updater"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
 	"github.com/sirupsen/logrus"
 )
 
+// Version is the running agent version, set by main at startup.
+var Version = "1.0.0"
+
 type Agent struct {
 	config     *config.Config
+	configPath string
 	logger     *logrus.Entry
 	httpClient *http.Client
+	rpc        *rpc.Client // nil unless control_plane.transport is grpc
 	ctx        context.Context
 	cancel     context.CancelFunc
 	metrics    *metrics.Collector
+	downloader *downloader.Downloader
+	commands   *commandRegistry
+	updater    *updater.Updater
+	wings      *wings.Manager
+	services   service.Manager
+	heartbeats *buffer.Queue
+	certs      *certs.Store
+	tlsConfig  *tls.Config
+	dial       netdial.DialFunc // control plane connections, per address_family and source_address
+	startedAt  time.Time
+	session    SessionInfo
+	// started is set once Start has begun the session, so Stop after a
+	// bare Enroll doesn't record a shutdown.
+	started bool
+
+	endpointStats *endpointStats
+	responseCache *responseCache
+	controlPlanes *controlPlanePool
+	auth          *authGuard
+	health        *health.Runner
+	hooks         *hooks.Runner
+	wingsProbe    *wings.Prober
+	wingsConsole  *wings.ConsoleProber
+	wingsAPI      *wings.APIClient
+	drain         *drainState
+	standby       *standbyState
+	bandwidth     *bandwidthState
+	listenerAudit listenerAuditState
+	wingsDrift    wingsDriftState
+	locks         *locks.Manager
+	firewall      *firewall.Manager // nil unless firewall.enabled
+	wingsTLS      wingsTLSState
+	wingsToken    *wingsTokenState
+	signer        *signingState
+	addressPool   *addressPoolState
+	mtu           mtuState
+	acme          *acme.Client // nil unless wings_tls.source is acme
+	tasks         *tasks.Manager
+	events        *events.Bus
+	eventReporter *events.Reporter
+	backups       *backups.Scheduler
+	remoteBackups *backups.Remote
+	schedules     *schedule.Scheduler
+	logShipper    *logship.Shipper
+	shells        *shell.Manager  // nil unless shell.enabled
+	shaper        *shaping.Shaper // nil without an uplink interface
+	diskUsage     *diskusage.Tracker
+	incidents     *incident.Recorder
+	snapshots     *snapshot.Manager
+	fds           fdState
+	clock         clockState
+	images        imageState
+	diskHealth    diskHealthState
+	alerts        alertLog
+
+	// tokenMu guards ControlPlane.AuthToken, which is rotated at runtime,
+	// and the rest of the config that re-enrollment and reloads change
+	tokenMu sync.RWMutex
+
+	channelMu    sync.Mutex
+	channelSend  func(event string, data interface{}) error
+	channelClose func()
+
+	// heartbeatReset carries a new heartbeat interval after a reload
+	heartbeatReset chan time.Duration
+
+	// metricsReset does the same for the metrics sampling interval
+	metricsReset chan time.Duration
+
+	// heartbeatMu serializes heartbeats from the ticker and the local API
+	heartbeatMu   sync.Mutex
+	stateMu       sync.Mutex
+	lastHeartbeat api.HeartbeatResult
+
+	// heartbeat outcomes since start, under stateMu
+	heartbeatsSent   int64
+	heartbeatsFailed int64
 }
 
 type EnrollmentRequest struct {
-	Token    string                 `json:"token"`
-	NodeInfo map[string]interface{} `json:"node_info"`
+	Token       string                 `json:"token"`
+	NodeInfo    map[string]interface{} `json:"node_info"`
+	CSR         string                 `json:"csr,omitempty"`
+	Attestation *attest.Evidence       `json:"attestation,omitempty"`
+	SigningKey  *signing.JWK           `json:"signing_key"` // verifies the node's heartbeats and events
+}
+
+// ActivationRequest activates a node the control plane pre-registered.
+type ActivationRequest struct {
+	NodeID      string                 `json:"node_id"`
+	Token       string                 `json:"token"`
+	NodeInfo    map[string]interface{} `json:"node_info"`
+	CSR         string                 `json:"csr,omitempty"`
+	Attestation *attest.Evidence       `json:"attestation,omitempty"`
+	SigningKey  *signing.JWK           `json:"signing_key"`
 }
 
 type EnrollmentResponse struct {
-	NodeID     string `json:"node_id"`
-	AuthToken  string `json:"auth_token"`
-	WingsConfig map[string]interface{} `json:"wings_config"`
+	NodeID            string                 `json:"node_id"`
+	AuthToken         string                 `json:"auth_token"`
+	WingsConfig       map[string]interface{} `json:"wings_config"`
+	ClientCertificate string                 `json:"client_certificate,omitempty"`
 }
 
 type HeartbeatRequest struct {
-	AgentVersion  string                 `json:"agent_version"`
-	WingsVersion  string                 `json:"wings_version,omitempty"`
-	System        map[string]interface{} `json:"system"`
+	Timestamp      time.Time                   `json:"timestamp"`
+	Session        *SessionInfo                `json:"session,omitempty"`
+	AgentVersion   string                      `json:"agent_version"`
+	WingsVersion   string                      `json:"wings_version,omitempty"`
+	System         map[string]interface{}      `json:"system"`
+	Update         *updater.Status             `json:"update,omitempty"`
+	Time           *system.TimeSettings        `json:"time,omitempty"`
+	Virtualization *system.Virtualization      `json:"virtualization,omitempty"`
+	Health         *health.Report              `json:"health,omitempty"`
+	Wings          *wings.ProbeResult          `json:"wings,omitempty"`
+	WingsConsole   *wings.ConsoleProbeResult   `json:"wings_console,omitempty"`
+	WingsDrift     *wings.Drift                `json:"wings_drift,omitempty"`
+	WingsTLS       *WingsCertificate           `json:"wings_tls,omitempty"`
+	WingsToken     *WingsTokenStatus           `json:"wings_token,omitempty"`
+	MTU            *MTUReport                  `json:"mtu,omitempty"`
+	Images         *ImageReport                `json:"images,omitempty"`
+	AgentMetrics   *api.AgentMetrics           `json:"agent_metrics,omitempty"`
+	DockerNetwork  *wings.NetworkState         `json:"docker_network,omitempty"`
+	ControlPlane   *api.ControlPlaneStatus     `json:"control_plane,omitempty"`
+	ServerDisk     *diskusage.Report           `json:"server_disk,omitempty"`
+	Bandwidth      *api.BandwidthUsage         `json:"bandwidth,omitempty"`
+	Transfers      *shaping.Status             `json:"transfers,omitempty"`
+	Drain          api.DrainStatus             `json:"drain"`
+	Standby        *api.StandbyStatus          `json:"standby,omitempty"`
+	Schedulable    bool                        `json:"schedulable"` // false while draining or in standby
+	Listeners      *ListenerAudit              `json:"listeners,omitempty"`
+	Firewall       *firewall.State             `json:"firewall,omitempty"`
+	FailureDomain  *config.FailureDomainConfig `json:"failure_domain,omitempty"`
+	Labels         map[string]string           `json:"labels,omitempty"`
+	Capabilities   *system.Capabilities        `json:"capabilities,omitempty"`
+	FDs            *FDReport                   `json:"file_descriptors,omitempty"`
+	Disks          []system.DiskHealth         `json:"disk_health,omitempty"`
 }
 
-func New(cfg *config.Config, logger *logrus.Entry) (*Agent, error) {
+func New(cfg *config.Config, configPath string, logger *logrus.Entry) (*Agent, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
+	var certStore *certs.Store
+	if cfg.ControlPlane.TLS.Enabled {
+		certStore = certs.NewStore(cfg.ControlPlane.TLS.CertPath, cfg.ControlPlane.TLS.KeyPath)
+		if err := certStore.Load(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	}
+
+	tlsConfig, err := certs.ClientTLSConfig(cfg.ControlPlane, certStore)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	dial, err := netdial.New(cfg.ControlPlane.AddressFamily, cfg.ControlPlane.SourceAddress)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           cfg.ControlPlane.ProxyFunc(),
+			DialContext:     dial,
+			TLSClientConfig: tlsConfig,
+		},
 	}
 
-	metricsCollector, err := metrics.New()
+	if err := claimDataDir(cfg.Agent.DataDir); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	heartbeats, err := buffer.Open(filepath.Join(cfg.Agent.DataDir, "heartbeats.jsonl"), cfg.Agent.BufferMaxEntries)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open heartbeat buffer: %w", err)
+	}
+
+	metricsCollector, err := metrics.New(cfg.Metrics)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create metrics collector: %w", err)
 	}
 
-	return &Agent{
+	dl, err := downloader.New(cfg.Downloads, cfg.ControlPlane.ProxyFunc(), logger)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create downloader: %w", err)
+	}
+
+	services, err := service.New(cfg.Agent.ServiceManager)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	upd, err := updater.New(updater.Options{
+		CurrentVersion: Version,
+		PinnedVersion:  cfg.Agent.PinnedVersion,
+		PublicKey:      cfg.Agent.UpdatePublicKey,
+		AllowUnsigned:  cfg.Agent.AllowUnsignedUpdate,
+		SystemdUnit:    cfg.Agent.SystemdUnit,
+		Services:       services,
+	}, dl, logger)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create updater: %w", err)
+	}
+
+	a := &Agent{
 		config:     cfg,
+		configPath: configPath,
 		logger:     logger,
 		httpClient: httpClient,
 		ctx:        ctx,
 		cancel:     cancel,
 		metrics:    metricsCollector,
-	}, nil
+		downloader: dl,
+		commands:   newCommandRegistry(),
+		updater:    upd,
+		wings:      wings.NewManager(cfg.Wings, services, dl, logger),
+		services:   services,
+		heartbeats: heartbeats,
+		certs:      certStore,
+		tlsConfig:  tlsConfig,
+		dial:       dial,
+		startedAt:  time.Now(),
+		session: SessionInfo{
+			SessionID: newSessionID(),
+			StartedAt: time.Now().UTC(),
+			BootID:    readBootID(),
+		},
+
+		endpointStats: newEndpointStats(),
+		responseCache: newResponseCache(filepath.Join(cfg.Agent.DataDir, "cache")),
+		controlPlanes: newControlPlanePool(cfg.ControlPlane),
+		auth:          newAuthGuard(time.Duration(cfg.ControlPlane.AuthProbeInterval) * time.Second),
+		health:        health.NewRunner(cfg.HealthChecks, logger),
+		hooks:         hooks.New(cfg.Hooks, logger),
+		wingsProbe:    wings.NewProber(cfg.Wings.ConfigPath),
+		wingsConsole:  wings.NewConsoleProber(cfg.Wings.ConfigPath),
+		wingsAPI:      wings.NewAPIClient(cfg.Wings.ConfigPath),
+		drain:         loadDrainState(cfg.Agent.DataDir),
+		wingsToken:    loadWingsTokenState(cfg.Agent.DataDir),
+		signer:        loadSigningState(cfg.Agent.DataDir),
+		addressPool:   loadAddressPoolState(cfg.Agent.DataDir),
+		standby:       loadStandbyState(cfg.Agent.DataDir),
+		bandwidth:     loadBandwidthState(cfg.Agent.DataDir),
+		events:        events.NewBus(),
+		locks:         locks.New(time.Duration(cfg.Tasks.LockTimeout) * time.Second),
+		incidents:     incident.NewRecorder(time.Duration(cfg.Agent.IncidentWindow) * time.Minute),
+
+		heartbeatReset: make(chan time.Duration, 1),
+		metricsReset:   make(chan time.Duration, 1),
+	}
+	taskManager, err := tasks.NewManager(filepath.Join(cfg.Agent.DataDir, "tasks"), cfg.Tasks, a.reportTaskResult, a.events, logger)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create task manager: %w", err)
+	}
+	a.tasks = taskManager
+	a.eventReporter = events.NewReporter(a.sendEvents, logger)
+
+	backupScheduler, err := backups.New(filepath.Join(cfg.Agent.DataDir, "backups"), cfg.Backups, cfg.Wings.ConfigPath, a.reportEvent, logger)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create backup scheduler: %w", err)
+	}
+	a.backups = backupScheduler
+	a.remoteBackups = backups.NewRemote(cfg.Backups, cfg.Wings.ConfigPath, a.reportEvent, logger)
+
+	scheduler, err := schedule.NewScheduler(filepath.Join(cfg.Agent.DataDir, "schedules"), a.tasks.Submit, logger)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+	a.schedules = scheduler
+	a.logShipper = logship.New(cfg.Logs, a.sendLogBatch, logger)
+	if cfg.ControlPlane.Transport == "grpc" {
+		a.rpc = rpc.NewClient(tlsConfig, cfg.ControlPlane.ProxyFunc(), dial)
+	}
+	a.shells = a.newShellManager()
+	a.snapshots = snapshot.New(cfg.Snapshots, cfg.Agent.DataDir, logger)
+	a.shaper = a.newShaper()
+	a.firewall = a.newFirewall()
+	a.acme = a.newACMEClient()
+
+	a.tasks.Register(tasks.TypeService, tasks.ServiceHandler(services))
+	a.tasks.Register(tasks.TypeCoordinatedRestart, a.runCoordinatedRestart)
+	a.tasks.Register(tasks.TypeDockerNetwork, a.runDockerNetworkTask)
+	a.tasks.Register(tasks.TypeServerPower, a.runServerPowerTask)
+	a.tasks.Register(tasks.TypeFileLimit, a.runFileLimitTask)
+	a.tasks.Register(tasks.TypeWingsSnapshot, a.runWingsSnapshotTask)
+	a.tasks.Register(tasks.TypeDecommission, a.runDecommissionTask)
+	a.tasks.Register(tasks.TypeNodeTuning, a.runNodeTuningTask)
+	a.tasks.Register(tasks.TypePullImages, a.runPullImagesTask)
+	a.tasks.Register(tasks.TypePruneImages, a.runPruneImagesTask)
+
+	// Tasks sharing a resource are run one after the other. The handlers
+	// still take the locks, which also keep them apart from commands and
+	// the agent's own loops.
+	a.tasks.SetResources(tasks.TypeCoordinatedRestart, locks.WingsService, locks.Docker)
+	a.tasks.SetResources(tasks.TypeDockerNetwork, locks.WingsConfig, locks.WingsService, locks.Docker)
+	a.tasks.SetResources(tasks.TypeFileLimit, locks.WingsService)
+	a.tasks.SetResources(tasks.TypeWingsSnapshot, locks.WingsService, locks.Docker)
+	a.tasks.SetResources(tasks.TypeSyncWingsConfig, locks.WingsConfig, locks.WingsService)
+	a.tasks.SetResources(tasks.TypeDecommission, locks.WingsService)
+	a.tasks.SetResources(tasks.TypeNodeTuning, locks.WingsService, locks.Docker)
+	a.tasks.SetResources(tasks.TypeCollectDiagnostics)
+	a.registerDirectiveTasks()
+
+	a.registerBuiltinCommands()
+	a.registerTaskCommands()
+	a.registerBackupCommands()
+	a.registerDockerCommands()
+	a.registerLogCommands()
+	a.registerShellCommands()
+	a.registerTransferCommands()
+	a.registerDrainCommands()
+	a.registerStandbyCommands()
+	a.registerFirewallCommands()
+	a.registerWingsTLSCommands()
+	a.registerMTUCommands()
+	a.registerWingsTokenCommands()
+	a.registerSigningCommands()
+	a.registerAddressPoolCommands()
+	a.registerPublicIPCommands()
+	a.commands.Allow(cfg.Permissions.Commands)
+	a.tasks.Allow(cfg.Permissions.Tasks)
+
+	return a, nil
 }
 
 func (a *Agent) Start() error {
-	a.logger.Info("Starting edge agent")
+	a.logger.WithField("session_id", a.session.SessionID).Info("Starting edge agent")
+
+	a.beginSession()
+	a.started = true
 
-	// If we don't have an auth token, enroll first
-	if a.config.ControlPlane.AuthToken == "" && a.config.ControlPlane.EnrollToken != "" {
+	go a.eventReporter.Run(a.ctx)
+	go a.runAlertLog()
+
+	go a.runAdminAPI()
+
+	// If we don't have an auth token, activate or enroll first
+	if a.config.ControlPlane.AuthToken == "" && a.config.ControlPlane.ActivationToken != "" {
+		if err := a.activate(); err != nil {
+			return fmt.Errorf("activation failed: %w", err)
+		}
+	} else if a.config.ControlPlane.AuthToken == "" && a.config.ControlPlane.EnrollToken != "" {
 		if err := a.enroll(); err != nil {
 			return fmt.Errorf("enrollment failed: %w", err)
 		}
@@ -82,6 +425,96 @@ func (a *Agent) Start() error {
 		return fmt.Errorf("no authentication token available")
 	}
 
+	a.checkTimezone()
+
+	// Open the command channel so the control plane can push work to us
+	go a.runCommandChannel()
+
+	go a.runUpdateLoop()
+
+	go a.runInstallFailureLoop()
+
+	go a.runDiskPressureLoop()
+
+	a.metrics.Start(a.ctx)
+	go a.runMetricsLoop()
+
+	go a.runIncidentLoop()
+
+	go a.runFDLoop()
+
+	go a.runClockLoop()
+
+	go a.runAddressPoolLoop()
+
+	go a.runImageLoop()
+
+	if a.config.Metrics.SMARTInterval > 0 {
+		go a.runDiskHealthLoop()
+	}
+
+	if a.config.Metrics.ServerDiskUsage {
+		a.startDiskUsageTracker()
+	}
+
+	go a.runBandwidthLoop()
+
+	a.health.Start(a.ctx)
+
+	go a.runWingsProbeLoop()
+
+	if a.config.Wings.ConsoleProbeInterval > 0 {
+		go a.runWingsConsoleLoop()
+	}
+
+	go a.runDrainLoop()
+
+	go a.runStandbyLoop()
+
+	if a.config.ListenerAudit.Interval > 0 {
+		go a.runListenerAuditLoop()
+	}
+
+	if a.config.Wings.DriftInterval > 0 {
+		go a.runWingsDriftLoop()
+	}
+
+	go a.runWingsTLSLoop()
+
+	go a.runWingsTokenLoop()
+
+	if a.config.Network.MTUInterval > 0 {
+		go a.runMTULoop()
+	}
+
+	a.tasks.Start(a.ctx)
+	a.schedules.Start(a.ctx)
+
+	a.backups.Start(a.ctx)
+
+	if a.certs != nil {
+		go a.runCertRenewalLoop()
+	}
+
+	go a.runTokenRefreshLoop()
+	go a.runSigningKeyLoop()
+
+	if a.shaper != nil {
+		go a.runTransferShapingLoop()
+	}
+
+	if a.config.ControlPlane.LatencyProbeInterval > 0 {
+		go a.runEndpointProbeLoop()
+	}
+
+	if a.config.Honeypot.Enabled {
+		go a.runHoneypotLoop()
+	}
+
+	if a.config.Telemetry.Enabled {
+		go a.runTelemetryLoop()
+	}
+
 	// Start heartbeat loop
 	ticker := time.NewTicker(time.Duration(a.config.Agent.HeartbeatInterval) * time.Second)
 	defer ticker.Stop()
@@ -100,6 +533,8 @@ func (a *Agent) Start() error {
 			if err := a.sendHeartbeat(); err != nil {
 				a.logger.WithError(err).Error("Failed to send heartbeat")
 			}
+		case interval := <-a.heartbeatReset:
+			ticker.Reset(interval)
 		}
 	}
 }
@@ -107,6 +542,51 @@ func (a *Agent) Start() error {
 func (a *Agent) Stop() {
 	a.logger.Info("Stopping agent")
 	a.cancel()
+	if a.started {
+		a.endSession()
+	}
+}
+
+// DataDirMarker is left in a data directory the agent created, or found
+// empty as the installer leaves it, so uninstall --purge knows the whole
+// directory is the agent's to delete.
+const DataDirMarker = ".hosting-agent"
+
+func claimDataDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(dir, DataDirMarker), nil, 0600)
+}
+
+// Enroll registers the node with the control plane using the configured
+// enrollment token, without starting the agent's loops. A node configured
+// with an activation token is activated instead.
+func (a *Agent) Enroll() error {
+	if a.config.ControlPlane.ActivationToken != "" {
+		return a.activate()
+	}
+	return a.enroll()
+}
+
+// Deregister tells the control plane the node is being removed, so it stops
+// expecting heartbeats and scheduling servers on it.
+func (a *Agent) Deregister() error {
+	if a.config.Agent.NodeID == "" {
+		return fmt.Errorf("node is not enrolled")
+	}
+	if err := a.makeRequest("DELETE", "/agent/enrollment", nil, nil); err != nil {
+		return fmt.Errorf("failed to deregister node: %w", err)
+	}
+	a.logger.WithField("node_id", a.config.Agent.NodeID).Info("Node deregistered")
+	return nil
 }
 
 func (a *Agent) enroll() error {
@@ -122,64 +602,246 @@ func (a *Agent) enroll() error {
 		NodeInfo: nodeInfo,
 	}
 
+	var keyPEM []byte
+	if enrollReq.CSR, keyPEM, err = a.enrollmentCSR(); err != nil {
+		return err
+	}
+	if enrollReq.Attestation, err = a.attestation(enrollReq.Token, enrollReq.CSR); err != nil {
+		return err
+	}
+	signingKey, err := a.enrollmentSigningKey()
+	if err != nil {
+		return err
+	}
+	enrollReq.SigningKey = signingKey.PublicJWK()
+
 	var enrollResp EnrollmentResponse
 	if err := a.makeRequest("POST", "/agent/enroll", enrollReq, &enrollResp); err != nil {
 		return fmt.Errorf("enrollment request failed: %w", err)
 	}
+	if err := a.completeEnrollment(enrollResp, keyPEM); err != nil {
+		return err
+	}
+	a.installSigningKey(signingKey)
+
+	a.reportEvent("enrolled", map[string]string{"node_id": enrollResp.NodeID})
+	a.logger.WithField("node_id", enrollResp.NodeID).Info("Enrollment completed successfully")
+	return nil
+}
+
+// activate brings up a node the control plane pre-registered, e.g. from
+// Terraform: the node ID and a token bound to it were injected at
+// provisioning time, so the node ends up with the ID the infrastructure
+// code already knows instead of one assigned on enrollment.
+func (a *Agent) activate() error {
+	nodeID := a.config.Agent.NodeID
+	a.logger.WithField("node_id", nodeID).Info("Activating pre-registered node")
 
+	nodeInfo, err := a.gatherNodeInfo()
+	if err != nil {
+		return fmt.Errorf("failed to gather node info: %w", err)
+	}
+
+	activateReq := ActivationRequest{
+		NodeID:   nodeID,
+		Token:    a.config.ControlPlane.ActivationToken,
+		NodeInfo: nodeInfo,
+	}
+
+	var keyPEM []byte
+	if activateReq.CSR, keyPEM, err = a.enrollmentCSR(); err != nil {
+		return err
+	}
+	if activateReq.Attestation, err = a.attestation(activateReq.Token, activateReq.CSR); err != nil {
+		return err
+	}
+	signingKey, err := a.enrollmentSigningKey()
+	if err != nil {
+		return err
+	}
+	activateReq.SigningKey = signingKey.PublicJWK()
+
+	var resp EnrollmentResponse
+	if err := a.makeRequest("POST", "/agent/activate", activateReq, &resp); err != nil {
+		return fmt.Errorf("activation request failed: %w", err)
+	}
+	if resp.NodeID == "" {
+		resp.NodeID = nodeID
+	}
+	if resp.NodeID != nodeID {
+		return fmt.Errorf("control plane activated node %s, but this node was pre-registered as %s", resp.NodeID, nodeID)
+	}
+	if err := a.completeEnrollment(resp, keyPEM); err != nil {
+		return err
+	}
+	a.installSigningKey(signingKey)
+
+	a.reportEvent("activated", map[string]string{"node_id": nodeID})
+	a.logger.WithField("node_id", nodeID).Info("Activation completed successfully")
+	return nil
+}
+
+// enrollmentCSR returns a CSR and its key when the control plane issues
+// client certificates, and nothing otherwise.
+func (a *Agent) enrollmentCSR() (string, []byte, error) {
+	if a.certs == nil {
+		return "", nil, nil
+	}
+	csrPEM, keyPEM, err := certs.NewCSR(a.certCommonName())
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+	return string(csrPEM), keyPEM, nil
+}
+
+// attestation proves to the control plane which machine is enrolling, when
+// control_plane.attestation is set. Enrollment doesn't go ahead without it:
+// a control plane that asked for evidence would turn the node away anyway.
+func (a *Agent) attestation(token, csr string) (*attest.Evidence, error) {
+	provider, err := attest.New(a.config.ControlPlane.Attestation, a.config.Agent.DataDir)
+	if err != nil || provider == nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, time.Minute)
+	defer cancel()
+	evidence, err := provider.Attest(ctx, attest.Nonce(token, csr))
+	if err != nil {
+		return nil, fmt.Errorf("%s attestation failed: %w", provider.Name(), err)
+	}
+	return evidence, nil
+}
+
+// completeEnrollment stores what enrollment or activation returned. The
+// one-time tokens are cleared either way, except the enroll token when
+// reenroll_on_auth_failure will need it again. Re-enrollment runs alongside
+// the agent's loops, so the config is changed under tokenMu.
+func (a *Agent) completeEnrollment(resp EnrollmentResponse, keyPEM []byte) error {
 	// Update configuration with received data
-	a.config.Agent.NodeID = enrollResp.NodeID
-	a.config.ControlPlane.AuthToken = enrollResp.AuthToken
-	a.config.ControlPlane.EnrollToken = "" // Clear enrollment token
+	a.tokenMu.Lock()
+	a.config.Agent.NodeID = resp.NodeID
+	a.config.Agent.EnrolledAt = time.Now().UTC()
+	a.config.ControlPlane.AuthToken = resp.AuthToken
+	if !a.config.ControlPlane.ReenrollOnAuthFailure {
+		a.config.ControlPlane.EnrollToken = ""
+	}
+	a.config.ControlPlane.ActivationToken = ""
+	a.tokenMu.Unlock()
+
+	if a.certs != nil {
+		release, err := a.locks.Acquire(a.ctx, "enrollment", locks.Certificates)
+		if err != nil {
+			return err
+		}
+		err = a.certs.Install([]byte(resp.ClientCertificate), keyPEM)
+		release()
+		if err != nil {
+			return fmt.Errorf("failed to install client certificate: %w", err)
+		}
+	}
 
 	// Save updated configuration
-	if err := config.Save("/etc/hosting-agent/config.yaml", a.config); err != nil {
+	a.tokenMu.Lock()
+	err := config.Save(a.configPath, a.config)
+	a.tokenMu.Unlock()
+	if err != nil {
 		a.logger.WithError(err).Warn("Failed to save updated configuration")
 	}
 
 	// Configure Wings if configuration provided
-	if len(enrollResp.WingsConfig) > 0 {
-		if err := a.configureWings(enrollResp.WingsConfig); err != nil {
+	if len(resp.WingsConfig) > 0 {
+		if err := a.configureWings(resp.WingsConfig); err != nil {
 			a.logger.WithError(err).Error("Failed to configure Wings")
 		}
 	}
-
-	a.logger.WithField("node_id", enrollResp.NodeID).Info("Enrollment completed successfully")
 	return nil
 }
 
 func (a *Agent) sendHeartbeat() error {
+	a.heartbeatMu.Lock()
+	defer a.heartbeatMu.Unlock()
+
 	systemMetrics, err := a.metrics.Collect()
 	if err != nil {
 		a.logger.WithError(err).Warn("Failed to collect system metrics")
 		systemMetrics = make(map[string]interface{})
 	}
+	a.incidents.RecordMetrics(time.Now(), systemMetrics)
 
 	wingsVersion, _ := a.getWingsVersion()
 
+	updateStatus := a.updater.Status()
+	timeSettings := system.GetTimeSettings(a.services)
+	a.clock.fill(&timeSettings)
+	virt := system.DetectVirtualization()
+	capabilities := system.DetectCapabilities()
+	healthReport := a.health.Report()
+	wingsProbe := a.wingsProbe.Last()
+
 	heartbeat := HeartbeatRequest{
-		AgentVersion: "1.0.0",
-		WingsVersion: wingsVersion,
-		System:       systemMetrics,
+		Timestamp:      time.Now().UTC(),
+		Session:        &a.session,
+		AgentVersion:   Version,
+		WingsVersion:   wingsVersion,
+		System:         systemMetrics,
+		Update:         &updateStatus,
+		Time:           &timeSettings,
+		Virtualization: &virt,
+		Health:         &healthReport,
+		Wings:          &wingsProbe,
+		WingsConsole:   a.wingsConsole.Last(),
+		WingsDrift:     a.wingsDrift.get(),
+		WingsTLS:       a.wingsTLS.get(),
+		WingsToken:     a.wingsToken.get(),
+		MTU:            a.mtu.get(),
+		Images:         a.images.get(),
+		DockerNetwork:  a.dockerNetworkState(),
+		ControlPlane:   a.controlPlanes.active(),
+		ServerDisk:     a.serverDiskUsage(),
+		Bandwidth:      a.bandwidth.get(),
+		Transfers:      a.transferShaping(),
+		Drain:          a.drain.get(),
+		Standby:        a.standby.get(),
+		Schedulable:    a.schedulable(),
+		Listeners:      a.listenerAudit.get(),
+		Firewall:       a.firewallStatus(),
+		FailureDomain:  a.failureDomain(),
+		Labels:         a.config.Agent.Labels,
+		Capabilities:   &capabilities,
+		FDs:            a.fds.get(),
+		Disks:          a.diskHealth.get(),
 	}
+	agentMetrics := a.AgentMetrics()
+	heartbeat.AgentMetrics = &agentMetrics
 
-	return a.makeRequest("POST", "/agent/heartbeat", heartbeat, nil)
+	if a.config.Agent.MirrorHeartbeat {
+		if err := a.mirrorHeartbeat(heartbeat); err != nil {
+			a.logger.WithError(err).Warn("Failed to mirror heartbeat to disk")
+		}
+	}
+
+	err = a.deliverHeartbeat(heartbeat)
+	a.recordHeartbeat(heartbeat, err)
+	return err
 }
 
 func (a *Agent) gatherNodeInfo() (map[string]interface{}, error) {
 	hostname, _ := os.Hostname()
-	
+
 	// Get system information
 	systemInfo := map[string]interface{}{
 		"hostname":     hostname,
 		"architecture": runtime.GOARCH,
 		"platform":     runtime.GOOS,
+		"timezone":     system.Timezone(),
+		"locale":       system.Locale(),
 	}
 
 	// Try to get additional system info
 	if cpuInfo, err := a.getCPUInfo(); err == nil {
 		systemInfo["cpu_cores"] = cpuInfo["cores"]
+		systemInfo["cpu_threads"] = cpuInfo["threads"]
 		systemInfo["cpu_model"] = cpuInfo["model"]
+		systemInfo["cpu_mhz"] = cpuInfo["mhz"]
 	}
 
 	if memInfo, err := a.getMemoryInfo(); err == nil {
@@ -192,17 +854,129 @@ func (a *Agent) gatherNodeInfo() (map[string]interface{}, error) {
 
 	if networkInfo, err := a.getNetworkInfo(); err == nil {
 		systemInfo["public_ip"] = networkInfo["public_ip"]
+		systemInfo["public_ip_detection"] = networkInfo["public_ip_detection"]
 		systemInfo["private_ip"] = networkInfo["private_ip"]
+		systemInfo["interfaces"] = networkInfo["interfaces"]
+	}
+	// For the panel's allocation list, kept up to date by runAddressPoolLoop.
+	if blocks, err := system.AddressBlocks(); err == nil {
+		systemInfo["address_blocks"] = blocks
 	}
 
+	// Lets the control plane avoid scheduling eggs that need KVM on nodes
+	// that can't provide it
+	systemInfo["virtualization"] = system.DetectVirtualization()
+
+	if fd := a.failureDomain(); fd != nil {
+		systemInfo["failure_domain"] = fd
+	}
+
+	// Labels and capabilities let the control plane place servers by node
+	// attributes; both are refreshed with every heartbeat.
+	if len(a.config.Agent.Labels) > 0 {
+		systemInfo["labels"] = a.config.Agent.Labels
+	}
+	systemInfo["capabilities"] = system.DetectCapabilities()
+
 	return systemInfo, nil
 }
 
+type httpError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Status)
+}
+
+// makeRequest sends a request to the control plane, retrying transient
+// failures with backoff (see retryDelay). While the credentials are
+// rejected, requests other than enrollment and activation are refused
+// locally apart from an occasional probe, since those two are how the node
+// gets working credentials back.
 func (a *Agent) makeRequest(method, endpoint string, body interface{}, response interface{}) error {
-	url := strings.TrimSuffix(a.config.ControlPlane.URL, "/") + "/api" + endpoint
+	if endpoint != "/agent/enroll" && endpoint != "/agent/activate" && !a.auth.allow() {
+		return errCredentialsRejected
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := a.tryControlPlanes(method, endpoint, body, response)
+		delay, retry := retryDelay(method, err, attempt)
+		if !retry || a.ctx.Err() != nil {
+			return err
+		}
+
+		throttled := false
+		if httpErr, ok := err.(*httpError); ok {
+			throttled = httpErr.StatusCode == http.StatusTooManyRequests
+		}
+		a.endpointStats.retried(method, endpoint, throttled)
+		a.logger.WithError(err).WithFields(logrus.Fields{
+			"endpoint": endpoint,
+			"attempt":  attempt + 1,
+			"delay":    delay.Round(time.Millisecond),
+		}).Debug("Retrying control plane request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-a.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// tryControlPlanes tries each control plane endpoint in turn until one
+// answers.
+func (a *Agent) tryControlPlanes(method, endpoint string, body interface{}, response interface{}) error {
+	var err error
+	for _, baseURL := range a.controlPlanes.candidates() {
+		start := time.Now()
+		err = a.doRequest(baseURL, method, endpoint, body, response)
+		elapsed := time.Since(start)
+		a.endpointStats.record(method, endpoint, baseURL, elapsed, err)
+
+		status := 0
+		if httpErr, ok := err.(*httpError); ok {
+			status = httpErr.StatusCode
+		}
+		a.observeAuth(status, err)
+
+		if err == nil {
+			a.controlPlanes.success(baseURL, elapsed)
+			a.logger.WithFields(logrus.Fields{"endpoint": endpoint, "control_plane": baseURL}).Debug("Control plane request served")
+			return nil
+		}
+		if !shouldFailover(err) || a.ctx.Err() != nil {
+			return err
+		}
+		a.controlPlanes.failure(baseURL, err)
+		a.logger.WithError(err).WithField("control_plane", baseURL).Debug("Control plane request failed, trying next endpoint")
+	}
+	if err == nil {
+		return errNoControlPlane
+	}
+	return err
+}
+
+func (a *Agent) doRequest(baseURL, method, endpoint string, body interface{}, response interface{}) error {
+	if a.rpc != nil {
+		if handled, err := a.rpcRequest(baseURL, endpoint, body, response); handled {
+			return err
+		}
+	}
+
+	url := baseURL + "/api" + endpoint
 
 	var reqBody []byte
-	if body != nil {
+	contentType := "application/json"
+	if raw, ok := body.(rawBody); ok {
+		reqBody = raw.data
+		contentType = raw.contentType
+	} else if body != nil {
 		var err error
 		reqBody, err = json.Marshal(body)
 		if err != nil {
@@ -215,9 +989,20 @@ func (a *Agent) makeRequest(method, endpoint string, body interface{}, response
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if a.config.ControlPlane.AuthToken != "" {
-		req.Header.Set("Authorization", "Bearer "+a.config.ControlPlane.AuthToken)
+	cached, conditional := response.(*cachedResource)
+	if conditional && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Agent-Session", a.session.SessionID)
+	if token := a.authToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if signedEndpoints[endpoint] {
+		if signature := a.signPayload(reqBody); signature != "" {
+			req.Header.Set("X-Agent-Signature", signature)
+		}
 	}
 
 	resp, err := a.httpClient.Do(req)
@@ -227,10 +1012,29 @@ func (a *Agent) makeRequest(method, endpoint string, body interface{}, response
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return &httpError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	if response != nil {
+	if conditional {
+		cached.notModified = resp.StatusCode == http.StatusNotModified
+		if cached.notModified {
+			return nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		cached.ETag = resp.Header.Get("ETag")
+		cached.Body = body
+		return nil
+	}
+
+	// Some endpoints only sometimes have something to say.
+	if response != nil && resp.StatusCode != http.StatusNoContent && resp.ContentLength != 0 {
 		return json.NewDecoder(resp.Body).Decode(response)
 	}
 
@@ -240,40 +1044,98 @@ func (a *Agent) makeRequest(method, endpoint string, body interface{}, response
 func (a *Agent) configureWings(config map[string]interface{}) error {
 	a.logger.Info("Configuring Wings daemon")
 
-	// Convert config to YAML and write to file
-	configYAML, err := json.Marshal(config)
+	wingsConfig, err := wings.ParseConfig(config)
 	if err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(a.config.Wings.ConfigPath, configYAML, 0600); err != nil {
-		return fmt.Errorf("failed to write Wings config: %w", err)
+	// Held through the restart and any rollback, restartWings takes the
+	// service lock itself.
+	release, err := a.locks.Acquire(a.ctx, "configure_wings", locks.WingsConfig)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	backup, err := a.wings.WriteConfig(wingsConfig)
+	if err != nil {
+		return err
 	}
 
 	// Restart Wings service
-	if err := a.restartWings(); err != nil {
-		return fmt.Errorf("failed to restart Wings: %w", err)
+	restartErr := a.restartWings("config_change")
+	if restartErr == nil {
+		if err := a.saveDesiredWingsConfig(wingsConfig); err != nil {
+			a.logger.WithError(err).Warn("Failed to save desired Wings config, drift detection won't see this version")
+		}
+		event := map[string]interface{}{"backup": backup}
+		if results := a.hooks.Run(a.ctx, hooks.PostConfigApply, map[string]string{"config_backup": backup}); len(results) > 0 {
+			event["hooks"] = results
+		}
+		a.reportEvent("wings_config_changed", event)
+		return nil
+	}
+	if backup == "" {
+		return fmt.Errorf("failed to restart Wings: %w", restartErr)
 	}
 
-	return nil
+	// Don't leave the node broken, go back to the config that worked.
+	logs := a.wings.RecentLogs(50)
+	a.logger.WithError(restartErr).Warn("Wings failed to start with new config, rolling back")
+
+	event := map[string]interface{}{
+		"error":  restartErr.Error(),
+		"logs":   logs,
+		"backup": backup,
+	}
+	if err := a.wings.RestoreConfig(backup); err != nil {
+		event["rollback_error"] = err.Error()
+	} else if err := a.restartWings("config_rollback"); err != nil {
+		event["rollback_error"] = err.Error()
+	}
+	a.reportEvent("config_rollback", event)
+
+	return fmt.Errorf("failed to restart Wings, previous config restored: %w", restartErr)
 }
 
-func (a *Agent) restartWings() error {
-	cmd := exec.Command("systemctl", "restart", a.config.Wings.SystemdUnit)
-	if err := cmd.Run(); err != nil {
+// restartWings restarts Wings with the operator's pre/post restart hooks
+// around it.
+func (a *Agent) restartWings(reason string) error {
+	release, err := a.locks.Acquire(a.ctx, "restart_wings:"+reason, locks.WingsService)
+	if err != nil {
 		return err
 	}
+	defer release()
 
-	// Wait a moment and check if it started successfully
-	time.Sleep(5 * time.Second)
-	
-	cmd = exec.Command("systemctl", "is-active", a.config.Wings.SystemdUnit)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Wings service failed to start")
+	env := map[string]string{"reason": reason}
+	pre := a.hooks.Run(a.ctx, hooks.PreRestart, env)
+
+	err = a.wings.Restart()
+
+	env["result"] = "ok"
+	if err != nil {
+		env["result"] = "failed"
 	}
+	post := a.hooks.Run(a.ctx, hooks.PostRestart, env)
 
-	a.logger.Info("Wings service restarted successfully")
-	return nil
+	event := map[string]interface{}{"reason": reason}
+	if err != nil {
+		event["error"] = err.Error()
+	}
+	if results := append(pre, post...); len(results) > 0 {
+		event["hooks"] = results
+	}
+	a.reportEvent("wings_restarted", event)
+	return err
+}
+
+// failureDomain returns the configured topology, or nil if none was set.
+func (a *Agent) failureDomain() *config.FailureDomainConfig {
+	fd := a.config.FailureDomain
+	if fd == (config.FailureDomainConfig{}) {
+		return nil
+	}
+	return &fd
 }
 
 func (a *Agent) getWingsVersion() (string, error) {
@@ -297,31 +1159,57 @@ func (a *Agent) getWingsVersion() (string, error) {
 
 // System information gathering methods
 func (a *Agent) getCPUInfo() (map[string]interface{}, error) {
-	// Implementation would use gopsutil to get CPU info
+	cpuInfo, err := system.CPU()
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"cores": runtime.NumCPU(),
-		"model": "Unknown",
+		"cores":   cpuInfo.Cores,
+		"threads": cpuInfo.LogicalCores,
+		"model":   cpuInfo.Model,
+		"mhz":     cpuInfo.Mhz,
 	}, nil
 }
 
 func (a *Agent) getMemoryInfo() (map[string]interface{}, error) {
-	// Implementation would use gopsutil to get memory info
+	total, err := system.MemoryTotal()
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"total_mb": 4096, // Placeholder
+		"total_mb": total / (1 << 20),
 	}, nil
 }
 
+// getDiskInfo sizes the filesystem server data lives on, which is what the
+// control plane allocates from; it falls back to the root filesystem.
 func (a *Agent) getDiskInfo() (map[string]interface{}, error) {
-	// Implementation would use gopsutil to get disk info
+	path := "/var/lib/pterodactyl"
+	if _, err := os.Stat(path); err != nil {
+		path = "/"
+	}
+	total, err := system.DiskTotal(path)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"total_gb": 100, // Placeholder
+		"total_gb": total / (1 << 30),
+		"path":     path,
 	}, nil
 }
 
 func (a *Agent) getNetworkInfo() (map[string]interface{}, error) {
-	// Implementation would detect network interfaces and IPs
+	ifaces, err := system.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	privateIP, _ := system.LocalAddresses(ifaces)
+	publicIP := a.detectPublicIP(ifaces)
+
 	return map[string]interface{}{
-		"public_ip":  "0.0.0.0",
-		"private_ip": "127.0.0.1",
+		"public_ip":           publicIP.Address,
+		"public_ip_detection": publicIP,
+		"private_ip":          privateIP,
+		"interfaces":          ifaces,
 	}, nil
-}
\ No newline at end of file
+}
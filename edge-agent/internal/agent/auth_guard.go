@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errCredentialsRejected = errors.New("control plane rejected the agent's credentials, waiting before retrying")
+
+// authGuard stops the agent from hammering a control plane that rejects its
+// credentials, which can trip IP bans on the panel side. Once rejected, a
+// single request is let through per probe interval to see if access has
+// been restored.
+type authGuard struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	rejected  bool
+	since     time.Time
+	nextProbe time.Time
+	status    int
+}
+
+func newAuthGuard(interval time.Duration) *authGuard {
+	return &authGuard{interval: interval}
+}
+
+// allow reports whether a request may be sent now.
+func (g *authGuard) allow() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.rejected {
+		return true
+	}
+	now := time.Now()
+	if now.Before(g.nextProbe) {
+		return false
+	}
+	g.nextProbe = now.Add(g.interval)
+	return true
+}
+
+// observe records the outcome of a request. It returns whether the
+// credentials just became rejected, and whether they just recovered.
+func (g *authGuard) observe(status int, err error) (rejected, recovered bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		g.status = status
+		if g.rejected {
+			return false, false
+		}
+		g.rejected = true
+		g.since = time.Now()
+		g.nextProbe = g.since.Add(g.interval)
+		return true, false
+	}
+
+	// Only a request the control plane actually answered proves the
+	// credentials work again.
+	if g.rejected && (err == nil || status != 0) {
+		g.rejected = false
+		return false, true
+	}
+	return false, false
+}
+
+func (g *authGuard) state() (rejected bool, since time.Time, status int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rejected, g.since, g.status
+}
+
+// observeAuth feeds a response into the guard and reacts to transitions.
+func (a *Agent) observeAuth(status int, err error) {
+	rejected, recovered := a.auth.observe(status, err)
+	switch {
+	case rejected:
+		a.logger.WithField("status", status).Error("Control plane rejected the agent's credentials, backing off")
+		a.events.Publish("alert", map[string]interface{}{
+			"source":  "auth",
+			"message": "credentials rejected by control plane",
+			"status":  status,
+		})
+		if a.config.ControlPlane.ReenrollOnAuthFailure && a.config.ControlPlane.EnrollToken != "" {
+			go a.reenroll()
+		}
+	case recovered:
+		a.logger.Info("Control plane accepted the agent's credentials again")
+		a.reportEvent("credentials_restored", nil)
+	}
+}
+
+func (a *Agent) reenroll() {
+	a.logger.Warn("Re-enrolling after credentials were rejected")
+	a.tokenMu.Lock()
+	a.config.ControlPlane.AuthToken = ""
+	a.tokenMu.Unlock()
+
+	if err := a.enroll(); err != nil {
+		a.logger.WithError(err).Error("Re-enrollment failed")
+	}
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/backups"
+)
+
+// registerBackupCommands lets the control plane hand per-server backup
+// schedules to the node, and back servers up to or restore them from its
+// S3-compatible storage. set_backup_schedules replaces the full set.
+func (a *Agent) registerBackupCommands() {
+	a.commands.Register("set_backup_schedules", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var schedules []backups.Schedule
+		if err := json.Unmarshal(cmd.Payload, &schedules); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if err := a.backups.SetSchedules(schedules); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"schedules": len(schedules)}, nil
+	})
+
+	a.commands.Register("list_backup_schedules", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return map[string]interface{}{
+			"schedules": a.backups.Schedules(),
+			"history":   a.backups.History(),
+		}, nil
+	})
+
+	a.commands.Register("remote_backup", func(ctx context.Context, cmd Command) (interface{}, error) {
+		job, err := parseRemoteJob(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return a.remoteBackups.Backup(a.ctx, job)
+	})
+
+	a.commands.Register("remote_restore", func(ctx context.Context, cmd Command) (interface{}, error) {
+		job, err := parseRemoteJob(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return a.remoteBackups.Restore(a.ctx, job)
+	})
+
+	a.commands.Register("list_remote_backups", func(ctx context.Context, cmd Command) (interface{}, error) {
+		job, err := parseRemoteJob(cmd)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := a.remoteBackups.List(ctx, job.Target, job.Server)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"backups": objects}, nil
+	})
+
+	a.commands.Register("remote_backup_status", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return map[string]interface{}{"jobs": a.remoteBackups.Jobs()}, nil
+	})
+}
+
+// parseRemoteJob reads a remote backup job, which runs past the command
+// itself; the command ID stands in when the job has none.
+func parseRemoteJob(cmd Command) (backups.Job, error) {
+	var job backups.Job
+	if err := json.Unmarshal(cmd.Payload, &job); err != nil {
+		return job, fmt.Errorf("invalid payload: %w", err)
+	}
+	if job.ID == "" {
+		job.ID = cmd.ID
+	}
+	return job, nil
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/metrics"
+)
+
+// bandwidthState accumulates monthly transfer per interface. The last
+// kernel counters and the boot they belong to are persisted with the
+// totals, so traffic while the agent was stopped is still counted after a
+// restart.
+type bandwidthState struct {
+	mu   sync.Mutex
+	path string
+	data bandwidthFile
+}
+
+type bandwidthFile struct {
+	Usage    api.BandwidthUsage                 `json:"usage"`
+	Counters map[string]metrics.NetworkCounters `json:"counters"`
+	BootID   string                             `json:"boot_id"`
+}
+
+func loadBandwidthState(dataDir string) *bandwidthState {
+	s := &bandwidthState{path: filepath.Join(dataDir, "bandwidth.json")}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.data)
+	}
+	return s
+}
+
+// get returns a copy of the usage, or nil before the first update.
+func (s *bandwidthState) get() *api.BandwidthUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Usage.Month == "" {
+		return nil
+	}
+	usage := s.data.Usage
+	usage.Interfaces = make(map[string]api.InterfaceTransfer, len(s.data.Usage.Interfaces))
+	for name, t := range s.data.Usage.Interfaces {
+		usage.Interfaces[name] = t
+	}
+	return &usage
+}
+
+// update adds the traffic since the last reading. After a reboot, or when a
+// counter went backwards because the interface was recreated, the whole
+// value is new traffic.
+func (s *bandwidthState) update(counters map[string]metrics.NetworkCounters, bootID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	month := now.UTC().Format("2006-01")
+	usage := &s.data.Usage
+	if usage.Month != month {
+		if usage.Month != "" {
+			previous := *usage
+			previous.Previous = nil
+			usage.Previous = &previous
+		}
+		usage.Month = month
+		usage.Interfaces = make(map[string]api.InterfaceTransfer)
+	}
+	if usage.Interfaces == nil {
+		usage.Interfaces = make(map[string]api.InterfaceTransfer)
+	}
+
+	rebooted := s.data.BootID != "" && bootID != s.data.BootID
+	for name, cur := range counters {
+		prev, seen := s.data.Counters[name]
+		switch {
+		case rebooted:
+			prev = metrics.NetworkCounters{}
+		case !seen:
+			// No baseline yet; count from here on.
+			continue
+		}
+		t := usage.Interfaces[name]
+		t.RxBytes += counterDelta(prev.BytesRecv, cur.BytesRecv)
+		t.TxBytes += counterDelta(prev.BytesSent, cur.BytesSent)
+		usage.Interfaces[name] = t
+	}
+	s.data.Counters = counters
+	s.data.BootID = bootID
+	usage.UpdatedAt = now.UTC()
+
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+func (a *Agent) runBandwidthLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Metrics.BandwidthInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		a.updateBandwidth()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) updateBandwidth() {
+	counters, err := a.metrics.Interfaces()
+	if err != nil {
+		a.logger.WithError(err).Debug("Failed to read interface counters")
+		return
+	}
+	if err := a.bandwidth.update(counters, readBootID(), time.Now()); err != nil {
+		a.logger.WithError(err).Warn("Failed to save bandwidth accounting")
+	}
+}
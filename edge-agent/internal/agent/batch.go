@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BatchScheduled = "scheduled"
+	BatchRunning   = "running"
+	BatchDone      = "done"
+	BatchCancelled = "cancelled"
+)
+
+// CommandBatch is the same set of commands fanned out to many nodes. Each
+// node starts at its own offset within the window so e.g. an emergency Wings
+// patch doesn't restart the whole fleet at once.
+type CommandBatch struct {
+	ID            string    `json:"batch_id"`
+	WindowSeconds int       `json:"window_seconds"`
+	Commands      []Command `json:"commands"`
+}
+
+// BatchProgress is acknowledged once per state change rather than per
+// command, keeping the control plane's fan-in manageable.
+type BatchProgress struct {
+	BatchID     string          `json:"batch_id"`
+	State       string          `json:"state"`
+	Total       int             `json:"total"`
+	Completed   int             `json:"completed"`
+	Failed      int             `json:"failed"`
+	ScheduledAt time.Time       `json:"scheduled_at"`
+	Results     []CommandResult `json:"results,omitempty"`
+}
+
+// batchDelay picks a stable offset within the window from the node and
+// batch IDs, so retransmits of a batch land on the same slot.
+func (a *Agent) batchDelay(batch CommandBatch) time.Duration {
+	if batch.WindowSeconds <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(a.config.Agent.NodeID + "/" + batch.ID))
+	return time.Duration(h.Sum32()%uint32(batch.WindowSeconds)) * time.Second
+}
+
+func (a *Agent) runBatch(batch CommandBatch) {
+	logger := a.logger.WithFields(logrus.Fields{
+		"batch_id": batch.ID,
+		"commands": len(batch.Commands),
+	})
+
+	delay := a.batchDelay(batch)
+	progress := BatchProgress{
+		BatchID:     batch.ID,
+		State:       BatchScheduled,
+		Total:       len(batch.Commands),
+		ScheduledAt: time.Now().Add(delay),
+	}
+	a.reportBatchProgress(progress)
+
+	logger.WithField("delay", delay).Info("Batch scheduled")
+
+	select {
+	case <-a.ctx.Done():
+		progress.State = BatchCancelled
+		a.reportBatchProgress(progress)
+		return
+	case <-time.After(delay):
+	}
+
+	progress.State = BatchRunning
+	a.reportBatchProgress(progress)
+
+	// Commands in a batch run in order, later ones may depend on earlier ones.
+	for _, cmd := range batch.Commands {
+		result := a.commands.Dispatch(a.ctx, cmd)
+		progress.Results = append(progress.Results, result)
+		if result.Status == "ok" {
+			progress.Completed++
+		} else {
+			progress.Failed++
+		}
+	}
+
+	progress.State = BatchDone
+	a.reportBatchProgress(progress)
+
+	logger.WithFields(logrus.Fields{
+		"completed": progress.Completed,
+		"failed":    progress.Failed,
+	}).Info("Batch finished")
+}
+
+func (a *Agent) reportBatchProgress(progress BatchProgress) {
+	if err := a.sendOnChannel("agent:batch_progress", progress); err != nil {
+		a.logger.WithError(err).WithField("batch_id", progress.BatchID).Warn("Failed to acknowledge batch progress")
+	}
+}
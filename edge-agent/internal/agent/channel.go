@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	channelPingInterval = 30 * time.Second
+	channelPongTimeout  = 60 * time.Second
+	channelMinBackoff   = time.Second
+	channelMaxBackoff   = 2 * time.Minute
+)
+
+// channelMessage mirrors the {event, data} envelope used by the control
+// plane's WebSocket gateway.
+type channelMessage struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// runCommandChannel keeps a WebSocket open to the control plane so commands
+// can be pushed to the node, reconnecting with exponential backoff.
+func (a *Agent) runCommandChannel() {
+	logger := a.logger.WithField("component", "command_channel")
+	backoff := channelMinBackoff
+
+	for {
+		connected, err := a.serveCommandChannel()
+		if a.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = channelMinBackoff
+		}
+
+		logger.WithError(err).WithField("retry_in", backoff).Warn("Command channel disconnected")
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > channelMaxBackoff {
+			backoff = channelMaxBackoff
+		}
+	}
+}
+
+// Capabilities is advertised to the control plane on every connection.
+type Capabilities struct {
+	AgentVersion string   `json:"agent_version"`
+	NodeID       string   `json:"node_id"`
+	SessionID    string   `json:"session_id"`
+	Commands     []string `json:"commands"`
+	TaskTypes    []string `json:"task_types"`
+}
+
+func (a *Agent) capabilities() Capabilities {
+	return Capabilities{
+		AgentVersion: Version,
+		NodeID:       a.config.Agent.NodeID,
+		SessionID:    a.session.SessionID,
+		Commands:     a.commands.Types(),
+		TaskTypes:    a.tasks.Types(),
+	}
+}
+
+// CommandChannelURL derives the WebSocket endpoint from the control plane URL.
+func CommandChannelURL(controlPlaneURL string) string {
+	base := strings.TrimSuffix(controlPlaneURL, "/")
+	if strings.HasPrefix(base, "https://") {
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	} else if strings.HasPrefix(base, "http://") {
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return base + "/api/agent/ws"
+}
+
+// serveCommandChannel runs a single connection until it drops. The bool
+// reports whether the dial succeeded, so the caller can reset its backoff.
+func (a *Agent) serveCommandChannel() (bool, error) {
+	if a.rpc != nil {
+		return a.serveCommandStream()
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            a.config.ControlPlane.ProxyFunc(),
+		NetDialContext:   a.dial,
+		HandshakeTimeout: 15 * time.Second,
+		TLSClientConfig:  a.tlsConfig,
+	}
+
+	if !a.auth.allow() {
+		return false, errCredentialsRejected
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+a.authToken())
+
+	conn, resp, err := dialer.DialContext(a.ctx, CommandChannelURL(a.controlPlanes.preferred()), header)
+	if resp != nil {
+		a.observeAuth(resp.StatusCode, err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("dial failed: %w", err)
+	}
+	defer conn.Close()
+
+	a.logger.Info("Command channel connected")
+
+	var writeMu sync.Mutex
+	send := func(event string, data interface{}) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(channelMessage{Event: event, Data: payload})
+	}
+
+	// Batches outlive a single command, let them reach whichever connection is current.
+	a.setChannelSender(send, func() { conn.Close() })
+	defer a.setChannelSender(nil, nil)
+
+	// Tell the control plane what this node will accept before it sends work.
+	if err := send("agent:hello", a.capabilities()); err != nil {
+		return true, fmt.Errorf("failed to send capabilities: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(channelPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(channelPongTimeout))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(channelPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-a.ctx.Done():
+				writeMu.Lock()
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "agent stopping"),
+					time.Now().Add(time.Second))
+				writeMu.Unlock()
+				conn.Close()
+				return
+			case <-ticker.C:
+				writeMu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+				writeMu.Unlock()
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var msg channelMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return true, err
+		}
+		a.handleChannelMessage(msg, send)
+	}
+}
+
+// handleChannelMessage acts on one event from the control plane, whichever
+// transport carried it; send answers on the same connection.
+func (a *Agent) handleChannelMessage(msg channelMessage, send func(event string, data interface{}) error) {
+	switch msg.Event {
+	case "agent:command":
+		var cmd Command
+		if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+			a.logger.WithError(err).Warn("Received malformed command")
+			return
+		}
+
+		go func(cmd Command) {
+			a.logger.WithFields(logrus.Fields{
+				"command_id": cmd.ID,
+				"type":       cmd.Type,
+			}).Info("Executing command")
+
+			result := a.commands.Dispatch(a.ctx, cmd)
+			if err := send("agent:command_result", result); err != nil {
+				a.logger.WithError(err).WithField("command_id", cmd.ID).Warn("Failed to send command result")
+			}
+		}(cmd)
+
+	case "agent:batch":
+		var batch CommandBatch
+		if err := json.Unmarshal(msg.Data, &batch); err != nil {
+			a.logger.WithError(err).Warn("Received malformed command batch")
+			return
+		}
+		go a.runBatch(batch)
+
+	case "agent:shell_input", "agent:shell_resize":
+		a.handleShellEvent(msg.Event, msg.Data)
+
+	default:
+		a.logger.WithField("event", msg.Event).Debug("Ignoring unknown command channel event")
+	}
+}
+
+func (a *Agent) setChannelSender(send func(event string, data interface{}) error, closeConn func()) {
+	a.channelMu.Lock()
+	a.channelSend = send
+	a.channelClose = closeConn
+	a.channelMu.Unlock()
+}
+
+// dropCommandChannel closes the current connection, if any, so it is
+// redialled against the preferred endpoint.
+func (a *Agent) dropCommandChannel() {
+	a.channelMu.Lock()
+	closeConn := a.channelClose
+	a.channelMu.Unlock()
+
+	if closeConn != nil {
+		closeConn()
+	}
+}
+
+// sendOnChannel sends an event on the current command channel connection.
+func (a *Agent) sendOnChannel(event string, data interface{}) error {
+	a.channelMu.Lock()
+	send := a.channelSend
+	a.channelMu.Unlock()
+
+	if send == nil {
+		return fmt.Errorf("command channel not connected")
+	}
+	return send(event, data)
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/sirupsen/logrus"
+)
+
+const clockCheckInterval = 5 * time.Minute
+
+type clockState struct {
+	mu     sync.Mutex
+	offset *system.ClockOffset
+	err    string
+}
+
+func (s *clockState) set(offset *system.ClockOffset, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset, s.err = offset, ""
+	if err != nil {
+		s.err = err.Error()
+	}
+}
+
+// fill adds the last clock check to the heartbeat's time settings.
+func (s *clockState) fill(settings *system.TimeSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offset != nil {
+		ms := float64(s.offset.Offset) / float64(time.Millisecond)
+		settings.ClockOffsetMs = &ms
+		settings.ClockSource = s.offset.Source
+	}
+	settings.ClockError = s.err
+}
+
+// runClockLoop measures the clock offset and reports when it crosses the
+// configured threshold and again once it recovers, like fd pressure. A
+// skewed clock fails in confusing ways elsewhere: the control plane rejects
+// tokens as not yet valid or expired, and schedules fire at the wrong time.
+func (a *Agent) runClockLoop() {
+	threshold := time.Duration(a.config.Agent.ClockDriftThreshold) * time.Millisecond
+	drifting := false
+
+	ticker := time.NewTicker(clockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		offset, err := system.MeasureClockOffset(a.ctx, a.config.Agent.NTPServer)
+		if err != nil {
+			a.logger.WithError(err).Debug("Failed to measure clock offset")
+			a.clock.set(nil, err)
+		} else {
+			a.clock.set(&offset, nil)
+
+			abs := offset.Offset
+			if abs < 0 {
+				abs = -abs
+			}
+			if high := abs > threshold; high != drifting {
+				drifting = high
+				state := "cleared"
+				if high {
+					state = "high"
+					a.logger.WithFields(logrus.Fields{"offset": offset.Offset, "source": offset.Source}).Warn("Clock is drifting, check the NTP daemon")
+				}
+				synced, _ := system.NTPStatus(a.services)
+				a.reportEvent("clock_drift", map[string]interface{}{
+					"state":            state,
+					"offset_ms":        offset.Offset.Milliseconds(),
+					"threshold_ms":     threshold.Milliseconds(),
+					"source":           offset.Source,
+					"ntp_synchronized": synced,
+				})
+			}
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// Command is an instruction pushed by the control plane.
+type Command struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// CommandResult is sent back to the control plane once a command finishes.
+type CommandResult struct {
+	ID     string      `json:"id"`
+	Status string      `json:"status"` // "ok" or "error"
+	Error  string      `json:"error,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// CommandHandler executes a single command type.
+type CommandHandler func(ctx context.Context, cmd Command) (interface{}, error)
+
+// CommandDispatcher routes incoming commands to their handlers.
+type CommandDispatcher interface {
+	Dispatch(ctx context.Context, cmd Command) CommandResult
+}
+
+type commandRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]CommandHandler
+	allowed  map[string]bool // nil allows every registered type
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{
+		handlers: make(map[string]CommandHandler),
+	}
+}
+
+func (r *commandRegistry) Register(cmdType string, handler CommandHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[cmdType] = handler
+}
+
+// Allow restricts dispatch to the given types. An empty list allows all.
+func (r *commandRegistry) Allow(types []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.allowed = nil
+	if len(types) > 0 {
+		r.allowed = make(map[string]bool, len(types))
+		for _, t := range types {
+			r.allowed[t] = true
+		}
+	}
+}
+
+// Types lists the command types this node will accept.
+func (r *commandRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		if r.allowed == nil || r.allowed[t] {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (r *commandRegistry) Dispatch(ctx context.Context, cmd Command) CommandResult {
+	r.mu.RLock()
+	handler, ok := r.handlers[cmd.Type]
+	permitted := r.allowed == nil || r.allowed[cmd.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return CommandResult{ID: cmd.ID, Status: "error", Error: fmt.Sprintf("unknown command type: %s", cmd.Type)}
+	}
+	if !permitted {
+		return CommandResult{ID: cmd.ID, Status: "error", Error: fmt.Sprintf("command type %s is not permitted on this node", cmd.Type)}
+	}
+
+	data, err := handler(ctx, cmd)
+	if err != nil {
+		return CommandResult{ID: cmd.ID, Status: "error", Error: err.Error()}
+	}
+	return CommandResult{ID: cmd.ID, Status: "ok", Data: data}
+}
+
+// registerBuiltinCommands wires the commands the agent supports out of the box.
+func (a *Agent) registerBuiltinCommands() {
+	a.commands.Register("ping", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return map[string]interface{}{"pong": true}, nil
+	})
+
+	a.commands.Register("restart_wings", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return nil, a.restartWings("command")
+	})
+
+	a.commands.Register("update_wings_config", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var wingsConfig map[string]interface{}
+		if err := json.Unmarshal(cmd.Payload, &wingsConfig); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		return nil, a.configureWings(wingsConfig)
+	})
+
+	a.commands.Register("set_timezone", a.handleSetTimezone)
+
+	a.commands.Register("install_wings", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var rel wings.Release
+		if err := json.Unmarshal(cmd.Payload, &rel); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		release, err := a.locks.Acquire(ctx, "install_wings", locks.WingsBinary, locks.WingsService)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return nil, a.wings.Install(ctx, rel)
+	})
+
+	// Also used for downgrades, the version is whatever the control plane asks for.
+	a.commands.Register("upgrade_wings", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var rel wings.Release
+		if err := json.Unmarshal(cmd.Payload, &rel); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		release, err := a.locks.Acquire(ctx, "upgrade_wings", locks.WingsBinary, locks.WingsService)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return nil, a.wings.Upgrade(ctx, rel)
+	})
+}
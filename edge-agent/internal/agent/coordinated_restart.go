@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+const defaultSlotRetry = 15 * time.Second
+
+type restartSlotRequest struct {
+	TaskID string `json:"task_id"`
+	Target string `json:"target"`
+}
+
+type restartSlotResponse struct {
+	Granted    bool   `json:"granted"`
+	SlotID     string `json:"slot_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // seconds
+}
+
+// runCoordinatedRestart waits for the control plane to hand out a restart
+// slot for the node's region, restarts the target and gives the slot back.
+// The task timeout bounds the wait as well as the restart.
+func (a *Agent) runCoordinatedRestart(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.CoordinatedRestartPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	var restart func() error
+	switch p.Target {
+	case "wings":
+		restart = func() error { return a.restartWings("coordinated_restart") }
+	case "docker":
+		restart = func() error {
+			release, err := a.locks.Acquire(ctx, "coordinated_restart", locks.Docker)
+			if err != nil {
+				return err
+			}
+			defer release()
+			return a.services.Restart(ctx, "docker.service")
+		}
+	default:
+		return "", -1, fmt.Errorf("unsupported restart target %q", p.Target)
+	}
+
+	started := time.Now()
+	var slot restartSlotResponse
+	for {
+		if err := a.makeRequest("POST", "/agent/restart-slots", restartSlotRequest{TaskID: task.ID, Target: p.Target}, &slot); err != nil {
+			a.logger.WithError(err).Warn("Failed to request restart slot")
+		} else if slot.Granted {
+			break
+		}
+
+		wait := defaultSlotRetry
+		if slot.RetryAfter > 0 {
+			wait = time.Duration(slot.RetryAfter) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return "", -1, fmt.Errorf("no restart slot granted after %s", time.Since(started).Round(time.Second))
+		case <-time.After(wait):
+		}
+	}
+
+	a.logger.WithField("target", p.Target).WithField("slot", slot.SlotID).Info("Restart slot granted")
+	restartErr := restart()
+
+	// Always hand the slot back so the next node isn't held up, even if the
+	// restart failed.
+	if err := a.makeRequest("POST", fmt.Sprintf("/agent/restart-slots/%s/release", slot.SlotID), nil, nil); err != nil {
+		a.logger.WithError(err).Warn("Failed to release restart slot")
+	}
+
+	if restartErr != nil {
+		return "", 1, fmt.Errorf("restart failed: %w", restartErr)
+	}
+	return fmt.Sprintf("restarted %s after waiting %s for a slot", p.Target, time.Since(started).Round(time.Second)), 0, nil
+}
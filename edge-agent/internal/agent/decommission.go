@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+// decommissionDelay gives the decommission task's result time to reach the
+// control plane before the credentials it's reported with are gone.
+const decommissionDelay = 10 * time.Second
+
+// DecommissionOptions are the optional parts of a decommission.
+type DecommissionOptions struct {
+	Reason    string
+	StopWings bool // also stop and disable Wings
+	KeepData  bool // leave DataDir in place
+	Force     bool // carry on locally if the control plane can't be told
+}
+
+// DecommissionStep is one step of a decommission and how it went.
+type DecommissionStep struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+type decommissionRequest struct {
+	Reason       string `json:"reason,omitempty"`
+	RevokeTokens bool   `json:"revoke_tokens"`
+}
+
+// Decommission takes the node out of service for good: the control plane
+// drops it and revokes its tokens, and the agent forgets its identity,
+// credentials and state. The service itself is left to the caller. Wings
+// snapshots tracked in DataDir are forgotten, not destroyed.
+func (a *Agent) Decommission(ctx context.Context, opts DecommissionOptions) ([]DecommissionStep, error) {
+	var steps []DecommissionStep
+	var failed []string
+	step := func(name string, err error) {
+		s := DecommissionStep{Name: name}
+		if err != nil {
+			s.Error = err.Error()
+			failed = append(failed, name)
+		}
+		steps = append(steps, s)
+	}
+
+	a.logger.WithField("reason", opts.Reason).Warn("Decommissioning node")
+
+	// Past this point the node can't authenticate, so the control plane
+	// has to hear about it first.
+	err := a.makeRequest("DELETE", "/agent/enrollment", decommissionRequest{Reason: opts.Reason, RevokeTokens: true}, nil)
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusNotFound || httpErr.StatusCode == http.StatusUnauthorized) {
+		// Already removed, or its tokens already revoked.
+		err = nil
+	}
+	step("deregister", err)
+	if err != nil && !opts.Force {
+		return steps, fmt.Errorf("failed to deregister node: %w", err)
+	}
+
+	if opts.StopWings {
+		step("stop wings", a.stopWingsForGood(ctx))
+	}
+
+	for _, path := range []string{a.config.ControlPlane.TLS.CertPath, a.config.ControlPlane.TLS.KeyPath} {
+		if path != "" && a.config.ControlPlane.TLS.Enabled {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				step("remove "+path, err)
+			}
+		}
+	}
+	// Kept data or not, the key must not outlive the node's registration.
+	if err := os.Remove(a.signer.path); err != nil && !os.IsNotExist(err) {
+		step("remove "+a.signer.path, err)
+	}
+
+	a.tokenMu.Lock()
+	config.Scrub(a.config)
+	a.tokenMu.Unlock()
+	err = config.Save(a.configPath, a.config)
+	if err == nil {
+		err = config.DeleteSecrets(a.config)
+	}
+	step("scrub credentials", err)
+
+	if !opts.KeepData {
+		step("wipe "+a.config.Agent.DataDir, wipeDir(a.config.Agent.DataDir))
+	}
+
+	if len(failed) > 0 {
+		return steps, fmt.Errorf("decommission incomplete, failed steps: %s", strings.Join(failed, ", "))
+	}
+	a.logger.Warn("Node decommissioned")
+	return steps, nil
+}
+
+func (a *Agent) stopWingsForGood(ctx context.Context) error {
+	release, err := a.locks.Acquire(ctx, "decommission", locks.WingsService)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	unit := a.config.Wings.SystemdUnit
+	if err := a.services.Stop(ctx, unit); err != nil {
+		return fmt.Errorf("failed to stop %s: %w", unit, err)
+	}
+	if err := a.services.Disable(ctx, unit); err != nil {
+		return fmt.Errorf("failed to disable %s: %w", unit, err)
+	}
+	return nil
+}
+
+// wipeDir empties dir but keeps it, with its permissions, for a later
+// enrollment.
+func wipeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDecommissionTask accepts the decommission and carries it out once the
+// result has had time to be reported. The agent then disables and stops its
+// own service, since just exiting would have the init system restart it
+// without credentials, and bootstrap could re-enroll it from user-data.
+func (a *Agent) runDecommissionTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.DecommissionPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	// The control plane asked for this, so it needn't hear back to go ahead.
+	opts := DecommissionOptions{Reason: p.Reason, StopWings: p.StopWings, KeepData: p.KeepData, Force: true}
+	if opts.Reason == "" {
+		opts.Reason = "decommission task " + task.ID
+	}
+
+	go func() {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(decommissionDelay):
+		}
+
+		steps, err := a.Decommission(a.ctx, opts)
+		entry := a.logger.WithField("steps", steps)
+		if err != nil {
+			entry.WithError(err).Error("Decommission finished with errors")
+		}
+		if err := a.services.Disable(a.ctx, a.config.Agent.SystemdUnit); err != nil {
+			entry.WithError(err).Warn("Failed to disable the agent service")
+		}
+		if err := a.services.StopDetached(a.config.Agent.SystemdUnit); err != nil {
+			entry.WithError(err).Warn("Failed to stop the agent service")
+		}
+		// Not Stop: there's no session state left to record a shutdown in.
+		a.cancel()
+	}()
+	return fmt.Sprintf("decommissioning in %s", decommissionDelay), 0, nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package agent
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileDevice is the device a file is on, to tell filesystems apart.
+func fileDevice(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
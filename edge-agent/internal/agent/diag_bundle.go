@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	bundleLogLines   = 5000
+	bundleKeep       = 5
+	bundleCmdTimeout = 20 * time.Second
+)
+
+// rawBody is sent by doRequest as is instead of being encoded as JSON.
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// DiagnosticsBundle writes a tar.gz with what support needs to look into a
+// node: logs, the redacted config, service and Docker state and a system
+// snapshot. With upload it's also sent to the control plane, to be
+// attached to a support ticket.
+func (a *Agent) DiagnosticsBundle(upload bool) (api.DiagnosticsBundle, error) {
+	dir := filepath.Join(a.config.Agent.DataDir, "diagnostics")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return api.DiagnosticsBundle{}, fmt.Errorf("failed to create diagnostics directory: %w", err)
+	}
+
+	name := fmt.Sprintf("diagnostics-%s-%s.tar.gz", a.config.Agent.NodeID, time.Now().UTC().Format("20060102-150405"))
+	bundle := api.DiagnosticsBundle{Path: filepath.Join(dir, name)}
+
+	files, err := a.writeBundle(bundle.Path)
+	if err != nil {
+		os.Remove(bundle.Path)
+		return bundle, err
+	}
+	bundle.Files = files
+	if info, err := os.Stat(bundle.Path); err == nil {
+		bundle.Size = info.Size()
+	}
+	pruneBundles(dir)
+
+	if upload {
+		data, err := os.ReadFile(bundle.Path)
+		if err != nil {
+			return bundle, err
+		}
+		var resp struct {
+			ID string `json:"id"`
+		}
+		body := rawBody{contentType: "application/gzip", data: data}
+		if err := a.makeRequest("POST", "/agent/diagnostics?name="+name, body, &resp); err != nil {
+			return bundle, fmt.Errorf("failed to upload diagnostics bundle: %w", err)
+		}
+		bundle.UploadID = resp.ID
+	}
+
+	a.logger.WithFields(logrus.Fields{"path": bundle.Path, "size": bundle.Size, "uploaded": upload}).Info("Diagnostics bundle created")
+	return bundle, nil
+}
+
+func (a *Agent) writeBundle(path string) ([]string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	var files []string
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+		files = append(files, name)
+		return nil
+	}
+	addJSON := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		return add(name, data)
+	}
+
+	config, err := yaml.Marshal(a.RedactedConfig())
+	if err != nil {
+		config = []byte(err.Error())
+	}
+	metrics, err := a.metrics.Collect()
+	if err != nil {
+		metrics = map[string]interface{}{"error": err.Error()}
+	}
+	agentUnit := a.config.Agent.SystemdUnit
+	wingsUnit := a.config.Wings.SystemdUnit
+
+	steps := []func() error{
+		func() error { return addJSON("diagnostics.json", a.collectDiagnostics()) },
+		func() error { return addJSON("last-heartbeat.json", a.LastHeartbeat()) },
+		func() error { return addJSON("metrics.json", metrics) },
+		func() error { return add("config.yaml", config) },
+		func() error { return add("agent.log", a.serviceLogs(agentUnit)) },
+		func() error { return add("wings.log", a.serviceLogs(wingsUnit)) },
+		func() error { return add("services.txt", a.serviceStatus(agentUnit, wingsUnit, "docker.service")) },
+		func() error {
+			return add("docker.txt", joinOutputs(
+				commandOutput("docker", "info"),
+				commandOutput("docker", "ps", "-a"),
+			))
+		},
+		func() error {
+			return add("system.txt", joinOutputs(
+				commandOutput("uptime"),
+				commandOutput("free", "-m"),
+				commandOutput("df", "-h"),
+				commandOutput("df", "-i"),
+			))
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, fmt.Errorf("failed to write diagnostics bundle: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return files, f.Close()
+}
+
+// serviceLogs and serviceStatus ask whichever init system the node runs,
+// with the same error handling as commandOutput.
+func (a *Agent) serviceLogs(name string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), bundleCmdTimeout)
+	defer cancel()
+	out, err := a.services.Logs(ctx, name, bundleLogLines)
+	return serviceOutput(a.services.Kind()+" logs "+name, out, err)
+}
+
+func (a *Agent) serviceStatus(names ...string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), bundleCmdTimeout)
+	defer cancel()
+	out, err := a.services.Status(ctx, names...)
+	return serviceOutput(a.services.Kind()+" status "+strings.Join(names, " "), out, err)
+}
+
+func serviceOutput(header, out string, err error) []byte {
+	if err != nil {
+		out += "\n(" + err.Error() + ")\n"
+	}
+	return []byte("# " + header + "\n" + out)
+}
+
+// commandOutput runs a command for the bundle. Failures end up in the
+// output, a missing tool shouldn't stop the rest of the bundle.
+func commandOutput(name string, args ...string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), bundleCmdTimeout)
+	defer cancel()
+
+	header := "$ " + name + " " + strings.Join(args, " ") + "\n"
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		out = append(out, []byte("\n("+err.Error()+")\n")...)
+	}
+	return append([]byte(header), out...)
+}
+
+func joinOutputs(outputs ...[]byte) []byte {
+	var joined []byte
+	for _, out := range outputs {
+		joined = append(joined, out...)
+		joined = append(joined, '\n')
+	}
+	return joined
+}
+
+// pruneBundles keeps the newest bundles; names sort by creation time.
+func pruneBundles(dir string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "diagnostics-*.tar.gz"))
+	if len(paths) <= bundleKeep {
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths[:len(paths)-bundleKeep] {
+		os.Remove(path)
+	}
+}
+
+func (a *Agent) runDiagnosticsBundleTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.DiagnosticsBundlePayload
+	if len(task.Payload) > 0 {
+		if err := json.Unmarshal(task.Payload, &p); err != nil {
+			return "", -1, fmt.Errorf("invalid payload: %w", err)
+		}
+	}
+
+	bundle, err := a.DiagnosticsBundle(p.Upload)
+	if err != nil {
+		return "", 1, err
+	}
+	out, err := json.Marshal(bundle)
+	if err != nil {
+		return "", -1, err
+	}
+	return string(out), 0, nil
+}
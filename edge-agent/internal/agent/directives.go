@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+// HeartbeatResponse is what the control plane may answer a heartbeat with.
+// Directives are tasks it has queued for the node, so basic remote control
+// keeps working when the command channel can't be established, e.g. behind
+// a proxy that drops WebSockets.
+type HeartbeatResponse struct {
+	Directives []tasks.Task `json:"directives,omitempty"`
+}
+
+// handleDirectives queues the directives from a heartbeat response. The
+// control plane repeats a directive until it has its result, and the task
+// queue ignores IDs that are queued, running or in its history, so repeats
+// are harmless. A
+// directive the node refuses is reported straight back as failed.
+func (a *Agent) handleDirectives(directives []tasks.Task) {
+	for _, task := range directives {
+		logger := a.logger.WithField("task_id", task.ID).WithField("type", task.Type)
+		if task.RequestedBy == "" {
+			task.RequestedBy = "control_plane"
+		}
+		if err := a.tasks.Submit(task); err != nil {
+			logger.WithError(err).Warn("Refused heartbeat directive")
+			now := time.Now()
+			result := tasks.Result{
+				TaskID:     task.ID,
+				Type:       task.Type,
+				Status:     tasks.StatusFailed,
+				ExitCode:   -1,
+				Error:      err.Error(),
+				StartedAt:  now,
+				FinishedAt: now,
+			}
+			if err := a.reportTaskResult(result); err != nil {
+				logger.WithError(err).Debug("Failed to report refused directive")
+			}
+			continue
+		}
+		logger.Debug("Queued heartbeat directive")
+	}
+}
+
+// registerDirectiveTasks adds the task types that stand in for commands
+// when directives arrive without a command channel.
+func (a *Agent) registerDirectiveTasks() {
+	a.tasks.Register(tasks.TypeCommand, a.runCommandTask)
+
+	a.tasks.Register(tasks.TypeSyncWingsConfig, func(ctx context.Context, task tasks.Task) (string, int, error) {
+		var wingsConfig map[string]interface{}
+		if err := json.Unmarshal(task.Payload, &wingsConfig); err != nil {
+			return "", -1, fmt.Errorf("invalid payload: %w", err)
+		}
+		if err := a.configureWings(wingsConfig); err != nil {
+			return "", 1, err
+		}
+		return "Wings configuration applied", 0, nil
+	})
+
+	// A newer release restarts the agent through systemd, which can cut
+	// the task short; it's then reported as interrupted after the restart.
+	a.tasks.Register(tasks.TypeUpdateAgent, func(ctx context.Context, task tasks.Task) (string, int, error) {
+		if err := a.checkForUpdate(); err != nil {
+			return "", 1, err
+		}
+		status := a.updater.Status()
+		return fmt.Sprintf("update state: %s (available %s)", status.State, status.AvailableVersion), 0, nil
+	})
+
+	a.tasks.Register(tasks.TypeDiagnosticsBundle, a.runDiagnosticsBundleTask)
+
+	a.tasks.Register(tasks.TypeCollectDiagnostics, func(ctx context.Context, task tasks.Task) (string, int, error) {
+		out, err := json.MarshalIndent(a.collectDiagnostics(), "", "  ")
+		if err != nil {
+			return "", -1, err
+		}
+		return string(out), 0, nil
+	})
+}
+
+// runCommandTask runs a registered command. Command permissions apply as
+// they would on the command channel.
+func (a *Agent) runCommandTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.CommandPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	result := a.commands.Dispatch(ctx, Command{ID: task.ID, Type: p.Type, Payload: p.Payload})
+	if result.Status != "ok" {
+		return "", 1, errors.New(result.Error)
+	}
+	out, err := json.Marshal(result.Data)
+	if err != nil {
+		return "", -1, err
+	}
+	return string(out), 0, nil
+}
+
+// collectDiagnostics gathers what support usually asks for first.
+func (a *Agent) collectDiagnostics() map[string]interface{} {
+	wingsVersion, _ := a.getWingsVersion()
+	return map[string]interface{}{
+		"status":         a.Status(),
+		"endpoints":      a.endpointStats.summary(),
+		"health":         a.health.Report(),
+		"wings":          a.wingsProbe.Last(),
+		"wings_version":  wingsVersion,
+		"wings_active":   a.wings.IsActive(),
+		"wings_logs":     a.wings.RecentLogs(100),
+		"docker":         a.wings.DockerStatus(),
+		"docker_network": a.dockerNetworkState(),
+		"collected_at":   time.Now().UTC(),
+	}
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+)
+
+type diskHealthState struct {
+	mu   sync.Mutex
+	last []system.DiskHealth
+}
+
+func (s *diskHealthState) get() []system.DiskHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *diskHealthState) set(disks []system.DiskHealth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = disks
+}
+
+// diskProblems lists what's wrong with a drive, empty for a healthy one.
+func diskProblems(d system.DiskHealth, wearThreshold int) []string {
+	var problems []string
+	if !d.Passed {
+		problems = append(problems, "smart_failed")
+	}
+	if d.ReallocatedSectors > 0 {
+		problems = append(problems, "reallocated_sectors")
+	}
+	if d.PendingSectors > 0 || d.UncorrectableSectors > 0 {
+		problems = append(problems, "unreadable_sectors")
+	}
+	if d.MediaErrors > 0 {
+		problems = append(problems, "media_errors")
+	}
+	if wearThreshold > 0 && d.WearPercent >= wearThreshold {
+		problems = append(problems, "wear")
+	}
+	if d.SpareThreshold > 0 && d.AvailableSpare <= d.SpareThreshold {
+		problems = append(problems, "spare_low")
+	}
+	return problems
+}
+
+// runDiskHealthLoop reads SMART data and reports a disk_health event when
+// a drive's problems change or its bad sector count grows, so a dying
+// disk gets replaced before it takes game data with it. A failed SMART
+// self-assessment is also a critical alert.
+func (a *Agent) runDiskHealthLoop() {
+	interval := time.Duration(a.config.Metrics.SMARTInterval) * time.Second
+	wearThreshold := a.config.Metrics.SMARTWearThreshold
+
+	type seen struct {
+		problems string
+		sectors  int64
+	}
+	known := make(map[string]seen)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		disks, err := system.SMARTHealth(a.ctx)
+		if errors.Is(err, system.ErrNoSmartctl) {
+			a.logger.Info("smartctl not installed, disk health monitoring disabled")
+			return
+		}
+		if err != nil {
+			a.logger.WithError(err).Warn("Failed to read disk health")
+		} else {
+			a.diskHealth.set(disks)
+		}
+
+		for _, d := range disks {
+			if d.Error != "" {
+				continue
+			}
+			key := d.Serial
+			if key == "" {
+				key = d.Device
+			}
+			problems := diskProblems(d, wearThreshold)
+			sort.Strings(problems)
+			now := seen{problems: strings.Join(problems, ","), sectors: d.ReallocatedSectors + d.PendingSectors + d.UncorrectableSectors}
+			before, ok := known[key]
+			known[key] = now
+			if !ok && len(problems) == 0 {
+				continue
+			}
+			if ok && now.problems == before.problems && now.sectors <= before.sectors {
+				continue
+			}
+
+			state := "cleared"
+			if len(problems) > 0 {
+				state = "degraded"
+				a.logger.WithField("device", d.Device).WithField("problems", now.problems).Warn("Disk health degraded")
+			}
+			if !d.Passed && (!ok || !strings.Contains(before.problems, "smart_failed")) {
+				a.criticalAlert(map[string]interface{}{
+					"source":  "disk_health",
+					"message": "SMART reports " + d.Device + " as failing",
+					"device":  d.Device,
+					"model":   d.Model,
+					"serial":  d.Serial,
+				})
+			}
+			a.reportEvent("disk_health", map[string]interface{}{
+				"device":   d.Device,
+				"state":    state,
+				"problems": problems,
+				"disk":     d,
+			})
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
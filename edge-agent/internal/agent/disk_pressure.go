@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"os"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const diskPressureCheckInterval = time.Minute
+
+// Filesystems watched for disk pressure. Missing paths are skipped, as are
+// paths on a filesystem already checked.
+var diskPressurePaths = []string{"/", "/var/lib/docker", "/var/lib/pterodactyl"}
+
+// runDiskPressureLoop reports when a filesystem crosses the configured usage
+// threshold, and again once it recovers, rather than on every check.
+func (a *Agent) runDiskPressureLoop() {
+	threshold := a.config.Agent.DiskPressureThreshold
+	pressured := make(map[string]bool)
+
+	ticker := time.NewTicker(diskPressureCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		seen := make(map[uint64]bool)
+		for _, path := range diskPressurePaths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if dev, ok := fileDevice(info); ok {
+				if seen[dev] {
+					continue
+				}
+				seen[dev] = true
+			}
+			usage, err := disk.Usage(path)
+			if err != nil {
+				continue
+			}
+
+			high := usage.UsedPercent >= threshold
+			if high == pressured[path] {
+				continue
+			}
+			pressured[path] = high
+
+			state := "cleared"
+			if high {
+				state = "high"
+				a.logger.WithField("path", path).WithField("used_percent", usage.UsedPercent).Warn("Disk pressure")
+				a.criticalAlert(map[string]interface{}{
+					"source":       "disk_pressure",
+					"message":      "disk usage above threshold on " + path,
+					"path":         path,
+					"used_percent": usage.UsedPercent,
+				})
+			}
+			a.reportEvent("disk_pressure", map[string]interface{}{
+				"path":         path,
+				"state":        state,
+				"used_percent": usage.UsedPercent,
+				"free_bytes":   usage.Free,
+			})
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/diskusage"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// startDiskUsageTracker watches the Wings data directory so per-server disk
+// usage can go out with every heartbeat without a du scan each time.
+func (a *Agent) startDiskUsageTracker() {
+	root := (&wings.DaemonConfig{}).DataDirectory()
+	if cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath); err == nil {
+		root = cfg.DataDirectory()
+	}
+
+	tracker := diskusage.New(root, time.Duration(a.config.Metrics.DiskReconcileInterval)*time.Second, a.logger)
+	if err := tracker.Start(a.ctx); err != nil {
+		a.logger.WithError(err).Warn("Per-server disk usage tracking disabled")
+		return
+	}
+	a.stateMu.Lock()
+	a.diskUsage = tracker
+	a.stateMu.Unlock()
+}
+
+func (a *Agent) serverDiskUsage() *diskusage.Report {
+	a.stateMu.Lock()
+	tracker := a.diskUsage
+	a.stateMu.Unlock()
+
+	if tracker == nil {
+		return nil
+	}
+	report := tracker.Report()
+	return &report
+}
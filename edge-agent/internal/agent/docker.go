@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// registerDockerCommands lets the control plane manage the Docker daemon
+// Wings runs on.
+func (a *Agent) registerDockerCommands() {
+	a.commands.Register("install_docker", func(ctx context.Context, cmd Command) (interface{}, error) {
+		release, err := a.locks.Acquire(ctx, "install_docker", locks.Docker)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		if err := a.wings.InstallDocker(ctx); err != nil {
+			return nil, err
+		}
+		return a.wings.DockerStatus(), nil
+	})
+
+	a.commands.Register("configure_docker", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var spec wings.DockerDaemonSpec
+		if err := json.Unmarshal(cmd.Payload, &spec); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+
+		release, err := a.locks.Acquire(ctx, "configure_docker", locks.Docker)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		err = a.wings.ConfigureDocker(spec)
+		event := map[string]interface{}{"spec": spec}
+		if err != nil {
+			event["error"] = err.Error()
+		}
+		a.reportEvent("docker_configured", event)
+		if err != nil {
+			return nil, err
+		}
+		return a.wings.DockerStatus(), nil
+	})
+
+	a.commands.Register("restart_docker", func(ctx context.Context, cmd Command) (interface{}, error) {
+		release, err := a.locks.Acquire(ctx, "restart_docker", locks.Docker)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		err = a.wings.RestartDocker()
+		event := map[string]string{"reason": "command"}
+		if err != nil {
+			event["error"] = err.Error()
+		}
+		a.reportEvent("docker_restarted", event)
+		return nil, err
+	})
+
+	a.commands.Register("docker_status", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return a.wings.DockerStatus(), nil
+	})
+}
@@ -0,0 +1,306 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const (
+	imageCheckInterval = 10 * time.Minute
+	imagePullTimeout   = 30 * time.Minute
+)
+
+// ImageReport is Docker's image cache as of the last check.
+type ImageReport struct {
+	Images    []wings.DockerImage `json:"images"`
+	TotalSize int64               `json:"total_size"`
+	Missing   []string            `json:"missing,omitempty"` // images.pre_pull entries not cached
+	LastPrune *ImagePrune         `json:"last_prune,omitempty"`
+	CheckedAt time.Time           `json:"checked_at"`
+}
+
+// ImagePrune is one round of removing unused images.
+type ImagePrune struct {
+	Reason    string    `json:"reason"` // disk_usage or task
+	Removed   []string  `json:"removed"`
+	Reclaimed int64     `json:"reclaimed"` // bytes
+	Errors    []string  `json:"errors,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+type imageState struct {
+	mu        sync.Mutex
+	busy      sync.Mutex // held while pulling or pruning
+	last      *ImageReport
+	lastPrune *ImagePrune
+}
+
+func (s *imageState) get() *ImageReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *imageState) set(report *ImageReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report.LastPrune = s.lastPrune
+	s.last = report
+}
+
+func (s *imageState) pruned(prune *ImagePrune) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastPrune = prune
+}
+
+// imageRef normalizes an image reference the way Docker lists tags:
+// Docker Hub images without registry or library prefix, and an explicit
+// tag.
+func imageRef(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+	if !strings.Contains(image, "@") && strings.LastIndex(image, ":") <= strings.LastIndex(image, "/") {
+		image += ":latest"
+	}
+	return image
+}
+
+// missingImages returns the wanted images the cache doesn't have.
+func missingImages(images []wings.DockerImage, wanted []string) []string {
+	cached := make(map[string]bool)
+	for _, img := range images {
+		for _, tag := range img.Tags {
+			cached[imageRef(tag)] = true
+		}
+	}
+	var missing []string
+	for _, image := range wanted {
+		if !cached[imageRef(image)] {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
+// runImageLoop keeps images.pre_pull cached, which also pulls them right
+// after enrollment, and prunes unused images once Docker's filesystem
+// fills past images.prune_threshold.
+func (a *Agent) runImageLoop() {
+	ticker := time.NewTicker(imageCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.checkImages()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) checkImages() {
+	images, err := a.wings.ListImages()
+	if err != nil {
+		a.logger.WithError(err).Debug("Failed to list Docker images")
+		return
+	}
+
+	if missing := missingImages(images, a.config.Images.PrePull); len(missing) > 0 {
+		a.pullImages(missing, "pre_pull")
+	}
+
+	if threshold := a.config.Images.PruneThreshold; threshold > 0 {
+		if used, ok := a.dockerDiskUsage(); ok && used >= threshold {
+			a.logger.WithField("used_percent", used).Info("Docker filesystem above prune threshold, pruning unused images")
+			a.pruneImages(a.config.Images.PrePull, "disk_usage", threshold, false)
+		}
+	}
+	a.updateImageReport()
+}
+
+func (a *Agent) updateImageReport() {
+	images, err := a.wings.ListImages()
+	if err != nil {
+		return
+	}
+	report := &ImageReport{
+		Images:    images,
+		Missing:   missingImages(images, a.config.Images.PrePull),
+		CheckedAt: time.Now().UTC(),
+	}
+	for _, img := range images {
+		report.TotalSize += img.Size
+	}
+	a.images.set(report)
+}
+
+func (a *Agent) dockerDiskUsage() (float64, bool) {
+	root, err := a.wings.DockerRootDir()
+	if err != nil || root == "" {
+		return 0, false
+	}
+	usage, err := disk.Usage(root)
+	if err != nil {
+		return 0, false
+	}
+	return usage.UsedPercent, true
+}
+
+// pullImages pulls each image and returns the failures by image.
+func (a *Agent) pullImages(images []string, reason string) map[string]string {
+	a.images.busy.Lock()
+	defer a.images.busy.Unlock()
+
+	failed := make(map[string]string)
+	for _, image := range images {
+		ctx, cancel := context.WithTimeout(a.ctx, imagePullTimeout)
+		err := a.wings.PullImage(ctx, image)
+		cancel()
+		if a.ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			a.logger.WithError(err).WithField("image", image).Warn("Failed to pull image")
+			failed[image] = err.Error()
+		}
+	}
+	a.reportEvent("images_pulled", map[string]interface{}{
+		"images": images,
+		"failed": failed,
+		"reason": reason,
+	})
+	return failed
+}
+
+// pruneImages removes images no container uses, oldest first, keeping the
+// listed ones. With a target it stops once Docker's filesystem is back
+// under it.
+func (a *Agent) pruneImages(keep []string, reason string, target float64, dryRun bool) (*ImagePrune, error) {
+	a.images.busy.Lock()
+	defer a.images.busy.Unlock()
+
+	images, err := a.wings.ListImages()
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, image := range keep {
+		kept[imageRef(image)] = true
+	}
+
+	var candidates []wings.DockerImage
+	for _, img := range images {
+		if img.InUse {
+			continue
+		}
+		keepIt := false
+		for _, tag := range img.Tags {
+			keepIt = keepIt || kept[imageRef(tag)]
+		}
+		if !keepIt {
+			candidates = append(candidates, img)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Created.Before(candidates[j].Created) })
+
+	prune := &ImagePrune{Reason: reason, Removed: []string{}, At: time.Now().UTC()}
+	for _, img := range candidates {
+		if target > 0 {
+			if used, ok := a.dockerDiskUsage(); ok && used < target {
+				break
+			}
+		}
+		name := img.ID
+		if len(img.Tags) > 0 {
+			name = img.Tags[0]
+		}
+		if !dryRun {
+			if err := a.wings.RemoveImage(img); err != nil {
+				prune.Errors = append(prune.Errors, err.Error())
+				continue
+			}
+		}
+		prune.Removed = append(prune.Removed, name)
+		prune.Reclaimed += img.Size
+	}
+
+	if !dryRun {
+		a.images.pruned(prune)
+		if len(prune.Removed) > 0 || len(prune.Errors) > 0 {
+			a.reportEvent("images_pruned", prune)
+		}
+	}
+	return prune, nil
+}
+
+// runPullImagesTask pulls the given images, or images.pre_pull, whether
+// they're cached or not, which also picks up a moved tag.
+func (a *Agent) runPullImagesTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.PullImagesPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(p.Images) == 0 {
+		p.Images = a.config.Images.PrePull
+	}
+	if len(p.Images) == 0 {
+		return "", -1, fmt.Errorf("no images given and images.pre_pull is empty")
+	}
+
+	failed := a.pullImages(p.Images, "task")
+	a.updateImageReport()
+
+	var out strings.Builder
+	for _, image := range p.Images {
+		if err, ok := failed[image]; ok {
+			fmt.Fprintf(&out, "%s: %s\n", image, err)
+		} else {
+			fmt.Fprintf(&out, "%s: pulled\n", image)
+		}
+	}
+	if len(failed) > 0 {
+		return out.String(), 1, fmt.Errorf("%d of %d images failed to pull", len(failed), len(p.Images))
+	}
+	return out.String(), 0, nil
+}
+
+func (a *Agent) runPruneImagesTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.PruneImagesPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	keep := append(append([]string{}, a.config.Images.PrePull...), p.Keep...)
+	prune, err := a.pruneImages(keep, "task", 0, p.DryRun)
+	if err != nil {
+		return "", 1, err
+	}
+	a.updateImageReport()
+
+	var out strings.Builder
+	verb := "removed"
+	if p.DryRun {
+		verb = "would remove"
+	}
+	for _, name := range prune.Removed {
+		fmt.Fprintf(&out, "%s %s\n", verb, name)
+	}
+	fmt.Fprintf(&out, "%d images, %d MiB\n", len(prune.Removed), prune.Reclaimed>>20)
+	if len(prune.Errors) > 0 {
+		out.WriteString(strings.Join(prune.Errors, "\n") + "\n")
+		return out.String(), 1, fmt.Errorf("%d images could not be removed", len(prune.Errors))
+	}
+	return out.String(), 0, nil
+}
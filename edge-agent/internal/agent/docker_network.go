@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+type dockerNetworkPayload struct {
+	Action  string             `json:"action"` // "inspect" or "repair"
+	Network *wings.NetworkSpec `json:"network,omitempty"`
+}
+
+// dockerNetworkState inspects the Wings network against what Wings is
+// configured to create. It returns nil when Wings isn't configured yet.
+func (a *Agent) dockerNetworkState() *wings.NetworkState {
+	cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath)
+	if err != nil {
+		return nil
+	}
+	state, err := a.wings.InspectNetwork(wings.NetworkSpecFromConfig(cfg))
+	if err != nil {
+		return nil
+	}
+	return &state
+}
+
+// runDockerNetworkTask inspects or repairs the Wings Docker network. Without
+// a spec in the payload, the settings in the Wings config are used.
+func (a *Agent) runDockerNetworkTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p dockerNetworkPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	spec := p.Network
+	if spec == nil {
+		cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath)
+		if err != nil {
+			return "", -1, err
+		}
+		s := wings.NetworkSpecFromConfig(cfg)
+		spec = &s
+	}
+
+	var state wings.NetworkState
+	var err error
+	switch p.Action {
+	case "inspect":
+		state, err = a.wings.InspectNetwork(*spec)
+	case "repair":
+		var release func()
+		release, err = a.locks.Acquire(ctx, "repair_docker_network", locks.WingsConfig, locks.WingsService, locks.Docker)
+		if err != nil {
+			return "", 1, err
+		}
+		state, err = a.wings.RepairNetwork(*spec)
+		release()
+		if err == nil {
+			a.reportEvent("docker_network_repaired", state)
+		}
+	default:
+		return "", -1, fmt.Errorf("unsupported action %q", p.Action)
+	}
+	if err != nil {
+		return "", 1, err
+	}
+
+	out, _ := json.Marshal(state)
+	if len(state.Problems) > 0 {
+		return string(out), 1, fmt.Errorf("network has problems: %s", strings.Join(state.Problems, "; "))
+	}
+	return string(out), 0, nil
+}
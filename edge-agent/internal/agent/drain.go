@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+)
+
+const (
+	DrainActive   = "active"
+	DrainDraining = "draining"
+	DrainDrained  = "drained"
+
+	drainCheckInterval = 15 * time.Second
+)
+
+// drainState persists across agent restarts and reboots, so a node under
+// maintenance stays out of service until it's explicitly undrained.
+type drainState struct {
+	mu      sync.Mutex
+	path    string
+	status  api.DrainStatus
+	stopped map[string]bool // servers already sent a stop
+	check   chan struct{}
+}
+
+func loadDrainState(dataDir string) *drainState {
+	d := &drainState{
+		path:    filepath.Join(dataDir, "drain.json"),
+		status:  api.DrainStatus{State: DrainActive},
+		stopped: make(map[string]bool),
+		check:   make(chan struct{}, 1),
+	}
+	if data, err := os.ReadFile(d.path); err == nil {
+		json.Unmarshal(data, &d.status)
+	}
+	return d
+}
+
+func (d *drainState) get() api.DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// set changes the state and saves it. Callers hold mu.
+func (d *drainState) set(state string) error {
+	d.status.State = state
+	d.status.Since = time.Now().UTC()
+	data, err := json.Marshal(d.status)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.path, data, 0600)
+}
+
+// registerDrainCommands adds drain and undrain. While draining the node
+// reports it in every heartbeat so the control plane stops placing servers
+// on it; with stop_servers the agent also stops the running game servers.
+func (a *Agent) registerDrainCommands() {
+	a.commands.Register("drain", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req struct {
+			Reason      string `json:"reason"`
+			StopServers bool   `json:"stop_servers"`
+		}
+		if len(cmd.Payload) > 0 {
+			if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+				return nil, fmt.Errorf("invalid payload: %w", err)
+			}
+		}
+
+		a.drain.mu.Lock()
+		a.drain.status.Reason = req.Reason
+		a.drain.status.StopServers = req.StopServers
+		a.drain.stopped = make(map[string]bool)
+		err := a.drain.set(DrainDraining)
+		status := a.drain.status
+		a.drain.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to save drain state: %w", err)
+		}
+
+		a.logger.WithField("reason", req.Reason).Info("Draining node")
+		a.reportEvent("node_draining", status)
+		a.checkDrainSoon()
+		// Don't wait for the next heartbeat to stop new placements.
+		go a.sendHeartbeat()
+		return status, nil
+	})
+
+	a.commands.Register("undrain", func(ctx context.Context, cmd Command) (interface{}, error) {
+		a.drain.mu.Lock()
+		a.drain.status = api.DrainStatus{}
+		err := a.drain.set(DrainActive)
+		status := a.drain.status
+		a.drain.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to save drain state: %w", err)
+		}
+
+		a.logger.Info("Node back in service")
+		a.reportEvent("node_undrained", status)
+		go a.sendHeartbeat()
+		return status, nil
+	})
+}
+
+func (a *Agent) checkDrainSoon() {
+	select {
+	case a.drain.check <- struct{}{}:
+	default:
+	}
+}
+
+// runDrainLoop watches the game servers while the node is draining and
+// reports once they have all stopped, so the node can be rebooted safely.
+func (a *Agent) runDrainLoop() {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.drain.check:
+		}
+
+		if a.drain.get().State == DrainActive {
+			continue
+		}
+		a.checkDrain()
+	}
+}
+
+func (a *Agent) checkDrain() {
+	servers, err := a.wingsAPI.Servers()
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to list servers while draining")
+		return
+	}
+
+	a.drain.mu.Lock()
+	defer a.drain.mu.Unlock()
+
+	running := 0
+	for _, s := range servers {
+		if s.State == "offline" {
+			continue
+		}
+		running++
+		if a.drain.status.StopServers && !a.drain.stopped[s.UUID] {
+			a.drain.stopped[s.UUID] = true
+			if err := a.wingsAPI.Power(s.UUID, "stop"); err != nil {
+				a.logger.WithError(err).WithField("server", s.UUID).Warn("Failed to stop server for drain")
+			}
+		}
+	}
+	a.drain.status.RunningServers = running
+
+	switch state := a.drain.status.State; {
+	case state == DrainDraining && running == 0:
+		if err := a.drain.set(DrainDrained); err != nil {
+			a.logger.WithError(err).Warn("Failed to save drain state")
+		}
+		a.logger.Info("Node drained, all game servers stopped")
+		a.reportEvent("node_drained", a.drain.status)
+	case state == DrainDrained && running > 0:
+		// Someone started a server again, it isn't safe to reboot anymore.
+		if err := a.drain.set(DrainDraining); err != nil {
+			a.logger.WithError(err).Warn("Failed to save drain state")
+		}
+		a.logger.WithField("running", running).Warn("Servers running on drained node")
+		a.reportEvent("node_draining", a.drain.status)
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// regionalEndpoint is an API endpoint the control plane publishes, e.g. one
+// per region behind GeoDNS.
+type regionalEndpoint struct {
+	URL    string `json:"url"`
+	Region string `json:"region,omitempty"`
+}
+
+// runEndpointProbeLoop latency-tests every control plane endpoint at startup
+// and then periodically, so the latency strategy has fresh numbers even for
+// endpoints no request has gone to yet.
+func (a *Agent) runEndpointProbeLoop() {
+	a.probeEndpoints()
+
+	ticker := time.NewTicker(time.Duration(a.config.ControlPlane.LatencyProbeInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.probeEndpoints()
+		}
+	}
+}
+
+func (a *Agent) probeEndpoints() {
+	if a.config.ControlPlane.DiscoverEndpoints {
+		var resp struct {
+			Endpoints []regionalEndpoint `json:"endpoints"`
+		}
+		if err := a.getCached("/agent/endpoints", &resp); err != nil {
+			a.logger.WithError(err).Warn("Failed to fetch control plane endpoints")
+		} else {
+			a.controlPlanes.setDiscovered(resp.Endpoints)
+		}
+	}
+
+	urls := a.controlPlanes.urls()
+	if len(urls) < 2 {
+		return
+	}
+
+	before := a.controlPlanes.preferred()
+	for _, url := range urls {
+		start := time.Now()
+		if err := a.pingControlPlane(url); err != nil {
+			a.controlPlanes.failure(url, err)
+			continue
+		}
+		a.controlPlanes.measured(url, time.Since(start))
+	}
+
+	after := a.controlPlanes.active()
+	if after == nil || after.URL == before {
+		return
+	}
+
+	a.logger.WithFields(logrus.Fields{
+		"from":       before,
+		"to":         after.URL,
+		"region":     after.Region,
+		"latency_ms": after.LatencyMs,
+	}).Info("Switching control plane endpoint")
+	a.reportEvent("control_plane_switched", map[string]interface{}{
+		"from":       before,
+		"to":         after.URL,
+		"region":     after.Region,
+		"latency_ms": after.LatencyMs,
+	})
+	// Move the command channel over as well.
+	a.dropCommandChannel()
+}
+
+// pingControlPlane times an unauthenticated request to the health endpoint.
+func (a *Agent) pingControlPlane(baseURL string) error {
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("health check returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
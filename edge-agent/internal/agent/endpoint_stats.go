@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+)
+
+// Latency samples kept per endpoint for percentile calculation.
+const endpointSampleWindow = 256
+
+type endpointRecord struct {
+	requests  int64
+	failures  int64
+	retries   int64 // attempts repeated after a transient failure
+	throttled int64 // of which were answered with 429
+	lastError string
+	server    string
+	samples   []time.Duration // ring buffer
+	next      int
+}
+
+// endpointStats tracks success rate and latency per control-plane endpoint.
+type endpointStats struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointRecord
+}
+
+func newEndpointStats() *endpointStats {
+	return &endpointStats{
+		endpoints: make(map[string]*endpointRecord),
+	}
+}
+
+// endpointKey drops query strings, which would split one endpoint into
+// many series.
+func endpointKey(method, endpoint string) string {
+	if idx := strings.IndexByte(endpoint, '?'); idx >= 0 {
+		endpoint = endpoint[:idx]
+	}
+	return method + " " + endpoint
+}
+
+// recordFor returns the record for key, creating it. Callers hold mu.
+func (s *endpointStats) recordFor(key string) *endpointRecord {
+	rec, ok := s.endpoints[key]
+	if !ok {
+		rec = &endpointRecord{}
+		s.endpoints[key] = rec
+	}
+	return rec
+}
+
+func (s *endpointStats) retried(method, endpoint string, throttled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.recordFor(endpointKey(method, endpoint))
+	rec.retries++
+	if throttled {
+		rec.throttled++
+	}
+}
+
+func (s *endpointStats) record(method, endpoint, server string, elapsed time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.recordFor(endpointKey(method, endpoint))
+	rec.requests++
+	rec.server = server
+	if err != nil {
+		rec.failures++
+		rec.lastError = err.Error()
+	}
+
+	if len(rec.samples) < endpointSampleWindow {
+		rec.samples = append(rec.samples, elapsed)
+	} else {
+		rec.samples[rec.next] = elapsed
+		rec.next = (rec.next + 1) % endpointSampleWindow
+	}
+}
+
+func (s *endpointStats) summary() []api.EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]api.EndpointStats, 0, len(s.endpoints))
+	for key, rec := range s.endpoints {
+		if rec.requests == 0 {
+			continue
+		}
+		sorted := append([]time.Duration(nil), rec.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		out = append(out, api.EndpointStats{
+			Endpoint:    key,
+			Requests:    rec.requests,
+			Failures:    rec.failures,
+			Retries:     rec.retries,
+			Throttled:   rec.throttled,
+			SuccessRate: float64(rec.requests-rec.failures) / float64(rec.requests),
+			P50Ms:       percentile(sorted, 0.50),
+			P90Ms:       percentile(sorted, 0.90),
+			P99Ms:       percentile(sorted, 0.99),
+			LastError:   rec.lastError,
+			LastServer:  rec.server,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Endpoint < out[j].Endpoint })
+	return out
+}
+
+// overall gives latency percentiles across every endpoint's samples.
+func (s *endpointStats) overall() (p50, p90, p99 float64) {
+	s.mu.Lock()
+	var all []time.Duration
+	for _, rec := range s.endpoints {
+		all = append(all, rec.samples...)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return percentile(all, 0.50), percentile(all, 0.90), percentile(all, 0.99)
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+)
+
+type eventBatch struct {
+	SessionID string         `json:"session_id"`
+	NodeID    string         `json:"node_id"`
+	Events    []events.Event `json:"events"`
+}
+
+// reportEvent publishes an event locally and queues it for the control
+// plane's audit trail.
+func (a *Agent) reportEvent(eventType string, data interface{}) {
+	a.events.Publish(eventType, data)
+	a.eventReporter.Report(eventType, data)
+}
+
+func (a *Agent) sendEvents(batch []events.Event) error {
+	return a.makeRequest("POST", "/agent/events", eventBatch{
+		SessionID: a.session.SessionID,
+		NodeID:    a.config.Agent.NodeID,
+		Events:    batch,
+	}, nil)
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+// latencySmoothing is the EWMA weight given to the newest latency sample.
+const latencySmoothing = 0.3
+
+type controlPlaneEndpoint struct {
+	url            string
+	region         string
+	discovered     bool // published by the control plane rather than configured
+	unhealthyUntil time.Time
+	latency        time.Duration // EWMA of successful requests
+	served         int64
+	failures       int64
+	lastError      string
+}
+
+// controlPlanePool picks which control plane URL to talk to. An endpoint that
+// fails is skipped for the cooldown; if every endpoint is cooling down they
+// are still tried, soonest-recovering first, rather than giving up.
+type controlPlanePool struct {
+	mu        sync.Mutex
+	endpoints []*controlPlaneEndpoint
+	byLatency bool
+	cooldown  time.Duration
+}
+
+func newControlPlanePool(cfg config.ControlPlaneConfig) *controlPlanePool {
+	p := &controlPlanePool{
+		byLatency: cfg.FailoverStrategy == "latency",
+		cooldown:  time.Duration(cfg.FailoverCooldown) * time.Second,
+	}
+	for _, u := range cfg.Endpoints() {
+		p.endpoints = append(p.endpoints, &controlPlaneEndpoint{url: u})
+	}
+	return p
+}
+
+// reset replaces the endpoint list after a config reload, keeping the
+// history of endpoints that are still configured and any discovered ones.
+func (p *controlPlanePool) reset(cfg config.ControlPlaneConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	endpoints := make([]*controlPlaneEndpoint, 0, len(p.endpoints))
+	for _, u := range cfg.Endpoints() {
+		ep := p.find(u)
+		if ep == nil {
+			ep = &controlPlaneEndpoint{url: u}
+		}
+		ep.discovered = false
+		endpoints = append(endpoints, ep)
+	}
+	for _, ep := range p.endpoints {
+		if ep.discovered && !containsEndpoint(endpoints, ep.url) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	p.endpoints = endpoints
+	p.byLatency = cfg.FailoverStrategy == "latency"
+	p.cooldown = time.Duration(cfg.FailoverCooldown) * time.Second
+}
+
+// setDiscovered replaces the endpoints published by the control plane.
+// Configured endpoints are kept and only pick up the published region.
+func (p *controlPlanePool) setDiscovered(published []regionalEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var endpoints []*controlPlaneEndpoint
+	for _, ep := range p.endpoints {
+		if !ep.discovered {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	for _, pub := range published {
+		u := strings.TrimSuffix(pub.URL, "/")
+		if u == "" {
+			continue
+		}
+		if ep := findEndpoint(endpoints, u); ep != nil {
+			ep.region = pub.Region
+			continue
+		}
+		ep := p.find(u)
+		if ep == nil {
+			ep = &controlPlaneEndpoint{url: u, discovered: true}
+		}
+		ep.region = pub.Region
+		endpoints = append(endpoints, ep)
+	}
+	p.endpoints = endpoints
+}
+
+// urls returns every endpoint in configured order.
+func (p *controlPlanePool) urls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	urls := make([]string, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		urls = append(urls, ep.url)
+	}
+	return urls
+}
+
+// candidates returns the URLs to try for one request, in order.
+func (p *controlPlanePool) candidates() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var healthy, cooling []*controlPlaneEndpoint
+	for _, ep := range p.endpoints {
+		if now.Before(ep.unhealthyUntil) {
+			cooling = append(cooling, ep)
+		} else {
+			healthy = append(healthy, ep)
+		}
+	}
+
+	if p.byLatency {
+		// Endpoints without a sample yet sort first so they get measured.
+		sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].latency < healthy[j].latency })
+	}
+	sort.SliceStable(cooling, func(i, j int) bool { return cooling[i].unhealthyUntil.Before(cooling[j].unhealthyUntil) })
+
+	urls := make([]string, 0, len(p.endpoints))
+	for _, ep := range append(healthy, cooling...) {
+		urls = append(urls, ep.url)
+	}
+	return urls
+}
+
+// preferred is the endpoint long-lived connections should use.
+func (p *controlPlanePool) preferred() string {
+	if urls := p.candidates(); len(urls) > 0 {
+		return urls[0]
+	}
+	return ""
+}
+
+func (p *controlPlanePool) find(url string) *controlPlaneEndpoint {
+	return findEndpoint(p.endpoints, url)
+}
+
+func findEndpoint(endpoints []*controlPlaneEndpoint, url string) *controlPlaneEndpoint {
+	for _, ep := range endpoints {
+		if ep.url == url {
+			return ep
+		}
+	}
+	return nil
+}
+
+func containsEndpoint(endpoints []*controlPlaneEndpoint, url string) bool {
+	return findEndpoint(endpoints, url) != nil
+}
+
+func (p *controlPlanePool) success(url string, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep := p.find(url)
+	if ep == nil {
+		return
+	}
+	ep.served++
+	ep.observe(elapsed)
+}
+
+// measured records a latency probe, which counts as proof of health but
+// not as a served request.
+func (p *controlPlanePool) measured(url string, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ep := p.find(url); ep != nil {
+		ep.observe(elapsed)
+	}
+}
+
+func (ep *controlPlaneEndpoint) observe(elapsed time.Duration) {
+	ep.unhealthyUntil = time.Time{}
+	if ep.latency == 0 {
+		ep.latency = elapsed
+	} else {
+		ep.latency = time.Duration(latencySmoothing*float64(elapsed) + (1-latencySmoothing)*float64(ep.latency))
+	}
+}
+
+func (p *controlPlanePool) failure(url string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep := p.find(url)
+	if ep == nil {
+		return
+	}
+	ep.failures++
+	ep.lastError = err.Error()
+	ep.unhealthyUntil = time.Now().Add(p.cooldown)
+}
+
+func (p *controlPlanePool) status() []api.ControlPlaneStatus {
+	active := p.preferred()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	out := make([]api.ControlPlaneStatus, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		out = append(out, api.ControlPlaneStatus{
+			URL:       ep.url,
+			Region:    ep.region,
+			Active:    ep.url == active,
+			Healthy:   !now.Before(ep.unhealthyUntil),
+			LatencyMs: float64(ep.latency) / float64(time.Millisecond),
+			Served:    ep.served,
+			Failures:  ep.failures,
+			LastError: ep.lastError,
+		})
+	}
+	return out
+}
+
+// active returns the status of the preferred endpoint, for heartbeats.
+func (p *controlPlanePool) active() *api.ControlPlaneStatus {
+	for _, cp := range p.status() {
+		if cp.Active {
+			return &cp
+		}
+	}
+	return nil
+}
+
+// shouldFailover reports whether another endpoint might succeed where this
+// one failed. Client errors would fail the same way everywhere.
+func shouldFailover(err error) bool {
+	if httpErr, ok := err.(*httpError); ok {
+		return httpErr.StatusCode >= 500
+	}
+	return true
+}
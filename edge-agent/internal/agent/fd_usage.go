@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+const fdCheckInterval = time.Minute
+
+// FDReport is open file descriptor usage for the node and the processes
+// that run out first on a busy node: Wings holds a descriptor per console
+// and SFTP session.
+type FDReport struct {
+	System *system.FileDescriptors `json:"system,omitempty"`
+	Wings  *system.FileDescriptors `json:"wings,omitempty"`
+	Agent  *system.FileDescriptors `json:"agent,omitempty"`
+}
+
+type fdState struct {
+	mu   sync.Mutex
+	last *FDReport
+}
+
+func (s *fdState) get() *FDReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *fdState) set(report *FDReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = report
+}
+
+func (a *Agent) checkFileDescriptors() *FDReport {
+	report := &FDReport{}
+	if fds, err := system.SystemFileDescriptors(); err == nil {
+		report.System = &fds
+	}
+	if pid, ok := system.FindProcess(a.config.Wings.BinaryPath); ok {
+		if fds, err := system.ProcessFileDescriptors(pid); err == nil {
+			report.Wings = &fds
+		}
+	}
+	if fds, err := system.ProcessFileDescriptors(os.Getpid()); err == nil {
+		report.Agent = &fds
+	}
+	return report
+}
+
+// runFDLoop reports when descriptor usage crosses the configured threshold
+// and again once it recovers, like disk pressure. Running out doesn't log
+// anything useful: consoles and SFTP just stop accepting connections.
+func (a *Agent) runFDLoop() {
+	threshold := a.config.Agent.FDPressureThreshold
+	pressured := make(map[string]bool)
+
+	ticker := time.NewTicker(fdCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		report := a.checkFileDescriptors()
+		a.fds.set(report)
+
+		for scope, fds := range map[string]*system.FileDescriptors{"system": report.System, "wings": report.Wings, "agent": report.Agent} {
+			if fds == nil {
+				continue
+			}
+			high := fds.Percent >= threshold
+			if high == pressured[scope] {
+				continue
+			}
+			pressured[scope] = high
+
+			state := "cleared"
+			if high {
+				state = "high"
+				a.logger.WithField("scope", scope).WithField("open", fds.Open).WithField("limit", fds.Limit).Warn("File descriptor usage high")
+			}
+			a.reportEvent("fd_pressure", map[string]interface{}{
+				"scope":   scope,
+				"state":   state,
+				"open":    fds.Open,
+				"limit":   fds.Limit,
+				"percent": fds.Percent,
+			})
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runFileLimitTask raises a service's open file limit, by default Wings'.
+// The new limit only applies once the service restarts, which the task
+// does when asked to.
+func (a *Agent) runFileLimitTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.FileLimitPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if p.Unit == "" {
+		p.Unit = a.config.Wings.SystemdUnit
+	}
+	if p.Limit <= 0 {
+		return "", -1, fmt.Errorf("limit must be positive")
+	}
+	// The kernel refuses limits above fs.nr_open, and systemd then fails
+	// to start the unit at all.
+	if data, err := os.ReadFile("/proc/sys/fs/nr_open"); err == nil {
+		if max, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && p.Limit > max {
+			return "", -1, fmt.Errorf("limit %d is above fs.nr_open (%d)", p.Limit, max)
+		}
+	}
+
+	if err := a.services.SetFileLimit(ctx, p.Unit, p.Limit); err != nil {
+		return "", 1, fmt.Errorf("failed to set file limit for %s: %w", p.Unit, err)
+	}
+	out := fmt.Sprintf("%s: open file limit set to %d\n", p.Unit, p.Limit)
+
+	if !p.Restart {
+		return out + "takes effect on the next restart\n", 0, nil
+	}
+	var err error
+	if p.Unit == a.config.Wings.SystemdUnit {
+		err = a.restartWings("file_limit")
+	} else {
+		err = a.services.Restart(ctx, p.Unit)
+	}
+	if err != nil {
+		return out, 1, fmt.Errorf("failed to restart %s: %w", p.Unit, err)
+	}
+	return out + "restarted\n", 0, nil
+}
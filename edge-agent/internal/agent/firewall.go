@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/firewall"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+)
+
+var errFirewallDisabled = errors.New("firewall management is disabled on this node")
+
+func (a *Agent) newFirewall() *firewall.Manager {
+	if !a.config.Firewall.Enabled {
+		return nil
+	}
+	fw, err := firewall.New(a.config.Firewall, a.config.Agent.DataDir, a.logger)
+	if err != nil {
+		a.logger.WithError(err).Warn("Firewall management unavailable")
+		return nil
+	}
+	return fw
+}
+
+// firewallStatus is reported in heartbeats, nil when not managed.
+func (a *Agent) firewallStatus() *firewall.State {
+	if a.firewall == nil {
+		return nil
+	}
+	state := a.firewall.Status()
+	return &state
+}
+
+// registerFirewallCommands lets the control plane push inbound rules. An
+// apply is undone when the control plane can't be reached afterwards, so a
+// bad rule set can't cut the node off.
+func (a *Agent) registerFirewallCommands() {
+	a.commands.Register("firewall_apply", func(ctx context.Context, cmd Command) (interface{}, error) {
+		if a.firewall == nil {
+			return nil, errFirewallDisabled
+		}
+		var req struct {
+			Rules      []firewall.Rule `json:"rules"`
+			SkipVerify bool            `json:"skip_verify"`
+		}
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+
+		release, err := a.locks.Acquire(ctx, "firewall_apply", locks.Firewall)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		var verify func() error
+		if !req.SkipVerify {
+			verify = a.sendHeartbeat
+		}
+		changed, err := a.firewall.Apply(req.Rules, verify)
+		event := map[string]interface{}{"rules": len(req.Rules), "changed": changed}
+		if err != nil {
+			event["error"] = err.Error()
+		}
+		if changed || err != nil {
+			a.reportEvent("firewall_applied", event)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return a.firewall.Status(), nil
+	})
+
+	a.commands.Register("firewall_rollback", func(ctx context.Context, cmd Command) (interface{}, error) {
+		if a.firewall == nil {
+			return nil, errFirewallDisabled
+		}
+		release, err := a.locks.Acquire(ctx, "firewall_rollback", locks.Firewall)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		if err := a.firewall.Rollback(); err != nil {
+			return nil, err
+		}
+		a.reportEvent("firewall_rolled_back", nil)
+		return a.firewall.Status(), nil
+	})
+
+	a.commands.Register("firewall_status", func(ctx context.Context, cmd Command) (interface{}, error) {
+		if a.firewall == nil {
+			return nil, errFirewallDisabled
+		}
+		return a.firewall.Status(), nil
+	})
+}
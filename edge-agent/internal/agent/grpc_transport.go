@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/attest"
+	"github.com/pterodactyl-cp/edge-agent/internal/rpc"
+	"github.com/pterodactyl-cp/edge-agent/internal/signing"
+)
+
+const rpcTimeout = 30 * time.Second
+
+// rpcMetadata is sent with every gRPC call, as the REST headers are.
+func (a *Agent) rpcMetadata() http.Header {
+	md := http.Header{}
+	md.Set("X-Agent-Session", a.session.SessionID)
+	if token := a.authToken(); token != "" {
+		md.Set("Authorization", "Bearer "+token)
+	}
+	return md
+}
+
+// rpcRequest sends the requests agent.proto has an RPC for over gRPC and
+// reports false for the rest, which stay on REST. Failures come back as
+// httpErrors so retries, failover and the auth guard treat both
+// transports alike.
+func (a *Agent) rpcRequest(baseURL, endpoint string, body, response interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(a.ctx, rpcTimeout)
+	defer cancel()
+
+	var err error
+	switch endpoint {
+	case "/agent/enroll", "/agent/activate":
+		req := &rpc.EnrollRequest{}
+		var nodeInfo map[string]interface{}
+		var evidence *attest.Evidence
+		var signingKey *signing.JWK
+		switch b := body.(type) {
+		case EnrollmentRequest:
+			req.Token, req.CSR, nodeInfo, evidence, signingKey = b.Token, b.CSR, b.NodeInfo, b.Attestation, b.SigningKey
+		case ActivationRequest:
+			req.Token, req.CSR, req.NodeID, nodeInfo, evidence, signingKey = b.Token, b.CSR, b.NodeID, b.NodeInfo, b.Attestation, b.SigningKey
+		default:
+			return true, fmt.Errorf("unexpected %T body for %s", body, endpoint)
+		}
+		if req.NodeInfo, err = json.Marshal(nodeInfo); err != nil {
+			return true, err
+		}
+		if evidence != nil {
+			if req.Attestation, err = json.Marshal(evidence); err != nil {
+				return true, err
+			}
+		}
+		if signingKey != nil {
+			if req.SigningKey, err = json.Marshal(signingKey); err != nil {
+				return true, err
+			}
+		}
+		var resp rpc.EnrollResponse
+		if err = a.rpc.Invoke(ctx, baseURL, "Enroll", a.rpcMetadata(), req, &resp); err != nil {
+			break
+		}
+		if out, ok := response.(*EnrollmentResponse); ok {
+			*out = EnrollmentResponse{NodeID: resp.NodeID, AuthToken: resp.AuthToken, ClientCertificate: resp.ClientCertificate}
+			if len(resp.WingsConfig) > 0 {
+				if err := json.Unmarshal(resp.WingsConfig, &out.WingsConfig); err != nil {
+					return true, fmt.Errorf("invalid wings config in enrollment response: %w", err)
+				}
+			}
+		}
+
+	case "/agent/heartbeat":
+		req := &rpc.HeartbeatRequest{SessionID: a.session.SessionID}
+		if req.Heartbeat, err = json.Marshal(body); err != nil {
+			return true, err
+		}
+		md := a.rpcMetadata()
+		if signature := a.signPayload(req.Heartbeat); signature != "" {
+			md.Set("X-Agent-Signature", signature)
+		}
+		var resp rpc.HeartbeatResponse
+		if err = a.rpc.Invoke(ctx, baseURL, "Heartbeat", md, req, &resp); err != nil {
+			break
+		}
+		if response != nil && len(resp.Response) > 0 {
+			return true, json.Unmarshal(resp.Response, response)
+		}
+
+	case "/agent/metrics":
+		req := &rpc.PushMetricsRequest{SessionID: a.session.SessionID, TimestampMs: time.Now().UnixMilli()}
+		if req.Metrics, err = json.Marshal(body); err != nil {
+			return true, err
+		}
+		err = a.rpc.Invoke(ctx, baseURL, "PushMetrics", a.rpcMetadata(), req, &rpc.PushMetricsResponse{})
+
+	default:
+		return false, nil
+	}
+
+	var statusErr *rpc.StatusError
+	if errors.As(err, &statusErr) {
+		return true, &httpError{StatusCode: statusErr.HTTPStatus(), Status: statusErr.Error()}
+	}
+	return true, err
+}
+
+// serveCommandStream is the command channel over the StreamCommands RPC.
+// HTTP/2 gives no read deadline to lean on, so the agent pings and drops
+// the stream when the control plane stops answering.
+func (a *Agent) serveCommandStream() (bool, error) {
+	if !a.auth.allow() {
+		return false, errCredentialsRejected
+	}
+
+	stream, err := a.rpc.OpenStream(a.ctx, a.controlPlanes.preferred(), "StreamCommands", a.rpcMetadata())
+	if err != nil {
+		return false, fmt.Errorf("failed to open command stream: %w", err)
+	}
+	defer stream.Close()
+
+	send := func(event string, data interface{}) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&rpc.ChannelMessage{Event: event, Data: payload})
+	}
+
+	a.setChannelSender(send, stream.Close)
+	defer a.setChannelSender(nil, nil)
+
+	if err := send("agent:hello", a.capabilities()); err != nil {
+		return false, fmt.Errorf("failed to send capabilities: %w", err)
+	}
+
+	var lastRecv atomic.Int64
+	lastRecv.Store(time.Now().UnixNano())
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(channelPingInterval)
+		defer ticker.Stop()
+		// The first answer confirms the stream is up.
+		send("agent:ping", nil)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if time.Since(time.Unix(0, lastRecv.Load())) > channelPongTimeout {
+				a.logger.Warn("Command stream stopped answering, reconnecting")
+				stream.Close()
+				return
+			}
+			if err := send("agent:ping", nil); err != nil {
+				stream.Close()
+				return
+			}
+		}
+	}()
+
+	connected := false
+	for {
+		var msg rpc.ChannelMessage
+		if err := stream.Recv(&msg); err != nil {
+			var statusErr *rpc.StatusError
+			if errors.As(err, &statusErr) {
+				a.observeAuth(statusErr.HTTPStatus(), err)
+			}
+			return connected, err
+		}
+		lastRecv.Store(time.Now().UnixNano())
+		if !connected {
+			connected = true
+			a.logger.Info("Command channel connected over gRPC")
+		}
+		if msg.Event == "agent:pong" {
+			continue
+		}
+		a.handleChannelMessage(channelMessage{Event: msg.Event, Data: msg.Data}, send)
+	}
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/buffer"
+)
+
+// bufferable reports whether a failed request is worth keeping for replay.
+// Client errors mean the control plane saw and rejected it, so resending the
+// same payload won't help.
+func bufferable(err error) bool {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == 429
+	}
+	return true
+}
+
+// deliverHeartbeat sends any buffered heartbeats in order, then this one.
+// A buffered heartbeat the control plane rejects is dropped, so one bad
+// record can't hold up the rest. This one is sent even if the replay
+// stopped, and queued on disk if the control plane is unreachable.
+func (a *Agent) deliverHeartbeat(heartbeat HeartbeatRequest) error {
+	if a.heartbeats.Len() > 0 {
+		err := a.heartbeats.Replay(func(raw json.RawMessage) error {
+			err := a.makeRequest("POST", "/agent/heartbeat", raw, nil)
+			if err != nil && !bufferable(err) {
+				a.logger.WithError(err).Warn("Control plane rejected a buffered heartbeat, dropping it")
+				return fmt.Errorf("%w: %v", buffer.ErrDiscard, err)
+			}
+			return err
+		})
+		if err != nil {
+			a.logger.WithError(err).Debug("Failed to replay buffered heartbeats")
+		} else {
+			a.logger.Info("Replayed buffered heartbeats")
+		}
+	}
+
+	var resp HeartbeatResponse
+	if err := a.makeRequest("POST", "/agent/heartbeat", heartbeat, &resp); err != nil {
+		return a.bufferHeartbeat(heartbeat, err)
+	}
+	a.handleDirectives(resp.Directives)
+	return nil
+}
+
+func (a *Agent) bufferHeartbeat(heartbeat HeartbeatRequest, sendErr error) error {
+	if !bufferable(sendErr) {
+		return sendErr
+	}
+
+	if err := a.heartbeats.Push(heartbeat); err != nil {
+		a.logger.WithError(err).Warn("Failed to buffer heartbeat")
+	}
+	return sendErr
+}
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// mirrorHeartbeat writes the heartbeat to MirrorPath for node-local tooling
+// such as textfile collectors. DataDir is 0700, so the mirror lives outside
+// it in a directory other users can traverse. The rename keeps readers from
+// ever seeing a half-written file.
+func (a *Agent) mirrorHeartbeat(heartbeat HeartbeatRequest) error {
+	data, err := json.MarshalIndent(heartbeat, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := a.config.Agent.MirrorPath
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create heartbeat mirror directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
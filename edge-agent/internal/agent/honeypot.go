@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/honeypot"
+	"github.com/sirupsen/logrus"
+)
+
+type securityEventReport struct {
+	Type    string                   `json:"type"`
+	Sources []honeypot.SourceSummary `json:"sources"`
+}
+
+// runHoneypotLoop reports connections to the decoy ports as port scan
+// security events.
+func (a *Agent) runHoneypotLoop() {
+	cfg := a.config.Honeypot
+	detector := honeypot.New(cfg.Ports, a.logger)
+	if err := detector.Start(a.ctx); err != nil {
+		a.logger.WithError(err).Warn("Honeypot disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.ReportInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sources := detector.Drain()
+		if len(sources) == 0 {
+			continue
+		}
+
+		for _, src := range sources {
+			if src.Count < cfg.AlertThreshold {
+				continue
+			}
+			a.logger.WithFields(logrus.Fields{
+				"source": src.Source,
+				"count":  src.Count,
+				"ports":  src.Ports,
+			}).Warn("Port scan detected")
+			a.events.Publish("alert", map[string]interface{}{
+				"source":  "honeypot",
+				"message": "port scan from " + src.Source,
+				"scan":    src,
+			})
+		}
+
+		if err := a.makeRequest("POST", "/agent/security-events", securityEventReport{Type: "port_scan", Sources: sources}, nil); err != nil {
+			a.logger.WithError(err).Warn("Failed to report port scan events")
+		}
+	}
+}
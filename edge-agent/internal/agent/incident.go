@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/incident"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+const (
+	incidentServerPoll  = 30 * time.Second
+	incidentJournalTail = 100
+	incidentTaskLimit   = 20 // each can carry 4KiB of output
+)
+
+// runIncidentLoop records Wings server state changes for incident
+// timelines. Metrics are recorded with each heartbeat.
+func (a *Agent) runIncidentLoop() {
+	ticker := time.NewTicker(incidentServerPoll)
+	defer ticker.Stop()
+
+	for {
+		if servers, err := a.wingsAPI.Servers(); err == nil {
+			a.incidents.RecordServers(time.Now(), servers)
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// criticalAlert raises an alert with an incident timeline attached, and
+// sends it to the control plane as well as local subscribers.
+func (a *Agent) criticalAlert(alert map[string]interface{}) {
+	alert["severity"] = "critical"
+	alert["timeline"] = a.incidentTimeline()
+	a.reportEvent("alert", alert)
+}
+
+// incidentTimeline assembles what the node was doing over the incident
+// window: recorded metrics and server changes, the tasks that finished and
+// the tail of the journal for Wings, Docker and the agent.
+func (a *Agent) incidentTimeline() *incident.Timeline {
+	timeline := a.incidents.Timeline(time.Now())
+
+	history, err := a.tasks.History(tasks.HistoryQuery{Since: timeline.From, Until: timeline.At, Limit: incidentTaskLimit})
+	if err != nil {
+		timeline.Errors["tasks"] = err.Error()
+	}
+	timeline.Tasks = history
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+	for _, unit := range []string{a.config.Wings.SystemdUnit, "docker.service", a.config.Agent.SystemdUnit} {
+		logs, err := a.services.Logs(ctx, unit, incidentJournalTail)
+		if err != nil {
+			timeline.Errors["journal:"+unit] = err.Error()
+			continue
+		}
+		timeline.Journal[unit] = logs
+	}
+	return timeline
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+const installFailureScanInterval = time.Minute
+
+type installFailureReport struct {
+	Failures []wings.InstallFailure `json:"failures"`
+}
+
+// runInstallFailureLoop reports failed server installations found in the
+// Wings install logs.
+func (a *Agent) runInstallFailureLoop() {
+	scanner := wings.NewInstallLogScanner(
+		a.config.Wings.InstallLogDir,
+		filepath.Join(a.config.Agent.DataDir, "install-failures.json"),
+	)
+
+	ticker := time.NewTicker(installFailureScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		failures, err := scanner.Scan()
+		if err != nil {
+			a.logger.WithError(err).Warn("Failed to scan Wings install logs")
+			continue
+		}
+		if len(failures) > 0 {
+			if err := a.makeRequest("POST", "/agent/install-failures", installFailureReport{Failures: failures}, nil); err != nil {
+				a.logger.WithError(err).Warn("Failed to report install failures")
+				continue
+			}
+			a.logger.WithField("count", len(failures)).Info("Reported server install failures")
+		}
+
+		if err := scanner.Commit(); err != nil {
+			a.logger.WithError(err).Warn("Failed to save install log scan state")
+		}
+	}
+}
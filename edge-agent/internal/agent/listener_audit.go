@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+// Processes expected to listen on any node. docker-proxy publishes the
+// game server allocations.
+var expectedListenerProcesses = []string{"sshd", "wings", "docker-proxy", "systemd-resolve", "chronyd"}
+
+// ListenerAudit is the outcome of the last listening socket audit.
+type ListenerAudit struct {
+	CheckedAt  time.Time         `json:"checked_at"`
+	Listeners  int               `json:"listeners"`
+	Unexpected []system.Listener `json:"unexpected,omitempty"`
+}
+
+type listenerAuditState struct {
+	mu       sync.Mutex
+	last     *ListenerAudit
+	reported map[string]bool
+}
+
+func (s *listenerAuditState) get() *ListenerAudit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// runListenerAuditLoop periodically compares the node's listening sockets
+// with what a Wings node is expected to run and alerts on the rest.
+func (a *Agent) runListenerAuditLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.ListenerAudit.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		a.auditListeners()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) auditListeners() {
+	listeners, err := system.Listeners()
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to enumerate listening sockets")
+		return
+	}
+
+	ports, processes := a.expectedListeners()
+	audit := &ListenerAudit{CheckedAt: time.Now().UTC(), Listeners: len(listeners)}
+	current := make(map[string]bool)
+	for _, l := range listeners {
+		if l.Loopback() && !a.config.ListenerAudit.IncludeLoopback {
+			continue
+		}
+		if ports[int(l.Port)] || processes[l.Process] || l.PID == int32(os.Getpid()) {
+			continue
+		}
+		audit.Unexpected = append(audit.Unexpected, l)
+		current[l.String()] = true
+	}
+
+	a.listenerAudit.mu.Lock()
+	var fresh []system.Listener
+	for _, l := range audit.Unexpected {
+		if !a.listenerAudit.reported[l.String()] {
+			fresh = append(fresh, l)
+		}
+	}
+	// Forget listeners that went away, so they alert again if they return.
+	a.listenerAudit.reported = current
+	a.listenerAudit.last = audit
+	a.listenerAudit.mu.Unlock()
+
+	for _, l := range fresh {
+		a.logger.WithFields(logrus.Fields{
+			"listener": l.String(),
+			"process":  l.Process,
+			"pid":      l.PID,
+		}).Warn("Unexpected listening socket")
+		a.events.Publish("alert", map[string]interface{}{
+			"source":   "listener_audit",
+			"message":  "unexpected listener " + l.String(),
+			"listener": l,
+		})
+		a.reportEvent("unexpected_listener", l)
+	}
+}
+
+// expectedListeners builds the baseline from the agent's and Wings'
+// configuration plus the operator's allow lists.
+func (a *Agent) expectedListeners() (map[int]bool, map[string]bool) {
+	cfg := a.config.ListenerAudit
+	ports := map[int]bool{22: true}
+	for _, p := range cfg.AllowedPorts {
+		ports[p] = true
+	}
+	if a.config.Honeypot.Enabled {
+		for _, p := range a.config.Honeypot.Ports {
+			ports[p] = true
+		}
+	}
+	if _, port, err := net.SplitHostPort(a.config.Agent.AdminListen); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			ports[p] = true
+		}
+	}
+	if wingsCfg, err := wings.LoadConfig(a.config.Wings.ConfigPath); err == nil {
+		ports[wingsCfg.API.Port] = true
+		ports[wingsCfg.SFTPPort()] = true
+	}
+
+	processes := make(map[string]bool)
+	for _, name := range append(expectedListenerProcesses, cfg.AllowedProcesses...) {
+		processes[name] = true
+	}
+	return ports, processes
+}
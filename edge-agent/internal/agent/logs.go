@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/logship"
+)
+
+// sendLogBatch ships log lines over the command channel. Streams only exist
+// while someone is watching in the panel, so there's no HTTP fallback.
+func (a *Agent) sendLogBatch(batch logship.Batch) error {
+	return a.sendOnChannel("agent:log_batch", batch)
+}
+
+// registerLogCommands lets operators follow Wings logs from the panel.
+func (a *Agent) registerLogCommands() {
+	a.commands.Register("start_log_stream", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req logship.Request
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+
+		switch req.Source {
+		case logship.SourceFile:
+			req.Path = a.config.Wings.LogPath
+		case logship.SourceJournal:
+			if req.Unit == "" {
+				req.Unit = a.config.Wings.SystemdUnit
+			}
+			if req.Unit != a.config.Wings.SystemdUnit && req.Unit != "docker.service" && req.Unit != a.config.Agent.SystemdUnit {
+				return nil, fmt.Errorf("unit %q is not available for log streaming", req.Unit)
+			}
+		}
+
+		// Streams outlive the command, tie them to the agent instead.
+		if err := a.logShipper.Start(a.ctx, req); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stream_id": req.StreamID}, nil
+	})
+
+	a.commands.Register("stop_log_stream", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req struct {
+			StreamID string `json:"stream_id"`
+		}
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		a.logShipper.Stop(req.StreamID)
+		return nil, nil
+	})
+}
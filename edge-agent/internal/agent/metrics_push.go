@@ -0,0 +1,61 @@
+package agent
+
+import "time"
+
+// MetricsSample is one reading of the system metrics, taken every
+// agent.metrics_interval.
+type MetricsSample struct {
+	Timestamp time.Time              `json:"timestamp"`
+	System    map[string]interface{} `json:"system"`
+}
+
+// MetricsBatch is what's POSTed to /agent/metrics every
+// metrics.flush_interval, oldest sample first.
+type MetricsBatch struct {
+	SessionID string          `json:"session_id"`
+	Samples   []MetricsSample `json:"samples"`
+}
+
+// runMetricsLoop samples metrics on their own cadence and sends them in
+// batches, so a fine metrics resolution doesn't need frequent heartbeats.
+// Heartbeats still carry a current reading. Samples the control plane
+// couldn't take are kept for the next flush, up to max_pending_samples.
+func (a *Agent) runMetricsLoop() {
+	sampleTicker := time.NewTicker(time.Duration(a.config.Agent.MetricsInterval) * time.Second)
+	defer sampleTicker.Stop()
+	flushTicker := time.NewTicker(time.Duration(a.config.Metrics.FlushInterval) * time.Second)
+	defer flushTicker.Stop()
+
+	var pending []MetricsSample
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case interval := <-a.metricsReset:
+			sampleTicker.Reset(interval)
+		case <-sampleTicker.C:
+			m, err := a.metrics.Collect()
+			if err != nil {
+				a.logger.WithError(err).Debug("Failed to collect metrics sample")
+				continue
+			}
+			pending = append(pending, MetricsSample{Timestamp: time.Now().UTC(), System: m})
+			if limit := a.config.Metrics.MaxPendingSamples; len(pending) > limit {
+				pending = pending[len(pending)-limit:]
+			}
+		case <-flushTicker.C:
+			if len(pending) == 0 {
+				continue
+			}
+			batch := MetricsBatch{SessionID: a.session.SessionID, Samples: pending}
+			if err := a.makeRequest("POST", "/agent/metrics", batch, nil); err != nil {
+				if bufferable(err) {
+					a.logger.WithError(err).WithField("samples", len(pending)).Debug("Failed to send metrics, keeping them for the next flush")
+					continue
+				}
+				a.logger.WithError(err).WithField("samples", len(pending)).Warn("Control plane rejected metrics batch, dropping it")
+			}
+			pending = nil
+		}
+	}
+}
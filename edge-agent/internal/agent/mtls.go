@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/certs"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+)
+
+const certRenewalCheckInterval = 6 * time.Hour
+
+type certificateRequest struct {
+	CSR string `json:"csr"`
+}
+
+type certificateResponse struct {
+	ClientCertificate string `json:"client_certificate"`
+}
+
+// certCommonName is the subject we ask the control plane to sign.
+func (a *Agent) certCommonName() string {
+	if a.config.Agent.NodeID != "" {
+		return a.config.Agent.NodeID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// renewCertificate requests a new client certificate for a fresh key. The
+// current certificate stays in use until the new one is installed.
+func (a *Agent) renewCertificate() error {
+	csrPEM, keyPEM, err := certs.NewCSR(a.certCommonName())
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	var resp certificateResponse
+	if err := a.makeRequest("POST", "/agent/certificate", certificateRequest{CSR: string(csrPEM)}, &resp); err != nil {
+		return fmt.Errorf("certificate request failed: %w", err)
+	}
+
+	release, err := a.locks.Acquire(a.ctx, "cert_renewal", locks.Certificates)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := a.certs.Install([]byte(resp.ClientCertificate), keyPEM); err != nil {
+		return err
+	}
+
+	a.logger.WithField("expires", a.certs.NotAfter()).Info("Client certificate renewed")
+	return nil
+}
+
+func (a *Agent) runCertRenewalLoop() {
+	renewBefore := time.Duration(a.config.ControlPlane.TLS.RenewBefore) * time.Hour
+
+	ticker := time.NewTicker(certRenewalCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		notAfter := a.certs.NotAfter()
+		if notAfter.IsZero() || time.Until(notAfter) < renewBefore {
+			if err := a.renewCertificate(); err != nil {
+				a.logger.WithError(err).Warn("Client certificate renewal failed")
+			}
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+// MTUProbe is the path MTU to one destination.
+type MTUProbe struct {
+	Target  string `json:"target"`
+	PathMTU int    `json:"path_mtu,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// MTUReport compares the MTUs the node sends with against what its paths
+// carry. A mismatch, say a 1500 byte interface on a provider's 1450 byte
+// overlay, stalls large packets while small ones pass, which shows up as
+// transfers that hang partway rather than fail outright.
+type MTUReport struct {
+	Interface    string     `json:"interface,omitempty"`
+	InterfaceMTU int        `json:"interface_mtu,omitempty"`
+	DockerMTU    int        `json:"docker_mtu,omitempty"`
+	Probes       []MTUProbe `json:"probes"`
+	Problems     []string   `json:"problems,omitempty"`
+	CheckedAt    time.Time  `json:"checked_at"`
+}
+
+type mtuState struct {
+	mu   sync.Mutex
+	last *MTUReport
+}
+
+func (s *mtuState) get() *MTUReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// swap stores the report and returns the previous one.
+func (s *mtuState) swap(report *MTUReport) *MTUReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.last
+	s.last = report
+	return prev
+}
+
+func (a *Agent) runMTULoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Network.MTUInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		a.checkMTU()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkMTU probes the control plane and the configured peers, and reports
+// problems when they differ from the last check.
+func (a *Agent) checkMTU() {
+	targets := append([]string{hostOf(a.controlPlanes.preferred())}, a.config.Network.MTUPeers...)
+	report := a.probeMTU(a.ctx, targets)
+	prev := a.mtu.swap(report)
+
+	if len(report.Problems) == 0 || (prev != nil && strings.Join(prev.Problems, "\n") == strings.Join(report.Problems, "\n")) {
+		return
+	}
+	a.logger.WithFields(logrus.Fields{"interface": report.Interface, "mtu": report.InterfaceMTU}).
+		Warnf("MTU mismatch: %s", strings.Join(report.Problems, "; "))
+	a.reportEvent("mtu_mismatch", report)
+}
+
+func (a *Agent) probeMTU(ctx context.Context, targets []string) *MTUReport {
+	report := &MTUReport{CheckedAt: time.Now().UTC()}
+
+	if name, err := system.DefaultRouteInterface(); err == nil {
+		if iface, err := net.InterfaceByName(name); err == nil {
+			report.Interface = name
+			report.InterfaceMTU = iface.MTU
+		}
+	}
+	if cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath); err == nil {
+		if state, err := a.wings.InspectNetwork(wings.NetworkSpecFromConfig(cfg)); err == nil && state.Exists {
+			report.DockerMTU = state.MTU
+			if report.DockerMTU == 0 {
+				report.DockerMTU = 1500 // Docker's default when the option isn't set
+			}
+		}
+	}
+
+	max := report.InterfaceMTU
+	if max == 0 {
+		max = 1500
+	}
+	smallest := 0
+	for _, target := range targets {
+		if target == "" {
+			continue
+		}
+		probe := MTUProbe{Target: target}
+		mtu, err := system.PathMTU(ctx, target, max)
+		switch {
+		case errors.Is(err, system.ErrNoICMP):
+			probe.Error = "no reply to ping, path MTU unknown"
+		case err != nil:
+			probe.Error = err.Error()
+		default:
+			probe.PathMTU = mtu
+			if smallest == 0 || mtu < smallest {
+				smallest = mtu
+			}
+			if mtu < max {
+				report.Problems = append(report.Problems, fmt.Sprintf(
+					"path to %s carries %d bytes but %s sends up to %d", target, mtu, report.Interface, max))
+			}
+		}
+		report.Probes = append(report.Probes, probe)
+	}
+
+	// Containers send at the bridge MTU. If that's above what the paths
+	// carry, Wings' network_mtu needs lowering even when the host is fine.
+	if smallest > 0 && report.DockerMTU > smallest {
+		report.Problems = append(report.Problems, fmt.Sprintf(
+			"Docker network MTU is %d, above the smallest path MTU of %d; set docker.network.network_mtu in Wings' config", report.DockerMTU, smallest))
+	}
+	return report
+}
+
+// registerMTUCommands lets the control plane probe arbitrary peers, e.g.
+// both ends of a planned transfer.
+func (a *Agent) registerMTUCommands() {
+	a.commands.Register("probe_mtu", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req struct {
+			Targets []string `json:"targets"`
+		}
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if len(req.Targets) == 0 {
+			return nil, fmt.Errorf("at least one target is required")
+		}
+		return a.probeMTU(ctx, req.Targets), nil
+	})
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
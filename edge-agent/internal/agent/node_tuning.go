@@ -0,0 +1,353 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/tuning"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// nodeTuningBaseline is what the node had before the agent tuned it. Each
+// setting is recorded the first time a profile changes it, so a revert
+// goes back past any number of profiles to the node's own settings.
+type nodeTuningBaseline struct {
+	path string
+
+	Profile       string                        `json:"profile,omitempty"` // last applied
+	AppliedAt     time.Time                     `json:"applied_at"`
+	Sysctls       map[string]string             `json:"sysctls,omitempty"`
+	SwapMB        *int                          `json:"swap_mb,omitempty"`
+	DockerUlimits map[string]wings.DockerUlimit `json:"docker_ulimits,omitempty"`
+	HasUlimits    bool                          `json:"has_docker_ulimits,omitempty"` // DockerUlimits was recorded, possibly as none
+}
+
+func loadNodeTuningBaseline(dataDir string) *nodeTuningBaseline {
+	b := &nodeTuningBaseline{path: filepath.Join(dataDir, "node-tuning.json")}
+	if data, err := os.ReadFile(b.path); err == nil {
+		json.Unmarshal(data, b)
+	}
+	if b.Sysctls == nil {
+		b.Sysctls = make(map[string]string)
+	}
+	return b
+}
+
+func (b *nodeTuningBaseline) empty() bool {
+	return len(b.Sysctls) == 0 && b.SwapMB == nil && !b.HasUlimits
+}
+
+func (b *nodeTuningBaseline) save() error {
+	if b.empty() {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0600)
+}
+
+// runNodeTuningTask applies a tuning profile from the control plane, or
+// reverts to the node's original settings. Settings already at the wanted
+// value are skipped. A dry run reports the changes and makes none.
+func (a *Agent) runNodeTuningTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.NodeTuningPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if err := validateNodeTuning(p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	baseline := loadNodeTuningBaseline(a.config.Agent.DataDir)
+	if !p.DryRun {
+		if err := tuning.Writable(nodeTuningPaths(p, baseline)...); err != nil {
+			return "", 1, err
+		}
+	}
+
+	var changes []string
+	var err error
+	if p.Revert {
+		changes, err = a.revertNodeTuning(ctx, baseline, p.DryRun)
+	} else {
+		changes, err = a.applyNodeTuning(ctx, baseline, p)
+	}
+
+	out := strings.Join(changes, "\n")
+	switch {
+	case len(changes) == 0:
+		out = "nothing to change"
+	case p.DryRun:
+		out = "dry run, would change:\n" + out
+	}
+	if !p.DryRun && len(changes) > 0 {
+		event := map[string]interface{}{"profile": p.Profile, "revert": p.Revert, "changes": changes}
+		if err != nil {
+			event["error"] = err.Error()
+		}
+		a.reportEvent("node_tuned", event)
+	}
+	if err != nil {
+		return out + "\n", 1, err
+	}
+	return out + "\n", 0, nil
+}
+
+// nodeTuningPaths is what applying p, or reverting to the baseline, writes
+// to on the host. Docker's daemon.json is left to setDockerUlimits.
+func nodeTuningPaths(p tasks.NodeTuningPayload, baseline *nodeTuningBaseline) []string {
+	if p.Revert {
+		names := make([]string, 0, len(baseline.Sysctls))
+		for name := range baseline.Sysctls {
+			names = append(names, name)
+		}
+		return tuning.Paths(names, baseline.SwapMB != nil)
+	}
+	var names []string
+	for name, value := range map[string]*int{"vm.swappiness": p.Swappiness, "net.core.somaxconn": p.Somaxconn, "fs.file-max": p.FileMax} {
+		if value != nil {
+			names = append(names, name)
+		}
+	}
+	return tuning.Paths(names, p.SwapMB != nil)
+}
+
+func validateNodeTuning(p tasks.NodeTuningPayload) error {
+	switch {
+	case p.SwapMB != nil && *p.SwapMB < 0:
+		return fmt.Errorf("swap_mb must not be negative")
+	case p.Swappiness != nil && (*p.Swappiness < 0 || *p.Swappiness > 200):
+		return fmt.Errorf("swappiness must be between 0 and 200")
+	case p.Somaxconn != nil && *p.Somaxconn <= 0:
+		return fmt.Errorf("somaxconn must be positive")
+	case p.FileMax != nil && *p.FileMax <= 0:
+		return fmt.Errorf("file_max must be positive")
+	}
+	for name, limit := range p.DockerUlimits {
+		if limit.Soft < 0 || limit.Hard < 0 || limit.Soft > limit.Hard {
+			return fmt.Errorf("docker ulimit %s: soft must be between 0 and hard", name)
+		}
+	}
+	return nil
+}
+
+// applyNodeTuning makes the profile's changes one setting at a time and
+// records the original of each before touching it, so whatever was done
+// before a failure can still be reverted.
+func (a *Agent) applyNodeTuning(ctx context.Context, baseline *nodeTuningBaseline, p tasks.NodeTuningPayload) ([]string, error) {
+	var changes []string
+	save := func() error {
+		baseline.Profile, baseline.AppliedAt = p.Profile, time.Now().UTC()
+		if err := baseline.save(); err != nil {
+			return fmt.Errorf("failed to record node tuning baseline: %w", err)
+		}
+		return nil
+	}
+
+	sysctls := []struct {
+		name  string
+		value *int
+	}{
+		{"vm.swappiness", p.Swappiness},
+		{"net.core.somaxconn", p.Somaxconn},
+		{"fs.file-max", p.FileMax},
+	}
+	for _, s := range sysctls {
+		if s.value == nil {
+			continue
+		}
+		current, err := tuning.Sysctl(s.name)
+		if err != nil {
+			return changes, err
+		}
+		want := strconv.Itoa(*s.value)
+		if current == want {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", s.name, current, want))
+		if p.DryRun {
+			continue
+		}
+		if _, ok := baseline.Sysctls[s.name]; !ok {
+			baseline.Sysctls[s.name] = current
+			if err := save(); err != nil {
+				return changes, err
+			}
+		}
+		if err := tuning.SetSysctl(s.name, want); err != nil {
+			return changes, err
+		}
+		if err := tuning.PersistSysctls(map[string]string{s.name: want}); err != nil {
+			return changes, err
+		}
+	}
+
+	if p.SwapMB != nil {
+		current, err := tuning.SwapFileMB()
+		if err != nil {
+			return changes, err
+		}
+		if current != *p.SwapMB {
+			changes = append(changes, fmt.Sprintf("%s: %d MiB -> %d MiB", tuning.SwapFile, current, *p.SwapMB))
+			if !p.DryRun {
+				if baseline.SwapMB == nil {
+					baseline.SwapMB = &current
+					if err := save(); err != nil {
+						return changes, err
+					}
+				}
+				if err := tuning.ResizeSwapFile(ctx, *p.SwapMB); err != nil {
+					return changes, fmt.Errorf("failed to resize swapfile: %w", err)
+				}
+			}
+		}
+	}
+
+	if p.DockerUlimits != nil {
+		want := make(map[string]wings.DockerUlimit, len(p.DockerUlimits))
+		for name, limit := range p.DockerUlimits {
+			want[name] = wings.DockerUlimit{Name: name, Soft: limit.Soft, Hard: limit.Hard}
+		}
+		current, err := a.wings.DockerDefaultUlimits()
+		if err != nil {
+			return changes, err
+		}
+		if formatUlimits(current) != formatUlimits(want) {
+			changes = append(changes, fmt.Sprintf("docker default-ulimits: %s -> %s (restarts Docker and Wings)", formatUlimits(current), formatUlimits(want)))
+			if !p.DryRun {
+				if !baseline.HasUlimits {
+					baseline.DockerUlimits, baseline.HasUlimits = current, true
+					if err := save(); err != nil {
+						return changes, err
+					}
+				}
+				if err := a.setDockerUlimits(ctx, want); err != nil {
+					return changes, err
+				}
+			}
+		}
+	}
+
+	if !p.DryRun && len(changes) > 0 {
+		return changes, save()
+	}
+	return changes, nil
+}
+
+// revertNodeTuning puts back every setting in the baseline and forgets
+// each as it's restored.
+func (a *Agent) revertNodeTuning(ctx context.Context, baseline *nodeTuningBaseline, dryRun bool) ([]string, error) {
+	var changes []string
+
+	names := make([]string, 0, len(baseline.Sysctls))
+	for name := range baseline.Sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		original := baseline.Sysctls[name]
+		current, err := tuning.Sysctl(name)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, current, original))
+		if dryRun {
+			continue
+		}
+		if err := tuning.SetSysctl(name, original); err != nil {
+			return changes, err
+		}
+		if err := tuning.PersistSysctls(map[string]string{name: ""}); err != nil {
+			return changes, err
+		}
+		delete(baseline.Sysctls, name)
+		if err := baseline.save(); err != nil {
+			return changes, err
+		}
+	}
+
+	if baseline.SwapMB != nil {
+		current, err := tuning.SwapFileMB()
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("%s: %d MiB -> %d MiB", tuning.SwapFile, current, *baseline.SwapMB))
+		if !dryRun {
+			if current != *baseline.SwapMB {
+				if err := tuning.ResizeSwapFile(ctx, *baseline.SwapMB); err != nil {
+					return changes, fmt.Errorf("failed to resize swapfile: %w", err)
+				}
+			}
+			baseline.SwapMB = nil
+			if err := baseline.save(); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	if baseline.HasUlimits {
+		current, err := a.wings.DockerDefaultUlimits()
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("docker default-ulimits: %s -> %s (restarts Docker and Wings)", formatUlimits(current), formatUlimits(baseline.DockerUlimits)))
+		if !dryRun {
+			original := baseline.DockerUlimits
+			if original == nil {
+				original = map[string]wings.DockerUlimit{}
+			}
+			if err := a.setDockerUlimits(ctx, original); err != nil {
+				return changes, err
+			}
+			baseline.DockerUlimits, baseline.HasUlimits = nil, false
+			if err := baseline.save(); err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// setDockerUlimits rewrites daemon.json, which restarts Docker and Wings
+// along with it.
+func (a *Agent) setDockerUlimits(ctx context.Context, ulimits map[string]wings.DockerUlimit) error {
+	release, err := a.locks.Acquire(ctx, "node_tuning", locks.WingsService, locks.Docker)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := a.wings.ConfigureDocker(wings.DockerDaemonSpec{DefaultUlimits: ulimits}); err != nil {
+		return fmt.Errorf("failed to set Docker ulimits: %w", err)
+	}
+	return nil
+}
+
+func formatUlimits(ulimits map[string]wings.DockerUlimit) string {
+	if len(ulimits) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(ulimits))
+	for name := range ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d:%d", name, ulimits[name].Soft, ulimits[name].Hard)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/signing"
+	"github.com/sirupsen/logrus"
+)
+
+const signingKeyCheckInterval = time.Hour
+
+// signedEndpoints are the requests sent with an X-Agent-Signature header:
+// the node's reports, and key rotations, which the outgoing key vouches for.
+var signedEndpoints = map[string]bool{
+	"/agent/heartbeat":       true,
+	"/agent/events":          true,
+	"/agent/security-events": true,
+	"/agent/signing-key":     true,
+}
+
+type signingKeyRegistration struct {
+	Key           *signing.JWK `json:"key"`
+	PreviousKeyID string       `json:"previous_key_id,omitempty"`
+	Reason        string       `json:"reason"`
+	Proof         string       `json:"proof"` // the node ID signed with the new key
+}
+
+type signingState struct {
+	mu       sync.Mutex
+	rotating sync.Mutex // held through a rotation
+	path     string
+	key      *signing.Key
+}
+
+// loadSigningState picks up the saved key. Without a usable one the node
+// registers a new key, see runSigningKeyLoop.
+func loadSigningState(dataDir string) *signingState {
+	s := &signingState{path: filepath.Join(dataDir, "signing-key.pem")}
+	if key, err := signing.Load(s.path); err == nil {
+		s.key = key
+	}
+	return s
+}
+
+func (s *signingState) get() *signing.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key
+}
+
+// set switches to key and saves it. The key is used even if it can't be
+// saved: the control plane already has it.
+func (s *signingState) set(key *signing.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+	return key.Save(s.path)
+}
+
+// signPayload returns the detached JWS for a request body, or nothing
+// before the node has a key.
+func (a *Agent) signPayload(payload []byte) string {
+	key := a.signer.get()
+	if key == nil {
+		return ""
+	}
+	signature, err := key.Sign(payload)
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to sign payload")
+		return ""
+	}
+	return signature
+}
+
+// enrollmentSigningKey makes the key an enrollment registers. It is only
+// put to use once the enrollment went through.
+func (a *Agent) enrollmentSigningKey() (*signing.Key, error) {
+	key, err := signing.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	return key, nil
+}
+
+func (a *Agent) installSigningKey(key *signing.Key) {
+	if err := a.signer.set(key); err != nil {
+		a.logger.WithError(err).Warn("Failed to save payload signing key, it will be replaced after a restart")
+	}
+}
+
+// rotateSigningKey registers a new key, signed with the current one, and
+// switches to it. The control plane should keep accepting the previous key
+// for a little while: reports already in flight were signed with it.
+func (a *Agent) rotateSigningKey(reason string) (*signing.Key, error) {
+	a.signer.rotating.Lock()
+	defer a.signer.rotating.Unlock()
+
+	next, err := signing.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	proof, err := next.Sign([]byte(a.config.Agent.NodeID))
+	if err != nil {
+		return nil, err
+	}
+	req := signingKeyRegistration{Key: next.PublicJWK(), Reason: reason, Proof: proof}
+	previous := a.signer.get()
+	if previous != nil {
+		req.PreviousKeyID = previous.ID
+	}
+
+	if err := a.makeRequest("POST", "/agent/signing-key", req, nil); err != nil {
+		return nil, fmt.Errorf("failed to register signing key: %w", err)
+	}
+	a.installSigningKey(next)
+
+	a.logger.WithFields(logrus.Fields{"key_id": next.ID, "reason": reason}).Info("Rotated payload signing key")
+	a.reportEvent("signing_key_rotated", map[string]string{
+		"key_id":          next.ID,
+		"previous_key_id": req.PreviousKeyID,
+		"reason":          reason,
+	})
+	return next, nil
+}
+
+func (a *Agent) registerSigningCommands() {
+	a.commands.Register("rotate_signing_key", func(ctx context.Context, cmd Command) (interface{}, error) {
+		key, err := a.rotateSigningKey("command")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"key_id": key.ID}, nil
+	})
+}
+
+// runSigningKeyLoop registers a key for nodes enrolled before payloads
+// were signed, and rotates the key once it reaches
+// control_plane.signing_key_lifetime.
+func (a *Agent) runSigningKeyLoop() {
+	ticker := time.NewTicker(signingKeyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if a.config.Agent.NodeID != "" {
+			key := a.signer.get()
+			lifetime := time.Duration(a.config.ControlPlane.SigningKeyLifetime) * 24 * time.Hour
+			reason := ""
+			switch {
+			case key == nil:
+				reason = "initial"
+			case lifetime > 0 && !key.CreatedAt.IsZero() && time.Since(key.CreatedAt) > lifetime:
+				reason = "scheduled"
+			}
+			if reason != "" {
+				if _, err := a.rotateSigningKey(reason); err != nil {
+					a.logger.WithError(err).Warn("Failed to rotate payload signing key")
+				}
+			}
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
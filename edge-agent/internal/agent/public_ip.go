@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+)
+
+// PublicIPReport is how the node's public address was worked out. Both
+// values are sent, so the panel can flag a static override that no longer
+// matches what the node is seen as.
+type PublicIPReport struct {
+	Address    string            `json:"address"`              // what the node enrolls with
+	Configured string            `json:"configured,omitempty"` // agent.public_ip
+	Detected   string            `json:"detected,omitempty"`
+	Strategy   string            `json:"strategy,omitempty"` // the one that found Detected
+	Errors     map[string]string `json:"errors,omitempty"`   // strategies that came up empty, and why
+}
+
+type publicIPEcho struct {
+	IP string `json:"ip"`
+}
+
+// detectPublicIP runs agent.public_ip_strategies in order until one finds
+// an address:
+//
+//   - interface: a public address bound to the node, not there behind NAT
+//   - control_plane: the address the control plane sees requests from
+//   - stun: the address UDP traffic leaves from, as game traffic does
+//   - resolver: agent.public_ip_resolver over HTTP
+//
+// agent.public_ip, when set, is used over whatever was detected.
+func (a *Agent) detectPublicIP(ifaces []system.Interface) PublicIPReport {
+	report := PublicIPReport{Configured: a.config.Agent.PublicIP, Errors: map[string]string{}}
+
+	for _, strategy := range a.config.Agent.PublicIPStrategies {
+		ip, err := a.publicIPFrom(strategy, ifaces)
+		if err != nil {
+			report.Errors[strategy] = err.Error()
+			continue
+		}
+		if parsed := net.ParseIP(ip); parsed == nil || !parsed.IsGlobalUnicast() || parsed.IsPrivate() {
+			report.Errors[strategy] = fmt.Sprintf("%q is not a public address", ip)
+			continue
+		}
+		report.Detected, report.Strategy = ip, strategy
+		break
+	}
+	if len(report.Errors) == 0 {
+		report.Errors = nil
+	}
+
+	report.Address = report.Detected
+	if report.Configured != "" {
+		report.Address = report.Configured
+	}
+	if report.Address == "" {
+		a.logger.WithField("errors", report.Errors).Warn("Failed to determine public IP")
+	}
+	return report
+}
+
+func (a *Agent) publicIPFrom(strategy string, ifaces []system.Interface) (string, error) {
+	switch strategy {
+	case "interface":
+		if _, public := system.LocalAddresses(ifaces); public != "" {
+			return public, nil
+		}
+		return "", fmt.Errorf("no interface has a public IPv4 address")
+	case "control_plane":
+		var echo publicIPEcho
+		if err := a.makeRequest("GET", "/agent/ip", nil, &echo); err != nil {
+			return "", err
+		}
+		return echo.IP, nil
+	case "stun":
+		return system.LookupPublicIPSTUN(a.ctx, a.config.Agent.STUNServer)
+	case "resolver":
+		if a.config.Agent.PublicIPResolver == "none" {
+			return "", fmt.Errorf("public_ip_resolver is none")
+		}
+		return system.LookupPublicIP(a.ctx, a.config.Agent.PublicIPResolver)
+	}
+	return "", fmt.Errorf("unknown strategy")
+}
+
+func (a *Agent) registerPublicIPCommands() {
+	a.commands.Register("detect_public_ip", func(ctx context.Context, cmd Command) (interface{}, error) {
+		ifaces, err := system.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		return a.detectPublicIP(ifaces), nil
+	})
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Reload re-reads the config file and applies the settings that can change
+// at runtime: intervals, logging, control plane URLs and permissions.
+// Everything else needs a restart and is left as it was.
+func (a *Agent) Reload() error {
+	cfg, err := config.Load(a.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	var changed []string
+
+	// The command line level wins until the config actually changes it.
+	if cfg.Agent.LogLevel != a.config.Agent.LogLevel {
+		level, err := logrus.ParseLevel(cfg.Agent.LogLevel)
+		if err != nil {
+			return err
+		}
+		logging.SetLevel(level)
+		a.config.Agent.LogLevel = cfg.Agent.LogLevel
+		changed = append(changed, "log_level")
+	}
+
+	if !reflect.DeepEqual(cfg.Logging, a.config.Logging) {
+		if err := logging.Configure(cfg.Logging); err != nil {
+			return err
+		}
+		a.config.Logging = cfg.Logging
+		changed = append(changed, "logging")
+	}
+
+	if cfg.Agent.HeartbeatInterval != a.config.Agent.HeartbeatInterval {
+		a.config.Agent.HeartbeatInterval = cfg.Agent.HeartbeatInterval
+		select {
+		case a.heartbeatReset <- time.Duration(cfg.Agent.HeartbeatInterval) * time.Second:
+		default:
+		}
+		changed = append(changed, "heartbeat_interval")
+	}
+
+	if cfg.Agent.MetricsInterval != a.config.Agent.MetricsInterval {
+		a.config.Agent.MetricsInterval = cfg.Agent.MetricsInterval
+		select {
+		case a.metricsReset <- time.Duration(cfg.Agent.MetricsInterval) * time.Second:
+		default:
+		}
+		changed = append(changed, "metrics_interval")
+	}
+
+	old := a.config.ControlPlane
+	if !sameStrings(cfg.ControlPlane.Endpoints(), old.Endpoints()) ||
+		cfg.ControlPlane.FailoverStrategy != old.FailoverStrategy ||
+		cfg.ControlPlane.FailoverCooldown != old.FailoverCooldown {
+		a.tokenMu.Lock()
+		a.config.ControlPlane.URL = cfg.ControlPlane.URL
+		a.config.ControlPlane.URLs = cfg.ControlPlane.URLs
+		a.config.ControlPlane.FailoverStrategy = cfg.ControlPlane.FailoverStrategy
+		a.config.ControlPlane.FailoverCooldown = cfg.ControlPlane.FailoverCooldown
+		a.tokenMu.Unlock()
+
+		a.controlPlanes.reset(cfg.ControlPlane)
+		// Reconnect so the command channel moves to the new endpoint too.
+		a.dropCommandChannel()
+		changed = append(changed, "control_plane")
+	}
+
+	if !sameStrings(cfg.Permissions.Commands, a.config.Permissions.Commands) ||
+		!sameStrings(cfg.Permissions.Tasks, a.config.Permissions.Tasks) {
+		a.config.Permissions = cfg.Permissions
+		a.commands.Allow(cfg.Permissions.Commands)
+		a.tasks.Allow(cfg.Permissions.Tasks)
+		// Reconnect to advertise the new capabilities.
+		a.dropCommandChannel()
+		changed = append(changed, "permissions")
+	}
+
+	if cfg.FailureDomain != a.config.FailureDomain {
+		a.config.FailureDomain = cfg.FailureDomain
+		// The scheduler should see the move before the next heartbeat.
+		go a.sendHeartbeat()
+		changed = append(changed, "failure_domain")
+	}
+
+	if !sameLabels(cfg.Agent.Labels, a.config.Agent.Labels) {
+		a.config.Agent.Labels = cfg.Agent.Labels
+		go a.sendHeartbeat()
+		changed = append(changed, "labels")
+	}
+
+	a.logger.WithField("changed", changed).Info("Configuration reloaded")
+	if len(changed) > 0 {
+		a.reportEvent("config_reloaded", map[string]interface{}{"changed": changed})
+	}
+	return nil
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+)
+
+// cachedResource is a control plane response kept with its ETag. Passed as
+// the response to doRequest, it makes the request conditional.
+type cachedResource struct {
+	Endpoint string          `json:"endpoint"`
+	ETag     string          `json:"etag"`
+	Body     json.RawMessage `json:"body"`
+
+	notModified bool
+}
+
+// responseCache keeps rarely changing control plane resources on disk, so
+// large fleets don't download them again every cycle or after a restart.
+type responseCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]cachedResource
+	hits    int64
+	misses  int64
+}
+
+func newResponseCache(dir string) *responseCache {
+	return &responseCache{
+		dir:     dir,
+		entries: make(map[string]cachedResource),
+	}
+}
+
+func (c *responseCache) path(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (c *responseCache) get(endpoint string) cachedResource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[endpoint]; ok {
+		return entry
+	}
+	entry := cachedResource{Endpoint: endpoint}
+	if data, err := os.ReadFile(c.path(endpoint)); err == nil {
+		var stored cachedResource
+		// Guard against a hash collision handing back another resource.
+		if json.Unmarshal(data, &stored) == nil && stored.Endpoint == endpoint {
+			entry = stored
+		}
+	}
+	c.entries[endpoint] = entry
+	return entry
+}
+
+func (c *responseCache) put(entry cachedResource) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[entry.Endpoint] = entry
+	if entry.ETag == "" {
+		os.Remove(c.path(entry.Endpoint))
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	path := c.path(entry.Endpoint)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (c *responseCache) status() api.ResponseCacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return api.ResponseCacheStatus{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+func (c *responseCache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+// getCached fetches a resource with If-None-Match and decodes the cached
+// copy when the control plane answers 304 Not Modified. Only use it for
+// resources the control plane serves with an ETag.
+func (a *Agent) getCached(endpoint string, response interface{}) error {
+	entry := a.responseCache.get(endpoint)
+	if err := a.makeRequest("GET", endpoint, nil, &entry); err != nil {
+		return err
+	}
+
+	a.responseCache.count(entry.notModified)
+	if !entry.notModified {
+		if err := a.responseCache.put(entry); err != nil {
+			a.logger.WithError(err).WithField("endpoint", endpoint).Debug("Failed to cache control plane response")
+		}
+	}
+	if len(entry.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(entry.Body, response)
+}
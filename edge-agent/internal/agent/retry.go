@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRetries     = 3
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+
+	// A control plane asking for a longer pause is better served by the
+	// caller's own loop than by holding the request open.
+	maxRetryAfter = time.Minute
+)
+
+var errNoControlPlane = errors.New("no control plane URL configured")
+
+// retryDelay decides whether a failed request is worth repeating and how
+// long to wait first. Server errors and network failures are only retried
+// for idempotent methods, since a POST may have been applied before the
+// connection dropped. A 429 means the request wasn't processed at all, so
+// it's retried for any method, after Retry-After if the control plane sent
+// one.
+func retryDelay(method string, err error, attempt int) (time.Duration, bool) {
+	if err == nil || attempt >= maxRetries || errors.Is(err, errNoControlPlane) {
+		return 0, false
+	}
+
+	if httpErr, ok := err.(*httpError); ok {
+		if httpErr.StatusCode == http.StatusTooManyRequests {
+			if httpErr.RetryAfter > 0 {
+				if httpErr.RetryAfter > maxRetryAfter {
+					return 0, false
+				}
+				return httpErr.RetryAfter, true
+			}
+			return backoff(attempt), true
+		}
+		if httpErr.StatusCode < 500 {
+			return 0, false
+		}
+	}
+
+	if !idempotent(method) {
+		return 0, false
+	}
+	return backoff(attempt), true
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the delay per attempt up to retryMaxDelay, then picks a
+// random point in its upper half so agents that failed together don't all
+// retry together.
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << uint(attempt)
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds or an
+// HTTP date. It returns 0 when the header is missing or unusable.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+const serverPowerPoll = 5 * time.Second
+
+// serverPowerTargets is the state each action should leave a server in.
+var serverPowerTargets = map[string]string{
+	"start":   "running",
+	"restart": "running",
+	"stop":    "offline",
+	"kill":    "offline",
+}
+
+type serverPowerEvent struct {
+	TaskID      string `json:"task_id"`
+	Server      string `json:"server"`
+	Action      string `json:"action"`
+	Reason      string `json:"reason,omitempty"`
+	Status      string `json:"status"`
+	State       string `json:"state,omitempty"`
+	Error       string `json:"error,omitempty"`
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// runServerPowerTask sends a power action to game servers through Wings,
+// so capacity can follow a plan: a schedule entry starting the tournament
+// servers before the event and another stopping them after. With Wait set
+// each server must reach its target state in time to count as a success.
+func (a *Agent) runServerPowerTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.ServerPowerPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	target, ok := serverPowerTargets[p.Action]
+	if !ok {
+		return "", -1, fmt.Errorf("unsupported power action %q", p.Action)
+	}
+	if len(p.Servers) == 0 {
+		return "", -1, fmt.Errorf("no servers given")
+	}
+	if target == "running" && a.drain.get().State != DrainActive {
+		return "", 1, fmt.Errorf("node is draining, not starting servers")
+	}
+
+	var out strings.Builder
+	report := func(server, status, state string, err error) {
+		ev := serverPowerEvent{TaskID: task.ID, Server: server, Action: p.Action, Reason: p.Reason, Status: status, State: state, RequestedBy: task.RequestedBy}
+		if err != nil {
+			ev.Error = err.Error()
+			fmt.Fprintf(&out, "%s: %s: %v\n", server, status, err)
+		} else {
+			fmt.Fprintf(&out, "%s: %s\n", server, status)
+		}
+		a.reportEvent("server_power", ev)
+	}
+
+	pending := make(map[string]bool)
+	failed := 0
+	for _, server := range p.Servers {
+		if err := a.wingsAPI.Power(server, p.Action); err != nil {
+			report(server, tasks.StatusFailed, "", err)
+			failed++
+			continue
+		}
+		if p.Wait <= 0 {
+			report(server, tasks.StatusSucceeded, "", nil)
+			continue
+		}
+		pending[server] = true
+	}
+
+	if len(pending) > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, time.Duration(p.Wait)*time.Second)
+		defer cancel()
+
+		states := make(map[string]string)
+		ticker := time.NewTicker(serverPowerPoll)
+		defer ticker.Stop()
+		for len(pending) > 0 {
+			select {
+			case <-waitCtx.Done():
+				for server := range pending {
+					report(server, tasks.StatusTimedOut, states[server], fmt.Errorf("not %s after %ds", target, p.Wait))
+					failed++
+				}
+				pending = nil
+				continue
+			case <-ticker.C:
+			}
+
+			servers, err := a.wingsAPI.Servers()
+			if err != nil {
+				a.logger.WithError(err).Warn("Failed to list servers")
+				continue
+			}
+			for _, s := range servers {
+				if !pending[s.UUID] {
+					continue
+				}
+				states[s.UUID] = s.State
+				if s.State == target {
+					report(s.UUID, tasks.StatusSucceeded, s.State, nil)
+					delete(pending, s.UUID)
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		return out.String(), 1, fmt.Errorf("%d of %d servers failed to %s", failed, len(p.Servers), p.Action)
+	}
+	return out.String(), 0, nil
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SessionInfo identifies one run of the agent process. It is attached to all
+// telemetry so the control plane can tell restarts apart, and whether the
+// previous run ended with a clean shutdown or a crash.
+type SessionInfo struct {
+	SessionID         string    `json:"session_id"`
+	StartedAt         time.Time `json:"started_at"`
+	BootID            string    `json:"boot_id,omitempty"` // kernel boot, changes on host reboot
+	PreviousSessionID string    `json:"previous_session_id,omitempty"`
+	PreviousShutdown  string    `json:"previous_shutdown,omitempty"` // "clean" or "unclean"
+}
+
+type sessionState struct {
+	SessionID     string    `json:"session_id"`
+	StartedAt     time.Time `json:"started_at"`
+	AgentVersion  string    `json:"agent_version"`
+	CleanShutdown bool      `json:"clean_shutdown"`
+}
+
+func newSessionID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func readBootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (a *Agent) sessionPath() string {
+	return filepath.Join(a.config.Agent.DataDir, "session.json")
+}
+
+// beginSession records the new session and notes how the previous one ended.
+func (a *Agent) beginSession() {
+	var prev sessionState
+	if data, err := os.ReadFile(a.sessionPath()); err == nil && json.Unmarshal(data, &prev) == nil && prev.SessionID != "" {
+		a.session.PreviousSessionID = prev.SessionID
+		a.session.PreviousShutdown = "unclean"
+		if prev.CleanShutdown {
+			a.session.PreviousShutdown = "clean"
+		}
+	}
+
+	if err := a.writeSessionState(false); err != nil {
+		a.logger.WithError(err).Warn("Failed to record agent session")
+	}
+
+	if prev.AgentVersion != "" && prev.AgentVersion != Version {
+		a.reportEvent("update_applied", map[string]string{"from": prev.AgentVersion, "to": Version})
+	}
+
+	if a.session.PreviousShutdown == "unclean" {
+		a.logger.WithField("previous_session", a.session.PreviousSessionID).Warn("Previous agent session did not shut down cleanly")
+	}
+}
+
+// endSession marks the session as cleanly shut down.
+func (a *Agent) endSession() {
+	if err := a.writeSessionState(true); err != nil {
+		a.logger.WithError(err).Warn("Failed to record clean shutdown")
+	}
+}
+
+func (a *Agent) writeSessionState(clean bool) error {
+	data, err := json.Marshal(sessionState{
+		SessionID:     a.session.SessionID,
+		StartedAt:     a.session.StartedAt,
+		AgentVersion:  Version,
+		CleanShutdown: clean,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := a.sessionPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.sessionPath())
+}
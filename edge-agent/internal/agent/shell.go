@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/shell"
+)
+
+type shellInput struct {
+	SessionID string `json:"session_id"`
+	Data      []byte `json:"data,omitempty"`
+	Rows      uint16 `json:"rows,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+}
+
+func (a *Agent) newShellManager() *shell.Manager {
+	if !a.config.Shell.Enabled {
+		return nil
+	}
+	return shell.New(a.config.Shell, filepath.Join(a.config.Agent.DataDir, "shell-sessions"), a.sendShellOutput, a.reportEvent, a.logger)
+}
+
+func (a *Agent) sendShellOutput(out shell.Output) error {
+	return a.sendOnChannel("agent:shell_output", out)
+}
+
+// handleShellEvent takes keystrokes and resizes straight off the command
+// channel, without the command round trip, so typing stays responsive.
+func (a *Agent) handleShellEvent(event string, data json.RawMessage) {
+	if a.shells == nil {
+		return
+	}
+	var in shellInput
+	if err := json.Unmarshal(data, &in); err != nil {
+		a.logger.WithError(err).Warn("Received malformed shell event")
+		return
+	}
+
+	var err error
+	switch event {
+	case "agent:shell_input":
+		err = a.shells.Input(in.SessionID, in.Data)
+	case "agent:shell_resize":
+		err = a.shells.Resize(in.SessionID, in.Rows, in.Cols)
+	}
+	if err != nil {
+		a.logger.WithError(err).WithField("session_id", in.SessionID).Debug("Shell event failed")
+	}
+}
+
+// registerShellCommands lets allowlisted control plane users open a
+// terminal on the node. Nothing is registered unless shell.enabled is set.
+func (a *Agent) registerShellCommands() {
+	if a.shells == nil {
+		return
+	}
+
+	a.commands.Register("open_shell", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req shell.Request
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if req.SessionID == "" {
+			req.SessionID = cmd.ID
+		}
+		// Sessions outlive the command, tie them to the agent instead.
+		return a.shells.Open(a.ctx, req)
+	})
+
+	a.commands.Register("close_shell", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req shellInput
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		return nil, a.shells.Close(req.SessionID)
+	})
+
+	a.commands.Register("list_shells", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return a.shells.Sessions(), nil
+	})
+}
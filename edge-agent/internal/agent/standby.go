@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+)
+
+// Upper bound for one image pull, so a stuck registry can't hold up the
+// rest of the list.
+const standbyPullTimeout = 30 * time.Minute
+
+// standbyState is kept in DataDir like drainState. A nil status means the
+// node isn't in standby.
+type standbyState struct {
+	mu     sync.Mutex
+	path   string
+	status *api.StandbyStatus
+	pull   chan struct{}
+}
+
+func loadStandbyState(dataDir string) *standbyState {
+	s := &standbyState{
+		path: filepath.Join(dataDir, "standby.json"),
+		pull: make(chan struct{}, 1),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		var status api.StandbyStatus
+		if json.Unmarshal(data, &status) == nil {
+			s.status = &status
+		}
+	}
+	return s
+}
+
+// get returns a copy of the status, or nil when not in standby.
+func (s *standbyState) get() *api.StandbyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == nil {
+		return nil
+	}
+	status := *s.status
+	status.Images = make(map[string]string, len(s.status.Images))
+	for image, err := range s.status.Images {
+		status.Images[image] = err
+	}
+	return &status
+}
+
+// save writes the status, or removes the file when leaving standby. Callers
+// hold mu.
+func (s *standbyState) save() error {
+	if s.status == nil {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(s.status)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// schedulable is what the control plane uses to decide whether new servers
+// may be placed on the node.
+func (a *Agent) schedulable() bool {
+	return a.drain.get().State == DrainActive && a.standby.get() == nil
+}
+
+// registerStandbyCommands adds standby and activate. A node in standby keeps
+// Wings installed and the given images pulled but reports itself
+// unschedulable, so it can take servers moments after activation.
+func (a *Agent) registerStandbyCommands() {
+	a.commands.Register("standby", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var req struct {
+			Images []string `json:"images"`
+		}
+		if len(cmd.Payload) > 0 {
+			if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+				return nil, fmt.Errorf("invalid payload: %w", err)
+			}
+		}
+
+		a.standby.mu.Lock()
+		previous := a.standby.status
+		status := &api.StandbyStatus{
+			Since:          time.Now().UTC(),
+			Images:         make(map[string]string, len(req.Images)),
+			WingsInstalled: a.wings.Installed(),
+		}
+		if previous != nil {
+			// Already in standby, this only changes the image list.
+			status.Since = previous.Since
+			status.LastPull = previous.LastPull
+		}
+		for _, image := range req.Images {
+			status.Images[image] = "not pulled yet"
+			if previous != nil {
+				if err, ok := previous.Images[image]; ok {
+					status.Images[image] = err
+				}
+			}
+		}
+		a.standby.status = status
+		err := a.standby.save()
+		a.standby.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to save standby state: %w", err)
+		}
+
+		if previous == nil {
+			a.logger.WithField("images", len(req.Images)).Info("Node entering warm standby")
+			a.reportEvent("node_standby", status)
+			go a.sendHeartbeat()
+		}
+		a.pullStandbyImagesSoon()
+		return a.standby.get(), nil
+	})
+
+	a.commands.Register("activate", func(ctx context.Context, cmd Command) (interface{}, error) {
+		a.standby.mu.Lock()
+		was := a.standby.status
+		a.standby.status = nil
+		err := a.standby.save()
+		a.standby.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to save standby state: %w", err)
+		}
+		if was == nil {
+			return map[string]bool{"schedulable": a.schedulable()}, nil
+		}
+
+		// Wings normally runs throughout standby, but make sure before the
+		// control plane starts placing servers.
+		if !a.wings.IsActive() {
+			if err := a.restartWings("activation"); err != nil {
+				a.logger.WithError(err).Warn("Wings didn't start on activation")
+			}
+		}
+
+		a.logger.WithField("standby_since", was.Since).Info("Node activated from standby")
+		a.reportEvent("node_activated", map[string]interface{}{
+			"standby_since": was.Since,
+			"wings_active":  a.wings.IsActive(),
+		})
+		go a.sendHeartbeat()
+		return map[string]bool{"schedulable": a.schedulable()}, nil
+	})
+}
+
+func (a *Agent) pullStandbyImagesSoon() {
+	select {
+	case a.standby.pull <- struct{}{}:
+	default:
+	}
+}
+
+// runStandbyLoop refreshes the standby images so tags that move, like a
+// yolk rebuilt upstream, are still current when the node is activated.
+func (a *Agent) runStandbyLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Standby.PullInterval) * time.Second)
+	defer ticker.Stop()
+
+	// Catch up after a restart during standby.
+	a.pullStandbyImagesSoon()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.standby.pull:
+		}
+
+		status := a.standby.get()
+		if status == nil {
+			continue
+		}
+		a.pullStandbyImages(status)
+	}
+}
+
+func (a *Agent) pullStandbyImages(status *api.StandbyStatus) {
+	results := make(map[string]string, len(status.Images))
+	for image := range status.Images {
+		ctx, cancel := context.WithTimeout(a.ctx, standbyPullTimeout)
+		err := a.wings.PullImage(ctx, image)
+		cancel()
+		if a.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			a.logger.WithError(err).WithField("image", image).Warn("Failed to pull standby image")
+			results[image] = err.Error()
+			continue
+		}
+		results[image] = ""
+	}
+
+	a.standby.mu.Lock()
+	defer a.standby.mu.Unlock()
+
+	// Activated (and perhaps put back in standby) while pulling. Images
+	// dropped from the list in the meantime are skipped below.
+	if a.standby.status == nil || !a.standby.status.Since.Equal(status.Since) {
+		return
+	}
+	for image, err := range results {
+		if _, ok := a.standby.status.Images[image]; ok {
+			a.standby.status.Images[image] = err
+		}
+	}
+	a.standby.status.LastPull = time.Now().UTC()
+	a.standby.status.WingsInstalled = a.wings.Installed()
+	if err := a.standby.save(); err != nil {
+		a.logger.WithError(err).Warn("Failed to save standby state")
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/api"
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+)
+
+const recentAlerts = 20
+
+// alertLog keeps the latest alerts for the status page; the control plane
+// has the full history.
+type alertLog struct {
+	mu     sync.Mutex
+	alerts []events.Event
+}
+
+func (l *alertLog) add(e events.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.alerts = append(l.alerts, e)
+	if len(l.alerts) > recentAlerts {
+		l.alerts = l.alerts[len(l.alerts)-recentAlerts:]
+	}
+}
+
+// newest returns the alerts, newest first.
+func (l *alertLog) newest() []events.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]events.Event, 0, len(l.alerts))
+	for i := len(l.alerts) - 1; i >= 0; i-- {
+		out = append(out, l.alerts[i])
+	}
+	return out
+}
+
+func (a *Agent) runAlertLog() {
+	ch, unsubscribe := a.events.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case e := <-ch:
+			if e.Type == "alert" {
+				a.alerts.add(e)
+			}
+		}
+	}
+}
+
+func (a *Agent) StatusPage() api.StatusPage {
+	hostname, _ := os.Hostname()
+	page := api.StatusPage{
+		Status:       a.Status(),
+		Hostname:     hostname,
+		Timezone:     a.config.Agent.Timezone,
+		Health:       a.health.Report(),
+		WingsActive:  a.wings.IsActive(),
+		WingsConsole: a.wingsConsole.Last(),
+		Tasks:        a.tasks.Active(),
+		Alerts:       a.alerts.newest(),
+	}
+	if probe := a.wingsProbe.Last(); !probe.CheckedAt.IsZero() {
+		page.Wings = &probe
+	}
+	return page
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/schedule"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+)
+
+type taskResultReport struct {
+	tasks.Result
+	SessionID string `json:"session_id"`
+}
+
+// reportTaskResult posts a finished task's result to the control plane.
+func (a *Agent) reportTaskResult(result tasks.Result) error {
+	report := taskResultReport{Result: result, SessionID: a.session.SessionID}
+	return a.makeRequest("POST", fmt.Sprintf("/agent/tasks/%s/result", result.TaskID), report, nil)
+}
+
+// registerTaskCommands lets the control plane queue tasks over the command
+// channel. The command returns once the task is persisted; the outcome is
+// reported separately when it finishes.
+func (a *Agent) registerTaskCommands() {
+	a.commands.Register("run_task", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var task tasks.Task
+		if err := json.Unmarshal(cmd.Payload, &task); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if task.ID == "" {
+			task.ID = cmd.ID
+		}
+		if task.RequestedBy == "" {
+			task.RequestedBy = "control_plane"
+		}
+		if err := a.tasks.Submit(task); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"task_id": task.ID, "queued": true}, nil
+	})
+
+	// Schedules replace the full set; they fire locally even while the
+	// control plane is unreachable.
+	a.commands.Register("set_schedules", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var entries []schedule.Entry
+		if err := json.Unmarshal(cmd.Payload, &entries); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		for _, e := range entries {
+			if !a.tasks.Permitted(e.Type) {
+				return nil, fmt.Errorf("schedule %s: task type %q is not permitted on this node", e.ID, e.Type)
+			}
+		}
+		if err := a.schedules.SetEntries(entries); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"schedules": len(entries)}, nil
+	})
+
+	a.commands.Register("list_schedules", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return a.schedules.Entries(), nil
+	})
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/telemetry"
+)
+
+// runTelemetryLoop sends the opt-in anonymous report. The first one waits a
+// full interval, so a node stuck in a restart loop doesn't flood it.
+func (a *Agent) runTelemetryLoop() {
+	reporter, err := telemetry.New(a.config.Telemetry, a.config.Agent.DataDir, a.config.ControlPlane.ProxyFunc(), a.logger)
+	if err != nil {
+		a.logger.WithError(err).Warn("Telemetry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(a.config.Telemetry.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(a.ctx, time.Minute)
+		if err := reporter.Send(ctx, a.telemetryReport()); err != nil {
+			a.logger.WithError(err).Debug("Failed to send telemetry")
+		}
+		cancel()
+	}
+}
+
+// telemetryReport reduces the node's state to the coarse figures the
+// vendor sees.
+func (a *Agent) telemetryReport() telemetry.Report {
+	report := telemetry.Report{
+		AgentVersion: Version,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Hypervisor:   system.DetectVirtualization().Hypervisor,
+		CPUCores:     telemetry.Bucket(runtime.NumCPU(), 2, 4, 8, 16, 32, 64),
+		HealthScore:  telemetry.Round10(float64(a.health.Report().Score)),
+		Features:     telemetry.Features(a.config),
+	}
+	if version, err := a.getWingsVersion(); err == nil {
+		report.WingsVersion = version
+	}
+
+	m, err := a.metrics.Collect()
+	if err != nil {
+		return report
+	}
+	if v, ok := m["cpuUsage"].(float64); ok {
+		report.CPUUsage = telemetry.Round10(v)
+	}
+	if v, ok := m["memoryUsage"].(float64); ok {
+		report.MemoryUsage = telemetry.Round10(v)
+	}
+	if v, ok := m["memoryTotal"].(uint64); ok {
+		report.MemoryGB = telemetry.Bucket(int(v>>30), 4, 8, 16, 32, 64, 128, 256)
+	}
+	if v, ok := m["diskUsage"].(float64); ok {
+		report.DiskUsage = telemetry.Round10(v)
+	}
+	if v, ok := m["containerCount"].(int); ok {
+		report.Containers = v
+	}
+	if v, ok := m["uptime"].(uint64); ok {
+		report.UptimeDays = telemetry.Bucket(int(v/86400), 6, 29, 89, 364)
+	}
+	return report
+}
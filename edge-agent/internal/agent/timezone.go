@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/sirupsen/logrus"
+)
+
+// checkTimezone warns when the node deviates from the fleet timezone, since
+// mixed timezones make cross-node log correlation painful.
+func (a *Agent) checkTimezone() {
+	expected := a.config.Agent.Timezone
+	if expected == "" {
+		return
+	}
+
+	if actual := system.Timezone(); actual != expected {
+		a.logger.WithFields(logrus.Fields{
+			"timezone": actual,
+			"expected": expected,
+		}).Warn("Node timezone differs from fleet standard, run the set_timezone task to fix")
+	}
+}
+
+func (a *Agent) handleSetTimezone(ctx context.Context, cmd Command) (interface{}, error) {
+	var payload struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if payload.Timezone == "" {
+		payload.Timezone = a.config.Agent.Timezone
+	}
+	if payload.Timezone == "" {
+		return nil, fmt.Errorf("no timezone given")
+	}
+
+	if err := system.SetTimezone(payload.Timezone); err != nil {
+		return nil, err
+	}
+
+	// Give the NTP daemon a moment to confirm synchronization.
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		settings := system.GetTimeSettings(a.services)
+		if settings.NTPSynchronized {
+			return settings, nil
+		}
+		if time.Now().After(deadline) {
+			return settings, fmt.Errorf("timezone set to %s but NTP is not synchronized", payload.Timezone)
+		}
+
+		select {
+		case <-ctx.Done():
+			return settings, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+const (
+	tokenCheckInterval = time.Minute
+	// tokenRefreshFraction is how much of the token lifetime may elapse
+	// before it is refreshed.
+	tokenRefreshFraction = 0.75
+)
+
+type tokenRefreshResponse struct {
+	AuthToken string `json:"auth_token"`
+}
+
+func (a *Agent) authToken() string {
+	a.tokenMu.RLock()
+	defer a.tokenMu.RUnlock()
+	return a.config.ControlPlane.AuthToken
+}
+
+// tokenLifetime returns the issue and expiry times of a JWT auth token. The
+// signature isn't checked, the agent doesn't hold the control plane's key.
+// ok is false for opaque tokens or JWTs without an expiry.
+func tokenLifetime(token string) (issuedAt, expiresAt time.Time, ok bool) {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if claims.ExpiresAt == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return issuedAt, claims.ExpiresAt.Time, true
+}
+
+// tokenRefreshDue reports whether the token should be refreshed now.
+func tokenRefreshDue(token string, now time.Time) bool {
+	issuedAt, expiresAt, ok := tokenLifetime(token)
+	if !ok {
+		return false
+	}
+	if issuedAt.IsZero() || !issuedAt.Before(expiresAt) {
+		// Without an issue time, refresh in the last 5 minutes.
+		return expiresAt.Sub(now) < 5*time.Minute
+	}
+	refreshAt := issuedAt.Add(time.Duration(float64(expiresAt.Sub(issuedAt)) * tokenRefreshFraction))
+	return !now.Before(refreshAt)
+}
+
+// refreshToken swaps the auth token for a fresh one and persists it. The old
+// token keeps being used by in-flight requests until the swap.
+func (a *Agent) refreshToken() error {
+	var resp tokenRefreshResponse
+	if err := a.makeRequest("POST", "/agent/token/refresh", nil, &resp); err != nil {
+		return fmt.Errorf("token refresh request failed: %w", err)
+	}
+	if resp.AuthToken == "" {
+		return fmt.Errorf("control plane returned an empty token")
+	}
+
+	a.tokenMu.Lock()
+	a.config.ControlPlane.AuthToken = resp.AuthToken
+	err := config.Save(a.configPath, a.config)
+	a.tokenMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+
+	if _, expiresAt, ok := tokenLifetime(resp.AuthToken); ok {
+		a.logger.WithField("expires", expiresAt).Info("Auth token refreshed")
+	} else {
+		a.logger.Info("Auth token refreshed")
+	}
+	return nil
+}
+
+// runTokenRefreshLoop keeps a short-lived JWT auth token fresh. Opaque
+// tokens never expire from the agent's point of view and are left alone.
+func (a *Agent) runTokenRefreshLoop() {
+	ticker := time.NewTicker(tokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if tokenRefreshDue(a.authToken(), time.Now()) {
+			if err := a.refreshToken(); err != nil {
+				a.logger.WithError(err).Warn("Auth token refresh failed")
+			}
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/shaping"
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+const (
+	preflightRTTSamples = 5
+	preflightSampleTime = time.Second
+
+	// Assumed when the NIC doesn't report a speed, as with virtio.
+	assumedLinkMbit = 1000
+)
+
+// TransferEstimate is the preflight answer for moving one server off the
+// node. Wings sends a single compressed stream, so the raw size makes the
+// estimate an upper bound for compressible data.
+type TransferEstimate struct {
+	Server        string  `json:"server"`
+	SizeBytes     int64   `json:"size_bytes"`
+	RTTMs         float64 `json:"rtt_ms"`
+	LinkMbit      int     `json:"link_mbit"` // 0 if the NIC didn't report it
+	BusyMbit      float64 `json:"busy_mbit"` // uplink already in use
+	ShapedMbit    int     `json:"shaped_mbit,omitempty"`
+	WindowMbit    float64 `json:"window_mbit"` // single stream limit from send buffer and RTT
+	LoadPerCore   float64 `json:"load_per_core"`
+	EffectiveMbit float64 `json:"effective_mbit"`
+	Limiter       string  `json:"limiter"` // the factor that set the effective rate
+	Seconds       int64   `json:"seconds"`
+}
+
+// estimateTransfer measures the path to the destination's Wings API and
+// the node's own state, and works out how long sending the server's files
+// should take.
+func (a *Agent) estimateTransfer(ctx context.Context, server, remote string, port int) (*TransferEstimate, error) {
+	est := &TransferEstimate{Server: server}
+
+	size, err := a.serverSize(server)
+	if err != nil {
+		return nil, err
+	}
+	est.SizeBytes = size
+
+	rtt, err := measureRTT(ctx, net.JoinHostPort(remote, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("destination unreachable: %w", err)
+	}
+	est.RTTMs = float64(rtt) / float64(time.Millisecond)
+
+	iface := a.config.Transfers.Interface
+	if iface == "" {
+		iface, _ = system.DefaultRouteInterface()
+	}
+	link := assumedLinkMbit
+	if iface != "" {
+		est.LinkMbit = system.LinkSpeed(iface)
+		if est.LinkMbit > 0 {
+			link = est.LinkMbit
+		}
+		est.BusyMbit = uplinkBusy(ctx, iface)
+	}
+
+	// Game servers keep their share; the transfer gets what's left, but
+	// never less than a tenth of the link since TCP will claim some.
+	candidates := map[string]float64{"link": math.Max(float64(link)-est.BusyMbit, float64(link)/10)}
+
+	if rate := shaping.RateAt(a.config.Transfers, time.Now()); rate > 0 {
+		est.ShapedMbit = rate
+		candidates["shaping"] = float64(rate)
+	}
+	if buf := system.TCPSendBufferMax(); buf > 0 && rtt > 0 {
+		est.WindowMbit = float64(buf) * 8 / rtt.Seconds() / 1e6
+		candidates["tcp_window"] = est.WindowMbit
+	}
+
+	est.Limiter = "link"
+	est.EffectiveMbit = candidates["link"]
+	for name, mbit := range candidates {
+		if mbit < est.EffectiveMbit {
+			est.Limiter, est.EffectiveMbit = name, mbit
+		}
+	}
+
+	// Wings compresses the archive as it sends, which slows down once the
+	// CPUs are already saturated.
+	if avg, err := load.AvgWithContext(ctx); err == nil {
+		est.LoadPerCore = avg.Load1 / float64(runtime.NumCPU())
+		if est.LoadPerCore > 1 {
+			est.EffectiveMbit /= est.LoadPerCore
+			est.Limiter = "cpu_load"
+		}
+	}
+
+	est.Seconds = int64(math.Ceil(float64(est.SizeBytes) * 8 / (est.EffectiveMbit * 1e6)))
+	return est, nil
+}
+
+// serverSize uses the disk usage tracker when it runs, and walks the
+// server's directory otherwise.
+func (a *Agent) serverSize(server string) (int64, error) {
+	if report := a.serverDiskUsage(); report != nil {
+		if size, ok := report.Servers[server]; ok {
+			return size, nil
+		}
+	}
+
+	root := (&wings.DaemonConfig{}).DataDirectory()
+	if cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath); err == nil {
+		root = cfg.DataDirectory()
+	}
+	dir := filepath.Join(root, filepath.Base(server))
+
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to size server %s: %w", server, err)
+	}
+	return size, nil
+}
+
+// measureRTT times TCP handshakes to addr and returns the median.
+func measureRTT(ctx context.Context, addr string) (time.Duration, error) {
+	var samples []time.Duration
+	var lastErr error
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	for i := 0; i < preflightRTTSamples; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		samples = append(samples, time.Since(start))
+		conn.Close()
+	}
+	if len(samples) == 0 {
+		return 0, lastErr
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[len(samples)/2], nil
+}
+
+// uplinkBusy samples the interface's send rate in Mbit/s.
+func uplinkBusy(ctx context.Context, iface string) float64 {
+	before, err := system.TxBytes(iface)
+	if err != nil {
+		return 0
+	}
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-time.After(preflightSampleTime):
+	}
+	after, err := system.TxBytes(iface)
+	if err != nil || after < before {
+		return 0
+	}
+	return float64(after-before) * 8 / preflightSampleTime.Seconds() / 1e6
+}
+
+func (a *Agent) transferPreflight(ctx context.Context, cmd Command) (interface{}, error) {
+	var req struct {
+		Server string `json:"server"`
+		Remote string `json:"remote"` // destination node address
+		Port   int    `json:"port"`   // destination Wings API port
+	}
+	if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if req.Server == "" || req.Remote == "" || req.Port <= 0 {
+		return nil, fmt.Errorf("server, remote and port are required")
+	}
+	return a.estimateTransfer(ctx, req.Server, req.Remote, req.Port)
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/shaping"
+	"github.com/pterodactyl-cp/edge-agent/internal/system"
+)
+
+func (a *Agent) newShaper() *shaping.Shaper {
+	iface := a.config.Transfers.Interface
+	if iface == "" {
+		var err error
+		if iface, err = system.DefaultRouteInterface(); err != nil {
+			a.logger.WithError(err).Warn("Transfer shaping unavailable, no uplink interface")
+			return nil
+		}
+	}
+	return shaping.New(a.config.Transfers, iface, a.logger)
+}
+
+// runTransferShapingLoop moves the transfer limit between time-of-day
+// windows and removes shaping when the agent stops.
+func (a *Agent) runTransferShapingLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			a.shaper.Clear()
+			return
+		case now := <-ticker.C:
+			a.shaper.Tick(now)
+		}
+	}
+}
+
+// registerTransferCommands lets the control plane estimate a server
+// transfer up front, and bracket it on the source node so its stream is
+// rate limited.
+func (a *Agent) registerTransferCommands() {
+	a.commands.Register("transfer_preflight", a.transferPreflight)
+
+	a.commands.Register("begin_transfer", func(ctx context.Context, cmd Command) (interface{}, error) {
+		if a.shaper == nil {
+			return nil, fmt.Errorf("transfer shaping is not available on this node")
+		}
+		var transfer shaping.Transfer
+		if err := json.Unmarshal(cmd.Payload, &transfer); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if transfer.ID == "" {
+			transfer.ID = cmd.ID
+		}
+		if err := a.shaper.Begin(transfer); err != nil {
+			return nil, err
+		}
+		return a.shaper.Status(), nil
+	})
+
+	a.commands.Register("end_transfer", func(ctx context.Context, cmd Command) (interface{}, error) {
+		if a.shaper == nil {
+			return nil, nil
+		}
+		var req struct {
+			ID string `json:"transfer_id"`
+		}
+		if err := json.Unmarshal(cmd.Payload, &req); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		return nil, a.shaper.End(req.ID)
+	})
+}
+
+func (a *Agent) transferShaping() *shaping.Status {
+	if a.shaper == nil {
+		return nil
+	}
+	return a.shaper.Status()
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/updater"
+)
+
+// runUpdateLoop periodically asks the control plane for the agent build this
+// node should be running and hands it to the updater.
+func (a *Agent) runUpdateLoop() {
+	interval := time.Duration(a.config.Agent.UpdateCheckInterval) * time.Second
+	if interval <= 0 {
+		a.logger.Info("Automatic updates disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.checkForUpdate(); err != nil {
+			a.logger.WithError(err).Warn("Update check failed")
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) checkForUpdate() error {
+	query := url.Values{}
+	query.Set("version", Version)
+	query.Set("os", runtime.GOOS)
+	query.Set("arch", runtime.GOARCH)
+	if a.config.Agent.PinnedVersion != "" {
+		query.Set("pinned", a.config.Agent.PinnedVersion)
+	}
+
+	var release updater.Release
+	if err := a.getCached("/agent/update?"+query.Encode(), &release); err != nil {
+		return fmt.Errorf("failed to fetch release info: %w", err)
+	}
+
+	return a.updater.Apply(a.ctx, release)
+}
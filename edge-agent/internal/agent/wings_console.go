@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"time"
+)
+
+// runWingsConsoleLoop checks that server consoles can be opened. Consoles
+// failing while the API answers is its own failure mode (a broken proxy,
+// origin or token mismatch, a wedged websocket handler), so it's reported
+// separately and doesn't trigger the probe's Wings restart.
+func (a *Agent) runWingsConsoleLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Wings.ConsoleProbeInterval) * time.Second)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// A console can't work while Wings itself is down; the API probe
+		// already reports that.
+		if !a.wingsProbe.Last().Reachable {
+			continue
+		}
+
+		result := a.wingsConsole.Probe(a.ctx)
+		if result.Skipped || result.Healthy == healthy {
+			continue
+		}
+		healthy = result.Healthy
+
+		if !healthy {
+			a.logger.WithField("stage", result.Stage).WithField("error", result.Error).Warn("Wings console check failed")
+			a.events.Publish("alert", map[string]interface{}{
+				"source":  "wings_console",
+				"message": result.Error,
+				"stage":   result.Stage,
+			})
+			a.reportEvent("wings_console_unhealthy", result)
+		} else {
+			a.logger.Info("Wings consoles working again")
+			a.reportEvent("wings_console_recovered", result)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+type wingsDriftState struct {
+	mu   sync.Mutex
+	last *wings.Drift
+}
+
+func (s *wingsDriftState) get() *wings.Drift {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *wingsDriftState) set(drift *wings.Drift) {
+	s.mu.Lock()
+	s.last = drift
+	s.mu.Unlock()
+}
+
+// desiredWingsPath keeps the last config the control plane sent that Wings
+// started with. It holds the node token, like config.yml itself.
+func (a *Agent) desiredWingsPath() string {
+	return filepath.Join(a.config.Agent.DataDir, "wings-desired.yml")
+}
+
+func (a *Agent) saveDesiredWingsConfig(cfg *wings.DaemonConfig) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.desiredWingsPath(), data, 0600)
+}
+
+func (a *Agent) loadDesiredWingsConfig() (map[string]interface{}, error) {
+	data, err := os.ReadFile(a.desiredWingsPath())
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (a *Agent) runWingsDriftLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Wings.DriftInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		a.checkWingsDrift()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkWingsDrift reports a drifted config once per distinct on-disk
+// version, and puts the desired config back when remediation is enabled.
+// Nodes the control plane never configured have nothing to compare with.
+func (a *Agent) checkWingsDrift() {
+	raw, err := a.loadDesiredWingsConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			a.logger.WithError(err).Warn("Failed to read desired Wings config")
+		}
+		return
+	}
+	desired, err := wings.ParseConfig(raw)
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to read desired Wings config")
+		return
+	}
+
+	drift := wings.CompareConfig(a.config.Wings.ConfigPath, desired, a.config.Wings.DriftIgnore)
+	prev := a.wingsDrift.get()
+	if !drift.Detected || (prev != nil && prev.Detected && prev.ActualHash == drift.ActualHash) {
+		a.wingsDrift.set(&drift)
+		return
+	}
+
+	a.logger.WithFields(logrus.Fields{"fields": drift.Fields, "error": drift.Error}).Warn("Wings config differs from the control plane's version")
+	a.reportEvent("wings_config_drift", drift)
+
+	if a.config.Wings.DriftRemediate {
+		if err := a.configureWings(raw); err != nil {
+			a.logger.WithError(err).Error("Failed to restore desired Wings config")
+		} else {
+			remediated := drift
+			drift = wings.CompareConfig(a.config.Wings.ConfigPath, desired, a.config.Wings.DriftIgnore)
+			drift.Remediated = time.Now().UTC()
+			a.reportEvent("wings_config_remediated", remediated)
+		}
+	}
+	a.wingsDrift.set(&drift)
+}
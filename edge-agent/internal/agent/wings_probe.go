@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runWingsProbeLoop probes the Wings API and restarts Wings once it has
+// failed ProbeFailureThreshold times in a row, if auto_restart is enabled.
+func (a *Agent) runWingsProbeLoop() {
+	ticker := time.NewTicker(time.Duration(a.config.Wings.ProbeInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result := a.wingsProbe.Probe()
+		if result.Reachable {
+			continue
+		}
+
+		a.logger.WithFields(logrus.Fields{
+			"error":    result.Error,
+			"failures": result.ConsecutiveFailures,
+		}).Warn("Wings health probe failed")
+		alert := map[string]interface{}{
+			"source":   "wings_probe",
+			"message":  result.Error,
+			"failures": result.ConsecutiveFailures,
+		}
+		// Reaching the threshold is when Wings counts as down.
+		if result.ConsecutiveFailures == a.config.Wings.ProbeFailureThreshold {
+			a.criticalAlert(alert)
+		} else {
+			a.events.Publish("alert", alert)
+		}
+
+		if !a.config.Wings.AutoRestart || result.ConsecutiveFailures < a.config.Wings.ProbeFailureThreshold {
+			continue
+		}
+
+		a.logger.Warn("Wings unhealthy, restarting")
+		if err := a.restartWings("probe_failures"); err != nil {
+			a.logger.WithError(err).Error("Failed to restart unhealthy Wings")
+		}
+		a.wingsProbe.ResetFailures()
+	}
+}
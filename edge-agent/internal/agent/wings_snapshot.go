@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/snapshot"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// snapshotPath is the directory snapshots cover: snapshots.path, or the
+// Wings data directory.
+func (a *Agent) snapshotPath() string {
+	if a.config.Snapshots.Path != "" {
+		return a.config.Snapshots.Path
+	}
+	if cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath); err == nil {
+		return cfg.DataDirectory()
+	}
+	return (&wings.DaemonConfig{}).DataDirectory()
+}
+
+// runWingsSnapshotTask is the control plane's insurance for batch
+// operations: snapshot the server volumes first, roll them back if the
+// batch goes wrong, delete the snapshot once it's known to be fine.
+func (a *Agent) runWingsSnapshotTask(ctx context.Context, task tasks.Task) (string, int, error) {
+	var p tasks.WingsSnapshotPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	switch p.Action {
+	case "list":
+		out, _ := json.MarshalIndent(a.snapshots.List(), "", "  ")
+		return string(out) + "\n", 0, nil
+
+	case "create":
+		s, err := a.snapshots.Create(ctx, a.snapshotPath(), snapshot.Snapshot{
+			Reason:      p.Reason,
+			TaskID:      task.ID,
+			RequestedBy: task.RequestedBy,
+		})
+		if err != nil {
+			return "", 1, err
+		}
+		a.reportEvent("wings_snapshot_created", s)
+		return fmt.Sprintf("created %s snapshot %s (%s)\n", s.Backend, s.ID, s.Ref), 0, nil
+
+	case "rollback":
+		if p.ID == "" {
+			return "", -1, fmt.Errorf("id is required for rollback")
+		}
+		return a.rollbackSnapshot(ctx, task, p)
+
+	case "delete":
+		if p.ID == "" {
+			return "", -1, fmt.Errorf("id is required for delete")
+		}
+		if err := a.snapshots.Delete(ctx, p.ID); err != nil {
+			return "", 1, err
+		}
+		a.reportEvent("wings_snapshot_deleted", map[string]interface{}{"id": p.ID, "task_id": task.ID, "reason": p.Reason})
+		return fmt.Sprintf("deleted snapshot %s\n", p.ID), 0, nil
+	}
+	return "", -1, fmt.Errorf("unsupported snapshot action %q", p.Action)
+}
+
+// rollbackSnapshot stops Docker and Wings so nothing writes to the volumes
+// while they're rolled back, then starts them again either way; Wings
+// brings back the servers that were running.
+func (a *Agent) rollbackSnapshot(ctx context.Context, task tasks.Task, p tasks.WingsSnapshotPayload) (string, int, error) {
+	s, ok := a.snapshots.Get(p.ID)
+	if !ok {
+		return "", 1, fmt.Errorf("no snapshot %s", p.ID)
+	}
+
+	release, err := a.locks.Acquire(ctx, "wings_snapshot_rollback", locks.WingsService, locks.Docker)
+	if err != nil {
+		return "", 1, err
+	}
+	defer release()
+
+	wingsUnit := a.config.Wings.SystemdUnit
+	if err := a.services.Stop(ctx, wingsUnit); err != nil {
+		return "", 1, fmt.Errorf("failed to stop %s: %w", wingsUnit, err)
+	}
+	if err := a.services.Stop(ctx, "docker.service"); err != nil {
+		a.services.Start(ctx, wingsUnit)
+		return "", 1, fmt.Errorf("failed to stop docker: %w", err)
+	}
+
+	rollbackErr := a.snapshots.Rollback(ctx, p.ID)
+
+	// The services come back on the agent's context: a task timeout must
+	// not leave the node without Wings.
+	var startErr error
+	if err := a.services.Start(a.ctx, "docker.service"); err != nil {
+		startErr = fmt.Errorf("failed to start docker: %w", err)
+	} else if err := a.services.Start(a.ctx, wingsUnit); err != nil {
+		startErr = fmt.Errorf("failed to start %s: %w", wingsUnit, err)
+	}
+
+	event := map[string]interface{}{
+		"id":           s.ID,
+		"backend":      s.Backend,
+		"created_at":   s.CreatedAt,
+		"task_id":      task.ID,
+		"reason":       p.Reason,
+		"requested_by": task.RequestedBy,
+	}
+	if rollbackErr != nil {
+		event["error"] = rollbackErr.Error()
+		a.reportEvent("wings_snapshot_rollback_failed", event)
+		if startErr != nil {
+			return "", 1, fmt.Errorf("%w; %v", rollbackErr, startErr)
+		}
+		return "", 1, rollbackErr
+	}
+	a.reportEvent("wings_snapshot_rolled_back", event)
+
+	out := fmt.Sprintf("rolled back %s to snapshot %s from %s\n", s.Path, s.ID, s.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	if startErr != nil {
+		return out, 1, startErr
+	}
+	return out, 0, nil
+}
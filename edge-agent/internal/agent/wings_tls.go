@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/acme"
+	"github.com/pterodactyl-cp/edge-agent/internal/certs"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wingsCertCheckInterval = time.Hour
+	wingsCertAlertInterval = 24 * time.Hour
+)
+
+var errWingsSSLDisabled = errors.New("Wings doesn't have api.ssl enabled")
+
+type wingsCertificateRequest struct {
+	CSR      string   `json:"csr"`
+	DNSNames []string `json:"dns_names"`
+}
+
+type wingsCertificateResponse struct {
+	Certificate string `json:"certificate"` // PEM, leaf first, then intermediates
+}
+
+// WingsCertificate describes the certificate Wings serves to the panel.
+type WingsCertificate struct {
+	Source   string    `json:"source,omitempty"` // empty when the operator renews it
+	Path     string    `json:"path"`
+	DNSNames []string  `json:"dns_names,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	DaysLeft int       `json:"days_left"`
+	Renewed  time.Time `json:"renewed,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type wingsTLSState struct {
+	mu      sync.Mutex
+	last    *WingsCertificate
+	alerted time.Time
+}
+
+func (s *wingsTLSState) get() *WingsCertificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// wingsCertPaths returns where Wings loads its certificate from.
+func (a *Agent) wingsCertPaths() (string, string, error) {
+	cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath)
+	if err != nil {
+		return "", "", err
+	}
+	if !cfg.API.SSL.Enabled || cfg.API.SSL.Cert == "" || cfg.API.SSL.Key == "" {
+		return "", "", errWingsSSLDisabled
+	}
+	return cfg.API.SSL.Cert, cfg.API.SSL.Key, nil
+}
+
+func (a *Agent) wingsDNSNames() []string {
+	if len(a.config.WingsTLS.DNSNames) > 0 {
+		return a.config.WingsTLS.DNSNames
+	}
+	if out, err := exec.Command("hostname", "-f").Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return []string{name}
+		}
+	}
+	hostname, _ := os.Hostname()
+	return []string{hostname}
+}
+
+func (a *Agent) runWingsTLSLoop() {
+	ticker := time.NewTicker(wingsCertCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.checkWingsCertificate(false)
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkWingsCertificate renews the certificate when it's due, or when
+// forced, and raises an alert at most daily once expiry is close.
+func (a *Agent) checkWingsCertificate(force bool) (*WingsCertificate, error) {
+	certPath, keyPath, err := a.wingsCertPaths()
+	if err != nil {
+		a.wingsTLS.mu.Lock()
+		a.wingsTLS.last = nil
+		a.wingsTLS.mu.Unlock()
+		return nil, err
+	}
+
+	source := a.config.WingsTLS.Source
+	status := &WingsCertificate{Source: source, Path: certPath}
+	if prev := a.wingsTLS.get(); prev != nil {
+		status.Renewed = prev.Renewed
+	}
+
+	leaf, readErr := certs.ReadLeaf(certPath)
+	due := readErr != nil || time.Until(leaf.NotAfter) < days(a.config.WingsTLS.RenewBefore)
+
+	var renewErr error
+	if source != "" && (due || force) {
+		if renewErr = a.renewWingsCertificate(certPath, keyPath); renewErr == nil {
+			status.Renewed = time.Now().UTC()
+			leaf, readErr = certs.ReadLeaf(certPath)
+		} else {
+			a.logger.WithError(renewErr).Warn("Wings certificate renewal failed")
+		}
+	} else if force {
+		renewErr = fmt.Errorf("wings_tls.source isn't set, the certificate is renewed outside the agent")
+	}
+
+	switch {
+	case renewErr != nil:
+		status.Error = renewErr.Error()
+	case readErr != nil:
+		status.Error = readErr.Error()
+	}
+	if readErr == nil {
+		status.DNSNames = leaf.DNSNames
+		status.Issuer = leaf.Issuer.CommonName
+		status.NotAfter = leaf.NotAfter
+		status.DaysLeft = int(time.Until(leaf.NotAfter) / (24 * time.Hour))
+	}
+
+	a.wingsTLS.mu.Lock()
+	a.wingsTLS.last = status
+	alert := readErr == nil && time.Until(leaf.NotAfter) < days(a.config.WingsTLS.AlertBefore) &&
+		time.Since(a.wingsTLS.alerted) >= wingsCertAlertInterval
+	if alert {
+		a.wingsTLS.alerted = time.Now()
+	}
+	a.wingsTLS.mu.Unlock()
+
+	if alert {
+		a.logger.WithFields(logrus.Fields{"path": certPath, "not_after": status.NotAfter}).Warn("Wings certificate expires soon")
+		a.reportEvent("wings_certificate_expiring", status)
+	}
+	return status, renewErr
+}
+
+// renewWingsCertificate gets a certificate for a fresh key from the
+// configured source, installs it and restarts Wings to load it.
+func (a *Agent) renewWingsCertificate(certPath, keyPath string) error {
+	dnsNames := a.wingsDNSNames()
+
+	var certPEM, keyPEM []byte
+	var err error
+	switch a.config.WingsTLS.Source {
+	case "control_plane":
+		certPEM, keyPEM, err = a.requestWingsCertificate(dnsNames)
+	case "acme":
+		certPEM, keyPEM, err = a.obtainACMECertificate(dnsNames)
+	default:
+		err = fmt.Errorf("unsupported certificate source %q", a.config.WingsTLS.Source)
+	}
+	if err != nil {
+		return err
+	}
+
+	release, err := a.locks.Acquire(a.ctx, "wings_certificate", locks.Certificates)
+	if err != nil {
+		return err
+	}
+	leaf, err := certs.InstallKeyPair(certPath, keyPath, certPEM, keyPEM)
+	release()
+	if err != nil {
+		return fmt.Errorf("failed to install Wings certificate: %w", err)
+	}
+
+	a.reportEvent("wings_certificate_renewed", map[string]interface{}{
+		"source":    a.config.WingsTLS.Source,
+		"dns_names": leaf.DNSNames,
+		"not_after": leaf.NotAfter,
+	})
+	return a.restartWings("certificate_renewal")
+}
+
+// requestWingsCertificate has the operator's internal CA sign a CSR
+// through the control plane; the key never leaves the node.
+func (a *Agent) requestWingsCertificate(dnsNames []string) ([]byte, []byte, error) {
+	csrPEM, keyPEM, err := certs.NewServerCSR(dnsNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	var resp wingsCertificateResponse
+	if err := a.makeRequest("POST", "/agent/wings-certificate", wingsCertificateRequest{CSR: string(csrPEM), DNSNames: dnsNames}, &resp); err != nil {
+		return nil, nil, fmt.Errorf("certificate request failed: %w", err)
+	}
+	return []byte(resp.Certificate), keyPEM, nil
+}
+
+// obtainACMECertificate orders the certificate from the ACME server, e.g.
+// Let's Encrypt, in place of a manual certbot run.
+func (a *Agent) obtainACMECertificate(dnsNames []string) ([]byte, []byte, error) {
+	if a.acme == nil {
+		return nil, nil, errors.New("the ACME client isn't available, see the startup log")
+	}
+	csrPEM, keyPEM, err := certs.NewServerCSR(dnsNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+	certPEM, err := a.acme.Obtain(a.ctx, dnsNames, csrPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ACME order failed: %w", err)
+	}
+	return certPEM, keyPEM, nil
+}
+
+func (a *Agent) newACMEClient() *acme.Client {
+	if a.config.WingsTLS.Source != "acme" {
+		return nil
+	}
+	client, err := acme.New(a.config.WingsTLS.ACME, a.config.Agent.DataDir, a.config.ControlPlane.ProxyFunc(), a.logger)
+	if err != nil {
+		a.logger.WithError(err).Warn("ACME certificate provisioning unavailable")
+		return nil
+	}
+	return client
+}
+
+func (a *Agent) registerWingsTLSCommands() {
+	a.commands.Register("renew_wings_certificate", func(ctx context.Context, cmd Command) (interface{}, error) {
+		return a.checkWingsCertificate(true)
+	})
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
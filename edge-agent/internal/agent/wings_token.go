@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+const wingsTokenCheckInterval = time.Minute
+
+// WingsToken is a scoped, short-lived credential for the Wings API. The
+// control plane issues it through the agent, so the panel doesn't have to
+// hold the node's long-lived token. It must be valid for at least
+// config.MinWingsTokenLifetime, since each one restarts Wings. Wings knows
+// nothing of scopes: the control plane enforces them, the agent only passes
+// them along.
+type WingsToken struct {
+	TokenID   string    `json:"token_id"`
+	Token     string    `json:"token"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WingsTokenStatus describes the brokered token Wings runs with, without
+// the secret.
+type WingsTokenStatus struct {
+	TokenID     string    `json:"token_id"`
+	Scopes      []string  `json:"scopes,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	InstalledAt time.Time `json:"installed_at"`
+	Error       string    `json:"error,omitempty"` // last renewal failure
+}
+
+type wingsTokenRenewalRequest struct {
+	TokenID string   `json:"token_id"`
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+type wingsTokenState struct {
+	mu      sync.Mutex
+	path    string
+	status  *WingsTokenStatus
+	alerted string // token ID an expiry alert was raised for
+}
+
+func loadWingsTokenState(dataDir string) *wingsTokenState {
+	s := &wingsTokenState{path: filepath.Join(dataDir, "wings-token.json")}
+	if data, err := os.ReadFile(s.path); err == nil {
+		var status WingsTokenStatus
+		if json.Unmarshal(data, &status) == nil {
+			s.status = &status
+		}
+	}
+	return s
+}
+
+func (s *wingsTokenState) get() *WingsTokenStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	status := *s.status
+	return &status
+}
+
+func (s *wingsTokenState) set(status WingsTokenStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = &status
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (a *Agent) registerWingsTokenCommands() {
+	a.commands.Register("set_wings_token", func(ctx context.Context, cmd Command) (interface{}, error) {
+		var token WingsToken
+		if err := json.Unmarshal(cmd.Payload, &token); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if err := a.installWingsToken(token); err != nil {
+			return nil, err
+		}
+		return a.wingsToken.get(), nil
+	})
+}
+
+// installWingsToken puts the token in config.yml and restarts Wings, which
+// only reads it at startup; the game servers keep running. The desired
+// config follows, so drift detection doesn't put the old token back.
+func (a *Agent) installWingsToken(token WingsToken) error {
+	switch {
+	case token.TokenID == "" || token.Token == "":
+		return errors.New("token_id and token are required")
+	case !token.ExpiresAt.IsZero() && time.Now().After(token.ExpiresAt):
+		return fmt.Errorf("token %s expired at %s", token.TokenID, token.ExpiresAt)
+	case !token.ExpiresAt.IsZero() && time.Until(token.ExpiresAt) < config.MinWingsTokenLifetime:
+		return fmt.Errorf("token %s expires in %s, tokens must be valid for at least %s since installing one restarts Wings",
+			token.TokenID, time.Until(token.ExpiresAt).Round(time.Second), config.MinWingsTokenLifetime)
+	}
+
+	release, err := a.locks.Acquire(a.ctx, "wings_token", locks.WingsConfig)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	cfg, err := wings.LoadConfig(a.config.Wings.ConfigPath)
+	if err != nil {
+		return err
+	}
+	cfg.TokenID, cfg.Token = token.TokenID, token.Token
+	backup, err := a.wings.WriteConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := a.restartWings("token_rotation"); err != nil {
+		if backup != "" {
+			if restoreErr := a.wings.RestoreConfig(backup); restoreErr == nil {
+				a.restartWings("token_rollback")
+			}
+		}
+		return fmt.Errorf("failed to restart Wings with the new token: %w", err)
+	}
+
+	if raw, err := a.loadDesiredWingsConfig(); err == nil {
+		if desired, err := wings.ParseConfig(raw); err == nil {
+			desired.TokenID, desired.Token = token.TokenID, token.Token
+			if err := a.saveDesiredWingsConfig(desired); err != nil {
+				a.logger.WithError(err).Warn("Failed to update desired Wings config with the new token")
+			}
+		}
+	}
+
+	status := WingsTokenStatus{
+		TokenID:     token.TokenID,
+		Scopes:      token.Scopes,
+		ExpiresAt:   token.ExpiresAt,
+		InstalledAt: time.Now().UTC(),
+	}
+	if err := a.wingsToken.set(status); err != nil {
+		a.logger.WithError(err).Warn("Failed to save Wings token state")
+	}
+	a.logger.WithFields(logrus.Fields{"token_id": token.TokenID, "expires_at": token.ExpiresAt}).Info("Installed Wings API token")
+	a.reportEvent("wings_token_rotated", status)
+	return nil
+}
+
+// runWingsTokenLoop renews a brokered token ahead of its expiry. Nodes
+// still on a long-lived token, or one without an expiry, are left alone.
+func (a *Agent) runWingsTokenLoop() {
+	ticker := time.NewTicker(wingsTokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status := a.wingsToken.get()
+		if status == nil || status.ExpiresAt.IsZero() {
+			continue
+		}
+		if time.Until(status.ExpiresAt) > time.Duration(a.config.Wings.TokenRenewBefore)*time.Second {
+			continue
+		}
+		if err := a.renewWingsToken(*status); err != nil {
+			a.wingsTokenRenewalFailed(*status, err)
+		}
+	}
+}
+
+func (a *Agent) renewWingsToken(status WingsTokenStatus) error {
+	var token WingsToken
+	if err := a.makeRequest("POST", "/agent/wings-token", wingsTokenRenewalRequest{TokenID: status.TokenID, Scopes: status.Scopes}, &token); err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	return a.installWingsToken(token)
+}
+
+// wingsTokenRenewalFailed records the failure, and raises one alert per
+// token once it has expired and the panel can no longer reach Wings.
+func (a *Agent) wingsTokenRenewalFailed(status WingsTokenStatus, err error) {
+	a.logger.WithError(err).WithField("token_id", status.TokenID).Warn("Failed to renew Wings API token")
+	status.Error = err.Error()
+	a.wingsToken.set(status)
+
+	if time.Now().Before(status.ExpiresAt) {
+		return
+	}
+	a.wingsToken.mu.Lock()
+	alert := a.wingsToken.alerted != status.TokenID
+	a.wingsToken.alerted = status.TokenID
+	a.wingsToken.mu.Unlock()
+	if alert {
+		a.criticalAlert(map[string]interface{}{
+			"source":     "wings_token",
+			"message":    "Wings API token " + status.TokenID + " expired without a replacement",
+			"token_id":   status.TokenID,
+			"expired_at": status.ExpiresAt,
+			"error":      err.Error(),
+		})
+	}
+}
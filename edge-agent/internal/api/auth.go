@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Role is what a local API caller may do.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Caller is who made a local API request, as far as the agent can tell.
+type Caller struct {
+	Role Role   `json:"role"`
+	UID  *int   `json:"uid,omitempty"`
+	User string `json:"user,omitempty"`
+	Via  string `json:"via"` // "peer" or "token"
+}
+
+type peerKey struct{}
+
+type tcpKey struct{}
+
+type peer struct {
+	uid, gid int
+}
+
+// peerContext records the Unix socket peer's credentials for each
+// connection, or that it came in over TCP, so requests can be authorized by
+// who sent them.
+func peerContext(ctx context.Context, c net.Conn) context.Context {
+	if _, isTCP := c.(*net.TCPConn); isTCP {
+		return context.WithValue(ctx, tcpKey{}, true)
+	}
+	if uid, gid, ok := peerCredentials(c); ok {
+		return context.WithValue(ctx, peerKey{}, peer{uid: uid, gid: gid})
+	}
+	return ctx
+}
+
+type authorizer struct {
+	cfg      config.LocalAPIAuthConfig
+	enforced bool
+}
+
+// resolve works out the caller's role. A bearer token takes precedence over
+// peer credentials. Root and the agent's own user are always admins, since
+// they could edit the config anyway. TCP callers have no peer credentials,
+// so without a token they get nothing, roles configured or not.
+func (a *authorizer) resolve(r *http.Request) Caller {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		hash := hex.EncodeToString(sum[:])
+		caller := Caller{Via: "token"}
+		switch {
+		case matchToken(a.cfg.Admins.Tokens, hash):
+			caller.Role = RoleAdmin
+		case matchToken(a.cfg.Viewers.Tokens, hash):
+			caller.Role = RoleViewer
+		}
+		return caller
+	}
+
+	caller := Caller{Via: "peer"}
+	p, isPeer := r.Context().Value(peerKey{}).(peer)
+	if isPeer {
+		uid := p.uid
+		caller.UID = &uid
+		if u, err := user.LookupId(strconv.Itoa(p.uid)); err == nil {
+			caller.User = u.Username
+		}
+	}
+
+	_, isTCP := r.Context().Value(tcpKey{}).(bool)
+
+	switch {
+	case isTCP:
+		caller.Role = RoleNone
+	case !a.enforced:
+		caller.Role = RoleAdmin
+	case !isPeer:
+		caller.Role = RoleNone
+	case p.uid == 0 || p.uid == os.Getuid():
+		caller.Role = RoleAdmin
+	case a.matchPeer(a.cfg.Admins, p):
+		caller.Role = RoleAdmin
+	case a.matchPeer(a.cfg.Viewers, p):
+		caller.Role = RoleViewer
+	}
+	return caller
+}
+
+func matchToken(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(h)), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authorizer) matchPeer(p config.APIPrincipals, caller peer) bool {
+	uid := strconv.Itoa(caller.uid)
+	u, _ := user.LookupId(uid)
+	for _, name := range p.Users {
+		if name == uid || (u != nil && name == u.Username) {
+			return true
+		}
+	}
+	if len(p.Groups) == 0 {
+		return false
+	}
+
+	gids := []string{strconv.Itoa(caller.gid)}
+	if u != nil {
+		if more, err := u.GroupIds(); err == nil {
+			gids = append(gids, more...)
+		}
+	}
+	for _, want := range p.Groups {
+		if g, err := user.LookupGroup(want); err == nil {
+			want = g.Gid
+		}
+		for _, gid := range gids {
+			if gid == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requiredRole: reads are for viewers, anything that changes the agent is
+// for admins. Task history is admin-only, since task output can hold
+// anything a script printed; task_finished events leave the output out for
+// the same reason.
+func requiredRole(r *http.Request) Role {
+	if r.URL.Path == "/tasks/history" {
+		return RoleAdmin
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return RoleViewer
+	}
+	return RoleAdmin
+}
+
+// authorize wraps the API's handler, rejecting callers without the role a
+// request needs and logging the ones that change something.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := s.auth.resolve(r)
+		required := requiredRole(r)
+		if caller.Role < required {
+			status := http.StatusForbidden
+			if caller.Role == RoleNone {
+				status = http.StatusUnauthorized
+			}
+			writeError(w, status, fmt.Errorf("%s %s needs the %s role, caller has %s", r.Method, r.URL.Path, required, caller.Role))
+			return
+		}
+
+		if required == RoleAdmin && s.auth.enforced {
+			fields := logrus.Fields{"method": r.Method, "path": r.URL.Path, "via": caller.Via}
+			if caller.UID != nil {
+				fields["uid"] = *caller.UID
+				fields["user"] = caller.User
+			}
+			s.logger.WithFields(fields).Info("Local API admin request")
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+	})
+}
+
+type callerKey struct{}
+
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, r.Context().Value(callerKey{}))
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials reads SO_PEERCRED: the uid and gid of the process on the
+// other end of a Unix socket, as the kernel saw them at connect time.
+func peerCredentials(c net.Conn) (uid, gid int, ok bool) {
+	uc, isUnix := c.(*net.UnixConn)
+	if !isUnix {
+		return 0, 0, false
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return 0, 0, false
+	}
+	return int(cred.Uid), int(cred.Gid), true
+}
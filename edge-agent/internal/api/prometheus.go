@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// handleMetrics serves the agent's own metrics in the Prometheus text
+// format, for scraping over admin_listen.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	status := s.backend.Status()
+	m := s.backend.AgentMetrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p := promWriter{w: w}
+
+	p.gauge("edge_agent_info", "Agent version and node.", 1, "version", status.Version, "node_id", status.NodeID)
+	p.gauge("edge_agent_uptime_seconds", "Seconds since the agent started.", float64(m.UptimeSeconds))
+	p.gauge("edge_agent_goroutines", "Goroutines in the agent process.", float64(m.Goroutines))
+	p.gauge("edge_agent_heap_bytes", "Bytes of allocated heap objects.", float64(m.HeapBytes))
+	p.gauge("edge_agent_sys_bytes", "Bytes of memory obtained from the OS.", float64(m.SysBytes))
+	p.counter("edge_agent_gc_runs_total", "Completed garbage collection cycles.", float64(m.GCRuns))
+	p.gauge("edge_agent_open_fds", "Open file descriptors.", float64(m.OpenFDs))
+
+	p.help("edge_agent_heartbeats_total", "Heartbeats by outcome.", "counter")
+	p.sample("edge_agent_heartbeats_total", float64(m.HeartbeatsSent), "result", "sent")
+	p.sample("edge_agent_heartbeats_total", float64(m.HeartbeatsFailed), "result", "failed")
+
+	if !m.LastEnrollment.IsZero() {
+		p.gauge("edge_agent_last_enrollment_timestamp_seconds", "When the node last enrolled.", float64(m.LastEnrollment.Unix()))
+	}
+	if !status.LastHeartbeat.Time.IsZero() {
+		p.gauge("edge_agent_last_heartbeat_timestamp_seconds", "When the last heartbeat was attempted.", float64(status.LastHeartbeat.Time.Unix()))
+	}
+
+	queues := make([]string, 0, len(m.Queues))
+	for name := range m.Queues {
+		queues = append(queues, name)
+	}
+	sort.Strings(queues)
+	p.help("edge_agent_queue_depth", "Items waiting in the agent's queues.", "gauge")
+	for _, name := range queues {
+		p.sample("edge_agent_queue_depth", float64(m.Queues[name]), "queue", name)
+	}
+
+	stats := s.backend.EndpointStats()
+	p.help("edge_agent_requests_total", "Control plane requests by endpoint.", "counter")
+	for _, e := range stats {
+		p.sample("edge_agent_requests_total", float64(e.Requests), "endpoint", e.Endpoint)
+	}
+	p.help("edge_agent_request_failures_total", "Failed control plane requests by endpoint.", "counter")
+	for _, e := range stats {
+		p.sample("edge_agent_request_failures_total", float64(e.Failures), "endpoint", e.Endpoint)
+	}
+	p.help("edge_agent_request_duration_seconds", "Control plane request latency over recent requests.", "summary")
+	for _, e := range stats {
+		for _, q := range []struct {
+			quantile string
+			ms       float64
+		}{{"0.5", e.P50Ms}, {"0.9", e.P90Ms}, {"0.99", e.P99Ms}} {
+			p.sample("edge_agent_request_duration_seconds", q.ms/1000, "endpoint", e.Endpoint, "quantile", q.quantile)
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type promWriter struct {
+	w io.Writer
+}
+
+func (p promWriter) help(name, help, kind string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p promWriter) gauge(name, help string, value float64, labels ...string) {
+	p.help(name, help, "gauge")
+	p.sample(name, value, labels...)
+}
+
+func (p promWriter) counter(name, help string, value float64, labels ...string) {
+	p.help(name, help, "counter")
+	p.sample(name, value, labels...)
+}
+
+// sample writes one line; labels are name, value pairs.
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(p.w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
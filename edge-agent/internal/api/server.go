@@ -0,0 +1,459 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+	"github.com/pterodactyl-cp/edge-agent/internal/locks"
+	"github.com/pterodactyl-cp/edge-agent/internal/logging"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/updater"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// HeartbeatResult records the outcome of the most recent heartbeat.
+type HeartbeatResult struct {
+	Time    time.Time   `json:"time"`
+	Error   string      `json:"error,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+type Status struct {
+	Version            string               `json:"version"`
+	NodeID             string               `json:"node_id"`
+	SessionID          string               `json:"session_id"`
+	StartedAt          time.Time            `json:"started_at"`
+	Uptime             string               `json:"uptime"`
+	LogLevel           string               `json:"log_level"`
+	LastHeartbeat      HeartbeatResult      `json:"last_heartbeat"`
+	BufferedHeartbeats int                  `json:"buffered_heartbeats"`
+	Update             updater.Status       `json:"update"`
+	ControlPlanes      []ControlPlaneStatus `json:"control_planes"`
+	Auth               AuthStatus           `json:"auth"`
+	Drain              DrainStatus          `json:"drain"`
+	Standby            *StandbyStatus       `json:"standby,omitempty"`
+	ResponseCache      ResponseCacheStatus  `json:"response_cache"`
+	Bandwidth          *BandwidthUsage      `json:"bandwidth,omitempty"`
+	Locks              []locks.Holder       `json:"locks"`
+}
+
+// BandwidthUsage is the transfer per interface for the current calendar
+// month (UTC), with the previous month kept for billing after rollover.
+type BandwidthUsage struct {
+	Month      string                       `json:"month"` // YYYY-MM
+	Interfaces map[string]InterfaceTransfer `json:"interfaces"`
+	Previous   *BandwidthUsage              `json:"previous,omitempty"`
+	UpdatedAt  time.Time                    `json:"updated_at"`
+}
+
+// InterfaceTransfer is cumulative bytes received and sent.
+type InterfaceTransfer struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// ResponseCacheStatus counts conditional requests for cached control plane
+// resources. A hit is a 304 that saved a download.
+type ResponseCacheStatus struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// DrainStatus tracks taking the node out of service for maintenance.
+type DrainStatus struct {
+	State          string    `json:"state"` // "active", "draining" or "drained"
+	Reason         string    `json:"reason,omitempty"`
+	Since          time.Time `json:"since,omitempty"`
+	StopServers    bool      `json:"stop_servers"`
+	RunningServers int       `json:"running_servers"`
+}
+
+// StandbyStatus describes a spare node kept ready for activation. Images
+// maps each image to keep pulled to the last error pulling it, empty once
+// it's present.
+type StandbyStatus struct {
+	Since          time.Time         `json:"since"`
+	Images         map[string]string `json:"images"`
+	LastPull       time.Time         `json:"last_pull,omitempty"`
+	WingsInstalled bool              `json:"wings_installed"`
+}
+
+// AuthStatus reports whether the control plane is accepting the agent's
+// credentials.
+type AuthStatus struct {
+	State  string    `json:"state"` // "ok" or "rejected"
+	Since  time.Time `json:"since,omitempty"`
+	Status int       `json:"status,omitempty"`
+}
+
+// AgentMetrics describes the agent process itself, so a struggling agent
+// is as visible as a struggling node.
+type AgentMetrics struct {
+	Goroutines           int            `json:"goroutines"`
+	HeapBytes            uint64         `json:"heap_bytes"`
+	SysBytes             uint64         `json:"sys_bytes"` // memory obtained from the OS
+	GCRuns               uint32         `json:"gc_runs"`
+	OpenFDs              int            `json:"open_fds"`
+	UptimeSeconds        int64          `json:"uptime_seconds"`
+	HeartbeatsSent       int64          `json:"heartbeats_sent"`
+	HeartbeatsFailed     int64          `json:"heartbeats_failed"`
+	HeartbeatSuccessRate float64        `json:"heartbeat_success_rate"`
+	RequestP50Ms         float64        `json:"request_p50_ms"` // across all control plane endpoints
+	RequestP90Ms         float64        `json:"request_p90_ms"`
+	RequestP99Ms         float64        `json:"request_p99_ms"`
+	Queues               map[string]int `json:"queues"`
+	LastEnrollment       time.Time      `json:"last_enrollment,omitempty"`
+}
+
+// EndpointStats summarizes recent requests to one control-plane endpoint.
+type EndpointStats struct {
+	Endpoint    string  `json:"endpoint"`
+	Requests    int64   `json:"requests"`
+	Failures    int64   `json:"failures"`
+	Retries     int64   `json:"retries"`   // attempts repeated after a transient failure
+	Throttled   int64   `json:"throttled"` // retries caused by 429 responses
+	SuccessRate float64 `json:"success_rate"`
+	P50Ms       float64 `json:"p50_ms"`
+	P90Ms       float64 `json:"p90_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+	LastError   string  `json:"last_error,omitempty"`
+	LastServer  string  `json:"last_server,omitempty"` // control plane URL that served the last request
+}
+
+// ControlPlaneStatus describes one configured control plane endpoint.
+type ControlPlaneStatus struct {
+	URL       string  `json:"url"`
+	Region    string  `json:"region,omitempty"`
+	Active    bool    `json:"active"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMs float64 `json:"latency_ms"`
+	Served    int64   `json:"served"`
+	Failures  int64   `json:"failures"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// Backend is implemented by the agent.
+type Backend interface {
+	Status() Status
+	LastHeartbeat() HeartbeatResult
+	RedactedConfig() config.Config
+	ForceHeartbeat() error
+	EndpointStats() []EndpointStats
+	AgentMetrics() AgentMetrics
+	TaskHistory(q tasks.HistoryQuery) ([]tasks.HistoryEntry, error)
+	Subscribe() (<-chan events.Event, func())
+	Reload() error
+	DiagnosticsBundle(upload bool) (DiagnosticsBundle, error)
+	StatusPage() StatusPage
+}
+
+// DiagnosticsBundle describes a tar.gz of logs and node state written for
+// support.
+type DiagnosticsBundle struct {
+	Path     string   `json:"path"`
+	Size     int64    `json:"size"`
+	Files    []string `json:"files"`
+	UploadID string   `json:"upload_id,omitempty"` // set once the control plane has it
+}
+
+type Server struct {
+	backend Backend
+	auth    *authorizer
+	logger  *logrus.Entry
+	mux     *http.ServeMux
+}
+
+func New(backend Backend, auth config.LocalAPIAuthConfig, logger *logrus.Entry) *Server {
+	s := &Server{
+		backend: backend,
+		auth:    &authorizer{cfg: auth, enforced: auth.Enforced()},
+		logger:  logger.WithField("component", "api"),
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/heartbeat", s.handleHeartbeat)
+	s.mux.HandleFunc("/config", s.handleConfig)
+	s.mux.HandleFunc("/log-level", s.handleLogLevel)
+	s.mux.HandleFunc("/endpoints", s.handleEndpoints)
+	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/reload", s.handleReload)
+	s.mux.HandleFunc("/diagnostics", s.handleDiagnostics)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/tasks/history", s.handleTaskHistory)
+	s.mux.HandleFunc("/whoami", s.handleWhoami)
+	s.mux.HandleFunc("/", s.handleStatusPage)
+
+	return s
+}
+
+// Serve listens on a Unix socket and, if tcpAddr is set, on TCP as well
+// until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, socketPath, tcpAddr string) error {
+	// A stale socket from a previous run would make Listen fail.
+	os.Remove(socketPath)
+
+	unixListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// With roles configured, peer credentials decide who gets in, so
+	// viewers outside the agent's group need to be able to connect.
+	mode := os.FileMode(0660)
+	if viewers := s.auth.cfg.Viewers; s.auth.enforced && (len(viewers.Users) > 0 || len(viewers.Groups) > 0) {
+		mode = 0666
+	}
+	if err := os.Chmod(socketPath, mode); err != nil {
+		unixListener.Close()
+		return err
+	}
+
+	listeners := []net.Listener{unixListener}
+	if tcpAddr != "" {
+		tcpListener, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			unixListener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", tcpAddr, err)
+		}
+		listeners = append(listeners, tcpListener)
+	}
+
+	srv := &http.Server{
+		Handler:           s.authorize(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext:       peerContext,
+	}
+
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		s.logger.WithField("addr", l.Addr().String()).Info("Local API listening")
+		go func(l net.Listener) {
+			errCh <- srv.Serve(l)
+		}(l)
+	}
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		os.Remove(socketPath)
+		return nil
+	case err := <-errCh:
+		srv.Close()
+		return err
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.backend.Status())
+}
+
+// handleHeartbeat returns the last heartbeat result on GET and sends one
+// immediately on POST.
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.backend.LastHeartbeat())
+	case http.MethodPost:
+		if err := s.backend.ForceHeartbeat(); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.backend.LastHeartbeat())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	cfg := s.backend.RedactedConfig()
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	if err := s.backend.Reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
+
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	bundle, err := s.backend.DiagnosticsBundle(r.URL.Query().Get("upload") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+func (s *Server) handleEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.backend.EndpointStats())
+}
+
+// handleTaskHistory searches finished tasks. since and until take an
+// RFC 3339 time or a duration back from now, e.g. 24h.
+func (s *Server) handleTaskHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	query := r.URL.Query()
+	q := tasks.HistoryQuery{
+		Type:        query.Get("type"),
+		Status:      query.Get("status"),
+		RequestedBy: query.Get("requested_by"),
+		Search:      query.Get("q"),
+		Limit:       50,
+	}
+	var err error
+	if q.Since, err = parseHistoryTime(query.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since: %w", err))
+		return
+	}
+	if q.Until, err = parseHistoryTime(query.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid until: %w", err))
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %w", err))
+			return
+		}
+	}
+
+	entries, err := s.backend.TaskHistory(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func parseHistoryTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// handleEvents streams agent events as Server-Sent Events until the client
+// disconnects.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch, unsubscribe := s.backend.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comment lines keep idle connections from being closed by proxies.
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"level": logging.Level().String()})
+	case http.MethodPut, http.MethodPost:
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		level, err := logrus.ParseLevel(req.Level)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		logging.SetLevel(level)
+		s.logger.WithField("level", level.String()).Info("Log level changed")
+		writeJSON(w, http.StatusOK, map[string]string{"level": level.String()})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+}
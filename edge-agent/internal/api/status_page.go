@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+	"github.com/pterodactyl-cp/edge-agent/internal/health"
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// StatusPage is what the HTML status page shows: enough to see at a glance
+// whether the node is healthy without going through the panel.
+type StatusPage struct {
+	Status       Status
+	Hostname     string
+	Timezone     string // agent.timezone, used when the request doesn't pick one
+	Health       health.Report
+	WingsActive  bool
+	Wings        *wings.ProbeResult
+	WingsConsole *wings.ConsoleProbeResult
+	Tasks        []tasks.ActiveTask
+	Alerts       []events.Event // newest first
+}
+
+// handleStatusPage serves the status page at /. It's meant for an SSH
+// port-forward, so it has no scripts or external assets and refreshes
+// itself. Times are shown in ?tz= if given, else agent.timezone, else the
+// node's local zone.
+func (s *Server) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	page := s.backend.StatusPage()
+	loc := time.Local
+	zone := r.URL.Query().Get("tz")
+	if zone == "" {
+		zone = page.Timezone
+	}
+	if zone != "" {
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown timezone %q", zone))
+			return
+		}
+		loc = l
+	}
+
+	funcs := template.FuncMap{
+		"when": func(t time.Time) string {
+			if t.IsZero() {
+				return "never"
+			}
+			return t.In(loc).Format("2006-01-02 15:04:05 MST")
+		},
+		"ago": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return time.Since(t).Round(time.Second).String() + " ago"
+		},
+		"alert": alertText,
+	}
+	tmpl, err := template.New("status").Funcs(funcs).Parse(statusPageTemplate)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.Execute(w, map[string]interface{}{
+		"Page":     page,
+		"Location": loc.String(),
+		"Now":      time.Now(),
+	}); err != nil {
+		s.logger.WithError(err).Warn("Failed to render status page")
+	}
+}
+
+// alertText is an alert's message, falling back to its data as JSON for
+// alerts that don't carry one.
+func alertText(e events.Event) string {
+	if data, ok := e.Data.(map[string]interface{}); ok {
+		if msg, ok := data["message"].(string); ok && msg != "" {
+			if source, ok := data["source"].(string); ok && source != "" {
+				return source + ": " + msg
+			}
+			return msg
+		}
+	}
+	out, _ := json.Marshal(e.Data)
+	return strings.TrimSpace(string(out))
+}
+
+const statusPageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>{{.Page.Hostname}} - edge agent</title>
+<style>
+body { font: 14px/1.4 system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; margin-bottom: 0; }
+h2 { font-size: 1.1em; margin-top: 1.6em; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 12px 2px 0; text-align: left; vertical-align: top; }
+.ok { color: #1a7f37; } .bad { color: #cf222e; } .muted { color: #777; }
+</style>
+</head>
+<body>
+{{- $p := .Page}}
+<h1>{{$p.Hostname}}</h1>
+<p class="muted">node {{$p.Status.NodeID}} &middot; agent {{$p.Status.Version}} &middot; up {{$p.Status.Uptime}} &middot; {{when .Now}} ({{.Location}})</p>
+
+<h2>Control plane</h2>
+<table>
+<tr><th>Last heartbeat</th><td>{{when $p.Status.LastHeartbeat.Time}} <span class="muted">{{ago $p.Status.LastHeartbeat.Time}}</span>
+{{- if $p.Status.LastHeartbeat.Error}} <span class="bad">{{$p.Status.LastHeartbeat.Error}}</span>{{end}}</td></tr>
+<tr><th>Buffered heartbeats</th><td>{{$p.Status.BufferedHeartbeats}}</td></tr>
+<tr><th>Credentials</th><td class="{{if eq $p.Status.Auth.State "ok"}}ok{{else}}bad{{end}}">{{$p.Status.Auth.State}}</td></tr>
+<tr><th>Scheduling</th><td>{{$p.Status.Drain.State}}{{if $p.Status.Drain.Reason}} ({{$p.Status.Drain.Reason}}){{end}}{{if $p.Status.Standby}}, standby{{end}}</td></tr>
+</table>
+
+<h2>Health</h2>
+<p>Score <strong>{{$p.Health.Score}}</strong>/100</p>
+{{- if $p.Health.Checks}}
+<table>
+{{- range $p.Health.Checks}}
+<tr><td class="{{if .OK}}ok{{else}}bad{{end}}">{{if .OK}}pass{{else}}fail{{end}}</td><td>{{.Name}}</td><td class="muted">{{when .CheckedAt}}</td><td>{{.Output}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Wings</h2>
+<table>
+<tr><th>Service</th><td class="{{if $p.WingsActive}}ok{{else}}bad{{end}}">{{if $p.WingsActive}}active{{else}}inactive{{end}}</td></tr>
+{{- with $p.Wings}}
+<tr><th>API</th><td class="{{if .Reachable}}ok{{else}}bad{{end}}">{{if .Reachable}}reachable, {{printf "%.0f" .LatencyMs}} ms{{else}}unreachable{{if .Error}}: {{.Error}}{{end}}{{end}}</td></tr>
+<tr><th>Servers</th><td>{{.RunningServers}} running of {{.ServerCount}}</td></tr>
+{{- end}}
+{{- with $p.WingsConsole}}
+<tr><th>Consoles</th><td class="{{if or .Healthy .Skipped}}ok{{else}}bad{{end}}">{{if .Skipped}}no servers to check{{else if .Healthy}}connecting{{else}}failing at {{.Stage}}: {{.Error}}{{end}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Active tasks</h2>
+{{- if $p.Tasks}}
+<table>
+<tr><th>Task</th><th>Type</th><th>Started</th><th>Requested by</th></tr>
+{{- range $p.Tasks}}
+<tr><td>{{.ID}}</td><td>{{.Type}}</td><td>{{when .StartedAt}} <span class="muted">{{ago .StartedAt}}</span></td><td>{{.RequestedBy}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">None running.</p>
+{{- end}}
+
+<h2>Recent alerts</h2>
+{{- if $p.Alerts}}
+<table>
+{{- range $p.Alerts}}
+<tr><td class="muted">{{when .Time}}</td><td>{{alert .}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">No alerts since the agent started.</p>
+{{- end}}
+</body>
+</html>
+`
@@ -0,0 +1,56 @@
+// Package attest produces hardware- or cloud-backed evidence of a node's
+// identity for enrollment, so a stolen enrollment token alone isn't enough
+// to pass another machine off as the node.
+package attest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Evidence goes with the enrollment or activation request. Data is
+// provider-specific:
+//
+//	tpm:   ek_public, ak_public (PEM), ek_certificate (base64 DER, when the
+//	       TPM has one), quote, signature and pcrs (base64, from tpm2_quote)
+//	aws:   document and pkcs7, the signed instance identity document
+//	gcp:   token, the instance identity JWT with the nonce as audience
+//	azure: document, the PKCS#7 attested data, with AzureNonce(nonce)
+type Evidence struct {
+	Provider string            `json:"provider"`
+	Nonce    string            `json:"nonce"`
+	Data     map[string]string `json:"data"`
+}
+
+// Provider attests to the machine the agent runs on.
+type Provider interface {
+	Name() string
+	Attest(ctx context.Context, nonce string) (*Evidence, error)
+}
+
+// New returns the provider for the control_plane.attestation setting, or
+// nil for none. The TPM provider works in dataDir.
+func New(name, dataDir string) (Provider, error) {
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "tpm":
+		return &tpmProvider{dataDir: dataDir}, nil
+	case "aws":
+		return cloudProvider{name: name, attest: awsIdentity}, nil
+	case "gcp":
+		return cloudProvider{name: name, attest: gcpIdentity}, nil
+	case "azure":
+		return cloudProvider{name: name, attest: azureIdentity}, nil
+	}
+	return nil, fmt.Errorf("unknown attestation provider %q", name)
+}
+
+// Nonce binds evidence to one request: the token it presents and the CSR
+// of the key the node will hold. The control plane computes the same.
+func Nonce(token, csr string) string {
+	sum := sha256.Sum256([]byte(token + "\n" + csr))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package attest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	metadataHost = "http://169.254.169.254"
+	gcpMetadata  = "http://metadata.google.internal/computeMetadata/v1"
+)
+
+// metadataClient never goes through a proxy: the metadata service is only
+// reachable from the instance itself.
+var metadataClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{Proxy: nil},
+}
+
+// cloudProvider attests with the signed identity the provider's metadata
+// service hands out to the instance.
+type cloudProvider struct {
+	name   string
+	attest func(ctx context.Context, nonce string) (map[string]string, error)
+}
+
+func (c cloudProvider) Name() string { return c.name }
+
+func (c cloudProvider) Attest(ctx context.Context, nonce string) (*Evidence, error) {
+	data, err := c.attest(ctx, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s instance identity: %w", c.name, err)
+	}
+	return &Evidence{Provider: c.name, Nonce: nonce, Data: data}, nil
+}
+
+// awsIdentity returns the instance identity document and its PKCS#7
+// signature. EC2 can't sign a nonce, so the control plane should also
+// check the instance isn't already enrolled.
+func awsIdentity(ctx context.Context, _ string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, metadataHost+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := metadataDo(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata token: %w", err)
+	}
+	header := http.Header{"X-aws-ec2-metadata-token": {string(token)}}
+
+	document, err := metadataGet(ctx, metadataHost+"/latest/dynamic/instance-identity/document", header)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := metadataGet(ctx, metadataHost+"/latest/dynamic/instance-identity/pkcs7", header)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"document": string(document), "pkcs7": string(signature)}, nil
+}
+
+// gcpIdentity returns an identity token for the instance's default service
+// account, with the nonce as its audience.
+func gcpIdentity(ctx context.Context, nonce string) (map[string]string, error) {
+	query := url.Values{"audience": {nonce}, "format": {"full"}}
+	token, err := metadataGet(ctx, gcpMetadata+"/instance/service-accounts/default/identity?"+query.Encode(),
+		http.Header{"Metadata-Flavor": {"Google"}})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"token": string(token)}, nil
+}
+
+// azureIdentity returns the attested data document, which Azure signs with
+// the nonce embedded.
+func azureIdentity(ctx context.Context, nonce string) (map[string]string, error) {
+	query := url.Values{"api-version": {"2020-09-01"}, "nonce": {AzureNonce(nonce)}}
+	body, err := metadataGet(ctx, metadataHost+"/metadata/attested/document?"+query.Encode(),
+		http.Header{"Metadata": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid attested document: %w", err)
+	}
+	return map[string]string{"document": doc.Signature}, nil
+}
+
+// AzureNonce fits a nonce into the 10 digits Azure accepts: the first 8
+// bytes as a number, modulo 10^10.
+func AzureNonce(nonce string) string {
+	raw, err := hex.DecodeString(nonce)
+	if err != nil || len(raw) < 8 {
+		return ""
+	}
+	return fmt.Sprintf("%010d", binary.BigEndian.Uint64(raw)%1e10)
+}
+
+func metadataGet(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return metadataDo(req)
+}
+
+func metadataDo(req *http.Request) ([]byte, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metadata service: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service returned %s for %s", resp.Status, req.URL.Path)
+	}
+	return data, nil
+}
@@ -0,0 +1,96 @@
+package attest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoTPM means the machine has no TPM the agent can use, or tpm2-tools
+// isn't installed.
+var ErrNoTPM = errors.New("no TPM 2.0 device or tpm2-tools not installed")
+
+// quotePCRs are the boot measurements the quote covers: firmware, boot
+// loader and their configuration.
+const quotePCRs = "sha256:0,1,2,3,4,5,6,7"
+
+// ekCertIndex is where the manufacturer stores the RSA endorsement key
+// certificate, when there is one.
+const ekCertIndex = "0x01c00002"
+
+// tpmProvider quotes the boot PCRs with an attestation key made under the
+// TPM's endorsement key, through tpm2-tools. The endorsement key is derived
+// from the TPM's seed, so it is the same on every call and ties the quote to
+// this chip; the control plane checks it against the one it has on record,
+// or against the manufacturer certificate on first enrollment.
+type tpmProvider struct {
+	dataDir string
+}
+
+func (t *tpmProvider) Name() string { return "tpm" }
+
+func (t *tpmProvider) Attest(ctx context.Context, nonce string) (*Evidence, error) {
+	if _, err := exec.LookPath("tpm2_quote"); err != nil {
+		return nil, ErrNoTPM
+	}
+	if _, err := os.Stat("/dev/tpmrm0"); err != nil {
+		return nil, ErrNoTPM
+	}
+
+	dir, err := os.MkdirTemp(t.dataDir, "attest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	steps := [][]string{
+		{"tpm2_createek", "-c", path("ek.ctx"), "-G", "rsa", "-u", path("ek.pem"), "-f", "pem"},
+		{"tpm2_createak", "-C", path("ek.ctx"), "-c", path("ak.ctx"), "-G", "rsa", "-g", "sha256", "-s", "rsassa",
+			"-u", path("ak.pem"), "-f", "pem", "-n", path("ak.name")},
+		{"tpm2_quote", "-c", path("ak.ctx"), "-l", quotePCRs, "-q", nonce, "-g", "sha256",
+			"-m", path("quote.msg"), "-s", path("quote.sig"), "-o", path("quote.pcrs")},
+	}
+	for _, step := range steps {
+		if err := run(ctx, step[0], step[1:]...); err != nil {
+			return nil, err
+		}
+	}
+
+	evidence := &Evidence{Provider: "tpm", Nonce: nonce, Data: map[string]string{}}
+	for key, file := range map[string]string{"ek_public": "ek.pem", "ak_public": "ak.pem"} {
+		data, err := os.ReadFile(path(file))
+		if err != nil {
+			return nil, err
+		}
+		evidence.Data[key] = string(data)
+	}
+	for key, file := range map[string]string{"quote": "quote.msg", "signature": "quote.sig", "pcrs": "quote.pcrs"} {
+		data, err := os.ReadFile(path(file))
+		if err != nil {
+			return nil, err
+		}
+		evidence.Data[key] = base64.StdEncoding.EncodeToString(data)
+	}
+
+	// Plenty of TPMs, firmware ones especially, don't carry a certificate.
+	if err := run(ctx, "tpm2_nvread", ekCertIndex, "-o", path("ek.der")); err == nil {
+		if data, err := os.ReadFile(path("ek.der")); err == nil {
+			evidence.Data["ek_certificate"] = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return evidence, nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
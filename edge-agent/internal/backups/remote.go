@@ -0,0 +1,392 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	KindBackup  = "backup"
+	KindRestore = "restore"
+
+	StatusRunning = "running"
+
+	progressInterval = 15 * time.Second
+
+	// Finished jobs kept for remote_backup_status.
+	maxJobs = 50
+)
+
+// Job is a backup or restore of one server's data directory, triggered by
+// the control plane. These complement Wings' own backups: the archive goes
+// straight to the bucket, so the node's disk can be lost with it.
+type Job struct {
+	ID        string `json:"id"`
+	Server    string `json:"server"`
+	Target    Target `json:"target"`
+	Retention int    `json:"retention,omitempty"` // remote backups of the server kept, 0 keeps all
+	Key       string `json:"key,omitempty"`       // object to restore
+}
+
+// Progress is a job's state as reported in events.
+type Progress struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	Server      string    `json:"server"`
+	Key         string    `json:"key,omitempty"`
+	Status      string    `json:"status"`
+	TotalBytes  int64     `json:"total_bytes"`  // of server files, or of the archive for a restore
+	DoneBytes   int64     `json:"done_bytes"`   // of the same
+	StoredBytes int64     `json:"stored_bytes"` // compressed size in the bucket
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+}
+
+// Remote runs backups to and restores from S3-compatible targets, at most
+// MaxConcurrent at once and one per server.
+type Remote struct {
+	wingsPath string
+	api       *wings.APIClient
+	partSize  int
+	timeout   time.Duration
+	notify    Notifier
+	logger    *logrus.Entry
+	slots     chan struct{}
+
+	mu   sync.Mutex
+	jobs []*Progress
+	busy map[string]bool // by server
+}
+
+func NewRemote(cfg config.BackupsConfig, wingsConfigPath string, notify Notifier, logger *logrus.Entry) *Remote {
+	workers := cfg.MaxConcurrent
+	if workers <= 0 {
+		workers = 1
+	}
+	partSize := cfg.PartSize << 20
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	return &Remote{
+		wingsPath: wingsConfigPath,
+		api:       wings.NewAPIClient(wingsConfigPath),
+		partSize:  partSize,
+		timeout:   time.Duration(cfg.Timeout) * time.Second,
+		notify:    notify,
+		logger:    logger.WithField("component", "remote_backups"),
+		slots:     make(chan struct{}, workers),
+		busy:      make(map[string]bool),
+	}
+}
+
+// Backup starts archiving the server's files to the target and returns
+// straight away; progress and the outcome are reported as events.
+func (r *Remote) Backup(ctx context.Context, job Job) (*Progress, error) {
+	if err := job.Target.validate(); err != nil {
+		return nil, err
+	}
+	dir, err := r.serverDir(job.Server)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s/%s-%s.tar.gz", job.Server, time.Now().UTC().Format("20060102T150405Z"), job.ID)
+	progress, err := r.begin(job, KindBackup, job.Target.key(name))
+	if err != nil {
+		return nil, err
+	}
+
+	go r.run(ctx, progress, func(ctx context.Context) error {
+		atomic.StoreInt64(&progress.TotalBytes, dirSize(dir))
+		return r.backup(ctx, job, dir, progress)
+	})
+	return r.snapshot(progress), nil
+}
+
+// Restore replaces the server's files with a backup from the target. The
+// server must be offline; its current files are only removed once the
+// archive has been fully extracted.
+func (r *Remote) Restore(ctx context.Context, job Job) (*Progress, error) {
+	if err := job.Target.validate(); err != nil {
+		return nil, err
+	}
+	if job.Key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	dir, err := r.serverDir(job.Server)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkOffline(job.Server); err != nil {
+		return nil, err
+	}
+	progress, err := r.begin(job, KindRestore, job.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	go r.run(ctx, progress, func(ctx context.Context) error {
+		return r.restore(ctx, job, dir, progress)
+	})
+	return r.snapshot(progress), nil
+}
+
+// List returns the server's backups stored on the target, oldest first.
+func (r *Remote) List(ctx context.Context, target Target, server string) ([]Object, error) {
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+	return newS3Client(target).List(ctx, target.key(server+"/"))
+}
+
+// Jobs returns running and recently finished jobs, newest first.
+func (r *Remote) Jobs() []Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Progress, 0, len(r.jobs))
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		out = append(out, *r.snapshotLocked(r.jobs[i]))
+	}
+	return out
+}
+
+func (r *Remote) serverDir(server string) (string, error) {
+	if server == "" || strings.ContainsAny(server, `/\`) || server == "." || server == ".." {
+		return "", fmt.Errorf("invalid server %q", server)
+	}
+	cfg, err := wings.LoadConfig(r.wingsPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfg.DataDirectory(), server), nil
+}
+
+func (r *Remote) checkOffline(server string) error {
+	servers, err := r.api.Servers()
+	if err != nil {
+		return fmt.Errorf("failed to check server state: %w", err)
+	}
+	for _, s := range servers {
+		if s.UUID == server && s.State != "offline" {
+			return fmt.Errorf("server %s is %s, stop it before restoring", server, s.State)
+		}
+	}
+	return nil
+}
+
+func (r *Remote) begin(job Job, kind, key string) (*Progress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.busy[job.Server] {
+		return nil, fmt.Errorf("a backup or restore of %s is already running", job.Server)
+	}
+	r.busy[job.Server] = true
+
+	progress := &Progress{
+		ID:        job.ID,
+		Kind:      kind,
+		Server:    job.Server,
+		Key:       key,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	r.jobs = append(r.jobs, progress)
+	if n := len(r.jobs); n > maxJobs {
+		r.jobs = r.jobs[n-maxJobs:]
+	}
+	return progress, nil
+}
+
+// run waits for a slot, runs the job and reports progress until it ends.
+func (r *Remote) run(ctx context.Context, progress *Progress, fn func(context.Context) error) {
+	logger := r.logger.WithFields(logrus.Fields{"job": progress.ID, "server": progress.Server, "key": progress.Key})
+	defer func() {
+		r.mu.Lock()
+		delete(r.busy, progress.Server)
+		r.mu.Unlock()
+	}()
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		r.finish(progress, ctx.Err())
+		return
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	logger.Infof("Starting remote %s", progress.Kind)
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.notify != nil {
+				r.notify("remote_"+progress.Kind+"_progress", r.snapshot(progress))
+			}
+		case err := <-done:
+			if err != nil {
+				logger.WithError(err).Warnf("Remote %s failed", progress.Kind)
+			} else {
+				logger.Infof("Remote %s completed", progress.Kind)
+			}
+			r.finish(progress, err)
+			return
+		}
+	}
+}
+
+func (r *Remote) finish(progress *Progress, err error) {
+	r.mu.Lock()
+	progress.FinishedAt = time.Now().UTC()
+	progress.Status = StatusCompleted
+	if err != nil {
+		progress.Status = StatusFailed
+		progress.Error = err.Error()
+	}
+	snapshot := r.snapshotLocked(progress)
+	r.mu.Unlock()
+
+	if r.notify != nil {
+		r.notify("remote_"+progress.Kind+"_"+snapshot.Status, snapshot)
+	}
+}
+
+func (r *Remote) snapshot(progress *Progress) *Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked(progress)
+}
+
+// snapshotLocked copies progress, reading the counters the job updates
+// atomically. Callers hold mu.
+func (r *Remote) snapshotLocked(progress *Progress) *Progress {
+	p := *progress
+	p.TotalBytes = atomic.LoadInt64(&progress.TotalBytes)
+	p.DoneBytes = atomic.LoadInt64(&progress.DoneBytes)
+	p.StoredBytes = atomic.LoadInt64(&progress.StoredBytes)
+	return &p
+}
+
+// backup pipes the archive straight into a multipart upload, nothing is
+// staged on disk.
+func (r *Remote) backup(ctx context.Context, job Job, dir string, progress *Progress) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	client := newS3Client(job.Target)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(ctx, dir, pw, &progress.DoneBytes))
+	}()
+
+	_, err := client.Upload(ctx, progress.Key, &countingReader{r: pr, n: &progress.StoredBytes}, r.partSize)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	if job.Retention > 0 {
+		r.enforceRetention(ctx, client, job)
+	}
+	return nil
+}
+
+// enforceRetention deletes the server's oldest remote backups beyond the
+// job's retention. Keys start with a timestamp, so they sort by age.
+func (r *Remote) enforceRetention(ctx context.Context, client *s3Client, job Job) {
+	prefix := job.Target.key(job.Server + "/")
+	objects, err := client.List(ctx, prefix)
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to list remote backups for retention")
+		return
+	}
+	var archives []Object
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, prefix)
+		if strings.HasSuffix(name, ".tar.gz") && !strings.Contains(name, "/") {
+			archives = append(archives, o)
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Key < archives[j].Key })
+	if len(archives) <= job.Retention {
+		return
+	}
+
+	for _, o := range archives[:len(archives)-job.Retention] {
+		logger := r.logger.WithFields(logrus.Fields{"server": job.Server, "key": o.Key})
+		if err := client.Delete(ctx, o.Key); err != nil {
+			logger.WithError(err).Warn("Failed to delete expired remote backup")
+			continue
+		}
+		logger.Info("Deleted expired remote backup")
+	}
+}
+
+// restore extracts into a staging directory next to the server's, then
+// swaps the two.
+func (r *Remote) restore(ctx context.Context, job Job, dir string, progress *Progress) error {
+	body, size, err := newS3Client(job.Target).Download(ctx, job.Key)
+	if err != nil {
+		return fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer body.Close()
+	atomic.StoreInt64(&progress.TotalBytes, size)
+	atomic.StoreInt64(&progress.StoredBytes, size)
+
+	staging := filepath.Join(filepath.Dir(dir), "."+job.Server+".restore")
+	old := filepath.Join(filepath.Dir(dir), "."+job.Server+".old")
+	os.RemoveAll(staging)
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return err
+	}
+	if err := extractArchive(ctx, &countingReader{r: body, n: &progress.DoneBytes}, staging); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to extract backup: %w", err)
+	}
+
+	// The directory itself keeps the ownership and mode Wings gave it.
+	if info, err := os.Stat(dir); err == nil {
+		os.Chmod(staging, info.Mode().Perm())
+		if uid, gid, ok := owner(info); ok {
+			os.Chown(staging, uid, gid)
+		}
+	}
+
+	os.RemoveAll(old)
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(staging)
+		return err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
@@ -0,0 +1,347 @@
+package backups
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minPartSize = 5 << 20
+
+// Target is an S3-compatible bucket: AWS S3, Backblaze B2's S3 API, MinIO
+// and the like. The control plane sends it with each job, so credentials
+// aren't kept on the node.
+type Target struct {
+	Endpoint  string `json:"endpoint"` // e.g. https://s3.eu-central-003.backblazeb2.com
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	PathStyle bool   `json:"path_style,omitempty"` // bucket in the path rather than the host, as MinIO expects
+}
+
+func (t Target) validate() error {
+	switch {
+	case t.Endpoint == "":
+		return errors.New("target endpoint is required")
+	case t.Bucket == "":
+		return errors.New("target bucket is required")
+	case t.AccessKey == "" || t.SecretKey == "":
+		return errors.New("target credentials are required")
+	}
+	u, err := url.Parse(t.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("invalid target endpoint %q", t.Endpoint)
+	}
+	return nil
+}
+
+// key joins the target prefix onto an object name.
+func (t Target) key(name string) string {
+	if t.Prefix == "" {
+		return name
+	}
+	return strings.Trim(t.Prefix, "/") + "/" + name
+}
+
+// Object is a stored backup as listed from the bucket.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// s3Client signs requests with AWS Signature Version 4, which every
+// S3-compatible store accepts.
+type s3Client struct {
+	target Target
+	http   *http.Client
+}
+
+func newS3Client(target Target) *s3Client {
+	if target.Region == "" {
+		target.Region = "us-east-1"
+	}
+	return &s3Client{target: target, http: &http.Client{}}
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// do sends a signed request for key, "" addressing the bucket itself. The
+// caller closes the response body.
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, _ := url.Parse(strings.TrimSuffix(c.target.Endpoint, "/"))
+	host := endpoint.Host
+	path := "/" + escapePath(key)
+	if c.target.PathStyle {
+		path = "/" + c.target.Bucket + path
+	} else {
+		host = c.target.Bucket + "." + host
+	}
+
+	u := &url.URL{Scheme: endpoint.Scheme, Host: host, Path: unescapedPath(path), RawPath: path, RawQuery: canonicalQuery(query)}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	c.sign(req, path, query, body, time.Now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var s3err s3Error
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if xml.Unmarshal(data, &s3err) == nil && s3err.Code != "" {
+			return nil, &s3err
+		}
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, c.target.Endpoint)
+	}
+	return resp, nil
+}
+
+func (c *s3Client) sign(req *http.Request, path string, query url.Values, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(query),
+		"host:" + req.URL.Host + "\n" + "x-amz-content-sha256:" + payloadHash + "\n" + "x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.target.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+c.target.SecretKey), date)
+	key = hmacSHA256(key, c.target.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.target.AccessKey, scope, signedHeaders, signature))
+}
+
+// Upload streams r into key as a multipart upload, buffering one part at a
+// time, so archives of any size go out without touching the local disk.
+func (c *s3Client) Upload(ctx context.Context, key string, r io.Reader, partSize int) (int64, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return 0, fmt.Errorf("invalid upload response: %w", err)
+	}
+
+	size, err := c.uploadParts(ctx, key, initiated.UploadID, r, partSize)
+	if err != nil {
+		if resp, abortErr := c.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return size, err
+	}
+	return size, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *s3Client) uploadParts(ctx context.Context, key, uploadID string, r io.Reader, partSize int) (int64, error) {
+	var parts []completedPart
+	var size int64
+	buf := make([]byte, partSize)
+
+	for number := 1; ; number++ {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return size, readErr
+		}
+		if n == 0 && number > 1 {
+			break
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := c.do(ctx, http.MethodPut, key, query, buf[:n])
+		if err != nil {
+			return size, fmt.Errorf("failed to upload part %d: %w", number, err)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		size += int64(n)
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return size, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return size, fmt.Errorf("failed to complete upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 can report a failed completion in the body of a 200 response.
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var s3err s3Error
+	if xml.Unmarshal(data, &s3err) == nil && s3err.Code != "" {
+		return size, fmt.Errorf("failed to complete upload: %w", &s3err)
+	}
+	return size, nil
+}
+
+func (c *s3Client) Download(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (c *s3Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns every object under prefix, sorted by key.
+func (c *s3Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %w", err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, Object{Key: o.Key, Size: o.Size, LastModified: o.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// canonicalQuery encodes query the way SigV4 expects: sorted, with every
+// reserved character escaped.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapePath(key string) string {
+	return escape(key, true)
+}
+
+func unescapedPath(path string) string {
+	p, _ := url.PathUnescape(path)
+	return p
+}
+
+// escape is SigV4's URI encoding: everything but unreserved characters,
+// and slashes when keepSlash is set.
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/' && keepSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
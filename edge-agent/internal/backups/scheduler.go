@@ -0,0 +1,388 @@
+package backups
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/schedule"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TargetLocal = "local"
+
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+
+	// How often a running backup's archive is checked for completion.
+	pollInterval = 10 * time.Second
+
+	// Records kept in schedules.json. Older ones are forgotten, not deleted.
+	maxHistory = 500
+)
+
+// Schedule is a per-server backup schedule delegated by the control plane.
+type Schedule struct {
+	ID        string `json:"id"`
+	Server    string `json:"server"`
+	Cron      string `json:"cron"`
+	Retention int    `json:"retention"` // completed backups kept, 0 keeps all
+	Target    string `json:"target"`
+	Ignore    string `json:"ignore,omitempty"` // .pteroignore style patterns
+}
+
+// Record is a backup taken by a schedule.
+type Record struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	Server     string    `json:"server"`
+	Status     string    `json:"status"`
+	Size       int64     `json:"size,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Notifier is told about every finished backup.
+type Notifier func(eventType string, data interface{})
+
+type state struct {
+	Schedules []Schedule `json:"schedules"`
+	Backups   []Record   `json:"backups"`
+}
+
+// Scheduler runs backup schedules through Wings. At most MaxConcurrent
+// backups run at once; due schedules queue behind them instead of all
+// hitting the disks at midnight.
+type Scheduler struct {
+	path       string
+	wingsPath  string
+	api        *wings.APIClient
+	timeout    time.Duration
+	workers    int
+	notify     Notifier
+	logger     *logrus.Entry
+	queue      chan Schedule
+	mu         sync.Mutex
+	state      state
+	crons      map[string]*schedule.Cron
+	next       map[string]time.Time
+	inProgress map[string]bool // by server
+}
+
+func New(dir string, cfg config.BackupsConfig, wingsConfigPath string, notify Notifier, logger *logrus.Entry) (*Scheduler, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup state directory: %w", err)
+	}
+
+	workers := cfg.MaxConcurrent
+	if workers <= 0 {
+		workers = 1
+	}
+
+	s := &Scheduler{
+		path:       filepath.Join(dir, "schedules.json"),
+		wingsPath:  wingsConfigPath,
+		api:        wings.NewAPIClient(wingsConfigPath),
+		timeout:    time.Duration(cfg.Timeout) * time.Second,
+		workers:    workers,
+		notify:     notify,
+		logger:     logger.WithField("component", "backups"),
+		queue:      make(chan Schedule, 256),
+		crons:      make(map[string]*schedule.Cron),
+		next:       make(map[string]time.Time),
+		inProgress: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read backup schedules: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse backup schedules: %w", err)
+		}
+	}
+	if err := s.compile(s.state.Schedules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compile parses the cron specs and resets the next run times. Callers
+// hold mu, or own s exclusively.
+func (s *Scheduler) compile(schedules []Schedule) error {
+	crons := make(map[string]*schedule.Cron, len(schedules))
+	for _, sched := range schedules {
+		if sched.ID == "" || sched.Server == "" {
+			return fmt.Errorf("backup schedule needs an id and a server")
+		}
+		if sched.Target != "" && sched.Target != TargetLocal {
+			return fmt.Errorf("schedule %s: unsupported backup target %q", sched.ID, sched.Target)
+		}
+		c, err := schedule.ParseCron(sched.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", sched.ID, err)
+		}
+		crons[sched.ID] = c
+	}
+
+	now := time.Now()
+	s.crons = crons
+	s.next = make(map[string]time.Time, len(crons))
+	for id, c := range crons {
+		s.next[id] = c.Next(now)
+	}
+	return nil
+}
+
+// SetSchedules replaces every schedule. History for removed schedules is
+// kept, their backups are left for the control plane to clean up.
+func (s *Scheduler) SetSchedules(schedules []Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.compile(schedules); err != nil {
+		return err
+	}
+	s.state.Schedules = schedules
+	return s.save()
+}
+
+func (s *Scheduler) Schedules() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Schedule(nil), s.state.Schedules...)
+}
+
+// History returns the recorded backups, newest first.
+func (s *Scheduler) History() []Record {
+	s.mu.Lock()
+	records := append([]Record(nil), s.state.Backups...)
+	s.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].StartedAt.After(records[j].StartedAt) })
+	return records
+}
+
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save backup schedules: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Start begins checking schedules every minute and the backup workers.
+func (s *Scheduler) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+	go s.loop(ctx)
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.enqueueDue(now)
+		}
+	}
+}
+
+func (s *Scheduler) enqueueDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sched := range s.state.Schedules {
+		next, ok := s.next[sched.ID]
+		if !ok || next.IsZero() || now.Before(next) {
+			continue
+		}
+		s.next[sched.ID] = s.crons[sched.ID].Next(now)
+
+		// A server that's still being backed up skips this run rather
+		// than queueing a second archive of the same volume.
+		if s.inProgress[sched.Server] {
+			s.logger.WithField("schedule", sched.ID).Warn("Previous backup still running, skipping")
+			continue
+		}
+
+		select {
+		case s.queue <- sched:
+			s.inProgress[sched.Server] = true
+		default:
+			s.logger.WithField("schedule", sched.ID).Warn("Backup queue full, skipping")
+		}
+	}
+}
+
+func (s *Scheduler) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sched := <-s.queue:
+			s.run(ctx, sched)
+
+			s.mu.Lock()
+			delete(s.inProgress, sched.Server)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, sched Schedule) {
+	record := Record{
+		ID:         newBackupUUID(),
+		ScheduleID: sched.ID,
+		Server:     sched.Server,
+		StartedAt:  time.Now().UTC(),
+	}
+	logger := s.logger.WithFields(logrus.Fields{
+		"schedule": sched.ID,
+		"server":   sched.Server,
+		"backup":   record.ID,
+	})
+	logger.Info("Starting scheduled backup")
+
+	size, err := s.backup(ctx, sched, record.ID)
+	record.FinishedAt = time.Now().UTC()
+	record.Size = size
+	if err != nil {
+		record.Status = StatusFailed
+		record.Error = err.Error()
+		logger.WithError(err).Warn("Scheduled backup failed")
+	} else {
+		record.Status = StatusCompleted
+		logger.WithField("size", size).Info("Scheduled backup completed")
+	}
+
+	s.mu.Lock()
+	s.state.Backups = append(s.state.Backups, record)
+	expired := s.expired(sched)
+	if n := len(s.state.Backups); n > maxHistory {
+		s.state.Backups = s.state.Backups[n-maxHistory:]
+	}
+	if err := s.save(); err != nil {
+		logger.WithError(err).Warn("Failed to save backup history")
+	}
+	s.mu.Unlock()
+
+	if s.notify != nil {
+		s.notify("backup_"+record.Status, record)
+	}
+
+	for _, old := range expired {
+		s.prune(old)
+	}
+}
+
+func (s *Scheduler) backup(ctx context.Context, sched Schedule, backupUUID string) (int64, error) {
+	cfg, err := wings.LoadConfig(s.wingsPath)
+	if err != nil {
+		return 0, err
+	}
+	archive := filepath.Join(cfg.BackupDirectory(), backupUUID+".tar.gz")
+
+	if err := s.api.CreateBackup(sched.Server, backupUUID, sched.Ignore); err != nil {
+		return 0, fmt.Errorf("failed to start backup: %w", err)
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	// Wings archives in the background; the backup is done once the
+	// archive exists and has stopped growing.
+	var lastSize int64 = -1
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return lastSize, fmt.Errorf("backup did not finish: %w", ctx.Err())
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(archive)
+		if err != nil {
+			continue
+		}
+		if info.Size() > 0 && info.Size() == lastSize {
+			return info.Size(), nil
+		}
+		lastSize = info.Size()
+	}
+}
+
+// expired removes completed backups beyond the schedule's retention from
+// the history and returns them. Callers hold mu.
+func (s *Scheduler) expired(sched Schedule) []Record {
+	if sched.Retention <= 0 {
+		return nil
+	}
+
+	var completed []int
+	for i, r := range s.state.Backups {
+		if r.ScheduleID == sched.ID && r.Status == StatusCompleted {
+			completed = append(completed, i)
+		}
+	}
+	if len(completed) <= sched.Retention {
+		return nil
+	}
+
+	drop := make(map[int]bool)
+	var expired []Record
+	for _, i := range completed[:len(completed)-sched.Retention] {
+		drop[i] = true
+		expired = append(expired, s.state.Backups[i])
+	}
+
+	kept := s.state.Backups[:0]
+	for i, r := range s.state.Backups {
+		if !drop[i] {
+			kept = append(kept, r)
+		}
+	}
+	s.state.Backups = kept
+	return expired
+}
+
+func (s *Scheduler) prune(record Record) {
+	logger := s.logger.WithFields(logrus.Fields{"server": record.Server, "backup": record.ID})
+	if err := s.api.DeleteBackup(record.Server, record.ID); err != nil {
+		logger.WithError(err).Warn("Failed to delete expired backup")
+		return
+	}
+	logger.Info("Deleted expired backup")
+}
+
+func newBackupUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
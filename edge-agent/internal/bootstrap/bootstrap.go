@@ -0,0 +1,198 @@
+// Package bootstrap finds enrollment settings for a node that has never been
+// configured, so images can enroll themselves on first boot. Settings come
+// from a well-known file or from the cloud provider's user-data.
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is where provisioning tools can drop bootstrap settings when
+// the node has no cloud metadata service.
+const DefaultFile = "/etc/hosting-agent/bootstrap.yaml"
+
+// ErrNotFound means no source had bootstrap settings.
+var ErrNotFound = errors.New("no bootstrap settings found")
+
+// Settings is what a node needs to enroll, or to activate when the control
+// plane pre-registered it and issued a node-bound token.
+type Settings struct {
+	ControlPlaneURL string `yaml:"control_plane_url"`
+	EnrollToken     string `yaml:"enroll_token"`
+	NodeID          string `yaml:"node_id"`
+	ActivationToken string `yaml:"activation_token"`
+
+	Source string `yaml:"-"` // where the settings were found
+}
+
+func (s Settings) complete() bool {
+	return s.ControlPlaneURL != "" && (s.EnrollToken != "" || (s.NodeID != "" && s.ActivationToken != ""))
+}
+
+// Source is somewhere bootstrap settings might be. Fetch returns
+// ErrNotFound when the source exists but holds no settings for the agent.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) (Settings, error)
+}
+
+// Sources returns the sources for a --bootstrap mode: "auto" tries the file,
+// then whichever cloud the machine looks like it's running on, falling back
+// to trying every metadata service. A provider name or file path selects a
+// single source.
+func Sources(mode, file string) ([]Source, error) {
+	switch mode {
+	case "auto":
+		sources := []Source{fileSource{path: file}}
+		if cloud := detectCloud(); cloud != nil {
+			return append(sources, cloud), nil
+		}
+		return append(sources, cloudSources()...), nil
+	case "file":
+		return []Source{fileSource{path: file}}, nil
+	case "ec2", "hetzner", "digitalocean":
+		for _, s := range cloudSources() {
+			if s.Name() == mode {
+				return []Source{s}, nil
+			}
+		}
+	}
+	if strings.HasPrefix(mode, "/") {
+		return []Source{fileSource{path: mode}}, nil
+	}
+	return nil, fmt.Errorf("unknown bootstrap source %q (expected auto, file, ec2, hetzner, digitalocean or a file path)", mode)
+}
+
+// Discover asks each source in turn, retrying until ctx is done: on first
+// boot the metadata service can be unreachable until networking is up.
+func Discover(ctx context.Context, sources []Source, logger *logrus.Entry) (Settings, error) {
+	logger = logger.WithField("component", "bootstrap")
+
+	delay := 2 * time.Second
+	for {
+		unreachable := false
+		for _, source := range sources {
+			settings, err := source.Fetch(ctx)
+			switch {
+			case err == nil:
+				settings.Source = source.Name()
+				logger.WithFields(logrus.Fields{
+					"source":        settings.Source,
+					"control_plane": settings.ControlPlaneURL,
+				}).Info("Found bootstrap settings")
+				return settings, nil
+			case errors.Is(err, ErrNotFound):
+				logger.WithField("source", source.Name()).Debug("No bootstrap settings")
+			default:
+				unreachable = true
+				logger.WithError(err).WithField("source", source.Name()).Debug("Bootstrap source unavailable")
+			}
+		}
+		if !unreachable {
+			return Settings{}, ErrNotFound
+		}
+
+		select {
+		case <-ctx.Done():
+			return Settings{}, ErrNotFound
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+type fileSource struct {
+	path string
+}
+
+func (f fileSource) Name() string { return "file:" + f.path }
+
+func (f fileSource) Fetch(ctx context.Context) (Settings, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return Settings{}, ErrNotFound
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+	return Parse(data)
+}
+
+// Consume removes a bootstrap file once its settings are in the agent's
+// config, so the enrollment token doesn't stay on disk twice. Cloud
+// user-data can't be removed from here.
+func Consume(s Settings) error {
+	path, ok := strings.CutPrefix(s.Source, "file:")
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// Parse reads settings from a bootstrap file or user-data. User-data is
+// usually written for cloud-init too, so either of these works:
+//
+//   - YAML or JSON with control_plane_url and enroll_token at the top level
+//     or under a hosting_agent key (which cloud-init ignores);
+//   - HOSTING_AGENT_CONTROL_PLANE=... and HOSTING_AGENT_ENROLL_TOKEN=... lines
+//     anywhere, e.g. exported in a shell script.
+//
+// Pre-registered nodes give node_id and activation_token (or
+// HOSTING_AGENT_NODE_ID and HOSTING_AGENT_ACTIVATION_TOKEN) instead of the
+// enrollment token.
+func Parse(data []byte) (Settings, error) {
+	var doc struct {
+		Settings     `yaml:",inline"`
+		HostingAgent *Settings `yaml:"hosting_agent"`
+	}
+	// JSON is YAML, so one decoder covers both.
+	if err := yaml.Unmarshal(data, &doc); err == nil {
+		if doc.HostingAgent != nil && doc.HostingAgent.complete() {
+			return *doc.HostingAgent, nil
+		}
+		if doc.Settings.complete() {
+			return doc.Settings, nil
+		}
+	}
+
+	var s Settings
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(key) {
+		case "HOSTING_AGENT_CONTROL_PLANE":
+			s.ControlPlaneURL = value
+		case "HOSTING_AGENT_ENROLL_TOKEN":
+			s.EnrollToken = value
+		case "HOSTING_AGENT_NODE_ID":
+			s.NodeID = value
+		case "HOSTING_AGENT_ACTIVATION_TOKEN":
+			s.ActivationToken = value
+		}
+	}
+	if s.complete() {
+		return s, nil
+	}
+	return Settings{}, ErrNotFound
+}
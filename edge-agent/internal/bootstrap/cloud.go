@@ -0,0 +1,117 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const metadataHost = "http://169.254.169.254"
+
+// metadataClient keeps requests short: the link-local address either
+// answers immediately or isn't there.
+var metadataClient = &http.Client{Timeout: 3 * time.Second}
+
+// cloudSource reads user-data from a provider's metadata service.
+type cloudSource struct {
+	name   string
+	vendor string // DMI sys_vendor prefix that identifies the provider
+	fetch  func(ctx context.Context) ([]byte, error)
+}
+
+func (c cloudSource) Name() string { return c.name }
+
+func (c cloudSource) Fetch(ctx context.Context) (Settings, error) {
+	data, err := c.fetch(ctx)
+	if err != nil {
+		return Settings{}, err
+	}
+	return Parse(data)
+}
+
+func cloudSources() []Source {
+	return []Source{
+		cloudSource{name: "ec2", vendor: "Amazon EC2", fetch: ec2UserData},
+		cloudSource{name: "hetzner", vendor: "Hetzner", fetch: func(ctx context.Context) ([]byte, error) {
+			return metadataGet(ctx, metadataHost+"/hetzner/v1/userdata", nil)
+		}},
+		cloudSource{name: "digitalocean", vendor: "DigitalOcean", fetch: func(ctx context.Context) ([]byte, error) {
+			return metadataGet(ctx, metadataHost+"/metadata/v1/user-data", nil)
+		}},
+	}
+}
+
+// detectCloud picks the provider from DMI, so a node doesn't spend its
+// first boot probing metadata services that aren't its own.
+func detectCloud() Source {
+	data, err := ioutil.ReadFile("/sys/class/dmi/id/sys_vendor")
+	if err != nil {
+		return nil
+	}
+	vendor := strings.TrimSpace(string(data))
+	for _, s := range cloudSources() {
+		if strings.HasPrefix(vendor, s.(cloudSource).vendor) {
+			return s
+		}
+	}
+	return nil
+}
+
+// ec2UserData uses IMDSv2, which needs a session token first; instances
+// that still allow IMDSv1 accept it too.
+func ec2UserData(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, metadataHost+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata token: %w", err)
+	}
+	token, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata token request returned %s", resp.Status)
+	}
+
+	return metadataGet(ctx, metadataHost+"/latest/user-data", http.Header{
+		"X-aws-ec2-metadata-token": {string(token)},
+	})
+}
+
+// metadataGet fetches a metadata path. A 404 means the instance was started
+// without user-data, which is ErrNotFound rather than a reason to retry.
+func metadataGet(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metadata service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("metadata service returned %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user-data: %w", err)
+	}
+	return data, nil
+}
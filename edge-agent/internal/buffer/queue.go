@@ -0,0 +1,154 @@
+package buffer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrDiscard, returned (or wrapped) by a Replay callback, drops the record
+// instead of stopping the replay, for records that will never be accepted.
+var ErrDiscard = errors.New("record discarded")
+
+// Queue is an append-only, file-backed FIFO of JSON records. It survives
+// agent restarts and keeps at most maxEntries, dropping the oldest first.
+type Queue struct {
+	path       string
+	maxEntries int
+
+	mu    sync.Mutex
+	count int
+}
+
+func Open(path string, maxEntries int) (*Queue, error) {
+	q := &Queue{path: path, maxEntries: maxEntries}
+
+	entries, err := q.read()
+	if err != nil {
+		return nil, err
+	}
+	q.count = len(entries)
+
+	return q, nil
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+func (q *Queue) Push(item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	q.count++
+
+	// Compact in batches rather than on every push past the cap.
+	if q.maxEntries > 0 && q.count > q.maxEntries+q.maxEntries/10 {
+		entries, err := q.read()
+		if err != nil {
+			return err
+		}
+		return q.write(entries[len(entries)-q.maxEntries:])
+	}
+	return nil
+}
+
+// Replay hands queued records to fn oldest first. It stops at the first
+// error and keeps that record and everything after it for the next call,
+// unless the error is ErrDiscard, which drops the record and carries on.
+func (q *Queue) Replay(fn func(raw json.RawMessage) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := q.read()
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if err := fn(entry); err != nil && !errors.Is(err, ErrDiscard) {
+			if writeErr := q.write(entries[i:]); writeErr != nil {
+				return writeErr
+			}
+			return fmt.Errorf("replay stopped with %d records left: %w", len(entries)-i, err)
+		}
+	}
+
+	return q.write(nil)
+}
+
+func (q *Queue) read() ([]json.RawMessage, error) {
+	f, err := os.Open(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []json.RawMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// A crash mid-append can leave a torn last line, skip anything unparsable.
+		if !json.Valid(line) {
+			continue
+		}
+		entries = append(entries, append(json.RawMessage(nil), line...))
+	}
+	return entries, scanner.Err()
+}
+
+func (q *Queue) write(entries []json.RawMessage) error {
+	q.count = len(entries)
+	if len(entries) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := q.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		w.Write(entry)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, q.path)
+}
@@ -0,0 +1,128 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store holds the agent's client certificate for mutual TLS. The TLS stack
+// asks it for the certificate on every handshake, so a renewed certificate
+// takes effect without rebuilding any clients.
+type Store struct {
+	certPath string
+	keyPath  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewStore(certPath, keyPath string) *Store {
+	return &Store{certPath: certPath, keyPath: keyPath}
+}
+
+// Load reads the keypair from disk. A missing pair is not an error, the node
+// simply hasn't enrolled with mTLS yet.
+func (s *Store) Load() error {
+	cert, err := tls.LoadX509KeyPair(s.certPath, s.keyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return s.set(&cert)
+}
+
+func (s *Store) set(cert *tls.Certificate) error {
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+
+	s.mu.Lock()
+	s.cert = cert
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		// An empty certificate makes the handshake proceed without one.
+		return &tls.Certificate{}, nil
+	}
+	return s.cert, nil
+}
+
+// NotAfter returns the expiry of the current certificate, zero if none.
+func (s *Store) NotAfter() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return time.Time{}
+	}
+	return s.cert.Leaf.NotAfter
+}
+
+// NewCSR generates a fresh P-256 key and a certificate signing request for it.
+func NewCSR(commonName string) (csrPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return csrPEM, keyPEM, nil
+}
+
+// Install validates a signed certificate against its key, persists both and
+// switches to them.
+func (s *Store) Install(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	if err := writeAtomic(s.keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeAtomic(s.certPath, certPEM, 0644); err != nil {
+		return err
+	}
+
+	return s.set(&cert)
+}
+
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
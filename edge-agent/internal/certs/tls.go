@@ -0,0 +1,36 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+// ClientTLSConfig builds the TLS settings used for every connection to the
+// control plane. store may be nil when mTLS is disabled.
+func ClientTLSConfig(cfg config.ControlPlaneConfig, store *Store) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+
+	if cfg.TLS.CAPath != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLS.CAPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if store != nil {
+		tlsConfig.GetClientCertificate = store.GetClientCertificate
+	}
+
+	return tlsConfig, nil
+}
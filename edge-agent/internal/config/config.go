@@ -1,23 +1,113 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	ControlPlane ControlPlaneConfig `yaml:"control_plane"`
-	Agent        AgentConfig        `yaml:"agent"`
-	Wings        WingsConfig        `yaml:"wings"`
+	Version       int                 `yaml:"version"`
+	ControlPlane  ControlPlaneConfig  `yaml:"control_plane"`
+	Agent         AgentConfig         `yaml:"agent"`
+	Wings         WingsConfig         `yaml:"wings"`
+	Downloads     DownloadsConfig     `yaml:"downloads"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	HealthChecks  []HealthCheckConfig `yaml:"health_checks,omitempty"`
+	Hooks         []HookConfig        `yaml:"hooks,omitempty"`
+	Tasks         TasksConfig         `yaml:"tasks"`
+	Backups       BackupsConfig       `yaml:"backups"`
+	Logs          LogsConfig          `yaml:"logs"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Transfers     TransfersConfig     `yaml:"transfers"`
+	ListenerAudit ListenerAuditConfig `yaml:"listener_audit"`
+	Standby       StandbyConfig       `yaml:"standby"`
+	FailureDomain FailureDomainConfig `yaml:"failure_domain"`
+	Secrets       SecretsConfig       `yaml:"secrets"`
+	Honeypot      HoneypotConfig      `yaml:"honeypot"`
+	Permissions   PermissionsConfig   `yaml:"permissions"`
+	Telemetry     TelemetryConfig     `yaml:"telemetry"`
+	Firewall      FirewallConfig      `yaml:"firewall"`
+	WingsTLS      WingsTLSConfig      `yaml:"wings_tls"`
+	Network       NetworkConfig       `yaml:"network"`
+	Shell         ShellConfig         `yaml:"shell"`
+	Snapshots     SnapshotsConfig     `yaml:"snapshots"`
+	Images        ImagesConfig        `yaml:"images"`
+
+	env []envOverride // settings applyEnvOverrides replaced
 }
 
 type ControlPlaneConfig struct {
-	URL         string `yaml:"url"`
-	EnrollToken string `yaml:"enroll_token,omitempty"`
-	AuthToken   string `yaml:"auth_token,omitempty"`
-	TLSSkipVerify bool `yaml:"tls_skip_verify"`
+	URL              string   `yaml:"url"`
+	URLs             []string `yaml:"urls,omitempty"`              // additional endpoints, tried after url
+	FailoverStrategy string   `yaml:"failover_strategy,omitempty"` // "ordered" or "latency"
+	FailoverCooldown int      `yaml:"failover_cooldown"`           // seconds a failed endpoint is skipped
+
+	Transport string `yaml:"transport"` // rest, or grpc for heartbeats, enrollment and commands over one HTTP/2 connection
+
+	AddressFamily string `yaml:"address_family"`           // auto, ipv4, ipv6, prefer_ipv4 or prefer_ipv6
+	SourceAddress string `yaml:"source_address,omitempty"` // local address to connect from, e.g. to pick an uplink
+
+	DiscoverEndpoints    bool `yaml:"discover_endpoints"`     // also use the regional endpoints the control plane publishes
+	LatencyProbeInterval int  `yaml:"latency_probe_interval"` // seconds between endpoint latency tests, negative disables
+
+	AuthProbeInterval     int       `yaml:"auth_probe_interval"`      // seconds between retries once credentials are rejected
+	ReenrollOnAuthFailure bool      `yaml:"reenroll_on_auth_failure"` // keeps enroll_token after enrolling
+	EnrollToken           string    `yaml:"enroll_token,omitempty"`
+	ActivationToken       string    `yaml:"activation_token,omitempty"` // for a node pre-registered as agent.node_id
+	Attestation           string    `yaml:"attestation"`                // none, tpm, aws, gcp or azure: evidence sent with enrollment
+	SigningKeyLifetime    int       `yaml:"signing_key_lifetime"`       // days before the payload signing key is rotated, negative disables
+	AuthToken             string    `yaml:"auth_token,omitempty"`
+	TLSSkipVerify         bool      `yaml:"tls_skip_verify"`
+	TLS                   TLSConfig `yaml:"tls"`
+
+	// Proxy is an http://, https:// or socks5:// URL, with user:password@
+	// for proxy authentication. Empty falls back to HTTPS_PROXY, HTTP_PROXY
+	// and NO_PROXY from the environment.
+	Proxy string `yaml:"proxy,omitempty"`
+}
+
+// ProxyFunc picks the proxy for outbound requests: the configured one, or
+// the standard environment variables when none is set.
+func (c ControlPlaneConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if c.Proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	proxyURL, err := url.Parse(c.Proxy)
+	return func(*http.Request) (*url.URL, error) {
+		return proxyURL, err
+	}
+}
+
+// Endpoints returns every configured control plane URL, primary first.
+func (c ControlPlaneConfig) Endpoints() []string {
+	endpoints := make([]string, 0, 1+len(c.URLs))
+	seen := make(map[string]bool)
+	for _, u := range append([]string{c.URL}, c.URLs...) {
+		u = strings.TrimSuffix(u, "/")
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		endpoints = append(endpoints, u)
+	}
+	return endpoints
+}
+
+// TLSConfig enables mutual TLS towards the control plane. The client
+// certificate is issued during enrollment and renewed automatically.
+type TLSConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	CertPath    string `yaml:"cert_path"`
+	KeyPath     string `yaml:"key_path"`
+	CAPath      string `yaml:"ca_path,omitempty"`
+	RenewBefore int    `yaml:"renew_before"` // hours before expiry
 }
 
 type AgentConfig struct {
@@ -26,30 +116,435 @@ type AgentConfig struct {
 	HeartbeatInterval int    `yaml:"heartbeat_interval"` // seconds
 	MetricsInterval   int    `yaml:"metrics_interval"`   // seconds
 	DataDir           string `yaml:"data_dir"`
+	SystemdUnit       string `yaml:"systemd_unit"`
+	Timezone          string `yaml:"timezone,omitempty"`     // fleet standard, only warned about
+	BufferMaxEntries  int    `yaml:"buffer_max_entries"`     // heartbeats kept on disk while offline
+	MirrorHeartbeat   bool   `yaml:"mirror_heartbeat"`       // write the last heartbeat to MirrorPath on each send
+	MirrorPath        string `yaml:"mirror_path,omitempty"`  // world-readable, so kept outside DataDir
+	AdminSocket       string `yaml:"admin_socket,omitempty"` // defaults to DataDir/agent.sock
+	AdminListen       string `yaml:"admin_listen,omitempty"` // optional TCP address, e.g. 127.0.0.1:9180
+
+	DiskPressureThreshold float64 `yaml:"disk_pressure_threshold"` // used percent that raises a disk_pressure event
+	PublicIPResolver      string  `yaml:"public_ip_resolver"`      // URL answering with the caller's IP, "none" disables
+	IncidentWindow        int     `yaml:"incident_window"`         // minutes of history attached to critical alerts
+	FDPressureThreshold   float64 `yaml:"fd_pressure_threshold"`   // percent of an open file limit that raises an fd_pressure event
+	ClockDriftThreshold   int     `yaml:"clock_drift_threshold"`   // milliseconds of clock offset that raise a clock_drift event
+	NTPServer             string  `yaml:"ntp_server"`              // asked over SNTP when no local daemon knows the offset, "none" disables
+
+	PublicIP           string   `yaml:"public_ip,omitempty"`  // static override, e.g. the address forwarded to a NAT'd node
+	PublicIPStrategies []string `yaml:"public_ip_strategies"` // tried in order: interface, control_plane, stun, resolver
+	STUNServer         string   `yaml:"stun_server"`          // host:port for the stun strategy
+
+	PinnedVersion       string `yaml:"pinned_version,omitempty"`
+	UpdateCheckInterval int    `yaml:"update_check_interval"` // seconds, negative disables
+	UpdatePublicKey     string `yaml:"update_public_key,omitempty"`
+	AllowUnsignedUpdate bool   `yaml:"allow_unsigned_update,omitempty"` // install releases without update_public_key, for development builds only
+
+	EnrolledAt time.Time `yaml:"enrolled_at,omitempty"` // set by the agent on each enrollment
+
+	ServiceManager string `yaml:"service_manager"` // auto, systemd, openrc or windows
+
+	Labels map[string]string `yaml:"labels,omitempty"` // free-form attributes for placement, e.g. tier: premium
+
+	AdminAuth LocalAPIAuthConfig `yaml:"admin_auth"`
+}
+
+// LocalAPIAuthConfig assigns roles to callers of the local API. Viewers can
+// read status and metrics; admins can also change things. With nothing
+// configured every socket caller is an admin, and the socket's 0660 mode
+// keeps that to root and the agent's group. Callers on admin_listen always
+// need a token.
+type LocalAPIAuthConfig struct {
+	Admins  APIPrincipals `yaml:"admins"`
+	Viewers APIPrincipals `yaml:"viewers"`
+}
+
+// APIPrincipals are the callers holding one role.
+type APIPrincipals struct {
+	Users  []string `yaml:"users,omitempty"`  // names or uids, matched by socket peer credentials
+	Groups []string `yaml:"groups,omitempty"` // names or gids
+	Tokens []string `yaml:"tokens,omitempty"` // hex SHA-256 of bearer tokens, for admin_listen
+}
+
+// Enforced reports whether any roles are configured.
+func (c LocalAPIAuthConfig) Enforced() bool {
+	for _, p := range []APIPrincipals{c.Admins, c.Viewers} {
+		if len(p.Users) > 0 || len(p.Groups) > 0 || len(p.Tokens) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 type WingsConfig struct {
+	BinaryPath    string `yaml:"binary_path"`
 	ConfigPath    string `yaml:"config_path"`
 	SystemdUnit   string `yaml:"systemd_unit"`
 	LogPath       string `yaml:"log_path"`
+	InstallLogDir string `yaml:"install_log_dir"`
 	AutoRestart   bool   `yaml:"auto_restart"`
+
+	ProbeInterval         int `yaml:"probe_interval"`          // seconds
+	ProbeFailureThreshold int `yaml:"probe_failure_threshold"` // consecutive failures before auto-restart
+	ConsoleProbeInterval  int `yaml:"console_probe_interval"`  // seconds between console websocket checks, negative disables
+
+	// Drift detection compares config.yml with the last config the control
+	// plane sent.
+	DriftInterval  int      `yaml:"drift_interval"`         // seconds, negative disables
+	DriftRemediate bool     `yaml:"drift_remediate"`        // rewrite the desired config when drift is found
+	DriftIgnore    []string `yaml:"drift_ignore,omitempty"` // dotted paths Wings fills in itself
+
+	TokenRenewBefore int `yaml:"token_renew_before"` // seconds before a brokered Wings token expires to ask for a new one, at most half of MinWingsTokenLifetime
+}
+
+// MinWingsTokenLifetime is the shortest-lived brokered Wings token the agent
+// installs. Installing one restarts Wings, dropping consoles and SFTP
+// sessions, so with renewal at most half a lifetime early Wings restarts
+// for a new token no more than every half hour.
+const MinWingsTokenLifetime = time.Hour
+
+type DownloadsConfig struct {
+	MaxBandwidth  int64 `yaml:"max_bandwidth"` // bytes per second, 0 = unlimited
+	MaxConcurrent int   `yaml:"max_concurrent"`
+	MaxRetries    int   `yaml:"max_retries"`
+}
+
+type MetricsConfig struct {
+	MaxContainers  int      `yaml:"max_containers"`  // busiest N reported individually, rest aggregated; -1 for no cap
+	LabelAllowlist []string `yaml:"label_allowlist"` // container labels passed through to the control plane
+
+	ServerDiskUsage       bool `yaml:"server_disk_usage"`       // track per-server usage of the Wings data directory
+	DiskReconcileInterval int  `yaml:"disk_reconcile_interval"` // seconds between full rescans
+	BandwidthInterval     int  `yaml:"bandwidth_interval"`      // seconds between monthly transfer updates
+
+	SMARTInterval      int `yaml:"smart_interval"`       // seconds between SMART reads, negative disables
+	SMARTWearThreshold int `yaml:"smart_wear_threshold"` // NVMe percentage used that counts as worn out
+
+	FlushInterval     int `yaml:"flush_interval"`      // seconds between batches of agent.metrics_interval samples
+	MaxPendingSamples int `yaml:"max_pending_samples"` // samples kept while the control plane is unreachable
+}
+
+type TasksConfig struct {
+	MaxConcurrent  int `yaml:"max_concurrent"`  // tasks running at once
+	DefaultTimeout int `yaml:"default_timeout"` // seconds, when the task doesn't set one
+	LockTimeout    int `yaml:"lock_timeout"`    // seconds to wait for a shared resource before giving up
+
+	HistoryEntries int `yaml:"history_entries"` // finished tasks kept in the local history
+}
+
+// BackupsConfig limits the backup schedules the control plane delegates to
+// the node, and the remote backups it triggers.
+type BackupsConfig struct {
+	MaxConcurrent int `yaml:"max_concurrent"` // backups running at once across all servers
+	Timeout       int `yaml:"timeout"`        // seconds a single backup may take
+	PartSize      int `yaml:"part_size"`      // MiB buffered per upload part for S3 targets, at least 5
+}
+
+// LogsConfig bounds the Wings log streams the control plane can open.
+type LogsConfig struct {
+	MaxStreams        int `yaml:"max_streams"`
+	MaxLinesPerSecond int `yaml:"max_lines_per_second"` // per stream
+	BufferLines       int `yaml:"buffer_lines"`         // per stream, oldest dropped beyond this
+	IdleTimeout       int `yaml:"idle_timeout"`         // seconds a stream runs without being renewed
+}
+
+// ShellConfig allows interactive shells opened from the control plane.
+// They are off unless enabled, and only the listed control plane users can
+// open one. Sessions' output is recorded under DataDir/shell-sessions.
+type ShellConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Users         []string `yaml:"users,omitempty"` // control plane users allowed to open a shell
+	RunAs         string   `yaml:"run_as"`          // local account the shell runs as
+	Shell         string   `yaml:"shell"`
+	IdleTimeout   int      `yaml:"idle_timeout"`   // seconds without input before a session is closed
+	MaxSessions   int      `yaml:"max_sessions"`   // open at once
+	RecordingDays int      `yaml:"recording_days"` // days recordings are kept, negative keeps them
+	RecordInput   bool     `yaml:"record_input"`   // also record keystrokes, including passwords typed at prompts that don't echo
 }
 
+// ImagesConfig covers the Docker images cached for game servers. A server
+// whose image isn't cached yet takes minutes to start the first time.
+type ImagesConfig struct {
+	PrePull        []string `yaml:"pre_pull,omitempty"` // pulled when missing, e.g. the egg images the node will run
+	PruneThreshold float64  `yaml:"prune_threshold"`    // used percent of Docker's filesystem that prunes unused images, negative disables
+}
+
+// SnapshotsConfig covers snapshots of the Wings data directory taken
+// before risky operations.
+type SnapshotsConfig struct {
+	Path    string `yaml:"path,omitempty"` // defaults to the Wings data directory
+	LVMSize string `yaml:"lvm_size"`       // lvcreate size for classic LVM snapshots, e.g. 20G or 20%ORIGIN
+	Keep    int    `yaml:"keep"`           // newest snapshots kept, negative keeps all
+	MaxAge  int    `yaml:"max_age"`        // hours a snapshot is kept, negative keeps them
+}
+
+// LoggingConfig is the agent's own log output. The overall level stays
+// agent.log_level; components listed here log at their own level.
+type LoggingConfig struct {
+	Format     string            `yaml:"format"`               // text or json
+	File       string            `yaml:"file,omitempty"`       // log to this file instead of stderr
+	MaxSize    int               `yaml:"max_size"`             // MiB before the file is rotated
+	MaxAge     int               `yaml:"max_age"`              // days rotated files are kept, 0 keeps them
+	MaxBackups int               `yaml:"max_backups"`          // rotated files kept, negative keeps them all
+	Components map[string]string `yaml:"components,omitempty"` // level per component, e.g. tasks: debug
+	RateLimit  int               `yaml:"rate_limit"`           // times a message is logged per minute, negative for no limit
+}
+
+// TransfersConfig caps the uplink bandwidth of outgoing server transfers.
+// Windows override the rate at certain local times, e.g. a lower cap in the
+// evening when players are online.
+type TransfersConfig struct {
+	Interface   string           `yaml:"interface,omitempty"` // defaults to the default route's interface
+	RateMbit    int              `yaml:"rate_mbit"`           // 0 leaves transfers unshaped
+	Windows     []TransferWindow `yaml:"windows,omitempty"`
+	MaxDuration int              `yaml:"max_duration"` // seconds before a transfer that never ended is unshaped
+}
+
+type TransferWindow struct {
+	From     string `yaml:"from"` // HH:MM, local time
+	To       string `yaml:"to"`
+	RateMbit int    `yaml:"rate_mbit"`
+}
+
+// ListenerAuditConfig flags listening sockets nobody expects on a node,
+// like a forgotten debug service or a proxy a customer installed.
+type ListenerAuditConfig struct {
+	Interval         int      `yaml:"interval"`                    // seconds, negative disables
+	AllowedPorts     []int    `yaml:"allowed_ports,omitempty"`     // on top of SSH, Wings, the agent and server allocations
+	AllowedProcesses []string `yaml:"allowed_processes,omitempty"` // process names, e.g. node_exporter
+	IncludeLoopback  bool     `yaml:"include_loopback"`            // also audit listeners bound to localhost
+}
+
+// StandbyConfig controls spare nodes held in warm standby.
+type StandbyConfig struct {
+	PullInterval int `yaml:"pull_interval"` // seconds between refreshing the standby images
+}
+
+// FailureDomainConfig places the node in the physical topology so the
+// control plane can spread a customer's servers across hardware that fails
+// independently. It's reported as-is; empty fields are unknown.
+type FailureDomainConfig struct {
+	Datacenter string `yaml:"datacenter,omitempty" json:"datacenter,omitempty"`
+	Rack       string `yaml:"rack,omitempty" json:"rack,omitempty"`
+	Chassis    string `yaml:"chassis,omitempty" json:"chassis,omitempty"`       // blade enclosure or multi-node chassis
+	Hypervisor string `yaml:"hypervisor,omitempty" json:"hypervisor,omitempty"` // parent host when the node is a VM
+}
+
+// SecretsConfig picks where the control plane tokens are kept. With any
+// backend other than "config" they are moved out of this file on the next
+// save.
+type SecretsConfig struct {
+	Backend string `yaml:"backend"`        // config, file, keyring or encrypted
+	Path    string `yaml:"path,omitempty"` // for file and encrypted
+}
+
+// WingsTLSConfig manages the certificate Wings serves to the panel, at the
+// api.ssl paths in Wings' config. Expiry is tracked whenever Wings has SSL
+// enabled; renewal needs a source.
+type WingsTLSConfig struct {
+	Source      string     `yaml:"source,omitempty"`    // control_plane, acme, or empty to leave renewal to the operator
+	DNSNames    []string   `yaml:"dns_names,omitempty"` // defaults to the host's FQDN
+	RenewBefore int        `yaml:"renew_before"`        // days before expiry
+	AlertBefore int        `yaml:"alert_before"`        // days before expiry to raise an alert
+	ACME        ACMEConfig `yaml:"acme"`
+}
+
+// ACMEConfig is used when wings_tls.source is acme. HTTP-01 briefly serves
+// the challenge on port 80; DNS-01 calls a script to publish the TXT record
+// and is needed when port 80 isn't reachable from the internet.
+type ACMEConfig struct {
+	Directory      string `yaml:"directory"`          // defaults to Let's Encrypt production
+	Email          string `yaml:"email,omitempty"`    // expiry notices from the CA
+	Challenge      string `yaml:"challenge"`          // http-01 or dns-01
+	HTTPListen     string `yaml:"http_listen"`        // address for http-01
+	DNSHook        string `yaml:"dns_hook,omitempty"` // script for dns-01
+	DNSPropagation int    `yaml:"dns_propagation"`    // seconds to wait after the hook publishes the record
+}
+
+// NetworkConfig covers checks of the node's network path. MTU probes go to
+// the control plane and the listed peers, typically other nodes servers
+// get transferred to.
+type NetworkConfig struct {
+	MTUInterval int      `yaml:"mtu_interval"`        // seconds between path MTU checks, negative disables
+	MTUPeers    []string `yaml:"mtu_peers,omitempty"` // hosts probed besides the control plane
+}
+
+// FirewallConfig lets the control plane manage inbound rules, e.g. opening
+// allocation port ranges or limiting the Wings API to the panel. Only rules
+// the agent added are ever replaced.
+type FirewallConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Backend string `yaml:"backend"` // auto, nftables, iptables or ufw
+}
+
+// PermissionsConfig restricts which remote operations the node accepts.
+// An empty list allows everything the agent supports.
+type PermissionsConfig struct {
+	Commands []string `yaml:"commands,omitempty"` // command types, e.g. ping, restart_wings
+	Tasks    []string `yaml:"tasks,omitempty"`    // task types, e.g. shell, docker
+}
+
+// HoneypotConfig opens decoy ports and reports whoever connects to them as
+// likely scanners.
+type HoneypotConfig struct {
+	Enabled        bool  `yaml:"enabled"`
+	Ports          []int `yaml:"ports,omitempty"`
+	ReportInterval int   `yaml:"report_interval"` // seconds
+	AlertThreshold int   `yaml:"alert_threshold"` // connections per source per interval that raise an alert
+}
+
+// TelemetryConfig opts in to anonymous usage statistics for the vendor.
+// They go to their own endpoint, never the control plane, and carry
+// nothing that identifies the node or its operator.
+type TelemetryConfig struct {
+	Enabled  bool    `yaml:"enabled"`
+	Endpoint string  `yaml:"endpoint,omitempty"`
+	Interval int     `yaml:"interval"` // seconds
+	Epsilon  float64 `yaml:"epsilon"`  // privacy budget per 30-day period for noised counts, lower is noisier
+}
+
+// HealthCheckConfig is a site-specific check script, e.g. a RAID controller
+// CLI or a SAN mount test. Results feed the node health score.
+type HealthCheckConfig struct {
+	Name             string   `yaml:"name"`
+	Path             string   `yaml:"path"`
+	Args             []string `yaml:"args,omitempty"`
+	Interval         int      `yaml:"interval"` // seconds
+	Timeout          int      `yaml:"timeout"`  // seconds
+	ExpectedExitCode int      `yaml:"expected_exit_code"`
+	Weight           int      `yaml:"weight"`
+}
+
+// HookConfig is an operator script run around agent-driven Wings
+// operations, e.g. to silence monitoring during a restart.
+type HookConfig struct {
+	Name    string   `yaml:"name"`
+	Event   string   `yaml:"event"` // pre_restart, post_restart or post_config_apply
+	Path    string   `yaml:"path"`
+	Args    []string `yaml:"args,omitempty"`
+	Timeout int      `yaml:"timeout"` // seconds
+}
+
+// Load reads the config file, layers the conf.d fragments next to it on
+// top and applies AGENT_* environment overrides. The file may be missing
+// when fragments or the environment provide the settings instead.
 func Load(path string) (*Config, error) {
-	data, err := ioutil.ReadFile(path)
+	var cfg Config
+	plaintext := false // the file itself holds tokens
+
+	files, err := Fragments(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		migrated, err := migrate(path, data)
+		if err != nil {
+			return nil, err
+		}
+		if migrated != nil {
+			data = migrated
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+		cfg.Version = CurrentVersion
+		plaintext = cfg.ControlPlane.AuthToken != "" || cfg.ControlPlane.EnrollToken != "" || cfg.ControlPlane.ActivationToken != ""
+	case os.IsNotExist(err) && (hasEnvOverrides() || len(files) > 0):
+		cfg.Version = CurrentVersion
+	default:
+		return nil, err
+	}
+
+	if err := applyFragments(&cfg, files); err != nil {
+		return nil, err
+	}
+
+	if err := applyEnvOverrides(&cfg); err != nil {
 		return nil, err
 	}
 
 	// Set defaults
+	if cfg.ControlPlane.TLS.CertPath == "" {
+		cfg.ControlPlane.TLS.CertPath = "/etc/hosting-agent/client.crt"
+	}
+	if cfg.ControlPlane.TLS.KeyPath == "" {
+		cfg.ControlPlane.TLS.KeyPath = "/etc/hosting-agent/client.key"
+	}
+	if cfg.ControlPlane.Transport == "" {
+		cfg.ControlPlane.Transport = "rest"
+	}
+	if cfg.ControlPlane.Attestation == "" {
+		cfg.ControlPlane.Attestation = "none"
+	}
+	if cfg.ControlPlane.AddressFamily == "" {
+		cfg.ControlPlane.AddressFamily = "auto"
+	}
+	if cfg.ControlPlane.SigningKeyLifetime == 0 {
+		cfg.ControlPlane.SigningKeyLifetime = 90
+	}
+	if cfg.ControlPlane.FailoverStrategy == "" {
+		cfg.ControlPlane.FailoverStrategy = "ordered"
+	}
+	if cfg.ControlPlane.FailoverCooldown == 0 {
+		cfg.ControlPlane.FailoverCooldown = 60
+	}
+	if cfg.ControlPlane.LatencyProbeInterval == 0 {
+		cfg.ControlPlane.LatencyProbeInterval = 300
+	}
+	if cfg.ControlPlane.AuthProbeInterval == 0 {
+		cfg.ControlPlane.AuthProbeInterval = 300
+	}
+	if cfg.ControlPlane.TLS.RenewBefore == 0 {
+		cfg.ControlPlane.TLS.RenewBefore = 720
+	}
 	if cfg.Agent.LogLevel == "" {
 		cfg.Agent.LogLevel = "info"
 	}
+	if cfg.Shell.RunAs == "" {
+		cfg.Shell.RunAs = "root"
+	}
+	if cfg.Shell.Shell == "" {
+		cfg.Shell.Shell = "/bin/bash"
+		if _, err := os.Stat(cfg.Shell.Shell); err != nil {
+			cfg.Shell.Shell = "/bin/sh"
+		}
+	}
+	if cfg.Shell.IdleTimeout == 0 {
+		cfg.Shell.IdleTimeout = 900
+	}
+	if cfg.Shell.MaxSessions == 0 {
+		cfg.Shell.MaxSessions = 2
+	}
+	if cfg.Shell.RecordingDays == 0 {
+		cfg.Shell.RecordingDays = 90
+	}
+	if cfg.Images.PruneThreshold == 0 {
+		cfg.Images.PruneThreshold = 85
+	}
+	if cfg.Snapshots.LVMSize == "" {
+		cfg.Snapshots.LVMSize = "20%ORIGIN"
+	}
+	if cfg.Snapshots.Keep == 0 {
+		cfg.Snapshots.Keep = 3
+	}
+	if cfg.Snapshots.MaxAge == 0 {
+		cfg.Snapshots.MaxAge = 72
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = "text"
+	}
+	if cfg.Logging.MaxSize == 0 {
+		cfg.Logging.MaxSize = 50
+	}
+	if cfg.Logging.MaxBackups == 0 {
+		cfg.Logging.MaxBackups = 5
+	}
+	if cfg.Logging.RateLimit == 0 {
+		cfg.Logging.RateLimit = 60
+	}
 	if cfg.Agent.HeartbeatInterval == 0 {
 		cfg.Agent.HeartbeatInterval = 30
 	}
@@ -59,6 +554,48 @@ func Load(path string) (*Config, error) {
 	if cfg.Agent.DataDir == "" {
 		cfg.Agent.DataDir = "/var/lib/hosting-agent"
 	}
+	if cfg.Agent.MirrorPath == "" {
+		cfg.Agent.MirrorPath = "/run/hosting-agent/last-heartbeat.json"
+	}
+	if cfg.Agent.BufferMaxEntries == 0 {
+		cfg.Agent.BufferMaxEntries = 2880
+	}
+	if cfg.Agent.PublicIPResolver == "" {
+		cfg.Agent.PublicIPResolver = "https://api.ipify.org"
+	}
+	if len(cfg.Agent.PublicIPStrategies) == 0 {
+		cfg.Agent.PublicIPStrategies = []string{"interface", "control_plane", "stun", "resolver"}
+	}
+	if cfg.Agent.STUNServer == "" {
+		cfg.Agent.STUNServer = "stun.l.google.com:19302"
+	}
+	if cfg.Agent.DiskPressureThreshold == 0 {
+		cfg.Agent.DiskPressureThreshold = 90
+	}
+	if cfg.Agent.IncidentWindow == 0 {
+		cfg.Agent.IncidentWindow = 15
+	}
+	if cfg.Agent.FDPressureThreshold == 0 {
+		cfg.Agent.FDPressureThreshold = 80
+	}
+	if cfg.Agent.ClockDriftThreshold == 0 {
+		cfg.Agent.ClockDriftThreshold = 1000
+	}
+	if cfg.Agent.NTPServer == "" {
+		cfg.Agent.NTPServer = "pool.ntp.org"
+	}
+	if cfg.Agent.ServiceManager == "" {
+		cfg.Agent.ServiceManager = "auto"
+	}
+	if cfg.Agent.SystemdUnit == "" {
+		cfg.Agent.SystemdUnit = "hosting-edge-agent.service"
+	}
+	if cfg.Agent.UpdateCheckInterval == 0 {
+		cfg.Agent.UpdateCheckInterval = 3600
+	}
+	if cfg.Wings.BinaryPath == "" {
+		cfg.Wings.BinaryPath = "/usr/local/bin/wings"
+	}
 	if cfg.Wings.ConfigPath == "" {
 		cfg.Wings.ConfigPath = "/etc/pterodactyl/config.yml"
 	}
@@ -68,15 +605,199 @@ func Load(path string) (*Config, error) {
 	if cfg.Wings.LogPath == "" {
 		cfg.Wings.LogPath = "/var/log/pterodactyl/wings.log"
 	}
+	if cfg.Wings.ProbeInterval == 0 {
+		cfg.Wings.ProbeInterval = 30
+	}
+	if cfg.Wings.ConsoleProbeInterval == 0 {
+		cfg.Wings.ConsoleProbeInterval = 300
+	}
+	if cfg.Wings.ProbeFailureThreshold == 0 {
+		cfg.Wings.ProbeFailureThreshold = 3
+	}
+	if cfg.Wings.DriftInterval == 0 {
+		cfg.Wings.DriftInterval = 300
+	}
+	if cfg.Wings.TokenRenewBefore == 0 {
+		cfg.Wings.TokenRenewBefore = 900
+	}
+	if cfg.Wings.DriftIgnore == nil {
+		cfg.Wings.DriftIgnore = []string{"system.user.uid", "system.user.gid"}
+	}
+	if cfg.Wings.InstallLogDir == "" {
+		cfg.Wings.InstallLogDir = "/var/log/pterodactyl/install"
+	}
+	if cfg.Metrics.MaxContainers == 0 {
+		cfg.Metrics.MaxContainers = 50
+	}
+	if cfg.Metrics.DiskReconcileInterval == 0 {
+		cfg.Metrics.DiskReconcileInterval = 3600
+	}
+	if cfg.Metrics.BandwidthInterval == 0 {
+		cfg.Metrics.BandwidthInterval = 60
+	}
+	if cfg.Metrics.SMARTInterval == 0 {
+		cfg.Metrics.SMARTInterval = 3600
+	}
+	if cfg.Metrics.SMARTWearThreshold == 0 {
+		cfg.Metrics.SMARTWearThreshold = 80
+	}
+	if cfg.Metrics.FlushInterval == 0 {
+		cfg.Metrics.FlushInterval = 60
+	}
+	if cfg.Metrics.MaxPendingSamples == 0 {
+		cfg.Metrics.MaxPendingSamples = 720
+	}
+	for i := range cfg.HealthChecks {
+		check := &cfg.HealthChecks[i]
+		if check.Name == "" {
+			check.Name = check.Path
+		}
+		if check.Interval == 0 {
+			check.Interval = 60
+		}
+		if check.Timeout == 0 {
+			check.Timeout = 10
+		}
+		if check.Weight == 0 {
+			check.Weight = 1
+		}
+	}
+	for i := range cfg.Hooks {
+		hook := &cfg.Hooks[i]
+		if hook.Name == "" {
+			hook.Name = hook.Path
+		}
+		if hook.Timeout == 0 {
+			hook.Timeout = 30
+		}
+	}
+	if cfg.Downloads.MaxConcurrent == 0 {
+		cfg.Downloads.MaxConcurrent = 2
+	}
+	if cfg.Downloads.MaxRetries == 0 {
+		cfg.Downloads.MaxRetries = 5
+	}
+	if len(cfg.Honeypot.Ports) == 0 {
+		cfg.Honeypot.Ports = []int{23, 2323, 3389, 5900}
+	}
+	if cfg.Honeypot.ReportInterval == 0 {
+		cfg.Honeypot.ReportInterval = 60
+	}
+	if cfg.Honeypot.AlertThreshold == 0 {
+		cfg.Honeypot.AlertThreshold = 10
+	}
+	if cfg.WingsTLS.RenewBefore == 0 {
+		cfg.WingsTLS.RenewBefore = 30
+	}
+	if cfg.WingsTLS.AlertBefore == 0 {
+		cfg.WingsTLS.AlertBefore = 14
+	}
+	if cfg.WingsTLS.ACME.Directory == "" {
+		cfg.WingsTLS.ACME.Directory = "https://acme-v02.api.letsencrypt.org/directory"
+	}
+	if cfg.WingsTLS.ACME.Challenge == "" {
+		cfg.WingsTLS.ACME.Challenge = "http-01"
+	}
+	if cfg.WingsTLS.ACME.HTTPListen == "" {
+		cfg.WingsTLS.ACME.HTTPListen = ":80"
+	}
+	if cfg.WingsTLS.ACME.DNSPropagation == 0 {
+		cfg.WingsTLS.ACME.DNSPropagation = 60
+	}
+	if cfg.Network.MTUInterval == 0 {
+		cfg.Network.MTUInterval = 3600
+	}
+	if cfg.Firewall.Backend == "" {
+		cfg.Firewall.Backend = "auto"
+	}
+	if cfg.Telemetry.Interval == 0 {
+		cfg.Telemetry.Interval = 86400
+	}
+	if cfg.Telemetry.Epsilon == 0 {
+		cfg.Telemetry.Epsilon = 1
+	}
+	if cfg.Tasks.MaxConcurrent == 0 {
+		cfg.Tasks.MaxConcurrent = 2
+	}
+	if cfg.Tasks.DefaultTimeout == 0 {
+		cfg.Tasks.DefaultTimeout = 300
+	}
+	if cfg.Tasks.LockTimeout == 0 {
+		cfg.Tasks.LockTimeout = 600
+	}
+	if cfg.Tasks.HistoryEntries == 0 {
+		cfg.Tasks.HistoryEntries = 5000
+	}
+	if cfg.Logs.MaxStreams == 0 {
+		cfg.Logs.MaxStreams = 4
+	}
+	if cfg.Logs.MaxLinesPerSecond == 0 {
+		cfg.Logs.MaxLinesPerSecond = 200
+	}
+	if cfg.Logs.BufferLines == 0 {
+		cfg.Logs.BufferLines = 5000
+	}
+	if cfg.Logs.IdleTimeout == 0 {
+		cfg.Logs.IdleTimeout = 300
+	}
+	if cfg.Transfers.MaxDuration == 0 {
+		cfg.Transfers.MaxDuration = 6 * 3600
+	}
+	if cfg.ListenerAudit.Interval == 0 {
+		cfg.ListenerAudit.Interval = 300
+	}
+	if cfg.Backups.MaxConcurrent == 0 {
+		cfg.Backups.MaxConcurrent = 1
+	}
+	if cfg.Backups.Timeout == 0 {
+		cfg.Backups.Timeout = 3600
+	}
+	if cfg.Backups.PartSize == 0 {
+		cfg.Backups.PartSize = 16
+	}
+	if cfg.Standby.PullInterval == 0 {
+		cfg.Standby.PullInterval = 3600
+	}
+	if cfg.Secrets.Backend == "" {
+		cfg.Secrets.Backend = "config"
+	}
+	if cfg.Secrets.Path == "" {
+		switch cfg.Secrets.Backend {
+		case "file":
+			cfg.Secrets.Path = "/etc/hosting-agent/secrets.json"
+		case "encrypted":
+			cfg.Secrets.Path = "/etc/hosting-agent/secrets.enc"
+		}
+	}
+
+	if err := loadSecrets(&cfg); err != nil {
+		return nil, err
+	}
+	if plaintext && cfg.Secrets.Backend != "config" {
+		// Switching backends shouldn't leave the tokens behind in the file.
+		if err := Save(path, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to move tokens to the %s secrets backend: %w", cfg.Secrets.Backend, err)
+		}
+	}
 
 	return &cfg, nil
 }
 
 func Save(path string, cfg *Config) error {
-	data, err := yaml.Marshal(cfg)
+	cfg.Version = CurrentVersion
+
+	out, err := storeSecrets(withoutEnv(cfg))
+	if err != nil {
+		return err
+	}
+	doc, err := withoutFragments(path, out)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(doc)
 	if err != nil {
 		return err
 	}
 
 	return ioutil.WriteFile(path, data, 0600)
-}
\ No newline at end of file
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "AGENT_"
+
+// envAliases are short names for settings commonly passed via cloud-init.
+var envAliases = map[string]string{
+	"AGENT_ENROLL_TOKEN": "AGENT_CONTROL_PLANE_ENROLL_TOKEN",
+	"AGENT_AUTH_TOKEN":   "AGENT_CONTROL_PLANE_AUTH_TOKEN",
+}
+
+// envSeeds only fill in credentials neither the file nor the secrets
+// backend has, so a stale variable can't shadow a token the agent has
+// since refreshed.
+var envSeeds = map[string]bool{
+	"AGENT_CONTROL_PLANE_AUTH_TOKEN":       true,
+	"AGENT_CONTROL_PLANE_ENROLL_TOKEN":     true,
+	"AGENT_CONTROL_PLANE_ACTIVATION_TOKEN": true,
+}
+
+// envOverride is a setting an AGENT_* variable replaced. Save writes back
+// what the file had unless the agent changed the setting since, so the
+// variable isn't pinned in the file and unsetting it takes effect.
+type envOverride struct {
+	index  []int
+	before interface{}
+	value  interface{}
+}
+
+// hasEnvOverrides reports whether any AGENT_* variable is set.
+func hasEnvOverrides() bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnvOverrides layers AGENT_* variables over the YAML. Names follow the
+// YAML path: control_plane.url is AGENT_CONTROL_PLANE_URL. Fields of the
+// agent section drop the section name, so agent.log_level is
+// AGENT_LOG_LEVEL. Lists are comma separated; lists of sections such as
+// health_checks can't be set this way.
+func applyEnvOverrides(cfg *Config) error {
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		for alias, target := range envAliases {
+			if target == name {
+				return os.LookupEnv(alias)
+			}
+		}
+		return "", false
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlName(t.Field(i))
+		if name == "" || name == "version" {
+			continue
+		}
+		prefix := envPrefix + strings.ToUpper(name) + "_"
+		if name == "agent" {
+			prefix = envPrefix
+		}
+		if err := applyEnvStruct(v.Field(i), prefix, lookup, []int{i}, &cfg.env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool), index []int, overrides *[]envOverride) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		envName := prefix + strings.ToUpper(name)
+		field := v.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvStruct(field, envName+"_", lookup, fieldIndex, overrides); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := lookup(envName)
+		if !ok || (envSeeds[envName] && !field.IsZero()) {
+			continue
+		}
+		before := field.Interface()
+		if err := setFromString(field, raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", envName, err)
+		}
+		*overrides = append(*overrides, envOverride{index: fieldIndex, before: before, value: field.Interface()})
+	}
+	return nil
+}
+
+// fromEnv reports whether field, a pointer into c, was set by an AGENT_*
+// variable.
+func (c *Config) fromEnv(field interface{}) bool {
+	v := reflect.ValueOf(c).Elem()
+	for _, o := range c.env {
+		if v.FieldByIndex(o.index).Addr().Interface() == field {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutEnv returns cfg with the settings still at their AGENT_* value put
+// back to what the file had, for writing it.
+func withoutEnv(cfg *Config) *Config {
+	if len(cfg.env) == 0 {
+		return cfg
+	}
+	out := *cfg
+	v := reflect.ValueOf(&out).Elem()
+	for _, o := range cfg.env {
+		field := v.FieldByIndex(o.index)
+		if reflect.DeepEqual(field.Interface(), o.value) {
+			field.Set(reflect.ValueOf(o.before))
+		}
+	}
+	return &out
+}
+
+func setFromString(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setFromString(slice.Index(i), p); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		// Lists of sections and other composite types are YAML only.
+	}
+	return nil
+}
+
+func yamlName(f reflect.StructField) string {
+	tag := f.Tag.Get("yaml")
+	name := strings.Split(tag, ",")[0]
+	if name == "-" || strings.Contains(tag, "inline") {
+		return ""
+	}
+	return name
+}
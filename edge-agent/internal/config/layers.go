@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fragmentDir holds drop-in files layered over the main config, so
+// configuration management can ship e.g. 10-site.yaml and 50-node.yaml
+// instead of templating one file.
+func fragmentDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "conf.d")
+}
+
+// Fragments lists the drop-in files in the order they're applied, which is
+// lexical by file name.
+func Fragments(path string) ([]string, error) {
+	entries, err := os.ReadDir(fragmentDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config fragments: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		files = append(files, filepath.Join(fragmentDir(path), name))
+	}
+	return files, nil
+}
+
+// applyFragments decodes each fragment over cfg. Mappings merge key by key
+// at every level, while lists and scalars replace what came before.
+// Anchors work within a fragment but not across files.
+func applyFragments(cfg *Config, files []string) error {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// withoutFragments returns the document Save writes, leaving out settings
+// conf.d already provides so they stay owned by their fragment instead of
+// being pinned in the main file.
+func withoutFragments(path string, cfg *Config) (interface{}, error) {
+	files, err := Fragments(path)
+	if err != nil || len(files) == 0 {
+		return cfg, err
+	}
+
+	layer := make(map[string]interface{})
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		raw := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		mergeMaps(layer, raw)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	pruneNode(&doc, layer)
+	return &doc, nil
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if sm, ok := value.(map[string]interface{}); ok {
+			if dm, ok := dst[key].(map[string]interface{}); ok {
+				mergeMaps(dm, sm)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// pruneNode drops the mapping entries whose value matches layer, keeping
+// the order of everything else.
+func pruneNode(node *yaml.Node, layer map[string]interface{}) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	kept := node.Content[:0]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if lv, ok := layer[key.Value]; ok {
+			if lm, ok := lv.(map[string]interface{}); ok && value.Kind == yaml.MappingNode {
+				pruneNode(value, lm)
+				if len(value.Content) == 0 {
+					continue
+				}
+			} else {
+				var v interface{}
+				if value.Decode(&v) == nil && reflect.DeepEqual(v, lv) {
+					continue
+				}
+			}
+		}
+		kept = append(kept, key, value)
+	}
+	node.Content = kept
+}
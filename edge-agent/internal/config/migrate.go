@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config layout this build reads and writes. Bump it
+// and append to migrations whenever the YAML structure changes.
+const CurrentVersion = 1
+
+// migration upgrades a raw config document from version `from` to from+1.
+// Only a migration that restructures the document gets written back.
+type migration struct {
+	from        int
+	restructure bool
+	apply       func(raw map[string]interface{}) error
+}
+
+var migrations = []migration{
+	// v0 configs predate the version field, the layout is otherwise identical.
+	{from: 0, apply: func(raw map[string]interface{}) error { return nil }},
+}
+
+// migrate upgrades data in memory and returns the migrated document, or nil
+// when it is already current or nothing but the version changed. When a
+// migration restructured it, the file is rewritten, which drops its
+// comments, and the original kept as a backup. Writing is best effort: a
+// read-only file is migrated again on every load instead.
+func migrate(path string, data []byte) ([]byte, error) {
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if v, ok := raw["version"].(int); ok {
+		version = v
+	}
+
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than supported version %d", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return nil, nil
+	}
+
+	from := version
+	restructured := false
+	for _, m := range migrations {
+		if m.from < version {
+			continue
+		}
+		if err := m.apply(raw); err != nil {
+			return nil, fmt.Errorf("config migration from version %d failed: %w", m.from, err)
+		}
+		restructured = restructured || m.restructure
+		version = m.from + 1
+		raw["version"] = version
+	}
+	if !restructured {
+		return nil, nil
+	}
+
+	migrated, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := ioutil.WriteFile(backupPath, data, 0600); err == nil {
+		ioutil.WriteFile(path, migrated, 0600)
+	}
+	return migrated, nil
+}
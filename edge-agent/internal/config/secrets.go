@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/secrets"
+)
+
+// secretFields are the settings kept in the secrets backend rather than the
+// config file, by their name in the store.
+func secretFields(cfg *Config) map[string]*string {
+	return map[string]*string{
+		"auth_token":       &cfg.ControlPlane.AuthToken,
+		"enroll_token":     &cfg.ControlPlane.EnrollToken,
+		"activation_token": &cfg.ControlPlane.ActivationToken,
+	}
+}
+
+// loadSecrets fills in tokens from the secrets backend. A token already set
+// by the file wins, and Save moves it into the backend; one from the
+// environment only stands in for a token the backend doesn't have.
+func loadSecrets(cfg *Config) error {
+	store, err := secrets.Open(cfg.Secrets.Backend, cfg.Secrets.Path)
+	if err != nil || store == nil {
+		return err
+	}
+	for name, field := range secretFields(cfg) {
+		if *field != "" && !cfg.fromEnv(field) {
+			continue
+		}
+		value, err := store.Get(name)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s from the %s secrets backend: %w", name, cfg.Secrets.Backend, err)
+		}
+		*field = value
+	}
+	return nil
+}
+
+// storeSecrets writes the tokens to the secrets backend and returns the
+// config with them blanked, ready to be written to the file.
+func storeSecrets(cfg *Config) (*Config, error) {
+	store, err := secrets.Open(cfg.Secrets.Backend, cfg.Secrets.Path)
+	if err != nil || store == nil {
+		return cfg, err
+	}
+
+	out := *cfg
+	for name, field := range secretFields(cfg) {
+		if *field == "" {
+			err = store.Delete(name)
+		} else {
+			err = store.Set(name, *field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s in the %s secrets backend: %w", name, cfg.Secrets.Backend, err)
+		}
+	}
+	out.ControlPlane.AuthToken = ""
+	out.ControlPlane.EnrollToken = ""
+	out.ControlPlane.ActivationToken = ""
+	return &out, nil
+}
+
+// DeleteSecrets removes the tokens from the secrets backend, and the
+// backend's file if it has one.
+func DeleteSecrets(cfg *Config) error {
+	store, err := secrets.Open(cfg.Secrets.Backend, cfg.Secrets.Path)
+	if err != nil || store == nil {
+		return err
+	}
+	for name := range secretFields(cfg) {
+		if err := store.Delete(name); err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			return fmt.Errorf("failed to delete %s from the %s secrets backend: %w", name, cfg.Secrets.Backend, err)
+		}
+	}
+	if cfg.Secrets.Backend == "file" || cfg.Secrets.Backend == "encrypted" {
+		if err := os.Remove(cfg.Secrets.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scrub clears the node's identity and the credentials the config holds,
+// for a node being decommissioned: its tokens and any proxy password. Save
+// it, then DeleteSecrets, to get them off disk. The admin API token hashes
+// stay, so admin_listen keeps admitting the operators who hold them; TCP
+// callers without one get no access either way.
+func Scrub(cfg *Config) {
+	cfg.Agent.NodeID = ""
+	cfg.Agent.EnrolledAt = time.Time{}
+	cfg.ControlPlane.AuthToken = ""
+	cfg.ControlPlane.EnrollToken = ""
+	cfg.ControlPlane.ActivationToken = ""
+	if u, err := url.Parse(cfg.ControlPlane.Proxy); err == nil && u.User != nil {
+		u.User = nil
+		cfg.ControlPlane.Proxy = u.String()
+	}
+}
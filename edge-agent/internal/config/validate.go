@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var validLogLevels = map[string]bool{
+	"trace": true, "debug": true, "info": true, "warn": true, "warning": true,
+	"error": true, "fatal": true, "panic": true,
+}
+
+// labelPattern matches label keys, kept to characters that are safe in
+// the control plane's placement rules.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+
+var validHookEvents = map[string]bool{
+	"pre_restart": true, "post_restart": true, "post_config_apply": true,
+}
+
+// Validate reports every problem with the configuration at once rather than
+// stopping at the first.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.ControlPlane.URL == "" {
+		problems = append(problems, "control_plane.url is required")
+	} else if u, err := url.Parse(c.ControlPlane.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "control_plane.url must be an http(s) URL")
+	}
+	for i, raw := range c.ControlPlane.URLs {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("control_plane.urls[%d] must be an http(s) URL", i))
+		}
+	}
+	switch c.ControlPlane.Transport {
+	case "rest":
+	case "grpc":
+		// gRPC needs HTTP/2, which net/http only negotiates over TLS.
+		for _, raw := range append([]string{c.ControlPlane.URL}, c.ControlPlane.URLs...) {
+			if raw != "" && !strings.HasPrefix(raw, "https://") {
+				problems = append(problems, fmt.Sprintf("control_plane.transport grpc needs https URLs, %s isn't", raw))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("control_plane.transport %q must be \"rest\" or \"grpc\"", c.ControlPlane.Transport))
+	}
+	switch c.ControlPlane.Attestation {
+	case "none", "tpm", "aws", "gcp", "azure":
+	default:
+		problems = append(problems, fmt.Sprintf("control_plane.attestation %q must be none, tpm, aws, gcp or azure", c.ControlPlane.Attestation))
+	}
+	switch c.ControlPlane.AddressFamily {
+	case "auto", "ipv4", "ipv6", "prefer_ipv4", "prefer_ipv6":
+	default:
+		problems = append(problems, fmt.Sprintf("control_plane.address_family %q must be auto, ipv4, ipv6, prefer_ipv4 or prefer_ipv6", c.ControlPlane.AddressFamily))
+	}
+	if source := c.ControlPlane.SourceAddress; source != "" {
+		ip := net.ParseIP(source)
+		switch {
+		case ip == nil:
+			problems = append(problems, fmt.Sprintf("control_plane.source_address %q is not an IP address", source))
+		case ip.To4() != nil && c.ControlPlane.AddressFamily == "ipv6", ip.To4() == nil && c.ControlPlane.AddressFamily == "ipv4":
+			problems = append(problems, fmt.Sprintf("control_plane.source_address %s can't be used with address_family %s", source, c.ControlPlane.AddressFamily))
+		}
+	}
+	if s := c.ControlPlane.FailoverStrategy; s != "ordered" && s != "latency" {
+		problems = append(problems, fmt.Sprintf("control_plane.failover_strategy %q must be \"ordered\" or \"latency\"", s))
+	}
+
+	switch c.Secrets.Backend {
+	case "config", "file", "keyring", "encrypted":
+	default:
+		problems = append(problems, fmt.Sprintf("secrets.backend %q must be config, file, keyring or encrypted", c.Secrets.Backend))
+	}
+
+	switch c.WingsTLS.Source {
+	case "", "control_plane":
+	case "acme":
+		switch c.WingsTLS.ACME.Challenge {
+		case "http-01":
+		case "dns-01":
+			if c.WingsTLS.ACME.DNSHook == "" {
+				problems = append(problems, "wings_tls.acme.dns_hook is required for dns-01")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("wings_tls.acme.challenge %q must be http-01 or dns-01", c.WingsTLS.ACME.Challenge))
+		}
+		if !strings.HasPrefix(c.WingsTLS.ACME.Directory, "https://") {
+			problems = append(problems, "wings_tls.acme.directory must be an https URL")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("wings_tls.source %q must be control_plane, acme or empty", c.WingsTLS.Source))
+	}
+
+	switch c.Firewall.Backend {
+	case "auto", "nftables", "iptables", "ufw":
+	default:
+		problems = append(problems, fmt.Sprintf("firewall.backend %q must be auto, nftables, iptables or ufw", c.Firewall.Backend))
+	}
+
+	if c.ControlPlane.Proxy != "" {
+		if u, err := url.Parse(c.ControlPlane.Proxy); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			problems = append(problems, "control_plane.proxy must be an http(s):// or socks5:// URL")
+		}
+	}
+
+	if c.ControlPlane.AuthToken == "" && c.ControlPlane.EnrollToken == "" && c.ControlPlane.ActivationToken == "" {
+		problems = append(problems, "control_plane.auth_token, control_plane.enroll_token or control_plane.activation_token is required")
+	}
+	if c.ControlPlane.ActivationToken != "" && c.Agent.NodeID == "" {
+		problems = append(problems, "control_plane.activation_token needs agent.node_id, the ID the node was pre-registered as")
+	}
+
+	if !validLogLevels[c.Agent.LogLevel] {
+		problems = append(problems, fmt.Sprintf("agent.log_level %q is not a valid level", c.Agent.LogLevel))
+	}
+	if c.Agent.HeartbeatInterval <= 0 {
+		problems = append(problems, "agent.heartbeat_interval must be positive")
+	}
+	if c.Agent.MetricsInterval <= 0 {
+		problems = append(problems, "agent.metrics_interval must be positive")
+	}
+	if c.Metrics.FlushInterval <= 0 || c.Metrics.MaxPendingSamples <= 0 {
+		problems = append(problems, "metrics.flush_interval and metrics.max_pending_samples must be positive")
+	}
+	if c.Shell.Enabled && len(c.Shell.Users) == 0 {
+		problems = append(problems, "shell.users is required when shell.enabled is set")
+	}
+	if c.Shell.IdleTimeout < 0 || c.Shell.MaxSessions < 0 {
+		problems = append(problems, "shell.idle_timeout and shell.max_sessions must be positive")
+	}
+	if c.Images.PruneThreshold > 100 {
+		problems = append(problems, "images.prune_threshold must be a percentage")
+	}
+	if c.Snapshots.Path != "" && !filepath.IsAbs(c.Snapshots.Path) {
+		problems = append(problems, "snapshots.path must be absolute")
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		problems = append(problems, fmt.Sprintf("logging.format %q must be text or json", c.Logging.Format))
+	}
+	for component, level := range c.Logging.Components {
+		if !validLogLevels[level] {
+			problems = append(problems, fmt.Sprintf("logging.components.%s %q is not a valid level", component, level))
+		}
+	}
+	if c.Logging.MaxSize < 0 || c.Logging.MaxAge < 0 {
+		problems = append(problems, "logging.max_size and logging.max_age must not be negative")
+	}
+	if c.Agent.IncidentWindow < 0 {
+		problems = append(problems, "agent.incident_window must be positive")
+	}
+	for _, strategy := range c.Agent.PublicIPStrategies {
+		switch strategy {
+		case "interface", "control_plane", "stun", "resolver":
+		default:
+			problems = append(problems, fmt.Sprintf("agent.public_ip_strategies %q must be interface, control_plane, stun or resolver", strategy))
+		}
+	}
+	if ip := net.ParseIP(c.Agent.PublicIP); c.Agent.PublicIP != "" && ip == nil {
+		problems = append(problems, fmt.Sprintf("agent.public_ip %q is not an IP address", c.Agent.PublicIP))
+	}
+	if c.Agent.ClockDriftThreshold < 0 {
+		problems = append(problems, "agent.clock_drift_threshold must be positive")
+	}
+	if c.Agent.MirrorHeartbeat && !filepath.IsAbs(c.Agent.MirrorPath) {
+		problems = append(problems, "agent.mirror_path must be absolute")
+	}
+	if listen := c.Agent.AdminListen; listen != "" {
+		host, _, err := net.SplitHostPort(listen)
+		if ip := net.ParseIP(host); err != nil || (host != "localhost" && (ip == nil || !ip.IsLoopback())) {
+			problems = append(problems, fmt.Sprintf("agent.admin_listen %q must be a loopback address, e.g. 127.0.0.1:9180", listen))
+		}
+	}
+	for _, token := range append(append([]string{}, c.Agent.AdminAuth.Admins.Tokens...), c.Agent.AdminAuth.Viewers.Tokens...) {
+		if len(token) != 64 || strings.Trim(strings.ToLower(token), "0123456789abcdef") != "" {
+			problems = append(problems, "agent.admin_auth tokens must be hex SHA-256 hashes, e.g. from `printf %s TOKEN | sha256sum`")
+			break
+		}
+	}
+	for key, value := range c.Agent.Labels {
+		if !labelPattern.MatchString(key) || len(value) > 63 {
+			problems = append(problems, fmt.Sprintf("agent.labels %q: keys must be letters, digits, '.', '_', '-' or '/' and values at most 63 characters", key))
+		}
+	}
+	switch c.Agent.ServiceManager {
+	case "auto", "systemd", "openrc", "windows":
+	default:
+		problems = append(problems, fmt.Sprintf("agent.service_manager %q must be auto, systemd, openrc or windows", c.Agent.ServiceManager))
+	}
+	if c.Metrics.BandwidthInterval <= 0 {
+		problems = append(problems, "metrics.bandwidth_interval must be positive")
+	}
+	if max := int(MinWingsTokenLifetime.Seconds()) / 2; c.Wings.TokenRenewBefore < 0 || c.Wings.TokenRenewBefore > max {
+		problems = append(problems, fmt.Sprintf("wings.token_renew_before must be between 0 and %d seconds, half the minimum token lifetime", max))
+	}
+	if c.Backups.PartSize < 5 {
+		problems = append(problems, "backups.part_size must be at least 5 (MiB), the S3 minimum")
+	}
+	if c.Telemetry.Enabled {
+		if u, err := url.Parse(c.Telemetry.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, "telemetry.endpoint must be an https:// URL when telemetry is enabled")
+		}
+		if c.Telemetry.Interval <= 0 {
+			problems = append(problems, "telemetry.interval must be positive")
+		}
+	}
+
+	if c.Downloads.MaxBandwidth < 0 {
+		problems = append(problems, "downloads.max_bandwidth must not be negative")
+	}
+
+	if c.Transfers.RateMbit < 0 {
+		problems = append(problems, "transfers.rate_mbit must not be negative")
+	}
+	for i, w := range c.Transfers.Windows {
+		if !validClock(w.From) || !validClock(w.To) {
+			problems = append(problems, fmt.Sprintf("transfers.windows[%d] from and to must be HH:MM", i))
+		}
+		if w.RateMbit < 0 {
+			problems = append(problems, fmt.Sprintf("transfers.windows[%d].rate_mbit must not be negative", i))
+		}
+	}
+
+	for i, check := range c.HealthChecks {
+		if check.Path == "" {
+			problems = append(problems, fmt.Sprintf("health_checks[%d].path is required", i))
+		}
+		if check.Interval <= 0 || check.Timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("health_checks[%d] interval and timeout must be positive", i))
+		}
+	}
+
+	for i, hook := range c.Hooks {
+		if hook.Path == "" {
+			problems = append(problems, fmt.Sprintf("hooks[%d].path is required", i))
+		}
+		if !validHookEvents[hook.Event] {
+			problems = append(problems, fmt.Sprintf("hooks[%d].event %q must be pre_restart, post_restart or post_config_apply", i, hook.Event))
+		}
+		if hook.Timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("hooks[%d].timeout must be positive", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func validClock(s string) bool {
+	_, err := time.Parse("15:04", s)
+	return err == nil
+}
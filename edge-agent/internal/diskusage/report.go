@@ -0,0 +1,11 @@
+package diskusage
+
+import "time"
+
+// Report is the per-server usage sent in heartbeats.
+type Report struct {
+	Servers      map[string]int64 `json:"servers"` // bytes on disk by server UUID
+	Watches      int              `json:"watches"`
+	Unwatched    []string         `json:"unwatched,omitempty"` // servers only updated by reconciliation
+	ReconciledAt time.Time        `json:"reconciled_at"`
+}
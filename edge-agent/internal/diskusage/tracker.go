@@ -0,0 +1,362 @@
+//go:build linux
+
+package diskusage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Events are coalesced per directory and applied this often, so a
+	// server writing a large file doesn't cause a rescan per write.
+	flushInterval = 5 * time.Second
+
+	dirEvents  = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY
+	rootEvents = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+)
+
+type dirState struct {
+	server string
+	wd     int32 // -1 when unwatched
+	bytes  int64 // files directly in this directory
+}
+
+// Tracker keeps per-server disk usage of the Wings data directory current
+// without repeated du scans. Each directory's own usage is cached and only
+// the directory an inotify event names is rescanned. A full walk runs at
+// startup, periodically, and whenever the kernel drops events.
+//
+// All bookkeeping happens on the goroutine started by Start; mu only guards
+// the report handed to other goroutines.
+type Tracker struct {
+	root      string
+	reconcile time.Duration
+	logger    *logrus.Entry
+
+	fd        int
+	rootWd    int32
+	file      *os.File
+	watches   map[int32]string
+	dirs      map[string]*dirState
+	dirty     map[string]bool
+	unwatched map[string]bool
+	warned    bool
+
+	mu     sync.Mutex
+	report Report
+}
+
+func New(root string, reconcileInterval time.Duration, logger *logrus.Entry) *Tracker {
+	return &Tracker{
+		root:      filepath.Clean(root),
+		reconcile: reconcileInterval,
+		logger:    logger.WithField("component", "disk_usage"),
+		watches:   make(map[int32]string),
+		dirs:      make(map[string]*dirState),
+		dirty:     make(map[string]bool),
+		unwatched: make(map[string]bool),
+	}
+}
+
+// Report returns the latest usage snapshot.
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := t.report
+	r.Servers = make(map[string]int64, len(t.report.Servers))
+	for k, v := range t.report.Servers {
+		r.Servers[k] = v
+	}
+	r.Unwatched = append([]string(nil), t.report.Unwatched...)
+	return r
+}
+
+// Start sets up the watches and tracks usage until ctx is done.
+func (t *Tracker) Start(ctx context.Context) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to initialise inotify: %w", err)
+	}
+	t.fd = fd
+	// A non-blocking fd goes through the runtime poller, so Close unblocks Read.
+	t.file = os.NewFile(uintptr(fd), "inotify")
+
+	wd, err := syscall.InotifyAddWatch(fd, t.root, rootEvents)
+	if err != nil {
+		t.file.Close()
+		return fmt.Errorf("failed to watch %s: %w", t.root, err)
+	}
+	t.rootWd = int32(wd)
+	t.watches[t.rootWd] = t.root
+
+	events := make(chan syscall.InotifyEvent, 256)
+	names := make(chan string, 256)
+	go t.read(events, names)
+	go func() {
+		<-ctx.Done()
+		t.file.Close()
+	}()
+
+	t.fullReconcile()
+	go t.run(ctx, events, names)
+	return nil
+}
+
+// read decodes raw inotify events. Each event is paired with its name on
+// the second channel.
+func (t *Tracker) read(events chan<- syscall.InotifyEvent, names chan<- string) {
+	defer close(events)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := t.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := *(*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(ev.Len)]), "\x00")
+			offset = nameStart + int(ev.Len)
+
+			events <- ev
+			names <- name
+		}
+	}
+}
+
+func (t *Tracker) run(ctx context.Context, events <-chan syscall.InotifyEvent, names <-chan string) {
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	reconcile := time.NewTicker(t.reconcile)
+	defer reconcile.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			t.handle(ev, <-names)
+		case <-flush.C:
+			if len(t.dirty) > 0 {
+				t.flush()
+			}
+		case <-reconcile.C:
+			t.fullReconcile()
+		}
+	}
+}
+
+func (t *Tracker) handle(ev syscall.InotifyEvent, name string) {
+	if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		t.logger.Warn("inotify queue overflowed, reconciling")
+		t.fullReconcile()
+		return
+	}
+
+	dir, ok := t.watches[ev.Wd]
+	if !ok {
+		return
+	}
+	if ev.Mask&syscall.IN_IGNORED != 0 {
+		delete(t.watches, ev.Wd)
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	isDir := ev.Mask&syscall.IN_ISDIR != 0
+
+	switch {
+	case isDir && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		server := t.serverOf(path)
+		if server == "" {
+			return
+		}
+		// Directories moved in can already hold files.
+		t.scanTree(server, path)
+		t.publish()
+	case isDir && ev.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		t.dropTree(path)
+		t.publish()
+	case dir != t.root:
+		t.dirty[dir] = true
+	}
+}
+
+// serverOf returns the server UUID a path under the root belongs to.
+func (t *Tracker) serverOf(path string) string {
+	rel, err := filepath.Rel(t.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return strings.SplitN(rel, string(filepath.Separator), 2)[0]
+}
+
+// flush rescans the directories touched since the last flush.
+func (t *Tracker) flush() {
+	for dir := range t.dirty {
+		if st, ok := t.dirs[dir]; ok {
+			st.bytes = dirBytes(dir)
+		}
+	}
+	t.dirty = make(map[string]bool)
+	t.publish()
+}
+
+func (t *Tracker) scanTree(server, path string) {
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		t.addDir(server, p)
+		return nil
+	})
+}
+
+func (t *Tracker) addDir(server, dir string) {
+	st, ok := t.dirs[dir]
+	if !ok {
+		st = &dirState{server: server, wd: -1}
+		t.dirs[dir] = st
+	}
+	if st.wd < 0 && !t.unwatched[server] {
+		wd, err := syscall.InotifyAddWatch(t.fd, dir, dirEvents)
+		if err == nil {
+			st.wd = int32(wd)
+			t.watches[st.wd] = dir
+		} else if errors.Is(err, syscall.ENOSPC) {
+			t.unwatched[server] = true
+			if !t.warned {
+				t.warned = true
+				t.logger.Warn("Out of inotify watches, some servers are only updated on reconciliation; raise fs.inotify.max_user_watches")
+			}
+		}
+	}
+	st.bytes = dirBytes(dir)
+}
+
+func (t *Tracker) dropTree(path string) {
+	prefix := path + string(filepath.Separator)
+	for dir, st := range t.dirs {
+		if dir != path && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		if st.wd >= 0 {
+			syscall.InotifyRmWatch(t.fd, uint32(st.wd))
+			delete(t.watches, st.wd)
+		}
+		delete(t.dirs, dir)
+		delete(t.dirty, dir)
+	}
+}
+
+// fullReconcile walks the whole data directory, fixing any drift and
+// retrying watches for servers that ran out of them.
+func (t *Tracker) fullReconcile() {
+	start := time.Now()
+	t.unwatched = make(map[string]bool)
+	t.warned = false
+
+	seen := make(map[string]bool)
+	entries, err := os.ReadDir(t.root)
+	if err != nil {
+		t.logger.WithError(err).Warn("Failed to read Wings data directory")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		server := entry.Name()
+		filepath.WalkDir(filepath.Join(t.root, server), func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			seen[p] = true
+			t.addDir(server, p)
+			return nil
+		})
+	}
+
+	for dir, st := range t.dirs {
+		if seen[dir] {
+			continue
+		}
+		if st.wd >= 0 {
+			syscall.InotifyRmWatch(t.fd, uint32(st.wd))
+			delete(t.watches, st.wd)
+		}
+		delete(t.dirs, dir)
+	}
+	t.dirty = make(map[string]bool)
+
+	t.mu.Lock()
+	t.report.ReconciledAt = time.Now().UTC()
+	t.mu.Unlock()
+	t.publish()
+
+	t.logger.WithFields(logrus.Fields{
+		"directories": len(t.dirs),
+		"watches":     len(t.watches),
+		"took":        time.Since(start).Round(time.Millisecond),
+	}).Debug("Reconciled server disk usage")
+}
+
+// publish recomputes the per-server totals from the directory cache.
+func (t *Tracker) publish() {
+	servers := make(map[string]int64)
+	for _, st := range t.dirs {
+		servers[st.server] += st.bytes
+	}
+	var unwatched []string
+	for server := range t.unwatched {
+		unwatched = append(unwatched, server)
+	}
+
+	t.mu.Lock()
+	t.report.Servers = servers
+	t.report.Watches = len(t.watches) - 1
+	t.report.Unwatched = unwatched
+	t.mu.Unlock()
+}
+
+// dirBytes is the space allocated to the files directly in dir, as du
+// counts it.
+func dirBytes(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			total += st.Blocks * 512
+		} else {
+			total += info.Size()
+		}
+	}
+	return total
+}
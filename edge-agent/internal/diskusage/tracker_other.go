@@ -0,0 +1,27 @@
+//go:build !linux
+
+package diskusage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Tracker needs inotify, so off Linux it never starts and heartbeats go
+// without per-server disk usage.
+type Tracker struct{}
+
+func New(root string, reconcileInterval time.Duration, logger *logrus.Entry) *Tracker {
+	return &Tracker{}
+}
+
+func (t *Tracker) Report() Report {
+	return Report{}
+}
+
+func (t *Tracker) Start(ctx context.Context) error {
+	return fmt.Errorf("per-server disk usage tracking needs inotify, which is only available on Linux")
+}
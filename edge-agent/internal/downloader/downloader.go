@@ -0,0 +1,234 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const chunkSize = 32 * 1024
+
+// Request describes a single artifact to fetch.
+type Request struct {
+	URL     string
+	Dest    string
+	SHA256  string // optional hex digest, verified before the file is moved into place
+	Headers map[string]string
+}
+
+// Downloader is shared by everything on the node that fetches artifacts so
+// that bandwidth and concurrency caps apply globally.
+type Downloader struct {
+	client     *http.Client
+	logger     *logrus.Entry
+	limiter    *limiter
+	slots      chan struct{}
+	maxRetries int
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func New(cfg config.DownloadsConfig, proxy func(*http.Request) (*url.URL, error), logger *logrus.Entry) (*Downloader, error) {
+	if cfg.MaxBandwidth < 0 {
+		return nil, fmt.Errorf("invalid max_bandwidth: %d", cfg.MaxBandwidth)
+	}
+
+	concurrent := cfg.MaxConcurrent
+	if concurrent <= 0 {
+		concurrent = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &Downloader{
+		// No overall timeout: large artifacts on a capped link can take a while,
+		// the caller's context bounds the transfer instead.
+		client:     &http.Client{Transport: transport},
+		logger:     logger.WithField("component", "downloader"),
+		limiter:    newLimiter(cfg.MaxBandwidth),
+		slots:      make(chan struct{}, concurrent),
+		maxRetries: cfg.MaxRetries,
+	}, nil
+}
+
+// Download fetches req.URL into req.Dest. Partial data is kept in a ".part"
+// file next to the destination so an interrupted transfer resumes where it
+// left off on the next attempt, as long as the server's ETag shows the
+// content hasn't changed since.
+func (d *Downloader) Download(ctx context.Context, req Request) error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-d.slots }()
+
+	if err := os.MkdirAll(filepath.Dir(req.Dest), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	logger := d.logger.WithField("url", req.URL)
+	backoff := time.Second
+
+	var err error
+	for attempt := 0; attempt <= d.maxRetries; attempt++ {
+		if attempt > 0 {
+			logger.WithError(err).WithField("attempt", attempt).Warn("Download failed, retrying")
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		}
+
+		if err = d.fetch(ctx, req); err == nil {
+			break
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) || ctx.Err() != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("download failed after %d attempts: %w", d.maxRetries+1, err)
+	}
+
+	partPath := req.Dest + ".part"
+	os.Remove(partPath + ".etag")
+	if req.SHA256 != "" {
+		if err := verifyChecksum(partPath, req.SHA256); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, req.Dest); err != nil {
+		return fmt.Errorf("failed to move download into place: %w", err)
+	}
+
+	logger.WithField("dest", req.Dest).Info("Download completed")
+	return nil
+}
+
+func (d *Downloader) fetch(ctx context.Context, req Request) error {
+	partPath := req.Dest + ".part"
+	etagPath := partPath + ".etag"
+
+	// Only resume what the ETag identifies; without one the part file may
+	// be of a different version of the artifact.
+	var offset int64
+	etag, _ := os.ReadFile(etagPath)
+	if info, err := os.Stat(partPath); err == nil && len(etag) > 0 {
+		offset = info.Size()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", req.URL, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		httpReq.Header.Set("If-Range", string(etag))
+	}
+
+	resp, err := d.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file is as long as the artifact or longer, which a
+		// download cut short can't be. Start over.
+		resp.Body.Close()
+		os.Remove(partPath)
+		os.Remove(etagPath)
+		return d.fetch(ctx, req)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// Server ignored the range request, or the content changed since
+		// the part file was started: start from scratch.
+		flags |= os.O_TRUNC
+		if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			os.WriteFile(etagPath, []byte(etag), 0644)
+		} else {
+			os.Remove(etagPath)
+		}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)}
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return &permanentError{err}
+	}
+	defer f.Close()
+
+	buf := make([]byte, d.limiter.chunk(chunkSize))
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if err := d.limiter.wait(ctx, n); err != nil {
+				return err
+			}
+			if _, err := f.Write(buf[:n]); err != nil {
+				return &permanentError{err}
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func verifyChecksum(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reportBatchSize     = 50
+	reportFlushInterval = 5 * time.Second
+	reportMaxQueued     = 1000
+	reportMaxBackoff    = 5 * time.Minute
+)
+
+// Sender delivers one batch of events.
+type Sender func(batch []Event) error
+
+// Reporter queues events for the control plane and sends them in batches,
+// retrying with backoff while it's unreachable. When the queue is full the
+// oldest events are dropped.
+type Reporter struct {
+	send   Sender
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	queue   []Event
+	nextID  uint64
+	dropped int
+	notify  chan struct{}
+}
+
+func NewReporter(send Sender, logger *logrus.Entry) *Reporter {
+	return &Reporter{
+		send:   send,
+		logger: logger.WithField("component", "events"),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (r *Reporter) Report(eventType string, data interface{}) {
+	r.mu.Lock()
+	r.nextID++
+	r.queue = append(r.queue, Event{ID: r.nextID, Type: eventType, Time: time.Now().UTC(), Data: data})
+	if over := len(r.queue) - reportMaxQueued; over > 0 {
+		r.queue = r.queue[over:]
+		r.dropped += over
+	}
+	full := len(r.queue) >= reportBatchSize
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Len returns the number of events waiting to be sent.
+func (r *Reporter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queue)
+}
+
+// Run flushes queued events until ctx is done.
+func (r *Reporter) Run(ctx context.Context) {
+	backoff := reportFlushInterval
+	timer := time.NewTimer(reportFlushInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-r.notify:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+
+		if err := r.flush(); err != nil {
+			r.logger.WithError(err).Warn("Failed to send events, will retry")
+			backoff *= 2
+			if backoff > reportMaxBackoff {
+				backoff = reportMaxBackoff
+			}
+		} else {
+			backoff = reportFlushInterval
+		}
+		timer.Reset(backoff)
+	}
+}
+
+func (r *Reporter) flush() error {
+	for {
+		r.mu.Lock()
+		if r.dropped > 0 {
+			r.logger.WithField("count", r.dropped).Warn("Event queue full, dropped oldest events")
+			r.dropped = 0
+		}
+		n := len(r.queue)
+		if n > reportBatchSize {
+			n = reportBatchSize
+		}
+		batch := append([]Event(nil), r.queue[:n]...)
+		r.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := r.send(batch); err != nil {
+			return err
+		}
+
+		// Drop what was sent. Events may have been trimmed from the front
+		// meanwhile, so match by ID rather than position.
+		r.mu.Lock()
+		last := batch[len(batch)-1].ID
+		i := 0
+		for i < len(r.queue) && r.queue[i].ID <= last {
+			i++
+		}
+		r.queue = r.queue[i:]
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,285 @@
+// Package firewall applies the inbound rules the control plane pushes
+// through nftables, iptables or ufw, keeping its rules apart from the
+// operator's and rolling back to a snapshot when an apply goes wrong.
+package firewall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Rule actions. Every backend supports all three.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	ActionLimit = "limit" // drop new connections above Rate
+)
+
+// Rule is one inbound rule pushed by the control plane. Rules are matched
+// in order, so an allow for the panel IP goes before the deny for
+// everybody else.
+type Rule struct {
+	Action   string `json:"action"`
+	Protocol string `json:"protocol"`         // tcp or udp, defaults to tcp
+	Ports    string `json:"ports"`            // "2022" or "25565-25600"
+	Source   string `json:"source,omitempty"` // IP or CIDR, empty for any
+	Rate     string `json:"rate,omitempty"`   // for limit, e.g. "10/minute"
+	Comment  string `json:"comment,omitempty"`
+}
+
+var ratePattern = regexp.MustCompile(`^[1-9][0-9]*/(second|minute|hour|day)$`)
+
+// Validate normalizes the rule and rejects anything a backend would have to
+// guess about.
+func (r *Rule) Validate() error {
+	if r.Protocol == "" {
+		r.Protocol = "tcp"
+	}
+	switch r.Action {
+	case ActionAllow, ActionDeny:
+	case ActionLimit:
+		if !ratePattern.MatchString(r.Rate) {
+			return fmt.Errorf("invalid rate %q, expected e.g. 10/minute", r.Rate)
+		}
+	default:
+		return fmt.Errorf("unsupported action %q", r.Action)
+	}
+	if r.Protocol != "tcp" && r.Protocol != "udp" {
+		return fmt.Errorf("unsupported protocol %q", r.Protocol)
+	}
+	if _, _, err := r.portRange(); err != nil {
+		return err
+	}
+	if r.Source != "" && net.ParseIP(r.Source) == nil {
+		if _, _, err := net.ParseCIDR(r.Source); err != nil {
+			return fmt.Errorf("invalid source %q", r.Source)
+		}
+	}
+	return nil
+}
+
+func (r Rule) portRange() (int, int, error) {
+	lo, hi, isRange := strings.Cut(r.Ports, "-")
+	first, err := strconv.Atoi(lo)
+	if err != nil || first < 1 || first > 65535 {
+		return 0, 0, fmt.Errorf("invalid ports %q", r.Ports)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err := strconv.Atoi(hi)
+	if err != nil || last < first || last > 65535 {
+		return 0, 0, fmt.Errorf("invalid ports %q", r.Ports)
+	}
+	return first, last, nil
+}
+
+// ports formats the range with the backend's separator.
+func (r Rule) ports(sep string) string {
+	first, last, _ := r.portRange()
+	if first == last {
+		return strconv.Itoa(first)
+	}
+	return fmt.Sprintf("%d%s%d", first, sep, last)
+}
+
+// ipv6 reports whether the rule only applies to IPv6 sources.
+func (r Rule) ipv6() bool {
+	return r.Source != "" && strings.Contains(r.Source, ":")
+}
+
+// Backend owns a set of rules in one firewall tool. Apply replaces all of
+// them, so applying the same rules twice changes nothing. Snapshot and
+// Restore cover whatever Apply touches.
+type Backend interface {
+	Name() string
+	Apply(rules []Rule) error
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+// State is what was last applied.
+type State struct {
+	Backend    string    `json:"backend"`
+	Hash       string    `json:"hash,omitempty"`
+	Rules      []Rule    `json:"rules"`
+	AppliedAt  time.Time `json:"applied_at,omitempty"`
+	RolledBack bool      `json:"rolled_back,omitempty"` // the last apply was undone
+}
+
+// Manager applies rule sets with a snapshot taken first, and puts the
+// snapshot back when applying or the caller's verification fails.
+type Manager struct {
+	backend      Backend
+	statePath    string
+	snapshotPath string
+	logger       *logrus.Entry
+
+	mu    sync.Mutex
+	state State
+}
+
+// New picks the configured backend, or detects one for "auto", and loads
+// the state of the last apply from dataDir.
+func New(cfg config.FirewallConfig, dataDir string, logger *logrus.Entry) (*Manager, error) {
+	backend, err := newBackend(cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{
+		backend:      backend,
+		statePath:    filepath.Join(dataDir, "firewall.json"),
+		snapshotPath: filepath.Join(dataDir, "firewall.snapshot"),
+		logger:       logger.WithFields(logrus.Fields{"component": "firewall", "backend": backend.Name()}),
+	}
+	if data, err := os.ReadFile(m.statePath); err == nil {
+		json.Unmarshal(data, &m.state)
+	}
+	m.state.Backend = backend.Name()
+	return m, nil
+}
+
+func newBackend(name string) (Backend, error) {
+	if name == "auto" {
+		name = detect()
+		if name == "" {
+			return nil, fmt.Errorf("no supported firewall found (nft, iptables or ufw)")
+		}
+	}
+	switch name {
+	case "nftables":
+		return nftables{}, nil
+	case "iptables":
+		return iptables{}, nil
+	case "ufw":
+		return ufw{}, nil
+	}
+	return nil, fmt.Errorf("unsupported firewall backend %q", name)
+}
+
+// detect prefers an active ufw, since rules added underneath it would be
+// lost on its next reload.
+func detect() string {
+	if out, err := exec.Command("ufw", "status").Output(); err == nil && strings.Contains(string(out), "Status: active") {
+		return "ufw"
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		return "nftables"
+	}
+	if _, err := exec.LookPath("iptables-restore"); err == nil {
+		return "iptables"
+	}
+	return ""
+}
+
+// Hash identifies a rule set, so the control plane can tell whether the
+// node already has it.
+func Hash(rules []Rule) string {
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Apply installs rules unless they're already in place. verify runs after
+// applying, e.g. to check the control plane is still reachable; if it
+// fails the previous rules are restored.
+func (m *Manager) Apply(rules []Rule, verify func() error) (bool, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return false, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := Hash(rules)
+	if hash == m.state.Hash && !m.state.RolledBack {
+		return false, nil
+	}
+
+	snapshot, err := m.backend.Snapshot()
+	if err != nil {
+		return false, fmt.Errorf("failed to snapshot firewall: %w", err)
+	}
+	if err := os.WriteFile(m.snapshotPath, snapshot, 0600); err != nil {
+		return false, fmt.Errorf("failed to save firewall snapshot: %w", err)
+	}
+
+	err = m.backend.Apply(rules)
+	if err == nil && verify != nil {
+		if verr := verify(); verr != nil {
+			err = fmt.Errorf("verification failed: %w", verr)
+		}
+	}
+	if err != nil {
+		if rerr := m.backend.Restore(snapshot); rerr != nil {
+			return false, fmt.Errorf("failed to apply firewall rules (%v), and restoring the previous rules failed: %w", err, rerr)
+		}
+		m.logger.WithError(err).Warn("Firewall rules rolled back")
+		return false, fmt.Errorf("failed to apply firewall rules, previous rules restored: %w", err)
+	}
+
+	m.state = State{Backend: m.backend.Name(), Hash: hash, Rules: rules, AppliedAt: time.Now().UTC()}
+	m.logger.WithField("rules", len(rules)).Info("Firewall rules applied")
+	return true, m.save()
+}
+
+// Rollback restores the rules from before the last apply.
+func (m *Manager) Rollback() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot, err := os.ReadFile(m.snapshotPath)
+	if err != nil {
+		return fmt.Errorf("no firewall snapshot to roll back to: %w", err)
+	}
+	if err := m.backend.Restore(snapshot); err != nil {
+		return fmt.Errorf("failed to restore firewall snapshot: %w", err)
+	}
+	m.state.RolledBack = true
+	m.logger.Warn("Firewall rolled back to the previous rules")
+	return m.save()
+}
+
+// Status returns the last applied state.
+func (m *Manager) Status() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+func (m *Manager) save() error {
+	data, err := json.Marshal(m.state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.statePath, data, 0600)
+}
+
+// run executes a firewall tool, with stdin when given.
+func run(stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+)
+
+// iptablesChain holds the agent's rules, jumped to first from INPUT.
+const iptablesChain = "EDGE-AGENT"
+
+type iptables struct{}
+
+func (iptables) Name() string { return "iptables" }
+
+// Apply rewrites the chain for IPv4 and IPv6 with one restore each.
+// --noflush leaves every other chain alone, while declaring ours empties it.
+func (iptables) Apply(rules []Rule) error {
+	for _, tool := range []string{"iptables", "ip6tables"} {
+		v6 := tool == "ip6tables"
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "*filter\n:%s - [0:0]\n", iptablesChain)
+		for i, r := range rules {
+			if r.Source != "" && r.ipv6() != v6 {
+				continue
+			}
+			fmt.Fprintf(&b, "-A %s %s\n", iptablesChain, iptablesRule(i, r))
+		}
+		b.WriteString("COMMIT\n")
+
+		if _, err := run(b.String(), tool+"-restore", "--noflush"); err != nil {
+			return err
+		}
+		if _, err := run("", tool, "-C", "INPUT", "-j", iptablesChain); err != nil {
+			if _, err := run("", tool, "-I", "INPUT", "1", "-j", iptablesChain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func iptablesRule(i int, r Rule) string {
+	args := []string{"-p", r.Protocol}
+	if r.Source != "" {
+		args = append(args, "-s", r.Source)
+	}
+	args = append(args, "--dport", r.ports(":"))
+
+	switch r.Action {
+	case ActionAllow:
+		args = append(args, "-j", "ACCEPT")
+	case ActionDeny:
+		args = append(args, "-j", "DROP")
+	default:
+		args = append(args, "-m", "conntrack", "--ctstate", "NEW",
+			"-m", "hashlimit", "--hashlimit-above", r.Rate, "--hashlimit-mode", "srcip",
+			"--hashlimit-name", fmt.Sprintf("edge_limit_%d", i), "-j", "DROP")
+	}
+	if r.Comment != "" {
+		args = append(args, "-m", "comment", "--comment", fmt.Sprintf("%q", r.Comment))
+	}
+	return strings.Join(args, " ")
+}
+
+// Snapshot saves the whole filter table for both families, separated by a
+// marker line.
+func (iptables) Snapshot() ([]byte, error) {
+	v4, err := run("", "iptables-save", "-t", "filter")
+	if err != nil {
+		return nil, err
+	}
+	v6, err := run("", "ip6tables-save", "-t", "filter")
+	if err != nil {
+		return nil, err
+	}
+	return append(append(v4, []byte(ip6Marker)...), v6...), nil
+}
+
+const ip6Marker = "\n# ip6tables\n"
+
+func (iptables) Restore(snapshot []byte) error {
+	v4, v6, _ := strings.Cut(string(snapshot), ip6Marker)
+	if _, err := run(v4, "iptables-restore", "-T", "filter"); err != nil {
+		return err
+	}
+	if v6 != "" {
+		if _, err := run(v6, "ip6tables-restore", "-T", "filter"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nftTable is owned by the agent and replaced as a whole. Its input chain
+// runs before the distribution's filter chains; an accept here doesn't
+// override a drop in another table, so allow rules only make exceptions to
+// this table's own denies.
+const nftTable = "edge_agent"
+
+type nftables struct{}
+
+func (nftables) Name() string { return "nftables" }
+
+// Apply loads the table in one transaction: declaring it first makes the
+// delete succeed when it doesn't exist yet.
+func (nftables) Apply(rules []Rule) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n", nftTable, nftTable)
+	fmt.Fprintf(&b, "table inet %s {\n\tchain input {\n\t\ttype filter hook input priority -10; policy accept;\n", nftTable)
+	for i, r := range rules {
+		for _, line := range nftRule(i, r) {
+			fmt.Fprintf(&b, "\t\t%s\n", line)
+		}
+	}
+	b.WriteString("\t}\n}\n")
+
+	_, err := run(b.String(), "nft", "-f", "-")
+	return err
+}
+
+func nftRule(i int, r Rule) []string {
+	match := fmt.Sprintf("%s dport %s", r.Protocol, r.ports("-"))
+	comment := ""
+	if r.Comment != "" {
+		comment = fmt.Sprintf(" comment %q", r.Comment)
+	}
+
+	families := []string{"ip", "ip6"}
+	if r.Source != "" {
+		families = []string{"ip"}
+		if r.ipv6() {
+			families = []string{"ip6"}
+		}
+	}
+
+	switch r.Action {
+	case ActionAllow, ActionDeny:
+		verdict := "accept"
+		if r.Action == ActionDeny {
+			verdict = "drop"
+		}
+		if r.Source == "" {
+			return []string{fmt.Sprintf("%s %s%s", match, verdict, comment)}
+		}
+		return []string{fmt.Sprintf("%s saddr %s %s %s%s", families[0], r.Source, match, verdict, comment)}
+	default:
+		// The meter keeps a rate per source address.
+		var lines []string
+		for _, family := range families {
+			source := ""
+			if r.Source != "" {
+				source = fmt.Sprintf("%s saddr %s ", family, r.Source)
+			}
+			lines = append(lines, fmt.Sprintf("%s%s ct state new meter edge_limit_%d_%s { %s saddr limit rate over %s } drop%s",
+				source, match, i, family, family, r.Rate, comment))
+		}
+		return lines
+	}
+}
+
+func (nftables) Snapshot() ([]byte, error) {
+	out, err := run("", "nft", "list", "table", "inet", nftTable)
+	if err != nil {
+		// Nothing to keep before the first apply.
+		return nil, nil
+	}
+	return out, nil
+}
+
+func (nftables) Restore(snapshot []byte) error {
+	script := fmt.Sprintf("table inet %s\ndelete table inet %s\n", nftTable, nftTable) + string(snapshot)
+	_, err := run(script, "nft", "-f", "-")
+	return err
+}
@@ -0,0 +1,114 @@
+package firewall
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ufwComment tags the agent's rules, the rest are the operator's.
+const ufwComment = "edge-agent"
+
+var ufwRulesFiles = []string{"/etc/ufw/user.rules", "/etc/ufw/user6.rules"}
+
+var ufwNumbered = regexp.MustCompile(`^\[\s*(\d+)\]`)
+
+type ufw struct{}
+
+func (ufw) Name() string { return "ufw" }
+
+// Apply deletes the agent's rules and adds the new ones. ufw's limit has
+// a fixed rate of 6 connections in 30 seconds, Rate is ignored.
+func (u ufw) Apply(rules []Rule) error {
+	if err := u.deleteOwn(); err != nil {
+		return err
+	}
+	for _, r := range rules {
+		args := []string{r.Action, "proto", r.Protocol, "from", "any", "to", "any", "port", r.ports(":")}
+		if r.Source != "" {
+			args[4] = r.Source
+		}
+		comment := ufwComment
+		if r.Comment != "" {
+			comment += ": " + r.Comment
+		}
+		args = append(args, "comment", comment)
+		if _, err := run("", "ufw", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOwn removes tagged rules from the bottom up, so the numbers of
+// the ones still to go don't shift.
+func (ufw) deleteOwn() error {
+	out, err := run("", "ufw", "status", "numbered")
+	if err != nil {
+		return err
+	}
+	var numbers []int
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		m := ufwNumbered.FindStringSubmatch(line)
+		if m == nil || !strings.Contains(line, "# "+ufwComment) {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		numbers = append(numbers, n)
+	}
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if _, err := run("", "ufw", "--force", "delete", strconv.Itoa(numbers[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot keeps ufw's own rule files, which hold every user rule, each
+// after a "path size" header line.
+func (ufw) Snapshot() ([]byte, error) {
+	var b bytes.Buffer
+	for _, path := range ufwRulesFiles {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%s %d\n", path, len(data))
+		b.Write(data)
+	}
+	return b.Bytes(), nil
+}
+
+func (ufw) Restore(snapshot []byte) error {
+	r := bufio.NewReader(bytes.NewReader(snapshot))
+	for {
+		header, err := r.ReadString('\n')
+		if header == "" && err != nil {
+			break
+		}
+		var path string
+		var size int
+		if _, err := fmt.Sscanf(header, "%s %d\n", &path, &size); err != nil {
+			return fmt.Errorf("corrupt ufw snapshot: %w", err)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("corrupt ufw snapshot: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			return err
+		}
+	}
+	_, err := run("", "ufw", "reload")
+	return err
+}
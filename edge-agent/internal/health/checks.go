@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const maxOutputLen = 512
+
+// Result is the latest outcome of one check.
+type Result struct {
+	Name      string    `json:"name"`
+	OK        bool      `json:"ok"`
+	ExitCode  int       `json:"exit_code"`
+	Output    string    `json:"output,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the health summary attached to heartbeats. Score is 0-100, the
+// weighted share of passing checks.
+type Report struct {
+	Score  int      `json:"score"`
+	Checks []Result `json:"checks"`
+}
+
+// Runner executes operator-defined check scripts on their own intervals.
+type Runner struct {
+	checks []config.HealthCheckConfig
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	results map[string]Result
+}
+
+func NewRunner(checks []config.HealthCheckConfig, logger *logrus.Entry) *Runner {
+	return &Runner{
+		checks:  checks,
+		logger:  logger.WithField("component", "health"),
+		results: make(map[string]Result),
+	}
+}
+
+func (r *Runner) Start(ctx context.Context) {
+	for _, check := range r.checks {
+		go r.loop(ctx, check)
+	}
+}
+
+func (r *Runner) loop(ctx context.Context, check config.HealthCheckConfig) {
+	ticker := time.NewTicker(time.Duration(check.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		r.run(ctx, check)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, check config.HealthCheckConfig) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.Timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, check.Path, check.Args...).CombinedOutput()
+
+	result := Result{
+		Name:      check.Name,
+		Duration:  float64(time.Since(start)) / float64(time.Millisecond),
+		CheckedAt: start,
+		Output:    truncate(strings.TrimSpace(string(out)), maxOutputLen),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		// Timed out or couldn't start at all.
+		result.ExitCode = -1
+		if result.Output == "" {
+			result.Output = err.Error()
+		}
+	}
+	result.OK = result.ExitCode == check.ExpectedExitCode
+
+	r.mu.Lock()
+	prev, seen := r.results[check.Name]
+	r.results[check.Name] = result
+	r.mu.Unlock()
+
+	if !result.OK && (!seen || prev.OK) {
+		r.logger.WithFields(logrus.Fields{
+			"check":     check.Name,
+			"exit_code": result.ExitCode,
+		}).Warn("Health check failing")
+	}
+}
+
+func (r *Runner) Report() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{Score: 100}
+	totalWeight, passingWeight := 0, 0
+
+	for _, check := range r.checks {
+		result, ok := r.results[check.Name]
+		if !ok {
+			continue
+		}
+		report.Checks = append(report.Checks, result)
+		totalWeight += check.Weight
+		if result.OK {
+			passingWeight += check.Weight
+		}
+	}
+
+	if totalWeight > 0 {
+		report.Score = passingWeight * 100 / totalWeight
+	}
+	return report
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
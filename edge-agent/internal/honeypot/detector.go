@@ -0,0 +1,140 @@
+package honeypot
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SourceSummary aggregates connection attempts from one address over a
+// reporting window.
+type SourceSummary struct {
+	Source        string    `json:"source"`
+	Ports         []int     `json:"ports"`
+	Count         int       `json:"count"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	RatePerMinute float64   `json:"rate_per_minute"`
+}
+
+type sourceState struct {
+	ports     map[int]bool
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// Detector listens on decoy ports nothing legitimate should connect to.
+// Connections are closed immediately without reading or writing anything.
+type Detector struct {
+	ports  []int
+	logger *logrus.Entry
+
+	mu          sync.Mutex
+	sources     map[string]*sourceState
+	windowStart time.Time
+}
+
+func New(ports []int, logger *logrus.Entry) *Detector {
+	return &Detector{
+		ports:       ports,
+		logger:      logger.WithField("component", "honeypot"),
+		sources:     make(map[string]*sourceState),
+		windowStart: time.Now(),
+	}
+}
+
+// Start binds the decoy ports. Ports that are in use are skipped; it only
+// fails if none could be bound.
+func (d *Detector) Start(ctx context.Context) error {
+	bound := 0
+	for _, port := range d.ports {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			d.logger.WithError(err).WithField("port", port).Warn("Failed to bind decoy port")
+			continue
+		}
+		bound++
+
+		go func() {
+			<-ctx.Done()
+			l.Close()
+		}()
+		go d.accept(l, port)
+	}
+
+	if bound == 0 {
+		return fmt.Errorf("no decoy ports could be bound")
+	}
+	d.logger.WithField("ports", bound).Info("Listening on decoy ports")
+	return nil
+}
+
+func (d *Detector) accept(l net.Listener, port int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		conn.Close()
+		d.record(host, port)
+	}
+}
+
+func (d *Detector) record(source string, port int) {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.sources[source]
+	if !ok {
+		st = &sourceState{ports: make(map[int]bool), firstSeen: now}
+		d.sources[source] = st
+	}
+	st.ports[port] = true
+	st.count++
+	st.lastSeen = now
+}
+
+// Drain returns the sources seen since the last call and starts a new window.
+func (d *Detector) Drain() []SourceSummary {
+	d.mu.Lock()
+	sources := d.sources
+	windowStart := d.windowStart
+	d.sources = make(map[string]*sourceState)
+	d.windowStart = time.Now()
+	d.mu.Unlock()
+
+	minutes := time.Since(windowStart).Minutes()
+	out := make([]SourceSummary, 0, len(sources))
+	for source, st := range sources {
+		summary := SourceSummary{
+			Source:    source,
+			Count:     st.count,
+			FirstSeen: st.firstSeen,
+			LastSeen:  st.lastSeen,
+		}
+		for port := range st.ports {
+			summary.Ports = append(summary.Ports, port)
+		}
+		sort.Ints(summary.Ports)
+		if minutes > 0 {
+			summary.RatePerMinute = float64(st.count) / minutes
+		}
+		out = append(out, summary)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	return out
+}
@@ -0,0 +1,108 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PreRestart      = "pre_restart"
+	PostRestart     = "post_restart"
+	PostConfigApply = "post_config_apply"
+
+	maxOutputLen = 4096
+)
+
+// Result is the outcome of one hook script.
+type Result struct {
+	Name     string  `json:"name"`
+	Event    string  `json:"event"`
+	OK       bool    `json:"ok"`
+	ExitCode int     `json:"exit_code"`
+	Output   string  `json:"output,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// Runner runs the operator's hook scripts for an event, one after another
+// in config order. A failing hook is reported but never stops the
+// operation it belongs to; a broken monitoring script shouldn't keep Wings
+// from restarting.
+type Runner struct {
+	hooks  []config.HookConfig
+	logger *logrus.Entry
+}
+
+func New(hooks []config.HookConfig, logger *logrus.Entry) *Runner {
+	return &Runner{
+		hooks:  hooks,
+		logger: logger.WithField("component", "hooks"),
+	}
+}
+
+// Run executes the hooks for event. env is added to the agent's own
+// environment as EDGE_AGENT_<KEY>, along with EDGE_AGENT_HOOK_EVENT.
+func (r *Runner) Run(ctx context.Context, event string, env map[string]string) []Result {
+	var results []Result
+	for _, hook := range r.hooks {
+		if hook.Event != event {
+			continue
+		}
+		result := r.run(ctx, hook, env)
+		logger := r.logger.WithFields(logrus.Fields{"hook": hook.Name, "event": event})
+		if result.OK {
+			logger.Debug("Hook finished")
+		} else {
+			logger.WithField("exit_code", result.ExitCode).Warn("Hook failed: " + result.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (r *Runner) run(ctx context.Context, hook config.HookConfig, env map[string]string) Result {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Path, hook.Args...)
+	cmd.Env = append(os.Environ(), "EDGE_AGENT_HOOK_EVENT="+hook.Event)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, "EDGE_AGENT_"+strings.ToUpper(k)+"="+v)
+	}
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+
+	result := Result{
+		Name:     hook.Name,
+		Event:    hook.Event,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Output:   strings.TrimSpace(string(out)),
+	}
+	if len(result.Output) > maxOutputLen {
+		result.Output = result.Output[len(result.Output)-maxOutputLen:]
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.OK = true
+	case ctx.Err() == context.DeadlineExceeded:
+		result.ExitCode = -1
+		result.Error = "timed out"
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = exitErr.Error()
+	default:
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+// Package incident keeps a short rolling record of what the node was doing,
+// so a critical alert can carry the minutes leading up to it instead of
+// someone piecing them together from the node afterwards.
+package incident
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/pterodactyl-cp/edge-agent/internal/wings"
+)
+
+// timelineMetrics are the heartbeat metrics worth keeping per sample; the
+// rest (interfaces, containers, host details) would bloat the alert.
+var timelineMetrics = []string{
+	"cpuUsage", "cpuSteal", "memoryUsage", "diskUsage",
+	"networkRxRate", "networkTxRate", "loadAverage", "pressure", "containerCount",
+}
+
+type MetricSample struct {
+	Time   time.Time              `json:"time"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// ServerChange is a game server moving between Wings states.
+type ServerChange struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	From   string    `json:"from,omitempty"` // empty when the server first appeared
+	To     string    `json:"to"`             // empty when the server disappeared
+}
+
+// Timeline is what happened on the node around an alert.
+type Timeline struct {
+	At      time.Time            `json:"at"`
+	From    time.Time            `json:"from"`
+	Metrics []MetricSample       `json:"metrics"`
+	Servers []ServerChange       `json:"server_changes"`
+	Tasks   []tasks.HistoryEntry `json:"tasks"`
+	Journal map[string]string    `json:"journal,omitempty"` // recent lines per service
+	Errors  map[string]string    `json:"errors,omitempty"`  // parts that couldn't be gathered
+}
+
+// Recorder holds the last window of metrics and server state changes in
+// memory. They're only needed while the agent is running to raise alerts.
+type Recorder struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	metrics []MetricSample
+	changes []ServerChange
+	states  map[string]string
+}
+
+func NewRecorder(window time.Duration) *Recorder {
+	return &Recorder{window: window}
+}
+
+// RecordMetrics keeps the timeline subset of a heartbeat's metrics.
+func (r *Recorder) RecordMetrics(at time.Time, metrics map[string]interface{}) {
+	values := make(map[string]interface{}, len(timelineMetrics))
+	for _, key := range timelineMetrics {
+		if v, ok := metrics[key]; ok {
+			values[key] = v
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, MetricSample{Time: at, Values: values})
+	r.expire(at)
+}
+
+// RecordServers compares the servers Wings lists with the previous call
+// and records what changed. The first call only sets the baseline.
+func (r *Recorder) RecordServers(at time.Time, servers []wings.ServerState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := make(map[string]string, len(servers))
+	for _, s := range servers {
+		current[s.UUID] = s.State
+	}
+	if r.states != nil {
+		for uuid, state := range current {
+			if prev, ok := r.states[uuid]; !ok || prev != state {
+				r.changes = append(r.changes, ServerChange{Time: at, Server: uuid, From: prev, To: state})
+			}
+		}
+		for uuid, prev := range r.states {
+			if _, ok := current[uuid]; !ok {
+				r.changes = append(r.changes, ServerChange{Time: at, Server: uuid, From: prev})
+			}
+		}
+	}
+	r.states = current
+	r.expire(at)
+}
+
+func (r *Recorder) expire(now time.Time) {
+	cutoff := now.Add(-r.window)
+	i := 0
+	for i < len(r.metrics) && r.metrics[i].Time.Before(cutoff) {
+		i++
+	}
+	r.metrics = append([]MetricSample(nil), r.metrics[i:]...)
+
+	i = 0
+	for i < len(r.changes) && r.changes[i].Time.Before(cutoff) {
+		i++
+	}
+	r.changes = append([]ServerChange(nil), r.changes[i:]...)
+}
+
+// Timeline starts a timeline for an alert at the given time with what the
+// recorder holds. Tasks and journal lines are added by the caller.
+func (r *Recorder) Timeline(at time.Time) *Timeline {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(at)
+
+	return &Timeline{
+		At:      at,
+		From:    at.Add(-r.window),
+		Metrics: append([]MetricSample(nil), r.metrics...),
+		Servers: append([]ServerChange(nil), r.changes...),
+		Journal: make(map[string]string),
+		Errors:  make(map[string]string),
+	}
+}
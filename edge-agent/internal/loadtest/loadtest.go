@@ -0,0 +1,394 @@
+// Package loadtest simulates a fleet of agents against a control plane, to
+// find out how many nodes panel ingestion keeps up with before a large
+// fleet is onboarded for real.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/agent"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures a run.
+type Options struct {
+	ControlPlane string        // base URL, as in control_plane.url
+	EnrollToken  string        // enroll each simulated agent with this token
+	AuthToken    string        // or share one already enrolled node's token
+	Agents       int           // simulated agents
+	Interval     time.Duration // between heartbeats per agent
+	Ramp         time.Duration // spread agent start-up over this long
+	Duration     time.Duration // how long to run once all agents are up
+	Timeout      time.Duration // per request
+	Insecure     bool          // skip TLS verification, for test panels
+
+	// Failure injection.
+	MalformedRate float64       // fraction of heartbeats sent with a truncated body
+	OutageRate    float64       // chance per heartbeat that an agent goes offline
+	OutageLength  time.Duration // how long it stays offline before replaying what it missed
+}
+
+// Stats summarizes the requests of one kind.
+type Stats struct {
+	Requests int64            `json:"requests"`
+	Failures int64            `json:"failures"`
+	Statuses map[string]int64 `json:"statuses"` // HTTP status, or "error" for transport failures
+	P50Ms    float64          `json:"p50_ms"`
+	P90Ms    float64          `json:"p90_ms"`
+	P99Ms    float64          `json:"p99_ms"`
+	MaxMs    float64          `json:"max_ms"`
+	PerSec   float64          `json:"per_second"`
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Agents   int              `json:"agents"`
+	Enrolled int              `json:"enrolled"`
+	Elapsed  string           `json:"elapsed"`
+	Outages  int64            `json:"outages"`
+	Requests map[string]Stats `json:"requests"` // enroll, heartbeat, replay
+}
+
+// Latency samples kept per request kind; percentiles come from a uniform
+// sample once a run goes past it.
+const sampleSize = 20000
+
+type recorder struct {
+	mu       sync.Mutex
+	start    time.Time
+	kinds    map[string]*kindRecord
+	outages  int64
+	enrolled int
+}
+
+type kindRecord struct {
+	requests int64
+	failures int64
+	statuses map[string]int64
+	samples  []time.Duration
+	max      time.Duration
+}
+
+func (r *recorder) record(kind string, elapsed time.Duration, status string, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.kinds[kind]
+	if !ok {
+		k = &kindRecord{statuses: make(map[string]int64)}
+		r.kinds[kind] = k
+	}
+	k.requests++
+	if failed {
+		k.failures++
+	}
+	k.statuses[status]++
+	if elapsed > k.max {
+		k.max = elapsed
+	}
+	if len(k.samples) < sampleSize {
+		k.samples = append(k.samples, elapsed)
+	} else if i := rand.Int63n(k.requests); i < sampleSize {
+		k.samples[i] = elapsed
+	}
+}
+
+func (r *recorder) report(agents int) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.start)
+	report := Report{
+		Agents:   agents,
+		Enrolled: r.enrolled,
+		Elapsed:  elapsed.Round(time.Second).String(),
+		Outages:  r.outages,
+		Requests: make(map[string]Stats),
+	}
+	for kind, k := range r.kinds {
+		sorted := append([]time.Duration(nil), k.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		statuses := make(map[string]int64, len(k.statuses))
+		for status, n := range k.statuses {
+			statuses[status] = n
+		}
+		report.Requests[kind] = Stats{
+			Requests: k.requests,
+			Failures: k.failures,
+			Statuses: statuses,
+			P50Ms:    percentile(sorted, 0.50),
+			P90Ms:    percentile(sorted, 0.90),
+			P99Ms:    percentile(sorted, 0.99),
+			MaxMs:    float64(k.max) / float64(time.Millisecond),
+			PerSec:   float64(k.requests) / elapsed.Seconds(),
+		}
+	}
+	return report
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
+
+// Run simulates opts.Agents agents until ctx is cancelled or the ramp and
+// duration have passed, logging progress every interval.
+func Run(ctx context.Context, opts Options, logger *logrus.Entry) (Report, error) {
+	if opts.ControlPlane == "" {
+		return Report{}, fmt.Errorf("a control plane URL is required")
+	}
+	if opts.EnrollToken == "" && opts.AuthToken == "" {
+		return Report{}, fmt.Errorf("an enrollment token or an auth token is required")
+	}
+	if opts.Agents <= 0 || opts.Interval <= 0 {
+		return Report{}, fmt.Errorf("agents and interval must be positive")
+	}
+	logger = logger.WithField("component", "loadtest")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.Agents
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Transport: transport, Timeout: opts.Timeout}
+
+	rec := &recorder{start: time.Now(), kinds: make(map[string]*kindRecord)}
+	ctx, cancel := context.WithTimeout(ctx, opts.Ramp+opts.Duration)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			hb := rec.report(opts.Agents).Requests["heartbeat"]
+			logger.WithFields(logrus.Fields{
+				"heartbeats": hb.Requests,
+				"failures":   hb.Failures,
+				"per_second": fmt.Sprintf("%.1f", hb.PerSec),
+				"p99_ms":     fmt.Sprintf("%.0f", hb.P99Ms),
+			}).Info("Load test progress")
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Agents; i++ {
+		delay := time.Duration(0)
+		if opts.Agents > 1 {
+			delay = opts.Ramp * time.Duration(i) / time.Duration(opts.Agents)
+		}
+		sim := &simulated{
+			id:     i,
+			opts:   opts,
+			client: client,
+			rec:    rec,
+			rand:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(i))),
+			token:  opts.AuthToken,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			sim.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return rec.report(opts.Agents), nil
+}
+
+// simulated is one fake agent.
+type simulated struct {
+	id     int
+	opts   Options
+	client *http.Client
+	rec    *recorder
+	rand   *rand.Rand
+
+	token   string
+	session agent.SessionInfo
+}
+
+func (s *simulated) hostname() string {
+	return fmt.Sprintf("loadtest-%05d", s.id)
+}
+
+func (s *simulated) run(ctx context.Context) {
+	s.session = agent.SessionInfo{
+		SessionID: fmt.Sprintf("loadtest-%05d-%d", s.id, time.Now().UnixNano()),
+		StartedAt: time.Now().UTC(),
+	}
+
+	if s.opts.EnrollToken != "" {
+		if !s.enroll(ctx) {
+			return
+		}
+	}
+
+	// Start at a random point in the interval so heartbeats don't arrive
+	// in lockstep, as they wouldn't from a real fleet.
+	next := time.Now().Add(time.Duration(s.rand.Int63n(int64(s.opts.Interval))))
+	var missed []time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		next = next.Add(s.opts.Interval)
+
+		if s.opts.OutageRate > 0 && s.rand.Float64() < s.opts.OutageRate {
+			s.rec.mu.Lock()
+			s.rec.outages++
+			s.rec.mu.Unlock()
+			// Heartbeats due while offline are buffered and replayed in a
+			// burst on reconnect, like the real agent's heartbeat buffer.
+			back := time.Now().Add(s.opts.OutageLength)
+			for t := next; t.Before(back); t = t.Add(s.opts.Interval) {
+				missed = append(missed, t)
+			}
+			for !next.After(back) {
+				next = next.Add(s.opts.Interval)
+			}
+			continue
+		}
+
+		for len(missed) > 0 {
+			if !s.heartbeat(ctx, "replay", missed[0]) {
+				break
+			}
+			missed = missed[1:]
+		}
+		s.heartbeat(ctx, "heartbeat", time.Now())
+	}
+}
+
+func (s *simulated) enroll(ctx context.Context) bool {
+	req := agent.EnrollmentRequest{
+		Token: s.opts.EnrollToken,
+		NodeInfo: map[string]interface{}{
+			"hostname": s.hostname(),
+			"loadtest": true,
+			"version":  agent.Version,
+		},
+	}
+	var resp agent.EnrollmentResponse
+	if !s.post(ctx, "enroll", "/agent/enroll", req, &resp, false) {
+		return false
+	}
+	s.token = resp.AuthToken
+	s.rec.mu.Lock()
+	s.rec.enrolled++
+	s.rec.mu.Unlock()
+	return true
+}
+
+func (s *simulated) heartbeat(ctx context.Context, kind string, at time.Time) bool {
+	hb := agent.HeartbeatRequest{
+		Timestamp:    at.UTC(),
+		Session:      &s.session,
+		AgentVersion: agent.Version,
+		System:       s.systemMetrics(),
+		Schedulable:  true,
+	}
+	malformed := s.opts.MalformedRate > 0 && s.rand.Float64() < s.opts.MalformedRate
+	return s.post(ctx, kind, "/agent/heartbeat", hb, nil, malformed)
+}
+
+// systemMetrics makes up plausible numbers under the keys the metrics
+// collector uses, so the panel stores and graphs them like real ones.
+func (s *simulated) systemMetrics() map[string]interface{} {
+	const gib = 1 << 30
+	memTotal := uint64(64 * gib)
+	memUsed := uint64(float64(memTotal) * (0.3 + 0.5*s.rand.Float64()))
+	diskTotal := uint64(2000 * gib)
+	diskUsed := uint64(float64(diskTotal) * (0.2 + 0.6*s.rand.Float64()))
+	return map[string]interface{}{
+		"hostname":        s.hostname(),
+		"platform":        "loadtest",
+		"cpuUsage":        100 * s.rand.Float64(),
+		"memoryTotal":     memTotal,
+		"memoryUsed":      memUsed,
+		"memoryAvailable": memTotal - memUsed,
+		"memoryUsage":     100 * float64(memUsed) / float64(memTotal),
+		"diskTotal":       diskTotal,
+		"diskUsed":        diskUsed,
+		"diskFree":        diskTotal - diskUsed,
+		"diskUsage":       100 * float64(diskUsed) / float64(diskTotal),
+		"networkRxRate":   s.rand.Float64() * 100e6,
+		"networkTxRate":   s.rand.Float64() * 100e6,
+		"uptime":          uint64(time.Since(s.session.StartedAt).Seconds()),
+		"containerCount":  s.rand.Intn(40),
+	}
+}
+
+// post sends one request and records it. A malformed request has its body
+// cut in half; those are expected to be rejected, so a 4xx isn't counted
+// as a failure for them but a 2xx or 5xx is.
+func (s *simulated) post(ctx context.Context, kind, endpoint string, body, out interface{}, malformed bool) bool {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false
+	}
+	if malformed {
+		data = data[:len(data)/2]
+		kind += "_malformed"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.opts.ControlPlane, "/")+"/api"+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent-Session", s.session.SessionID)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.rec.record(kind, time.Since(start), "error", true)
+		}
+		return false
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	} else {
+		_, err = io.Copy(io.Discard, resp.Body)
+	}
+	elapsed := time.Since(start)
+
+	ok := resp.StatusCode < 400 && err == nil
+	failed := !ok
+	if malformed {
+		failed = resp.StatusCode < 400 || resp.StatusCode >= 500
+	}
+	s.rec.record(kind, elapsed, fmt.Sprint(resp.StatusCode), failed)
+	return ok
+}
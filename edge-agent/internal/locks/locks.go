@@ -0,0 +1,136 @@
+package locks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resources shared between the agent's mutating operations. An operation
+// takes every resource it changes, including ones a restart touches as a
+// side effect.
+const (
+	WingsConfig  = "wings_config"
+	WingsService = "wings_service"
+	WingsBinary  = "wings_binary"
+	Docker       = "docker"
+	Certificates = "certificates"
+	Firewall     = "firewall"
+)
+
+// Holder is a held lock as shown by the local API.
+type Holder struct {
+	Resource string    `json:"resource"`
+	Owner    string    `json:"owner"`
+	Since    time.Time `json:"since"`
+	Waiting  int       `json:"waiting"` // operations queued behind the holder
+}
+
+type lock struct {
+	Holder
+	done chan struct{}
+}
+
+// Manager hands out advisory locks. They only serialize agent code that
+// asks for them, nothing stops an operator editing files meanwhile.
+type Manager struct {
+	timeout time.Duration
+
+	mu   sync.Mutex
+	held map[string]*lock
+}
+
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout, held: make(map[string]*lock)}
+}
+
+// Acquire takes the resources in sorted order, so two operations can't each
+// hold what the other is waiting for. Waiting longer than the timeout is
+// treated as a deadlock: everything already taken is released and an error
+// names the holder. The returned release func may be called more than once.
+func (m *Manager) Acquire(ctx context.Context, owner string, resources ...string) (func(), error) {
+	sorted := append([]string(nil), resources...)
+	sort.Strings(sorted)
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	var taken []*lock
+	releaseAll := func() {
+		for _, l := range taken {
+			m.release(l)
+		}
+	}
+
+	for _, resource := range sorted {
+		l, err := m.take(ctx, timer.C, owner, resource)
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		taken = append(taken, l)
+	}
+
+	var once sync.Once
+	return func() { once.Do(releaseAll) }, nil
+}
+
+func (m *Manager) take(ctx context.Context, expired <-chan time.Time, owner, resource string) (*lock, error) {
+	for {
+		m.mu.Lock()
+		current, busy := m.held[resource]
+		if !busy {
+			l := &lock{
+				Holder: Holder{Resource: resource, Owner: owner, Since: time.Now()},
+				done:   make(chan struct{}),
+			}
+			m.held[resource] = l
+			m.mu.Unlock()
+			return l, nil
+		}
+		current.Waiting++
+		holder := current.Owner
+		m.mu.Unlock()
+
+		select {
+		case <-current.done:
+			continue
+		case <-expired:
+			m.unwait(current)
+			return nil, fmt.Errorf("timed out after %s waiting for %s, held by %s", m.timeout, resource, holder)
+		case <-ctx.Done():
+			m.unwait(current)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *Manager) unwait(l *lock) {
+	m.mu.Lock()
+	l.Waiting--
+	m.mu.Unlock()
+}
+
+func (m *Manager) release(l *lock) {
+	m.mu.Lock()
+	if m.held[l.Resource] == l {
+		delete(m.held, l.Resource)
+	}
+	m.mu.Unlock()
+	close(l.done)
+}
+
+// Held lists the locks currently held, by resource.
+func (m *Manager) Held() []Holder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	holders := make([]Holder, 0, len(m.held))
+	for _, l := range m.held {
+		holders = append(holders, l.Holder)
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Resource < holders[j].Resource })
+	return holders
+}
@@ -0,0 +1,222 @@
+// Package logging sets up the agent's own log output on logrus' standard
+// logger: text or JSON, to stderr or a rotated file, with per-component
+// levels and a cap on how often the same message is repeated.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	mu         sync.Mutex
+	base       = logrus.InfoLevel
+	components map[string]logrus.Level
+	file       *rotatingFile // nil when logging to stderr
+	filter     = &filterFormatter{inner: textFormatter(), base: logrus.InfoLevel}
+)
+
+func textFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{FullTimestamp: true}
+}
+
+// Init sets the level and the default text output, before any config has
+// been loaded.
+func Init(level logrus.Level) {
+	logrus.SetFormatter(filter)
+	SetLevel(level)
+}
+
+// Configure applies the logging section of the config. It can be called
+// again on reload; the previous log file is closed once the new output is
+// in place.
+func Configure(cfg config.LoggingConfig) error {
+	levels := make(map[string]logrus.Level, len(cfg.Components))
+	for component, name := range cfg.Components {
+		level, err := logrus.ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("invalid level for component %s: %w", component, err)
+		}
+		levels[component] = level
+	}
+
+	var formatter logrus.Formatter = textFormatter()
+	if cfg.Format == "json" {
+		formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	}
+
+	var out io.Writer = os.Stderr
+	var opened *rotatingFile
+	if cfg.File != "" {
+		f, err := openRotatingFile(cfg.File, int64(cfg.MaxSize)<<20, time.Duration(cfg.MaxAge)*24*time.Hour, cfg.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		opened = f
+		out = f
+	}
+
+	mu.Lock()
+	components = levels
+	previous := file
+	file = opened
+	mu.Unlock()
+
+	filter.set(formatter, levels, newRateLimiter(cfg.RateLimit, time.Minute))
+	logrus.SetFormatter(filter)
+	logrus.SetOutput(out)
+	applyLevel()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// SetLevel changes the level for components without their own.
+func SetLevel(level logrus.Level) {
+	mu.Lock()
+	base = level
+	mu.Unlock()
+	applyLevel()
+}
+
+// Level is the level for components without their own.
+func Level() logrus.Level {
+	mu.Lock()
+	defer mu.Unlock()
+	return base
+}
+
+// applyLevel lets through the most verbose of the configured levels; the
+// formatter drops what a component's own level doesn't want.
+func applyLevel() {
+	mu.Lock()
+	defer mu.Unlock()
+	level := base
+	for _, l := range components {
+		if l > level {
+			level = l
+		}
+	}
+	filter.setBase(base)
+	logrus.SetLevel(level)
+}
+
+// filterFormatter applies component levels and rate limiting before
+// handing entries to the real formatter. An entry it drops is formatted as
+// nothing, which logrus writes as nothing.
+type filterFormatter struct {
+	mu      sync.RWMutex
+	inner   logrus.Formatter
+	base    logrus.Level
+	levels  map[string]logrus.Level
+	limiter *rateLimiter
+}
+
+func (f *filterFormatter) set(inner logrus.Formatter, levels map[string]logrus.Level, limiter *rateLimiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inner, f.levels, f.limiter = inner, levels, limiter
+}
+
+func (f *filterFormatter) setBase(level logrus.Level) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.base = level
+}
+
+func (f *filterFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	f.mu.RLock()
+	inner, limiter := f.inner, f.limiter
+	threshold := f.base
+	component, _ := entry.Data["component"].(string)
+	if l, ok := f.levels[component]; ok {
+		threshold = l
+	}
+	f.mu.RUnlock()
+
+	if entry.Level > threshold {
+		return nil, nil
+	}
+	if entry.Level > logrus.FatalLevel && limiter != nil {
+		allowed, suppressed := limiter.allow(component + "\x00" + entry.Message)
+		if !allowed {
+			return nil, nil
+		}
+		if suppressed > 0 {
+			dup := *entry
+			dup.Data = make(logrus.Fields, len(entry.Data)+1)
+			for k, v := range entry.Data {
+				dup.Data[k] = v
+			}
+			dup.Data["suppressed"] = suppressed
+			return inner.Format(&dup)
+		}
+	}
+	return inner.Format(entry)
+}
+
+// rateLimiter lets each distinct message through a limited number of times
+// per interval, so a failing loop can't flood the journal or fill the disk.
+// The first message after a quiet period says how many were dropped.
+type rateLimiter struct {
+	limit    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// maxRateKeys bounds the limiter's memory when messages embed changing
+// values.
+const maxRateKeys = 4096
+
+func newRateLimiter(limit int, interval time.Duration) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, interval: interval, windows: make(map[string]*rateWindow)}
+}
+
+func (r *rateLimiter) allow(key string) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	w, ok := r.windows[key]
+	if !ok {
+		if len(r.windows) >= maxRateKeys {
+			for k, old := range r.windows {
+				if now.Sub(old.start) >= r.interval {
+					delete(r.windows, k)
+				}
+			}
+		}
+		w = &rateWindow{start: now}
+		r.windows[key] = w
+	}
+	if now.Sub(w.start) >= r.interval {
+		w.start, w.count = now, 0
+	}
+	if w.count >= r.limit {
+		w.suppressed++
+		return false, 0
+	}
+	w.count++
+	suppressed := w.suppressed
+	w.suppressed = 0
+	return true, suppressed
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "20060102-150405"
+
+// rotatingFile is a log file that's moved aside to <path>.<timestamp> once
+// it reaches maxSize. Rotated files older than maxAge, or beyond the newest
+// maxBackups, are deleted.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		// Keep logging to the current file if rotation fails; a full
+		// disk shouldn't also lose the messages saying so.
+		r.rotate()
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() {
+	rotated := r.path + "." + time.Now().Format(rotatedTimeFormat)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return
+	}
+	previous := r.f
+	if err := r.open(); err != nil {
+		// Carry on writing to the renamed file.
+		return
+	}
+	previous.Close()
+	go r.prune()
+}
+
+// prune deletes rotated files past maxAge or maxBackups.
+func (r *rotatingFile) prune() {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedTimeFormat, strings.TrimPrefix(m, r.path+".")); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	// The timestamp format sorts oldest first.
+	sort.Strings(rotated)
+
+	for i, path := range rotated {
+		expired := false
+		if r.maxBackups > 0 && len(rotated)-i > r.maxBackups {
+			expired = true
+		}
+		if r.maxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(path)
+		}
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,343 @@
+package logship
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SourceFile    = "file"
+	SourceJournal = "journal"
+
+	batchInterval = time.Second
+	// How often a followed file is checked for new data and rotation.
+	pollInterval = 500 * time.Millisecond
+)
+
+// Request asks for a log stream. The control plane renews it by sending the
+// same request again; a stream nobody renews stops after the idle timeout.
+type Request struct {
+	StreamID string `json:"stream_id"`
+	Source   string `json:"source"`           // "file" or "journal"
+	Backlog  int    `json:"backlog"`          // lines of history to send first
+	Unit     string `json:"unit,omitempty"`   // journal unit, defaults to the Wings unit
+	Follow   *bool  `json:"follow,omitempty"` // defaults to true
+
+	// Path is filled in by the agent, the control plane doesn't get to
+	// pick arbitrary files.
+	Path string `json:"-"`
+}
+
+// Batch is one shipment of lines. Dropped counts lines discarded since the
+// previous batch because the control plane couldn't keep up.
+type Batch struct {
+	StreamID string   `json:"stream_id"`
+	Lines    []string `json:"lines"`
+	Dropped  int      `json:"dropped,omitempty"`
+	Done     bool     `json:"done,omitempty"`
+}
+
+// Sender delivers a batch, normally over the command channel.
+type Sender func(Batch) error
+
+type stream struct {
+	req    Request
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	lines   []string
+	dropped int
+	renewed time.Time
+	eof     bool
+}
+
+// Shipper runs log streams requested by the control plane. Each stream
+// buffers at most BufferLines; when sending falls behind the oldest lines
+// are dropped and counted instead of growing without bound, and no stream
+// sends more than MaxLinesPerSecond.
+type Shipper struct {
+	cfg    config.LogsConfig
+	send   Sender
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+func New(cfg config.LogsConfig, send Sender, logger *logrus.Entry) *Shipper {
+	return &Shipper{
+		cfg:     cfg,
+		send:    send,
+		logger:  logger.WithField("component", "log_shipper"),
+		streams: make(map[string]*stream),
+	}
+}
+
+// Start begins a stream, or renews it if it's already running.
+func (s *Shipper) Start(ctx context.Context, req Request) error {
+	if req.StreamID == "" {
+		return fmt.Errorf("stream_id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.streams[req.StreamID]; ok {
+		st.mu.Lock()
+		st.renewed = time.Now()
+		st.mu.Unlock()
+		return nil
+	}
+	if len(s.streams) >= s.cfg.MaxStreams {
+		return fmt.Errorf("too many log streams (max %d)", s.cfg.MaxStreams)
+	}
+
+	var reader func(context.Context, *stream) error
+	switch req.Source {
+	case SourceFile:
+		reader = s.tailFile
+	case SourceJournal:
+		reader = s.tailJournal
+	default:
+		return fmt.Errorf("unknown log source %q", req.Source)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	st := &stream{req: req, cancel: cancel, renewed: time.Now()}
+	s.streams[req.StreamID] = st
+
+	logger := s.logger.WithFields(logrus.Fields{"stream_id": req.StreamID, "source": req.Source})
+	logger.Info("Log stream started")
+
+	go func() {
+		err := reader(ctx, st)
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).Warn("Log stream reader failed")
+		}
+		st.mu.Lock()
+		st.eof = true
+		st.mu.Unlock()
+	}()
+	go s.ship(ctx, st, logger)
+	return nil
+}
+
+// Stop ends a stream. Stopping an unknown stream is not an error.
+func (s *Shipper) Stop(streamID string) {
+	s.mu.Lock()
+	st, ok := s.streams[streamID]
+	delete(s.streams, streamID)
+	s.mu.Unlock()
+
+	if ok {
+		st.cancel()
+	}
+}
+
+// Active lists the running stream IDs.
+func (s *Shipper) Active() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.streams))
+	for id := range s.streams {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (st *stream) push(line string, limit int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.lines) >= limit {
+		st.lines = st.lines[1:]
+		st.dropped++
+	}
+	st.lines = append(st.lines, line)
+}
+
+// ship sends buffered lines once a second until the stream is stopped,
+// expires, or a finite reader has been fully sent.
+func (s *Shipper) ship(ctx context.Context, st *stream, logger *logrus.Entry) {
+	defer s.Stop(st.req.StreamID)
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	idle := time.Duration(s.cfg.IdleTimeout) * time.Second
+	perBatch := int(float64(s.cfg.MaxLinesPerSecond) * batchInterval.Seconds())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		st.mu.Lock()
+		if time.Since(st.renewed) > idle {
+			st.mu.Unlock()
+			logger.Info("Log stream expired")
+			s.send(Batch{StreamID: st.req.StreamID, Done: true})
+			return
+		}
+		n := len(st.lines)
+		if n > perBatch {
+			n = perBatch
+		}
+		batch := Batch{StreamID: st.req.StreamID, Lines: append([]string(nil), st.lines[:n]...), Dropped: st.dropped}
+		done := st.eof && n == len(st.lines)
+		st.mu.Unlock()
+
+		if len(batch.Lines) == 0 && batch.Dropped == 0 && !done {
+			continue
+		}
+		batch.Done = done
+
+		// On failure the lines stay buffered; the buffer limit turns a
+		// stalled connection into dropped lines rather than memory growth.
+		if err := s.send(batch); err != nil {
+			logger.WithError(err).Debug("Failed to send log batch")
+			continue
+		}
+
+		st.mu.Lock()
+		st.lines = st.lines[len(batch.Lines):]
+		st.dropped -= batch.Dropped
+		st.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
+func (s *Shipper) tailFile(ctx context.Context, st *stream) error {
+	f, err := os.Open(st.req.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	if err := seekBacklog(f, st.req.Backlog); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(f)
+
+	follow := st.req.Follow == nil || *st.req.Follow
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			st.push(partial+line[:len(line)-1], s.cfg.BufferLines)
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		partial += line
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Reopen if the file was rotated away or truncated.
+		pos, _ := f.Seek(0, io.SeekCurrent)
+		cur, statErr := f.Stat()
+		latest, pathErr := os.Stat(st.req.Path)
+		if pathErr == nil && statErr == nil && (!os.SameFile(cur, latest) || latest.Size() < pos) {
+			next, err := os.Open(st.req.Path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f = next
+			reader.Reset(f)
+			partial = ""
+		}
+	}
+}
+
+// seekBacklog positions f so reading from it yields roughly the last n lines.
+func seekBacklog(f *os.File, n int) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		_, err := f.Seek(0, io.SeekEnd)
+		return err
+	}
+
+	const chunk = 64 * 1024
+	size := info.Size()
+	offset := size
+	newlines := 0
+	buf := make([]byte, chunk)
+	for offset > 0 {
+		read := int64(chunk)
+		if offset < read {
+			read = offset
+		}
+		offset -= read
+		if _, err := f.ReadAt(buf[:read], offset); err != nil && err != io.EOF {
+			return err
+		}
+		for i := read - 1; i >= 0; i-- {
+			if buf[i] != '\n' || offset+i == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				_, err := f.Seek(offset+i+1, io.SeekStart)
+				return err
+			}
+		}
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *Shipper) tailJournal(ctx context.Context, st *stream) error {
+	args := []string{"-u", st.req.Unit, "-n", strconv.Itoa(st.req.Backlog), "--no-pager", "-o", "short-iso"}
+	if st.req.Follow == nil || *st.req.Follow {
+		args = append(args, "-f")
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		st.push(scanner.Text(), s.cfg.BufferLines)
+	}
+	cmd.Wait()
+	return scanner.Err()
+}
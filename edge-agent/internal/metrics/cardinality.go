@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"sort"
+)
+
+// otherContainersName is the bucket that absorbs containers past the cap.
+const otherContainersName = "_other"
+
+// limitContainers keeps the busiest max containers and folds the rest into a
+// single aggregate entry so heartbeat size stays bounded on dense nodes.
+func limitContainers(stats []ContainerStats, max int) []ContainerStats {
+	if max <= 0 || len(stats) <= max {
+		return stats
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CPUUsage != stats[j].CPUUsage {
+			return stats[i].CPUUsage > stats[j].CPUUsage
+		}
+		return stats[i].MemoryUsed > stats[j].MemoryUsed
+	})
+
+	// Reserve one slot for the aggregate.
+	keep := max - 1
+	other := ContainerStats{Name: otherContainersName}
+	for _, s := range stats[keep:] {
+		other.CPUUsage += s.CPUUsage
+		other.MemoryUsed += s.MemoryUsed
+		other.MemoryLimit += s.MemoryLimit
+		other.DiskRead += s.DiskRead
+		other.DiskWrite += s.DiskWrite
+		other.NetworkRx += s.NetworkRx
+		other.NetworkTx += s.NetworkTx
+		other.Aggregated++
+	}
+
+	return append(stats[:keep:keep], other)
+}
+
+// filterLabels returns only the allowlisted labels, or nil when none match.
+func filterLabels(labels map[string]string, allow map[string]bool) map[string]string {
+	if len(allow) == 0 || len(labels) == 0 {
+		return nil
+	}
+
+	var out map[string]string
+	for k, v := range labels {
+		if !allow[k] {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[k] = v
+	}
+	return out
+}
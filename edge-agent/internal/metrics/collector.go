@@ -1,37 +1,104 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/disk"
-	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/mem"
-	"github.com/shirou/gopsutil/v3/net"
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
 )
 
+var errNoData = errors.New("no data")
+
+// sampleInterval is how often the background sampler reads the CPU and
+// network counters. Collect reports usage and rates over the latest such
+// window, however many callers it has.
+const sampleInterval = 5 * time.Second
+
 type Collector struct {
-	lastNetStats map[string]net.IOCountersStat
-	lastTime     time.Time
+	source Source
+	clock  Clock
+	cfg    config.MetricsConfig
+
+	cpu      cpuSampler
+	net      netSampler
+	sampling atomic.Bool
+}
+
+// InterfaceStats is one interface's counters with the rates since the
+// previous collection, which are left out on the first reading.
+type InterfaceStats struct {
+	RxBytes uint64  `json:"rxBytes"`
+	TxBytes uint64  `json:"txBytes"`
+	RxRate  float64 `json:"rxRate,omitempty"`
+	TxRate  float64 `json:"txRate,omitempty"`
+}
+
+func New(cfg config.MetricsConfig) (*Collector, error) {
+	clock := realClock{}
+	return NewWithSource(cfg, defaultSource(cfg, clock), clock), nil
 }
 
-func New() (*Collector, error) {
+// NewWithSource builds a collector over an explicit source and clock.
+func NewWithSource(cfg config.MetricsConfig, source Source, clock Clock) *Collector {
 	return &Collector{
-		lastNetStats: make(map[string]net.IOCountersStat),
-		lastTime:     time.Now(),
-	}, nil
+		source: source,
+		clock:  clock,
+		cfg:    cfg,
+	}
+}
+
+// Start samples the CPU and network counters in the background until ctx
+// is done, so Collect never has to wait for a measurement window and
+// concurrent callers don't reset each other's baseline. Without it, Collect
+// measures since its previous call instead.
+func (c *Collector) Start(ctx context.Context) {
+	c.sampling.Store(true)
+	c.sample()
+	go func() {
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.sample()
+			}
+		}
+	}()
+}
+
+func (c *Collector) sample() {
+	if times, err := c.source.CPUTimes(); err == nil {
+		c.cpu.add(times)
+	}
+	if counters, err := c.source.Network(); err == nil {
+		c.net.addTotal(counters, c.clock.Now())
+	}
+	if counters, err := c.source.Interfaces(); err == nil {
+		c.net.addInterfaces(counters, c.clock.Now())
+	}
 }
 
 func (c *Collector) Collect() (map[string]interface{}, error) {
 	metrics := make(map[string]interface{})
 
-	// CPU Usage
-	if cpuPercent, err := cpu.Percent(time.Second, false); err == nil && len(cpuPercent) > 0 {
-		metrics["cpuUsage"] = cpuPercent[0]
+	// CPU usage and steal, as shares of all CPU time over the latest sample
+	// window. Left out until there has been one.
+	if !c.sampling.Load() {
+		c.sample()
+	}
+	if usage, steal, ok := c.cpu.get(); ok {
+		metrics["cpuUsage"] = usage
+		metrics["cpuSteal"] = steal
 	}
 
 	// Memory Usage
-	if memStat, err := mem.VirtualMemory(); err == nil {
+	if memStat, err := c.source.Memory(); err == nil {
 		metrics["memoryUsage"] = memStat.UsedPercent
 		metrics["memoryTotal"] = memStat.Total
 		metrics["memoryUsed"] = memStat.Used
@@ -39,41 +106,31 @@ func (c *Collector) Collect() (map[string]interface{}, error) {
 	}
 
 	// Disk Usage (root partition)
-	if diskStat, err := disk.Usage("/"); err == nil {
+	if diskStat, err := c.source.Disk("/"); err == nil {
 		metrics["diskUsage"] = diskStat.UsedPercent
 		metrics["diskTotal"] = diskStat.Total
 		metrics["diskUsed"] = diskStat.Used
 		metrics["diskFree"] = diskStat.Free
 	}
 
-	// Network I/O
-	if netStats, err := net.IOCounters(false); err == nil && len(netStats) > 0 {
-		totalStat := netStats[0] // Get total for all interfaces
-		
-		// Calculate rates if we have previous data
-		now := time.Now()
-		timeDiff := now.Sub(c.lastTime).Seconds()
-		
-		if c.lastTime.IsZero() || timeDiff < 1 {
-			// First run or too little time passed
-			metrics["networkRx"] = totalStat.BytesRecv
-			metrics["networkTx"] = totalStat.BytesSent
-		} else {
-			// Calculate rates
-			rxRate := float64(totalStat.BytesRecv) / timeDiff
-			txRate := float64(totalStat.BytesSent) / timeDiff
-			
-			metrics["networkRx"] = totalStat.BytesRecv
-			metrics["networkTx"] = totalStat.BytesSent
-			metrics["networkRxRate"] = rxRate
-			metrics["networkTxRate"] = txRate
+	// Network I/O, as of the latest sample
+	total, rated, ifaces, ok := c.net.get()
+	if ok {
+		metrics["networkRx"] = total.RxBytes
+		metrics["networkTx"] = total.TxBytes
+		if rated {
+			metrics["networkRxRate"] = total.RxRate
+			metrics["networkTxRate"] = total.TxRate
 		}
-		
-		c.lastTime = now
+	}
+
+	// Per-interface I/O
+	if ifaces != nil {
+		metrics["interfaces"] = ifaces
 	}
 
 	// System uptime
-	if hostStat, err := host.Info(); err == nil {
+	if hostStat, err := c.source.Host(); err == nil {
 		metrics["uptime"] = hostStat.Uptime
 		metrics["hostname"] = hostStat.Hostname
 		metrics["platform"] = hostStat.Platform
@@ -81,19 +138,130 @@ func (c *Collector) Collect() (map[string]interface{}, error) {
 	}
 
 	// Load average (Linux/Unix only)
-	if loadStat, err := host.SensorsTemperatures(); err == nil {
-		// This is a placeholder - actual load average would use different method
-		metrics["loadAverage"] = len(loadStat) // Placeholder
+	if avg, err := c.source.LoadAverage(); err == nil {
+		metrics["loadAverage"] = avg
+	}
+
+	// Pressure stall information (Linux 4.20+)
+	if pressure, err := c.source.Pressure(); err == nil {
+		metrics["pressure"] = pressure
+	}
+
+	// Per-server container usage, skipped when Docker isn't reachable
+	if containers, err := c.source.Containers(); err == nil {
+		metrics["containers"] = limitContainers(containers, c.cfg.MaxContainers)
+		metrics["containerCount"] = len(containers)
 	}
 
 	return metrics, nil
 }
 
+// networkRates turns two counter readings into bytes per second. It reports
+// false on the first reading, when too little time has passed, or when the
+// counters went backwards (interface reset).
+func networkRates(prev, cur NetworkCounters, elapsed time.Duration, first bool) (rx, tx float64, ok bool) {
+	if first || elapsed < time.Second {
+		return 0, 0, false
+	}
+	if cur.BytesRecv < prev.BytesRecv || cur.BytesSent < prev.BytesSent {
+		return 0, 0, false
+	}
+	seconds := elapsed.Seconds()
+	return float64(cur.BytesRecv-prev.BytesRecv) / seconds, float64(cur.BytesSent-prev.BytesSent) / seconds, true
+}
+
+// cpuSampler keeps the usage between its two latest CPU time readings.
+type cpuSampler struct {
+	mu    sync.Mutex
+	prev  CPUTimes
+	usage float64
+	steal float64
+	ok    bool
+}
+
+// add takes a reading. Counters going backwards only move the baseline.
+func (s *cpuSampler) add(cur CPUTimes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := cur.Total - s.prev.Total
+	if s.prev.Total > 0 && total > 0 && cur.Idle >= s.prev.Idle && cur.Steal >= s.prev.Steal {
+		busy := total - (cur.Idle - s.prev.Idle)
+		s.usage = math.Max(0, math.Min(100, 100*busy/total))
+		s.steal = 100 * (cur.Steal - s.prev.Steal) / total
+		s.ok = true
+	}
+	s.prev = cur
+}
+
+func (s *cpuSampler) get() (usage, steal float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage, s.steal, s.ok
+}
+
+// netSampler keeps the network counters from its latest reading, with the
+// rates since the one before.
+type netSampler struct {
+	mu        sync.Mutex
+	haveTotal bool
+	total     InterfaceStats
+	rated     bool
+	prev      NetworkCounters
+	prevAt    time.Time
+
+	ifaces   map[string]InterfaceStats
+	ifPrev   map[string]NetworkCounters
+	ifPrevAt time.Time
+}
+
+func (s *netSampler) addTotal(cur NetworkCounters, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total = InterfaceStats{RxBytes: cur.BytesRecv, TxBytes: cur.BytesSent}
+	s.total.RxRate, s.total.TxRate, s.rated = networkRates(s.prev, cur, now.Sub(s.prevAt), !s.haveTotal)
+	s.prev, s.prevAt, s.haveTotal = cur, now, true
+}
+
+func (s *netSampler) addInterfaces(counters map[string]NetworkCounters, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ifaces := make(map[string]InterfaceStats, len(counters))
+	for name, cur := range counters {
+		stats := InterfaceStats{RxBytes: cur.BytesRecv, TxBytes: cur.BytesSent}
+		prev, seen := s.ifPrev[name]
+		if rx, tx, ok := networkRates(prev, cur, now.Sub(s.ifPrevAt), !seen); ok {
+			stats.RxRate, stats.TxRate = rx, tx
+		}
+		ifaces[name] = stats
+	}
+	s.ifaces, s.ifPrev, s.ifPrevAt = ifaces, counters, now
+}
+
+// get returns the totals, whether they have rates yet, a copy of the
+// per-interface stats, and whether there are totals at all.
+func (s *netSampler) get() (total InterfaceStats, rated bool, ifaces map[string]InterfaceStats, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ifaces != nil {
+		ifaces = make(map[string]InterfaceStats, len(s.ifaces))
+		for name, stats := range s.ifaces {
+			ifaces[name] = stats
+		}
+	}
+	return s.total, s.rated, ifaces, s.haveTotal
+}
+
+// Interfaces returns the raw per-interface counters, for accounting that
+// needs them outside of Collect.
+func (c *Collector) Interfaces() (map[string]NetworkCounters, error) {
+	return c.source.Interfaces()
+}
+
 func (c *Collector) GetSystemInfo() (map[string]interface{}, error) {
 	info := make(map[string]interface{})
 
 	// Host information
-	if hostInfo, err := host.Info(); err == nil {
+	if hostInfo, err := c.source.Host(); err == nil {
 		info["hostname"] = hostInfo.Hostname
 		info["platform"] = hostInfo.Platform
 		info["platformFamily"] = hostInfo.PlatformFamily
@@ -103,21 +271,21 @@ func (c *Collector) GetSystemInfo() (map[string]interface{}, error) {
 	}
 
 	// CPU information
-	if cpuInfo, err := cpu.Info(); err == nil && len(cpuInfo) > 0 {
-		info["cpuModel"] = cpuInfo[0].ModelName
-		info["cpuCores"] = len(cpuInfo)
-		info["cpuMhz"] = cpuInfo[0].Mhz
+	if cpuInfo, err := c.source.CPUInfo(); err == nil {
+		info["cpuModel"] = cpuInfo.Model
+		info["cpuCores"] = cpuInfo.Cores
+		info["cpuMhz"] = cpuInfo.Mhz
 	}
 
 	// Memory information
-	if memInfo, err := mem.VirtualMemory(); err == nil {
+	if memInfo, err := c.source.Memory(); err == nil {
 		info["memoryTotal"] = memInfo.Total
 	}
 
 	// Disk information
-	if diskInfo, err := disk.Usage("/"); err == nil {
+	if diskInfo, err := c.source.Disk("/"); err == nil {
 		info["diskTotal"] = diskInfo.Total
 	}
 
 	return info, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+type stubClock struct {
+	now time.Time
+}
+
+func (c *stubClock) Now() time.Time { return c.now }
+
+func (c *stubClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// stubSource returns whatever the test last set. Anything left unset reads
+// as unavailable.
+type stubSource struct {
+	cpu        CPUTimes
+	net        NetworkCounters
+	ifaces     map[string]NetworkCounters
+	memory     *MemoryStats
+	containers []ContainerStats
+}
+
+var errUnavailable = errors.New("unavailable")
+
+func (s *stubSource) CPUInfo() (CPUInfo, error)           { return CPUInfo{}, errUnavailable }
+func (s *stubSource) Disk(path string) (DiskStats, error) { return DiskStats{}, errUnavailable }
+func (s *stubSource) Network() (NetworkCounters, error)   { return s.net, nil }
+func (s *stubSource) Host() (HostStats, error)            { return HostStats{}, errUnavailable }
+func (s *stubSource) CPUTimes() (CPUTimes, error)         { return s.cpu, nil }
+func (s *stubSource) LoadAverage() (LoadAverage, error)   { return LoadAverage{}, errUnavailable }
+func (s *stubSource) Pressure() (Pressure, error)         { return Pressure{}, errUnavailable }
+
+func (s *stubSource) Memory() (MemoryStats, error) {
+	if s.memory == nil {
+		return MemoryStats{}, errUnavailable
+	}
+	return *s.memory, nil
+}
+
+func (s *stubSource) Interfaces() (map[string]NetworkCounters, error) {
+	if s.ifaces == nil {
+		return nil, errUnavailable
+	}
+	return s.ifaces, nil
+}
+
+func (s *stubSource) Containers() ([]ContainerStats, error) {
+	if s.containers == nil {
+		return nil, errUnavailable
+	}
+	return s.containers, nil
+}
+
+func newTestCollector(cfg config.MetricsConfig) (*Collector, *stubSource, *stubClock) {
+	source := &stubSource{}
+	clock := &stubClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return NewWithSource(cfg, source, clock), source, clock
+}
+
+func TestCollectFirstSample(t *testing.T) {
+	c, source, _ := newTestCollector(config.MetricsConfig{})
+	source.cpu = CPUTimes{Total: 1000, Idle: 800}
+	source.net = NetworkCounters{BytesRecv: 5000, BytesSent: 3000}
+	source.ifaces = map[string]NetworkCounters{"eth0": {BytesRecv: 5000, BytesSent: 3000}}
+
+	m, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["cpuUsage"]; ok {
+		t.Error("cpuUsage reported without a previous reading")
+	}
+	if m["networkRx"] != uint64(5000) || m["networkTx"] != uint64(3000) {
+		t.Errorf("counters = %v/%v, want 5000/3000", m["networkRx"], m["networkTx"])
+	}
+	if _, ok := m["networkRxRate"]; ok {
+		t.Error("networkRxRate reported without a previous reading")
+	}
+	ifaces := m["interfaces"].(map[string]InterfaceStats)
+	if eth0 := ifaces["eth0"]; eth0.RxRate != 0 || eth0.TxRate != 0 {
+		t.Errorf("eth0 rates = %v/%v on the first reading, want none", eth0.RxRate, eth0.TxRate)
+	}
+}
+
+func TestCollectRates(t *testing.T) {
+	c, source, clock := newTestCollector(config.MetricsConfig{})
+	source.cpu = CPUTimes{Total: 1000, Idle: 800, Steal: 10}
+	source.net = NetworkCounters{BytesRecv: 5000, BytesSent: 3000}
+	c.Collect()
+
+	clock.advance(10 * time.Second)
+	source.cpu = CPUTimes{Total: 2000, Idle: 1550, Steal: 60}
+	source.net = NetworkCounters{BytesRecv: 15000, BytesSent: 4000}
+	m, _ := c.Collect()
+
+	// 1000 ticks, 750 of them idle and 50 stolen.
+	if m["cpuUsage"] != 25.0 || m["cpuSteal"] != 5.0 {
+		t.Errorf("cpu = %v/%v, want 25/5", m["cpuUsage"], m["cpuSteal"])
+	}
+	if m["networkRxRate"] != 1000.0 || m["networkTxRate"] != 100.0 {
+		t.Errorf("rates = %v/%v, want 1000/100", m["networkRxRate"], m["networkTxRate"])
+	}
+}
+
+func TestCollectSubSecondInterval(t *testing.T) {
+	c, source, clock := newTestCollector(config.MetricsConfig{})
+	source.net = NetworkCounters{BytesRecv: 5000, BytesSent: 3000}
+	c.Collect()
+
+	clock.advance(200 * time.Millisecond)
+	source.net = NetworkCounters{BytesRecv: 9000, BytesSent: 3500}
+	m, _ := c.Collect()
+	if _, ok := m["networkRxRate"]; ok {
+		t.Errorf("networkRxRate = %v over 200ms, want none", m["networkRxRate"])
+	}
+	if m["networkRx"] != uint64(9000) {
+		t.Errorf("networkRx = %v, want the latest counter 9000", m["networkRx"])
+	}
+}
+
+func TestCollectCounterReset(t *testing.T) {
+	c, source, clock := newTestCollector(config.MetricsConfig{})
+	source.net = NetworkCounters{BytesRecv: 50000, BytesSent: 30000}
+	c.Collect()
+
+	// The interface went down and came back, its counters start over.
+	clock.advance(10 * time.Second)
+	source.net = NetworkCounters{BytesRecv: 100, BytesSent: 100}
+	m, _ := c.Collect()
+	if _, ok := m["networkRxRate"]; ok {
+		t.Errorf("networkRxRate = %v across a counter reset, want none", m["networkRxRate"])
+	}
+
+	clock.advance(10 * time.Second)
+	source.net = NetworkCounters{BytesRecv: 2100, BytesSent: 1100}
+	m, _ = c.Collect()
+	if m["networkRxRate"] != 200.0 || m["networkTxRate"] != 100.0 {
+		t.Errorf("rates = %v/%v after the reset, want 200/100", m["networkRxRate"], m["networkTxRate"])
+	}
+}
+
+func TestNetworkRates(t *testing.T) {
+	prev := NetworkCounters{BytesRecv: 1000, BytesSent: 1000}
+	tests := []struct {
+		name    string
+		cur     NetworkCounters
+		elapsed time.Duration
+		first   bool
+		rx, tx  float64
+		ok      bool
+	}{
+		{"first reading", NetworkCounters{BytesRecv: 2000, BytesSent: 2000}, 10 * time.Second, true, 0, 0, false},
+		{"sub-second", NetworkCounters{BytesRecv: 2000, BytesSent: 2000}, 999 * time.Millisecond, false, 0, 0, false},
+		{"rx reset", NetworkCounters{BytesRecv: 10, BytesSent: 2000}, 10 * time.Second, false, 0, 0, false},
+		{"tx reset", NetworkCounters{BytesRecv: 2000, BytesSent: 10}, 10 * time.Second, false, 0, 0, false},
+		{"idle", prev, 10 * time.Second, false, 0, 0, true},
+		{"steady", NetworkCounters{BytesRecv: 3000, BytesSent: 1500}, 2 * time.Second, false, 1000, 250, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rx, tx, ok := networkRates(prev, tt.cur, tt.elapsed, tt.first)
+			if rx != tt.rx || tx != tt.tx || ok != tt.ok {
+				t.Errorf("got %v, %v, %v, want %v, %v, %v", rx, tx, ok, tt.rx, tt.tx, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCollectContainerDownsampling(t *testing.T) {
+	c, source, _ := newTestCollector(config.MetricsConfig{MaxContainers: 3})
+	source.containers = []ContainerStats{
+		{Name: "a", CPUUsage: 5, MemoryUsed: 100},
+		{Name: "b", CPUUsage: 50, MemoryUsed: 200},
+		{Name: "c", CPUUsage: 1, MemoryUsed: 300},
+		{Name: "d", CPUUsage: 20, MemoryUsed: 400},
+		{Name: "e", CPUUsage: 2, MemoryUsed: 500},
+	}
+
+	m, _ := c.Collect()
+	if m["containerCount"] != 5 {
+		t.Errorf("containerCount = %v, want all 5", m["containerCount"])
+	}
+	got := m["containers"].([]ContainerStats)
+	if len(got) != 3 {
+		t.Fatalf("got %d containers, want 3", len(got))
+	}
+	if got[0].Name != "b" || got[1].Name != "d" {
+		t.Errorf("kept %s and %s, want the busiest, b and d", got[0].Name, got[1].Name)
+	}
+	other := got[2]
+	if other.Name != otherContainersName || other.Aggregated != 3 || other.CPUUsage != 8 || other.MemoryUsed != 900 {
+		t.Errorf("aggregate = %+v, want a, c and e folded in", other)
+	}
+}
+
+func TestCollectContainersUncapped(t *testing.T) {
+	c, source, _ := newTestCollector(config.MetricsConfig{MaxContainers: -1})
+	source.containers = make([]ContainerStats, 10)
+
+	m, _ := c.Collect()
+	if got := m["containers"].([]ContainerStats); len(got) != 10 {
+		t.Errorf("got %d containers with no cap, want 10", len(got))
+	}
+}
+
+// Threshold checks downstream compare these against fixed percentages, so
+// they must stay within 0-100 whatever the counters do.
+func TestCollectUsageThresholdInputs(t *testing.T) {
+	c, source, clock := newTestCollector(config.MetricsConfig{})
+	source.memory = &MemoryStats{Total: 1000, Used: 950, UsedPercent: 95}
+	source.cpu = CPUTimes{Total: 1000, Idle: 500}
+	c.Collect()
+
+	// Idle can't rise by more than the total; clamp rather than go negative.
+	clock.advance(10 * time.Second)
+	source.cpu = CPUTimes{Total: 1100, Idle: 700}
+	m, _ := c.Collect()
+	if m["cpuUsage"] != 0.0 {
+		t.Errorf("cpuUsage = %v, want clamped to 0", m["cpuUsage"])
+	}
+	if m["memoryUsage"] != 95.0 {
+		t.Errorf("memoryUsage = %v, want 95", m["memoryUsage"])
+	}
+
+	// A counter going backwards only moves the baseline, the last usage
+	// stands.
+	clock.advance(10 * time.Second)
+	source.cpu = CPUTimes{Total: 500, Idle: 100}
+	m, _ = c.Collect()
+	if m["cpuUsage"] != 0.0 {
+		t.Errorf("cpuUsage = %v after a counter reset, want the previous 0", m["cpuUsage"])
+	}
+
+	clock.advance(10 * time.Second)
+	source.cpu = CPUTimes{Total: 1500, Idle: 100}
+	m, _ = c.Collect()
+	if m["cpuUsage"] != 100.0 {
+		t.Errorf("cpuUsage = %v fully busy, want 100", m["cpuUsage"])
+	}
+}
@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dockerSocket       = "/var/run/docker.sock"
+	dockerStatsWorkers = 8
+)
+
+// ContainerStats is the per-server usage reported for each Wings container.
+type ContainerStats struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"` // Wings names containers after the server UUID
+	CPUUsage    float64 `json:"cpuUsage"`
+	MemoryUsed  uint64  `json:"memoryUsed"`
+	MemoryLimit uint64  `json:"memoryLimit"`
+	DiskRead    uint64  `json:"diskRead"`
+	DiskWrite   uint64  `json:"diskWrite"`
+	NetworkRx   uint64  `json:"networkRx"`
+	NetworkTx   uint64  `json:"networkTx"`
+
+	Labels     map[string]string `json:"labels,omitempty"`
+	Aggregated int               `json:"aggregated,omitempty"` // containers folded into this entry
+}
+
+type cpuSample struct {
+	container uint64
+	system    uint64
+}
+
+// dockerClient talks to the Engine API directly over the Unix socket.
+type dockerClient struct {
+	http        *http.Client
+	labelFilter map[string]bool
+
+	mu      sync.Mutex
+	lastCPU map[string]cpuSample
+}
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint64 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+func newDockerClient(labelAllowlist []string) *dockerClient {
+	labelFilter := make(map[string]bool, len(labelAllowlist))
+	for _, l := range labelAllowlist {
+		labelFilter[l] = true
+	}
+
+	return &dockerClient{
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", dockerSocket)
+				},
+			},
+		},
+		labelFilter: labelFilter,
+		lastCPU:     make(map[string]cpuSample),
+	}
+}
+
+func (d *dockerClient) get(path string, out interface{}) error {
+	resp, err := d.http.Get("http://docker" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("docker API %s: HTTP %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ContainerStats returns usage for every running Pterodactyl server container.
+func (d *dockerClient) ContainerStats() ([]ContainerStats, error) {
+	filters := url.QueryEscape(`{"label":["Service=Pterodactyl"]}`)
+
+	var containers []dockerContainer
+	if err := d.get("/containers/json?filters="+filters, &containers); err != nil {
+		return nil, err
+	}
+
+	results := make([]ContainerStats, len(containers))
+	ok := make([]bool, len(containers))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < dockerStatsWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if stats, err := d.containerStats(containers[i]); err == nil {
+					results[i] = stats
+					ok[i] = true
+				}
+			}
+		}()
+	}
+	for i := range containers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	stats := make([]ContainerStats, 0, len(containers))
+	seen := make(map[string]bool, len(containers))
+	for i, r := range results {
+		if ok[i] {
+			stats = append(stats, r)
+			seen[r.ID] = true
+		}
+	}
+
+	// Forget CPU samples for containers that have gone away.
+	d.mu.Lock()
+	for id := range d.lastCPU {
+		if !seen[id] {
+			delete(d.lastCPU, id)
+		}
+	}
+	d.mu.Unlock()
+
+	return stats, nil
+}
+
+func (d *dockerClient) containerStats(c dockerContainer) (ContainerStats, error) {
+	// one-shot skips the daemon's one second pre-sample, CPU deltas are
+	// computed against our own previous sample instead.
+	var raw dockerStats
+	if err := d.get("/containers/"+c.ID+"/stats?stream=false&one-shot=true", &raw); err != nil {
+		return ContainerStats{}, err
+	}
+
+	stats := ContainerStats{
+		ID:          c.ID,
+		MemoryLimit: raw.MemoryStats.Limit,
+		MemoryUsed:  raw.MemoryStats.Usage,
+		Labels:      filterLabels(c.Labels, d.labelFilter),
+	}
+	if len(c.Names) > 0 {
+		stats.Name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	// Page cache isn't really "used" memory, match what `docker stats` shows.
+	if inactive, ok := raw.MemoryStats.Stats["inactive_file"]; ok && inactive < stats.MemoryUsed {
+		stats.MemoryUsed -= inactive
+	}
+
+	for _, entry := range raw.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.DiskRead += entry.Value
+		case "write":
+			stats.DiskWrite += entry.Value
+		}
+	}
+
+	for _, n := range raw.Networks {
+		stats.NetworkRx += n.RxBytes
+		stats.NetworkTx += n.TxBytes
+	}
+
+	sample := cpuSample{
+		container: raw.CPUStats.CPUUsage.TotalUsage,
+		system:    raw.CPUStats.SystemUsage,
+	}
+
+	d.mu.Lock()
+	prev, havePrev := d.lastCPU[c.ID]
+	d.lastCPU[c.ID] = sample
+	d.mu.Unlock()
+
+	if havePrev && sample.system > prev.system && sample.container >= prev.container {
+		cpus := raw.CPUStats.OnlineCPUs
+		if cpus == 0 {
+			cpus = 1
+		}
+		stats.CPUUsage = float64(sample.container-prev.container) / float64(sample.system-prev.system) * float64(cpus) * 100
+	}
+
+	return stats, nil
+}
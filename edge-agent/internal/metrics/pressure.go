@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LoadAverage is the run queue length averaged over 1, 5 and 15 minutes.
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// CPUTimes are cumulative seconds across all CPUs. Idle includes time
+// waiting on I/O. Steal is time the hypervisor ran someone else while this
+// guest had work to do.
+type CPUTimes struct {
+	Idle  float64
+	Steal float64
+	Total float64
+}
+
+// PressureLine is one line of a /proc/pressure file: the share of time
+// tasks were stalled on the resource, averaged over 10s, 60s and 300s, and
+// the total stall time in microseconds.
+type PressureLine struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// PressureStats is one resource. Some is when at least one task stalled;
+// Full is when all non-idle tasks did at once, and is missing for CPU on
+// kernels before 5.13.
+type PressureStats struct {
+	Some PressureLine  `json:"some"`
+	Full *PressureLine `json:"full,omitempty"`
+}
+
+// Pressure is Linux Pressure Stall Information. Unlike utilization it
+// measures lost work, so an oversold node shows up here before CPU or
+// memory percentages look alarming.
+type Pressure struct {
+	CPU    *PressureStats `json:"cpu,omitempty"`
+	Memory *PressureStats `json:"memory,omitempty"`
+	IO     *PressureStats `json:"io,omitempty"`
+}
+
+// parsePressure reads the format of /proc/pressure/{cpu,memory,io}:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(r io.Reader) (*PressureStats, error) {
+	var stats PressureStats
+	seen := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var line PressureLine
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed pressure field %q", field)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				line.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				line.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				line.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				line.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("malformed pressure field %q: %w", field, err)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			stats.Some = line
+			seen = true
+		case "full":
+			stats.Full = &line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !seen {
+		return nil, errNoData
+	}
+	return &stats, nil
+}
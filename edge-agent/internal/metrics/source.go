@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Clock is the collector's view of time, so rate calculations can be driven
+// deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Source supplies raw readings from the host. The default is the real host;
+// building with the fake tag swaps in synthetic data for simulation.
+type Source interface {
+	CPUInfo() (CPUInfo, error)
+	Memory() (MemoryStats, error)
+	Disk(path string) (DiskStats, error)
+	Network() (NetworkCounters, error)
+	Interfaces() (map[string]NetworkCounters, error)
+	Host() (HostStats, error)
+	CPUTimes() (CPUTimes, error)
+	LoadAverage() (LoadAverage, error)
+	Pressure() (Pressure, error)
+	Containers() ([]ContainerStats, error)
+}
+
+type CPUInfo struct {
+	Model string
+	Cores int
+	Mhz   float64
+}
+
+type MemoryStats struct {
+	Total       uint64
+	Used        uint64
+	Available   uint64
+	UsedPercent float64
+}
+
+type DiskStats struct {
+	Total       uint64
+	Used        uint64
+	Free        uint64
+	UsedPercent float64
+}
+
+// NetworkCounters are cumulative byte counts, across all interfaces or for
+// a single one.
+type NetworkCounters struct {
+	BytesRecv uint64
+	BytesSent uint64
+}
+
+type HostStats struct {
+	Hostname        string
+	Platform        string
+	PlatformFamily  string
+	PlatformVersion string
+	KernelVersion   string
+	KernelArch      string
+	Uptime          uint64
+}
@@ -0,0 +1,113 @@
+//go:build fake
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+)
+
+// fakeSource produces plausible, slowly varying readings derived from the
+// clock, for simulation runs without a real Wings node.
+type fakeSource struct {
+	clock Clock
+	start int64
+}
+
+func defaultSource(cfg config.MetricsConfig, clock Clock) Source {
+	return &fakeSource{clock: clock, start: clock.Now().Unix()}
+}
+
+// wave oscillates between lo and hi over period seconds.
+func (s *fakeSource) wave(lo, hi, period float64) float64 {
+	t := float64(s.clock.Now().Unix() - s.start)
+	return lo + (hi-lo)*(0.5+0.5*math.Sin(2*math.Pi*t/period))
+}
+
+func (s *fakeSource) elapsed() uint64 {
+	return uint64(s.clock.Now().Unix() - s.start)
+}
+
+func (s *fakeSource) CPUInfo() (CPUInfo, error) {
+	return CPUInfo{Model: "Simulated CPU", Cores: 8, Mhz: 3000}, nil
+}
+
+func (s *fakeSource) Memory() (MemoryStats, error) {
+	const total = 32 << 30
+	percent := s.wave(30, 60, 1800)
+	used := uint64(float64(total) * percent / 100)
+	return MemoryStats{Total: total, Used: used, Available: total - used, UsedPercent: percent}, nil
+}
+
+func (s *fakeSource) Disk(path string) (DiskStats, error) {
+	const total = 500 << 30
+	percent := s.wave(40, 45, 3600)
+	used := uint64(float64(total) * percent / 100)
+	return DiskStats{Total: total, Used: used, Free: total - used, UsedPercent: percent}, nil
+}
+
+func (s *fakeSource) Network() (NetworkCounters, error) {
+	// Steady 1 MB/s in and 4 MB/s out.
+	return NetworkCounters{BytesRecv: s.elapsed() << 20, BytesSent: s.elapsed() << 22}, nil
+}
+
+func (s *fakeSource) Interfaces() (map[string]NetworkCounters, error) {
+	total, _ := s.Network()
+	return map[string]NetworkCounters{
+		"eth0":         total,
+		"pterodactyl0": {BytesRecv: s.elapsed() << 18, BytesSent: s.elapsed() << 19},
+	}, nil
+}
+
+func (s *fakeSource) Host() (HostStats, error) {
+	return HostStats{
+		Hostname:        "sim-node",
+		Platform:        "ubuntu",
+		PlatformFamily:  "debian",
+		PlatformVersion: "22.04",
+		KernelVersion:   "5.15.0-sim",
+		KernelArch:      "x86_64",
+		Uptime:          86400 + s.elapsed(),
+	}, nil
+}
+
+func (s *fakeSource) CPUTimes() (CPUTimes, error) {
+	// 8 cores, 2% of the time stolen, and busy between 10% and 70% over
+	// ten minutes: the integral of the same wave as wave(10, 70, 600).
+	const lo, hi, period = 10.0, 70.0, 600.0
+	t := float64(s.clock.Now().Unix() - s.start)
+	busy := lo*t + (hi-lo)*(0.5*t+0.5*period/(2*math.Pi)*(1-math.Cos(2*math.Pi*t/period)))
+	total := t * 8
+	return CPUTimes{Idle: total - busy*8/100, Steal: total * 0.02, Total: total}, nil
+}
+
+func (s *fakeSource) LoadAverage() (LoadAverage, error) {
+	return LoadAverage{Load1: s.wave(1, 9, 600), Load5: s.wave(2, 7, 1800), Load15: s.wave(3, 6, 3600)}, nil
+}
+
+func (s *fakeSource) Pressure() (Pressure, error) {
+	line := func(lo, hi float64) PressureLine {
+		return PressureLine{Avg10: s.wave(lo, hi, 300), Avg60: s.wave(lo, hi, 900), Avg300: s.wave(lo, hi, 2700)}
+	}
+	return Pressure{
+		CPU:    &PressureStats{Some: line(1, 20)},
+		Memory: &PressureStats{Some: line(0, 2), Full: &PressureLine{}},
+		IO:     &PressureStats{Some: line(0, 5), Full: &PressureLine{}},
+	}, nil
+}
+
+func (s *fakeSource) Containers() ([]ContainerStats, error) {
+	containers := make([]ContainerStats, 12)
+	for i := range containers {
+		containers[i] = ContainerStats{
+			ID:          fmt.Sprintf("sim%02d", i),
+			Name:        fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			CPUUsage:    s.wave(0, 100, float64(300+60*i)),
+			MemoryUsed:  uint64(s.wave(512, 4096, float64(900+30*i))) << 20,
+			MemoryLimit: 4096 << 20,
+		}
+	}
+	return containers, nil
+}
@@ -0,0 +1,152 @@
+//go:build !fake
+
+package metrics
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// hostSource reads the real machine through gopsutil and the Docker socket.
+type hostSource struct {
+	docker *dockerClient
+}
+
+func defaultSource(cfg config.MetricsConfig, clock Clock) Source {
+	return &hostSource{docker: newDockerClient(cfg.LabelAllowlist)}
+}
+
+func (s *hostSource) CPUInfo() (CPUInfo, error) {
+	info, err := cpu.Info()
+	if err != nil {
+		return CPUInfo{}, err
+	}
+	if len(info) == 0 {
+		return CPUInfo{}, errNoData
+	}
+	return CPUInfo{Model: info[0].ModelName, Cores: len(info), Mhz: info[0].Mhz}, nil
+}
+
+func (s *hostSource) Memory() (MemoryStats, error) {
+	m, err := mem.VirtualMemory()
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	return MemoryStats{Total: m.Total, Used: m.Used, Available: m.Available, UsedPercent: m.UsedPercent}, nil
+}
+
+func (s *hostSource) Disk(path string) (DiskStats, error) {
+	d, err := disk.Usage(path)
+	if err != nil {
+		return DiskStats{}, err
+	}
+	return DiskStats{Total: d.Total, Used: d.Used, Free: d.Free, UsedPercent: d.UsedPercent}, nil
+}
+
+func (s *hostSource) Network() (NetworkCounters, error) {
+	counters, err := net.IOCounters(false)
+	if err != nil {
+		return NetworkCounters{}, err
+	}
+	if len(counters) == 0 {
+		return NetworkCounters{}, errNoData
+	}
+	return NetworkCounters{BytesRecv: counters[0].BytesRecv, BytesSent: counters[0].BytesSent}, nil
+}
+
+// Interfaces skips loopback and the veth pair of every container, which
+// would otherwise swamp the report on a busy node.
+func (s *hostSource) Interfaces() (map[string]NetworkCounters, error) {
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make(map[string]NetworkCounters, len(counters))
+	for _, c := range counters {
+		if c.Name == "lo" || strings.HasPrefix(c.Name, "veth") {
+			continue
+		}
+		ifaces[c.Name] = NetworkCounters{BytesRecv: c.BytesRecv, BytesSent: c.BytesSent}
+	}
+	return ifaces, nil
+}
+
+func (s *hostSource) Host() (HostStats, error) {
+	h, err := host.Info()
+	if err != nil {
+		return HostStats{}, err
+	}
+	return HostStats{
+		Hostname:        h.Hostname,
+		Platform:        h.Platform,
+		PlatformFamily:  h.PlatformFamily,
+		PlatformVersion: h.PlatformVersion,
+		KernelVersion:   h.KernelVersion,
+		KernelArch:      h.KernelArch,
+		Uptime:          h.Uptime,
+	}, nil
+}
+
+func (s *hostSource) CPUTimes() (CPUTimes, error) {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return CPUTimes{}, err
+	}
+	if len(times) == 0 {
+		return CPUTimes{}, errNoData
+	}
+	t := times[0]
+	return CPUTimes{
+		Idle:  t.Idle + t.Iowait,
+		Steal: t.Steal,
+		Total: t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal,
+	}, nil
+}
+
+func (s *hostSource) LoadAverage() (LoadAverage, error) {
+	avg, err := load.Avg()
+	if err != nil {
+		return LoadAverage{}, err
+	}
+	return LoadAverage{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}, nil
+}
+
+// Pressure needs a kernel with CONFIG_PSI (4.20+), and some distributions
+// only enable it with psi=1 on the kernel command line. Resources the
+// kernel doesn't report are left out.
+func (s *hostSource) Pressure() (Pressure, error) {
+	var p Pressure
+	found := false
+	for _, r := range []struct {
+		name  string
+		stats **PressureStats
+	}{{"cpu", &p.CPU}, {"memory", &p.Memory}, {"io", &p.IO}} {
+		f, err := os.Open("/proc/pressure/" + r.name)
+		if err != nil {
+			continue
+		}
+		stats, err := parsePressure(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		*r.stats = stats
+		found = true
+	}
+	if !found {
+		return Pressure{}, errNoData
+	}
+	return p, nil
+}
+
+func (s *hostSource) Containers() ([]ContainerStats, error) {
+	return s.docker.ContainerStats()
+}
@@ -0,0 +1,162 @@
+// Package netdial dials the control plane with a choice of address family
+// and source address, for nodes whose IPv4 or IPv6 path is broken or that
+// have more than one uplink.
+package netdial
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// fallbackDelay is how long the preferred family gets before the other
+// one is tried alongside it, as in RFC 8305.
+const fallbackDelay = 300 * time.Millisecond
+
+// DialFunc matches http.Transport.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// New returns a dialer for the given address family setting:
+//
+//   - auto races IPv6 and IPv4 the way Go does by default (RFC 6555),
+//     in the order the system's address selection prefers
+//   - ipv4 or ipv6 only ever use that family
+//   - prefer_ipv4 or prefer_ipv6 try that family first and fall back to
+//     the other after a short head start, or at once if it fails
+//
+// source, when set, is the local address connections come from, which also
+// picks the uplink on a multi-homed node. It limits dialing to its own
+// family.
+func New(family, source string) (DialFunc, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if source != "" {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", source)
+		}
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	switch family {
+	case "", "auto":
+		return d.DialContext, nil
+	case "ipv4", "ipv6":
+		suffix := map[string]string{"ipv4": "4", "ipv6": "6"}[family]
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if network == "tcp" || network == "udp" {
+				network += suffix
+			}
+			return d.DialContext(ctx, network, addr)
+		}, nil
+	case "prefer_ipv4", "prefer_ipv6":
+		p := &preferDialer{dialer: d, ipv4: family == "prefer_ipv4"}
+		return p.DialContext, nil
+	}
+	return nil, fmt.Errorf("unknown address family %q", family)
+}
+
+type preferDialer struct {
+	dialer *net.Dialer
+	ipv4   bool // preferred family
+}
+
+func (p *preferDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return p.dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var primary, fallback []string
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == p.ipv4 {
+			primary = append(primary, net.JoinHostPort(ip.String(), port))
+		} else {
+			fallback = append(fallback, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(primary) == 0 {
+		primary, fallback = fallback, nil
+	}
+	if len(primary) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return p.race(ctx, network, primary, fallback)
+}
+
+type dialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// race dials the primary addresses, and the fallback ones once the
+// primaries have had fallbackDelay or failed. The first connection wins,
+// a later one is closed.
+func (p *preferDialer) race(ctx context.Context, network string, primary, fallback []string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	dial := func(addrs []string, isPrimary bool) {
+		var err error
+		for _, addr := range addrs {
+			var conn net.Conn
+			if conn, err = p.dialer.DialContext(ctx, network, addr); err == nil {
+				select {
+				case results <- dialResult{conn: conn, primary: isPrimary}:
+				case <-ctx.Done():
+					conn.Close()
+				}
+				return
+			}
+		}
+		select {
+		case results <- dialResult{err: err, primary: isPrimary}:
+		case <-ctx.Done():
+		}
+	}
+
+	go dial(primary, true)
+	pending := 1
+	var fallbackTimer <-chan time.Time
+	if len(fallback) > 0 {
+		timer := time.NewTimer(fallbackDelay)
+		defer timer.Stop()
+		fallbackTimer = timer.C
+	}
+
+	var firstErr error
+	for {
+		select {
+		case <-fallbackTimer:
+			fallbackTimer = nil
+			go dial(fallback, false)
+			pending++
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			if firstErr == nil || r.primary {
+				firstErr = r.err
+			}
+			if fallbackTimer != nil {
+				fallbackTimer = nil
+				go dial(fallback, false)
+				pending++
+				continue
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package rpc is the agent's gRPC transport to the control plane: the
+// services in agent.proto spoken over HTTP/2 with the gRPC framing, built
+// on net/http. It only needs what the agent uses: unary calls and one
+// bidirectional stream, uncompressed, over TLS.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/netdial"
+)
+
+// Service is the gRPC service name from agent.proto.
+const Service = "edgeagent.v1.AgentService"
+
+const maxMessageSize = 16 << 20
+
+// gRPC status codes the agent acts on.
+const (
+	CodeOK                = 0
+	CodeCanceled          = 1
+	CodeInvalidArgument   = 3
+	CodeDeadlineExceeded  = 4
+	CodeNotFound          = 5
+	CodePermissionDenied  = 7
+	CodeResourceExhausted = 8
+	CodeUnimplemented     = 12
+	CodeUnavailable       = 14
+	CodeUnauthenticated   = 16
+)
+
+// StatusError is a call that failed, with the gRPC status the control
+// plane returned, or the HTTP status if it never got as far as gRPC.
+type StatusError struct {
+	Code    int
+	Message string
+	HTTP    int // set when the response wasn't gRPC at all
+}
+
+func (e *StatusError) Error() string {
+	if e.HTTP != 0 {
+		return fmt.Sprintf("grpc: HTTP %d: %s", e.HTTP, e.Message)
+	}
+	return fmt.Sprintf("grpc: code %d: %s", e.Code, e.Message)
+}
+
+// HTTPStatus is the HTTP status equivalent to the error, so callers can
+// treat both transports' failures alike.
+func (e *StatusError) HTTPStatus() int {
+	if e.HTTP != 0 {
+		return e.HTTP
+	}
+	switch e.Code {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeUnimplemented:
+		return http.StatusNotImplemented
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Client makes calls over one shared HTTP/2 connection per control plane,
+// which is what saves the per-request overhead of the REST transport.
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error), dial netdial.DialFunc) *Client {
+	var cfg *tls.Config
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	return &Client{http: &http.Client{
+		// No client timeout, it would cut streams off; calls use contexts.
+		Transport: &http.Transport{
+			Proxy:             proxy,
+			DialContext:       dial,
+			TLSClientConfig:   cfg,
+			ForceAttemptHTTP2: true,
+			IdleConnTimeout:   5 * time.Minute,
+		},
+	}}
+}
+
+// Invoke makes a unary call. md is sent as request headers.
+func (c *Client) Invoke(ctx context.Context, baseURL, method string, md http.Header, req, resp Message) error {
+	httpReq, err := newRequest(ctx, baseURL, method, md, bytes.NewReader(frame(req.Marshal())))
+	if err != nil {
+		return err
+	}
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if err := checkResponse(httpResp); err != nil {
+		return err
+	}
+
+	data, readErr := readFrame(httpResp.Body)
+	if readErr != nil && readErr != io.EOF {
+		return readErr
+	}
+	// The status comes in the trailers, which are only there after EOF.
+	io.Copy(io.Discard, httpResp.Body)
+	if err := status(httpResp); err != nil {
+		return err
+	}
+	if readErr == io.EOF {
+		return fmt.Errorf("grpc: %s returned no message", method)
+	}
+	return resp.Unmarshal(data)
+}
+
+// Stream is a bidirectional streaming call.
+type Stream struct {
+	cancel context.CancelFunc
+	body   *io.PipeWriter
+
+	sendMu sync.Mutex
+
+	ready chan struct{}
+	resp  *http.Response
+	err   error
+}
+
+// OpenStream starts a streaming call. Messages can be sent straight away;
+// the control plane may not answer until it has the first one.
+func (c *Client) OpenStream(ctx context.Context, baseURL, method string, md http.Header) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	req, err := newRequest(ctx, baseURL, method, md, pr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Stream{cancel: cancel, body: pw, ready: make(chan struct{})}
+	go func() {
+		defer close(s.ready)
+		resp, err := c.http.Do(req)
+		if err == nil {
+			if err = checkResponse(resp); err != nil {
+				resp.Body.Close()
+			}
+		}
+		if err != nil {
+			pr.CloseWithError(err)
+			s.err = err
+			return
+		}
+		s.resp = resp
+	}()
+	return s, nil
+}
+
+func (s *Stream) Send(m Message) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_, err := s.body.Write(frame(m.Marshal()))
+	return err
+}
+
+// Recv reads the next message. It returns io.EOF when the control plane
+// ends the stream cleanly, and a *StatusError when it ends it with an error.
+func (s *Stream) Recv(m Message) error {
+	<-s.ready
+	if s.err != nil {
+		return s.err
+	}
+	data, err := readFrame(s.resp.Body)
+	if err == io.EOF {
+		if statusErr := status(s.resp); statusErr != nil {
+			return statusErr
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(data)
+}
+
+// Close ends the stream from the agent's side and releases the connection.
+func (s *Stream) Close() {
+	s.body.Close()
+	s.cancel()
+	go func() {
+		<-s.ready
+		if s.resp != nil {
+			s.resp.Body.Close()
+		}
+	}()
+}
+
+func newRequest(ctx context.Context, baseURL, method string, md http.Header, body io.Reader) (*http.Request, error) {
+	url := strings.TrimSuffix(baseURL, "/") + "/" + Service + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range md {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		if ms := time.Until(deadline).Milliseconds(); ms > 0 {
+			req.Header.Set("Grpc-Timeout", strconv.FormatInt(ms, 10)+"m")
+		}
+	}
+	return req, nil
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.ProtoMajor != 2 {
+		return &StatusError{HTTP: http.StatusHTTPVersionNotSupported, Message: "control plane did not answer over HTTP/2"}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{HTTP: resp.StatusCode, Message: resp.Status}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		// Without trailers this can still be a status, sent as headers.
+		if err := status(resp); err != nil {
+			return err
+		}
+		return &StatusError{HTTP: http.StatusBadGateway, Message: "unexpected content type " + resp.Header.Get("Content-Type")}
+	}
+	return nil
+}
+
+// status reads grpc-status from the trailers, or from the headers for a
+// trailers-only response.
+func status(resp *http.Response) error {
+	code := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if code == "" || code == "0" {
+		return nil
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return &StatusError{Code: -1, Message: "invalid grpc-status " + code}
+	}
+	if unescaped, err := url.PathUnescape(msg); err == nil {
+		msg = unescaped
+	}
+	return &StatusError{Code: n, Message: msg}
+}
+
+// frame prefixes a message with the gRPC header: a compressed flag (never
+// set, compression isn't negotiated) and the big-endian length.
+func frame(msg []byte) []byte {
+	out := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(out[1:5], uint32(len(msg)))
+	copy(out[5:], msg)
+	return out
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("grpc: truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("grpc: compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("grpc: message of %d bytes is over the %d byte limit", size, maxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("grpc: truncated message: %w", err)
+	}
+	return data, nil
+}
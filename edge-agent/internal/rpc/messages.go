@@ -0,0 +1,265 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The messages in agent.proto only use string, bytes and int64 fields, so
+// they are encoded by hand rather than through generated code.
+
+// Message is a protobuf message from agent.proto.
+type Message interface {
+	Marshal() []byte
+	Unmarshal(data []byte) error
+}
+
+type EnrollRequest struct {
+	Token       string
+	CSR         string
+	NodeInfo    []byte
+	NodeID      string
+	Attestation []byte
+	SigningKey  []byte
+}
+
+func (m *EnrollRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Token)
+	b = appendString(b, 2, m.CSR)
+	b = appendBytes(b, 3, m.NodeInfo)
+	b = appendString(b, 4, m.NodeID)
+	b = appendBytes(b, 5, m.Attestation)
+	b = appendBytes(b, 6, m.SigningKey)
+	return b
+}
+
+func (m *EnrollRequest) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, _ uint64) {
+		switch field {
+		case 1:
+			m.Token = string(v)
+		case 2:
+			m.CSR = string(v)
+		case 3:
+			m.NodeInfo = v
+		case 4:
+			m.NodeID = string(v)
+		case 5:
+			m.Attestation = v
+		case 6:
+			m.SigningKey = v
+		}
+	})
+}
+
+type EnrollResponse struct {
+	NodeID            string
+	AuthToken         string
+	ClientCertificate string
+	WingsConfig       []byte
+}
+
+func (m *EnrollResponse) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.NodeID)
+	b = appendString(b, 2, m.AuthToken)
+	b = appendString(b, 3, m.ClientCertificate)
+	b = appendBytes(b, 4, m.WingsConfig)
+	return b
+}
+
+func (m *EnrollResponse) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, _ uint64) {
+		switch field {
+		case 1:
+			m.NodeID = string(v)
+		case 2:
+			m.AuthToken = string(v)
+		case 3:
+			m.ClientCertificate = string(v)
+		case 4:
+			m.WingsConfig = v
+		}
+	})
+}
+
+type HeartbeatRequest struct {
+	SessionID string
+	Heartbeat []byte
+}
+
+func (m *HeartbeatRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.SessionID)
+	b = appendBytes(b, 2, m.Heartbeat)
+	return b
+}
+
+func (m *HeartbeatRequest) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, _ uint64) {
+		switch field {
+		case 1:
+			m.SessionID = string(v)
+		case 2:
+			m.Heartbeat = v
+		}
+	})
+}
+
+type HeartbeatResponse struct {
+	Response []byte
+}
+
+func (m *HeartbeatResponse) Marshal() []byte {
+	return appendBytes(nil, 1, m.Response)
+}
+
+func (m *HeartbeatResponse) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, _ uint64) {
+		if field == 1 {
+			m.Response = v
+		}
+	})
+}
+
+type ChannelMessage struct {
+	Event string
+	Data  []byte
+}
+
+func (m *ChannelMessage) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Event)
+	b = appendBytes(b, 2, m.Data)
+	return b
+}
+
+func (m *ChannelMessage) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, _ uint64) {
+		switch field {
+		case 1:
+			m.Event = string(v)
+		case 2:
+			m.Data = v
+		}
+	})
+}
+
+type PushMetricsRequest struct {
+	SessionID   string
+	TimestampMs int64
+	Metrics     []byte
+}
+
+func (m *PushMetricsRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.SessionID)
+	b = appendInt64(b, 2, m.TimestampMs)
+	b = appendBytes(b, 3, m.Metrics)
+	return b
+}
+
+func (m *PushMetricsRequest) Unmarshal(data []byte) error {
+	return decode(data, func(field int, v []byte, n uint64) {
+		switch field {
+		case 1:
+			m.SessionID = string(v)
+		case 2:
+			m.TimestampMs = int64(n)
+		case 3:
+			m.Metrics = v
+		}
+	})
+}
+
+type PushMetricsResponse struct{}
+
+func (m *PushMetricsResponse) Marshal() []byte { return nil }
+
+func (m *PushMetricsResponse) Unmarshal(data []byte) error {
+	return decode(data, func(int, []byte, uint64) {})
+}
+
+// Wire types used by agent.proto.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// proto3 leaves fields at their zero value off the wire.
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendInt64(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// decode calls fn for each field: v for length-delimited fields, n for
+// varints. Fields of other types are skipped, as are unknown fields.
+func decode(data []byte, fn func(field int, v []byte, n uint64)) error {
+	for len(data) > 0 {
+		key, k := binary.Uvarint(data)
+		if k <= 0 {
+			return errTruncated
+		}
+		data = data[k:]
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case wireVarint:
+			n, k := binary.Uvarint(data)
+			if k <= 0 {
+				return errTruncated
+			}
+			data = data[k:]
+			fn(field, nil, n)
+		case wireBytes:
+			size, k := binary.Uvarint(data)
+			if k <= 0 || uint64(len(data)-k) < size {
+				return errTruncated
+			}
+			v := data[k : k+int(size)]
+			data = data[k+int(size):]
+			fn(field, append([]byte(nil), v...), 0)
+		case wireFixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+	}
+	return nil
+}
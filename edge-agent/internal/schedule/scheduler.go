@@ -0,0 +1,209 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/tasks"
+	"github.com/sirupsen/logrus"
+)
+
+// Entry runs a task on a cron schedule, e.g. a nightly docker prune.
+type Entry struct {
+	ID       string          `json:"id"`
+	Cron     string          `json:"cron"`
+	Type     string          `json:"type"`
+	Timeout  int             `json:"timeout,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+	LastRun  time.Time       `json:"last_run,omitempty"`
+	LastTask string          `json:"last_task,omitempty"`
+}
+
+// Submitter queues a task, normally tasks.Manager.Submit.
+type Submitter func(tasks.Task) error
+
+// Scheduler fires entries into the task queue. Entries live in DataDir so
+// they keep running while the control plane is unreachable; results queue
+// up with the other task results until they can be reported. Runs missed
+// while the agent was stopped are skipped, not caught up.
+type Scheduler struct {
+	path   string
+	submit Submitter
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	entries []Entry
+	crons   map[string]*Cron
+	next    map[string]time.Time
+}
+
+func NewScheduler(dir string, submit Submitter, logger *logrus.Entry) (*Scheduler, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+
+	s := &Scheduler{
+		path:   filepath.Join(dir, "schedules.json"),
+		submit: submit,
+		logger: logger.WithField("component", "scheduler"),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	var entries []Entry
+	if err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse schedules: %w", err)
+		}
+	}
+	if err := s.load(entries); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load compiles entries and makes them current. Callers hold mu, or own s
+// exclusively.
+func (s *Scheduler) load(entries []Entry) error {
+	crons := make(map[string]*Cron, len(entries))
+	for _, e := range entries {
+		if e.ID == "" || e.Type == "" {
+			return fmt.Errorf("schedule needs an id and a task type")
+		}
+		if _, dup := crons[e.ID]; dup {
+			return fmt.Errorf("duplicate schedule id %q", e.ID)
+		}
+		c, err := ParseCron(e.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", e.ID, err)
+		}
+		crons[e.ID] = c
+	}
+
+	now := time.Now()
+	s.entries = entries
+	s.crons = crons
+	s.next = make(map[string]time.Time, len(crons))
+	for id, c := range crons {
+		s.next[id] = c.Next(now)
+	}
+	return nil
+}
+
+// SetEntries replaces every schedule, keeping the last run of entries that
+// are still present.
+func (s *Scheduler) SetEntries(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make(map[string]Entry, len(s.entries))
+	for _, e := range s.entries {
+		previous[e.ID] = e
+	}
+	entries = append([]Entry(nil), entries...)
+	for i := range entries {
+		if old, ok := previous[entries[i].ID]; ok && entries[i].LastRun.IsZero() {
+			entries[i].LastRun = old.LastRun
+			entries[i].LastTask = old.LastTask
+		}
+	}
+
+	if err := s.load(entries); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Entries returns the schedules along with when each fires next.
+func (s *Scheduler) Entries() []EntryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]EntryStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, EntryStatus{Entry: e, NextRun: s.next[e.ID]})
+	}
+	return out
+}
+
+type EntryStatus struct {
+	Entry
+	NextRun time.Time `json:"next_run,omitempty"`
+}
+
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Start checks for due entries until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.fire(now)
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) fire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fired := false
+	for i := range s.entries {
+		e := &s.entries[i]
+		next := s.next[e.ID]
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+		s.next[e.ID] = s.crons[e.ID].Next(now)
+
+		// The run time makes the ID stable, so a fire can't queue twice.
+		task := tasks.Task{
+			ID:      fmt.Sprintf("schedule-%s-%d", e.ID, next.Unix()),
+			Type:    e.Type,
+			Timeout: e.Timeout,
+			Payload: e.Payload,
+
+			RequestedBy: "schedule:" + e.ID,
+		}
+		logger := s.logger.WithFields(logrus.Fields{"schedule": e.ID, "task_id": task.ID})
+		if err := s.submit(task); err != nil {
+			logger.WithError(err).Warn("Failed to queue scheduled task")
+			continue
+		}
+		logger.Debug("Queued scheduled task")
+
+		e.LastRun = now.UTC()
+		e.LastTask = task.ID
+		fired = true
+	}
+
+	if fired {
+		if err := s.save(); err != nil {
+			s.logger.WithError(err).Warn("Failed to save schedules")
+		}
+	}
+}
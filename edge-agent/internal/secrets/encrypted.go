@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const machineIDPath = "/etc/machine-id"
+
+// encryptedStore is a fileStore whose values are sealed with AES-GCM under a
+// key derived from the machine ID. It doesn't stop root on the node, but a
+// copied file or disk image is useless on any other machine.
+type encryptedStore struct {
+	file fileStore
+	key  []byte
+}
+
+func machineKey() ([]byte, error) {
+	id, err := os.ReadFile(machineIDPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine id: %w", err)
+	}
+	if strings.TrimSpace(string(id)) == "" {
+		return nil, fmt.Errorf("%s is empty", machineIDPath)
+	}
+	sum := sha256.Sum256(append([]byte("edge-agent secrets\x00"), strings.TrimSpace(string(id))...))
+	return sum[:], nil
+}
+
+func (e *encryptedStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(e.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptedStore) Get(name string) (string, error) {
+	sealed, err := e.file.Get(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret %s: %w", name, err)
+	}
+	aead, err := e.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is truncated", name)
+	}
+	// The name is authenticated so values can't be swapped between keys.
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s, was the file copied from another machine?", name)
+	}
+	return string(plain), nil
+}
+
+func (e *encryptedStore) Set(name, value string) error {
+	// Sealing again would always change the file, so compare first.
+	if current, err := e.Get(name); err == nil && current == value {
+		return nil
+	}
+	aead, err := e.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return e.file.Set(name, base64.StdEncoding.EncodeToString(sealed))
+}
+
+func (e *encryptedStore) Delete(name string) error {
+	return e.file.Delete(name)
+}
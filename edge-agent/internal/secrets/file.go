@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileStore keeps secrets as a JSON object in a file only root can read.
+type fileStore struct {
+	path string
+}
+
+func (f *fileStore) read() (map[string]string, error) {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// Like ssh with private keys, refuse a file others could have read.
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s is accessible by other users (mode %04o), expected 0600", f.path, info.Mode().Perm())
+	}
+
+	values := make(map[string]string)
+	if err := json.NewDecoder(file).Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	return values, nil
+}
+
+func (f *fileStore) write(values map[string]string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func (f *fileStore) Get(name string) (string, error) {
+	values, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (f *fileStore) Set(name, value string) error {
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+	if values[name] == value {
+		return nil
+	}
+	values[name] = value
+	return f.write(values)
+}
+
+func (f *fileStore) Delete(name string) error {
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return nil
+	}
+	delete(values, name)
+	return f.write(values)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package secrets
+
+import "fmt"
+
+// The kernel keyring is Linux-only; elsewhere use the file or encrypted
+// backend.
+func newKeyring() (Store, error) {
+	return nil, fmt.Errorf("the %s secrets backend is only available on Linux", BackendKeyring)
+}
@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	BackendConfig    = "config"    // plaintext in the main config file
+	BackendFile      = "file"      // separate root-only file
+	BackendKeyring   = "keyring"   // Linux kernel keyring
+	BackendEncrypted = "encrypted" // file encrypted with a machine-derived key
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps credentials out of the main config file, which tends to get
+// copied into support tickets and config management.
+type Store interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// Open returns the store for a backend. The config backend has no store;
+// Open returns nil for it.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendConfig:
+		return nil, nil
+	case BackendFile:
+		return &fileStore{path: path}, nil
+	case BackendKeyring:
+		return newKeyring()
+	case BackendEncrypted:
+		key, err := machineKey()
+		if err != nil {
+			return nil, err
+		}
+		return &encryptedStore{file: fileStore{path: path}, key: key}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", backend)
+	}
+}
@@ -0,0 +1,142 @@
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	openRCInitDir = "/etc/init.d"
+	openRCConfDir = "/etc/conf.d"
+	openRCLogDir  = "/var/log"
+)
+
+// openRC drives Alpine and Gentoo style init. Services log to
+// /var/log/<name>.log, the convention Alpine's own packages follow.
+type openRC struct{}
+
+func (openRC) Kind() string { return KindOpenRC }
+
+func (openRC) Start(ctx context.Context, name string) error {
+	return run(ctx, "rc-service", shortName(name), "start")
+}
+
+func (openRC) Stop(ctx context.Context, name string) error {
+	return run(ctx, "rc-service", shortName(name), "stop")
+}
+
+func (openRC) Restart(ctx context.Context, name string) error {
+	return run(ctx, "rc-service", shortName(name), "restart")
+}
+
+func (openRC) Reload(ctx context.Context, name string) error {
+	return run(ctx, "rc-service", shortName(name), "reload")
+}
+
+func (openRC) Enable(ctx context.Context, name string) error {
+	return run(ctx, "rc-update", "add", shortName(name), "default")
+}
+
+func (openRC) Disable(ctx context.Context, name string) error {
+	return run(ctx, "rc-update", "del", shortName(name), "default")
+}
+
+func (openRC) IsActive(name string) bool {
+	return exec.Command("rc-service", shortName(name), "status").Run() == nil
+}
+
+// RestartDetached runs the restart in its own session, so it survives the
+// service it's restarting.
+func (openRC) RestartDetached(name string) error {
+	cmd := exec.Command("rc-service", shortName(name), "restart")
+	cmd.SysProcAttr = detachedProcess()
+	return cmd.Start()
+}
+
+func (openRC) StopDetached(name string) error {
+	cmd := exec.Command("rc-service", shortName(name), "stop")
+	cmd.SysProcAttr = detachedProcess()
+	return cmd.Start()
+}
+
+// Install writes an init script run under supervise-daemon, which restarts
+// the service when it exits like systemd's Restart=on-failure.
+func (openRC) Install(def Definition) error {
+	name := shortName(def.Name)
+	logPath := filepath.Join(openRCLogDir, name+".log")
+
+	var b strings.Builder
+	b.WriteString("#!/sbin/openrc-run\n\n")
+	fmt.Fprintf(&b, "description=%q\n", def.Description)
+	fmt.Fprintf(&b, "command=%q\n", def.Command)
+	fmt.Fprintf(&b, "command_args=%q\n", strings.Join(def.Args, " "))
+	b.WriteString("supervisor=supervise-daemon\nrespawn_delay=5\nrespawn_max=30\nrespawn_period=180\n")
+	if def.WorkingDir != "" {
+		fmt.Fprintf(&b, "directory=%q\n", def.WorkingDir)
+	}
+	if def.OpenFiles > 0 {
+		fmt.Fprintf(&b, "rc_ulimit=\"-n %d\"\n", def.OpenFiles)
+	}
+	fmt.Fprintf(&b, "output_log=%q\nerror_log=%q\n", logPath, logPath)
+	if len(def.Requires) > 0 {
+		deps := make([]string, len(def.Requires))
+		for i, dep := range def.Requires {
+			deps[i] = shortName(dep)
+		}
+		fmt.Fprintf(&b, "\ndepend() {\n\tneed %s\n\tafter %s\n}\n", strings.Join(deps, " "), strings.Join(deps, " "))
+	}
+
+	return os.WriteFile(filepath.Join(openRCInitDir, name), []byte(b.String()), 0755)
+}
+
+func (openRC) DefinitionPath(name string) (string, error) {
+	path := filepath.Join(openRCInitDir, shortName(name))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (openRC) Remove(name string) error {
+	return os.RemoveAll(filepath.Join(openRCInitDir, shortName(name)))
+}
+
+// SetFileLimit sets rc_ulimit in the service's conf.d file, which
+// openrc-run applies before starting it. Other settings there are kept.
+func (openRC) SetFileLimit(ctx context.Context, name string, limit int) error {
+	path := filepath.Join(openRCConfDir, shortName(name))
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line != "" && !strings.HasPrefix(strings.TrimSpace(line), "rc_ulimit=") {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, fmt.Sprintf(`rc_ulimit="-n %d"`, limit))
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func (openRC) Logs(ctx context.Context, name string, lines int) (string, error) {
+	out, err := exec.CommandContext(ctx, "tail", "-n", fmt.Sprint(lines), filepath.Join(openRCLogDir, shortName(name)+".log")).CombinedOutput()
+	return string(out), err
+}
+
+func (openRC) Status(ctx context.Context, names ...string) (string, error) {
+	var b strings.Builder
+	for _, name := range names {
+		out, _ := exec.CommandContext(ctx, "rc-service", shortName(name), "status").CombinedOutput()
+		fmt.Fprintf(&b, "%s: %s\n", shortName(name), strings.TrimSpace(string(out)))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detect follows sd_booted(3): /run/systemd/system exists only when
+// systemd is PID 1, which tells a systemd host from one that merely has
+// systemctl installed.
+func detect() string {
+	if info, err := os.Stat("/run/systemd/system"); err == nil && info.IsDir() {
+		return KindSystemd
+	}
+	if _, err := exec.LookPath("openrc-run"); err == nil {
+		return KindOpenRC
+	}
+	if _, err := os.Stat("/sbin/openrc-run"); err == nil {
+		return KindOpenRC
+	}
+	return KindSystemd
+}
+
+func newPlatform(kind string) (Manager, error) {
+	switch kind {
+	case KindSystemd:
+		return systemd{}, nil
+	case KindOpenRC:
+		return openRC{}, nil
+	}
+	return nil, fmt.Errorf("service manager %q is not available on this platform", kind)
+}
+
+func detachedProcess() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
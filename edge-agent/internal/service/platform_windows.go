@@ -0,0 +1,16 @@
+//go:build windows
+
+package service
+
+import "fmt"
+
+func detect() string {
+	return KindWindows
+}
+
+func newPlatform(kind string) (Manager, error) {
+	if kind == KindWindows {
+		return windowsServices{}, nil
+	}
+	return nil, fmt.Errorf("service manager %q is not available on this platform", kind)
+}
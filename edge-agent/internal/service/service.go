@@ -0,0 +1,112 @@
+// Package service controls system services through whichever init system
+// the node runs, so the rest of the agent doesn't hard-code systemctl.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Init systems a Manager can drive.
+const (
+	KindSystemd = "systemd"
+	KindOpenRC  = "openrc"
+	KindWindows = "windows"
+)
+
+// ErrUnsupported is returned for operations the init system has no
+// equivalent for, e.g. reload on Windows.
+var ErrUnsupported = errors.New("not supported by this service manager")
+
+// Definition describes a long-running service for Install. Names are as in
+// the config, e.g. wings.service; managers that don't use the suffix drop
+// it.
+type Definition struct {
+	Name        string
+	Description string
+	Command     string // absolute path of the binary
+	Args        []string
+	WorkingDir  string
+	Requires    []string // services this one needs, and restarts along with
+	OpenFiles   int      // file descriptor limit, 0 keeps the default
+	PIDFile     string   // written by the service itself, if it does
+}
+
+// Manager controls services on the host.
+type Manager interface {
+	Kind() string
+
+	Start(ctx context.Context, name string) error
+	Stop(ctx context.Context, name string) error
+	Restart(ctx context.Context, name string) error
+	Reload(ctx context.Context, name string) error
+	Enable(ctx context.Context, name string) error
+	Disable(ctx context.Context, name string) error
+	IsActive(name string) bool
+
+	// RestartDetached asks for a restart without waiting for it, for a
+	// service restarting itself.
+	RestartDetached(name string) error
+	// StopDetached asks for a stop without waiting for it, for a service
+	// stopping itself for good. Unlike exiting, it keeps the init system
+	// from restarting the service.
+	StopDetached(name string) error
+
+	// Install writes the definition and makes it known to the init system.
+	// It doesn't enable or start the service.
+	Install(def Definition) error
+	// DefinitionPath is where the service is defined, or empty when it
+	// isn't installed.
+	DefinitionPath(name string) (string, error)
+	// Remove deletes the definition of a stopped service.
+	Remove(name string) error
+	// SetFileLimit overrides the service's open file limit without
+	// touching its definition. It applies from the next restart.
+	SetFileLimit(ctx context.Context, name string, limit int) error
+
+	// Logs returns the service's most recent output.
+	Logs(ctx context.Context, name string, lines int) (string, error)
+	// Status is a human-readable summary of the services, for support
+	// bundles.
+	Status(ctx context.Context, names ...string) (string, error)
+}
+
+// New returns the manager for kind, or the detected one for "" or "auto".
+func New(kind string) (Manager, error) {
+	if kind == "" || kind == "auto" {
+		kind = detect()
+	}
+	return newPlatform(kind)
+}
+
+// StartCommand is what an operator would type to start the service.
+func StartCommand(m Manager, name string) string {
+	switch m.Kind() {
+	case KindOpenRC:
+		return "rc-service " + shortName(name) + " start"
+	case KindWindows:
+		return "Start-Service " + shortName(name)
+	default:
+		return "systemctl start " + name
+	}
+}
+
+// shortName drops systemd's unit suffix for init systems without one.
+func shortName(name string) string {
+	return strings.TrimSuffix(name, ".service")
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	if out, err := exec.CommandContext(ctx, name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed: %s", name, strings.Join(args, " "), lastLine(out))
+	}
+	return nil
+}
+
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,138 @@
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+
+type systemd struct{}
+
+func (systemd) Kind() string { return KindSystemd }
+
+func (systemd) Start(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "start", name)
+}
+
+func (systemd) Stop(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "stop", name)
+}
+
+func (systemd) Restart(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "restart", name)
+}
+
+func (systemd) Reload(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "reload", name)
+}
+
+func (systemd) Enable(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "enable", name)
+}
+
+func (systemd) Disable(ctx context.Context, name string) error {
+	return run(ctx, "systemctl", "disable", name)
+}
+
+func (systemd) IsActive(name string) bool {
+	return exec.Command("systemctl", "is-active", "--quiet", name).Run() == nil
+}
+
+func (systemd) RestartDetached(name string) error {
+	return exec.Command("systemctl", "restart", "--no-block", name).Start()
+}
+
+// StopDetached waits for systemctl, which returns once the stop job is
+// queued, so the service can exit without being restarted.
+func (systemd) StopDetached(name string) error {
+	return exec.Command("systemctl", "stop", "--no-block", name).Run()
+}
+
+func (systemd) Install(def Definition) error {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", def.Description)
+	for _, dep := range def.Requires {
+		if !strings.Contains(dep, ".") {
+			dep += ".service"
+		}
+		fmt.Fprintf(&b, "After=%s\nRequires=%s\nPartOf=%s\n", dep, dep, dep)
+	}
+	b.WriteString("\n[Service]\nUser=root\n")
+	if def.WorkingDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", def.WorkingDir)
+	}
+	if def.OpenFiles > 0 {
+		fmt.Fprintf(&b, "LimitNOFILE=%d\n", def.OpenFiles)
+	}
+	if def.PIDFile != "" {
+		fmt.Fprintf(&b, "PIDFile=%s\n", def.PIDFile)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(append([]string{def.Command}, def.Args...), " "))
+	b.WriteString("Restart=on-failure\nStartLimitInterval=180\nStartLimitBurst=30\nRestartSec=5s\n")
+	b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+
+	if err := os.WriteFile(filepath.Join(systemdUnitDir, def.Name), []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return run(context.Background(), "systemctl", "daemon-reload")
+}
+
+// DefinitionPath is where systemd loaded the unit from, /etc/systemd/system
+// or a packaged location.
+func (systemd) DefinitionPath(name string) (string, error) {
+	out, err := exec.Command("systemctl", "show", "-p", "FragmentPath", "--value", name).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (s systemd) Remove(name string) error {
+	path, err := s.DefinitionPath(name)
+	if err != nil || path == "" {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return run(context.Background(), "systemctl", "daemon-reload")
+}
+
+// SetFileLimit writes a drop-in, so packaged units and ones the agent
+// installed are overridden the same way and package upgrades keep it.
+func (systemd) SetFileLimit(ctx context.Context, name string, limit int) error {
+	dir := filepath.Join(systemdUnitDir, name+".d")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("# Written by the edge agent\n[Service]\nLimitNOFILE=%d\n", limit)
+	if err := os.WriteFile(filepath.Join(dir, "limits.conf"), []byte(content), 0644); err != nil {
+		return err
+	}
+	return run(ctx, "systemctl", "daemon-reload")
+}
+
+func (systemd) Logs(ctx context.Context, name string, lines int) (string, error) {
+	out, err := exec.CommandContext(ctx, "journalctl", "-u", name, "-n", strconv.Itoa(lines), "--no-pager", "-o", "short-iso").CombinedOutput()
+	return string(out), err
+}
+
+func (systemd) Status(ctx context.Context, names ...string) (string, error) {
+	args := append([]string{"status", "--no-pager", "-n", "0"}, names...)
+	out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	// status exits non-zero when any unit is inactive, the output still
+	// says why.
+	if len(out) > 0 {
+		err = nil
+	}
+	return string(out), err
+}
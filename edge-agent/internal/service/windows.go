@@ -0,0 +1,115 @@
+//go:build windows
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// windowsServices drives the Service Control Manager. sc.exe changes
+// configuration; starting and stopping go through PowerShell, whose
+// cmdlets wait for the service to settle where sc.exe returns while it's
+// still pending.
+type windowsServices struct{}
+
+func (windowsServices) Kind() string { return KindWindows }
+
+func powershell(ctx context.Context, cmdlet, name string) error {
+	return run(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", fmt.Sprintf("%s -Name '%s'", cmdlet, shortName(name)))
+}
+
+func (windowsServices) Start(ctx context.Context, name string) error {
+	return powershell(ctx, "Start-Service", name)
+}
+
+func (windowsServices) Stop(ctx context.Context, name string) error {
+	return powershell(ctx, "Stop-Service", name)
+}
+
+func (windowsServices) Restart(ctx context.Context, name string) error {
+	return powershell(ctx, "Restart-Service", name)
+}
+
+func (windowsServices) Reload(ctx context.Context, name string) error {
+	return ErrUnsupported
+}
+
+func (windowsServices) Enable(ctx context.Context, name string) error {
+	return run(ctx, "sc.exe", "config", shortName(name), "start=", "auto")
+}
+
+func (windowsServices) Disable(ctx context.Context, name string) error {
+	return run(ctx, "sc.exe", "config", shortName(name), "start=", "disabled")
+}
+
+func (windowsServices) IsActive(name string) bool {
+	out, err := exec.Command("sc.exe", "query", shortName(name)).Output()
+	return err == nil && strings.Contains(string(out), "RUNNING")
+}
+
+func (windowsServices) RestartDetached(name string) error {
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", fmt.Sprintf("Restart-Service -Name '%s'", shortName(name))).Start()
+}
+
+func (windowsServices) StopDetached(name string) error {
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", fmt.Sprintf("Stop-Service -Name '%s'", shortName(name))).Start()
+}
+
+// Install registers the service with the SCM. Requires become service
+// dependencies; the file descriptor limit has no Windows equivalent.
+func (windowsServices) Install(def Definition) error {
+	binPath := def.Command
+	if strings.Contains(binPath, " ") {
+		binPath = `"` + binPath + `"`
+	}
+	if len(def.Args) > 0 {
+		binPath += " " + strings.Join(def.Args, " ")
+	}
+	args := []string{"create", shortName(def.Name), "binPath=", binPath, "start=", "demand", "DisplayName=", def.Description}
+	if len(def.Requires) > 0 {
+		deps := make([]string, len(def.Requires))
+		for i, dep := range def.Requires {
+			deps[i] = shortName(dep)
+		}
+		args = append(args, "depend=", strings.Join(deps, "/"))
+	}
+	if err := run(context.Background(), "sc.exe", args...); err != nil {
+		return err
+	}
+	// Restart after 5 seconds on failure, like the other init systems.
+	return run(context.Background(), "sc.exe", "failure", shortName(def.Name), "reset=", "180", "actions=", "restart/5000")
+}
+
+func (windowsServices) DefinitionPath(name string) (string, error) {
+	if err := exec.Command("sc.exe", "query", shortName(name)).Run(); err != nil {
+		return "", nil
+	}
+	return `HKLM\SYSTEM\CurrentControlSet\Services\` + shortName(name), nil
+}
+
+func (windowsServices) Remove(name string) error {
+	return run(context.Background(), "sc.exe", "delete", shortName(name))
+}
+
+// SetFileLimit has no equivalent: Windows has no per-service handle limit.
+func (windowsServices) SetFileLimit(ctx context.Context, name string, limit int) error {
+	return ErrUnsupported
+}
+
+// Logs isn't available: services write to the event log under their own
+// sources, with no per-service file to tail.
+func (windowsServices) Logs(ctx context.Context, name string, lines int) (string, error) {
+	return "", ErrUnsupported
+}
+
+func (windowsServices) Status(ctx context.Context, names ...string) (string, error) {
+	var b strings.Builder
+	for _, name := range names {
+		out, _ := exec.CommandContext(ctx, "sc.exe", "query", shortName(name)).CombinedOutput()
+		b.Write(out)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,241 @@
+package shaping
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rootHandle    = "1:"
+	transferClass = "1:10"
+
+	// tc wants one protocol per filter priority.
+	filterPrioV4 = "10"
+	filterPrioV6 = "11"
+)
+
+// Transfer is an outgoing Wings server transfer to shape.
+type Transfer struct {
+	ID        string    `json:"transfer_id"`
+	Remote    string    `json:"remote"` // destination node address
+	Port      int       `json:"port"`   // destination Wings API port
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Status is reported in heartbeats while transfers are shaped.
+type Status struct {
+	Interface string     `json:"interface"`
+	RateMbit  int        `json:"rate_mbit"` // 0 means unlimited
+	Transfers []Transfer `json:"transfers"`
+}
+
+// Shaper limits the bandwidth of server transfers leaving the node with an
+// HTB class on the uplink. All transfers share one class, so the limit is
+// for migrations as a whole. Traffic that matches no filter bypasses HTB,
+// so game servers are unaffected. The root qdisc is only replaced while a
+// transfer is running and removed again afterwards.
+type Shaper struct {
+	cfg    config.TransfersConfig
+	iface  string
+	logger *logrus.Entry
+
+	mu        sync.Mutex
+	transfers map[string]Transfer
+	installed bool
+	rate      int
+	dirty     bool // transfers changed since the filters were written
+}
+
+func New(cfg config.TransfersConfig, iface string, logger *logrus.Entry) *Shaper {
+	return &Shaper{
+		cfg:       cfg,
+		iface:     iface,
+		logger:    logger.WithFields(logrus.Fields{"component": "shaping", "interface": iface}),
+		transfers: make(map[string]Transfer),
+	}
+}
+
+// RateAt returns the transfer limit in Mbit/s for the given local time.
+// The first matching window wins; windows may wrap past midnight.
+func RateAt(cfg config.TransfersConfig, now time.Time) int {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range cfg.Windows {
+		from, err1 := parseClock(w.From)
+		to, err2 := parseClock(w.To)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		inWindow := minute >= from && minute < to
+		if from > to {
+			inWindow = minute >= from || minute < to
+		}
+		if inWindow {
+			return w.RateMbit
+		}
+	}
+	return cfg.RateMbit
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Begin starts shaping traffic to a transfer's destination.
+func (s *Shaper) Begin(t Transfer) error {
+	ip := net.ParseIP(t.Remote)
+	if ip == nil {
+		addrs, err := net.LookupIP(t.Remote)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("failed to resolve %s: %v", t.Remote, err)
+		}
+		ip = addrs[0]
+	}
+	t.Remote = ip.String()
+	if t.Port <= 0 || t.Port > 65535 {
+		return fmt.Errorf("invalid port %d", t.Port)
+	}
+	if t.StartedAt.IsZero() {
+		t.StartedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transfers[t.ID] = t
+	s.dirty = true
+	s.logger.WithFields(logrus.Fields{"transfer_id": t.ID, "remote": t.Remote}).Info("Shaping server transfer")
+	return s.apply(time.Now())
+}
+
+// End stops shaping a transfer. Ending an unknown transfer is not an error.
+func (s *Shaper) End(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.transfers[id]; !ok {
+		return nil
+	}
+	delete(s.transfers, id)
+	s.dirty = true
+	return s.apply(time.Now())
+}
+
+// Tick follows the time-of-day schedule and forgets transfers that were
+// never ended. Call it about once a minute.
+func (s *Shaper) Tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxAge := time.Duration(s.cfg.MaxDuration) * time.Second
+	for id, t := range s.transfers {
+		if now.Sub(t.StartedAt) > maxAge {
+			s.logger.WithField("transfer_id", id).Warn("Transfer shaping expired without an end")
+			delete(s.transfers, id)
+			s.dirty = true
+		}
+	}
+
+	if err := s.apply(now); err != nil {
+		s.logger.WithError(err).Warn("Failed to update transfer shaping")
+	}
+}
+
+// Status returns nil when nothing is being shaped.
+func (s *Shaper) Status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.transfers) == 0 {
+		return nil
+	}
+	status := &Status{Interface: s.iface, RateMbit: s.rate}
+	for _, t := range s.transfers {
+		status.Transfers = append(status.Transfers, t)
+	}
+	return status
+}
+
+// Clear removes any shaping, e.g. on shutdown.
+func (s *Shaper) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transfers = make(map[string]Transfer)
+	if err := s.apply(time.Now()); err != nil {
+		s.logger.WithError(err).Warn("Failed to remove transfer shaping")
+	}
+}
+
+// apply brings tc in line with the active transfers and the current rate.
+// Callers hold mu.
+func (s *Shaper) apply(now time.Time) error {
+	rate := RateAt(s.cfg, now)
+	if len(s.transfers) == 0 || rate == 0 {
+		s.rate = rate
+		if !s.installed {
+			return nil
+		}
+		s.installed = false
+		return tc("qdisc", "del", "dev", s.iface, "root")
+	}
+
+	if !s.installed {
+		if err := tc("qdisc", "replace", "dev", s.iface, "root", "handle", rootHandle, "htb"); err != nil {
+			return err
+		}
+		s.installed = true
+		s.rate = 0
+		s.dirty = true
+	}
+	if rate != s.rate {
+		r := strconv.Itoa(rate) + "mbit"
+		if err := tc("class", "replace", "dev", s.iface, "parent", rootHandle, "classid", transferClass, "htb", "rate", r, "ceil", r); err != nil {
+			return err
+		}
+		s.logger.WithField("rate_mbit", rate).Info("Transfer bandwidth limit set")
+		s.rate = rate
+	}
+
+	if !s.dirty {
+		return nil
+	}
+	// Filters are cheap to rebuild and this avoids tracking their handles.
+	tc("filter", "del", "dev", s.iface, "parent", rootHandle, "prio", filterPrioV4)
+	tc("filter", "del", "dev", s.iface, "parent", rootHandle, "prio", filterPrioV6)
+	for _, t := range s.transfers {
+		args := []string{"filter", "add", "dev", s.iface, "parent", rootHandle}
+		port := strconv.Itoa(t.Port)
+		if ip := net.ParseIP(t.Remote); ip.To4() != nil {
+			args = append(args, "prio", filterPrioV4, "protocol", "ip", "u32",
+				"match", "ip", "dst", t.Remote+"/32", "match", "ip", "dport", port, "0xffff")
+		} else {
+			args = append(args, "prio", filterPrioV6, "protocol", "ipv6", "u32",
+				"match", "ip6", "dst", t.Remote+"/128", "match", "ip6", "dport", port, "0xffff")
+		}
+		args = append(args, "flowid", transferClass)
+		if err := tc(args...); err != nil {
+			return err
+		}
+	}
+	s.dirty = false
+	return nil
+}
+
+func tc(args ...string) error {
+	if out, err := exec.Command("tc", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("tc %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
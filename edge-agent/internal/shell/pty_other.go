@@ -0,0 +1,23 @@
+//go:build !linux
+
+package shell
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+)
+
+// Remote shells need a Linux pseudo-terminal.
+func startPTY(cmd *exec.Cmd, account *user.User, rows, cols uint16) (*os.File, error) {
+	return nil, errors.New("remote shells are only supported on Linux")
+}
+
+func setSize(master *os.File, rows, cols uint16) error {
+	return nil
+}
+
+func killGroup(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,385 @@
+// Package shell runs interactive terminal sessions opened from the control
+// plane. Every session is recorded to disk in asciicast format and audited;
+// sessions nobody types into are closed after the idle timeout.
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Request opens a session.
+type Request struct {
+	SessionID string `json:"session_id"`
+	User      string `json:"user"` // control plane user opening it, checked against shell.users
+	Rows      uint16 `json:"rows"`
+	Cols      uint16 `json:"cols"`
+}
+
+// Output is terminal output for the control plane. Data is base64 in JSON.
+// The last message for a session has Closed set.
+type Output struct {
+	SessionID string `json:"session_id"`
+	Data      []byte `json:"data,omitempty"`
+	Closed    bool   `json:"closed,omitempty"`
+	Reason    string `json:"reason,omitempty"` // exited, idle, closed, disconnected or agent_stopping
+	ExitCode  *int   `json:"exit_code,omitempty"`
+}
+
+// Sender delivers output, normally over the command channel.
+type Sender func(Output) error
+
+// Auditor records session starts and ends, normally as agent events.
+type Auditor func(eventType string, data interface{})
+
+// SessionInfo describes a session for audit events and listings.
+type SessionInfo struct {
+	SessionID string    `json:"session_id"`
+	User      string    `json:"user"`
+	RunAs     string    `json:"run_as"`
+	StartedAt time.Time `json:"started_at"`
+	Recording string    `json:"recording"`
+}
+
+type session struct {
+	info     SessionInfo
+	cmd      *exec.Cmd
+	pty      *os.File
+	recorder *recorder
+
+	mu        sync.Mutex
+	lastInput time.Time
+	reason    string
+}
+
+// Manager runs the sessions allowed by the config.
+type Manager struct {
+	cfg    config.ShellConfig
+	dir    string
+	send   Sender
+	audit  Auditor
+	logger *logrus.Entry
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func New(cfg config.ShellConfig, dir string, send Sender, audit Auditor, logger *logrus.Entry) *Manager {
+	return &Manager{
+		cfg:      cfg,
+		dir:      dir,
+		send:     send,
+		audit:    audit,
+		logger:   logger.WithField("component", "shell"),
+		sessions: make(map[string]*session),
+	}
+}
+
+func (m *Manager) allowed(name string) bool {
+	for _, u := range m.cfg.Users {
+		if u == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Open starts a shell. Sessions are tied to ctx, normally the agent's, not
+// to the command that opened them.
+func (m *Manager) Open(ctx context.Context, req Request) (SessionInfo, error) {
+	if req.SessionID == "" || strings.ContainsAny(req.SessionID, `/\`) {
+		return SessionInfo{}, fmt.Errorf("invalid session id %q", req.SessionID)
+	}
+	if req.User == "" || !m.allowed(req.User) {
+		return SessionInfo{}, fmt.Errorf("user %q may not open a shell on this node", req.User)
+	}
+	if req.Rows == 0 || req.Cols == 0 {
+		req.Rows, req.Cols = 24, 80
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[req.SessionID]; exists {
+		return SessionInfo{}, fmt.Errorf("session %s already open", req.SessionID)
+	}
+	if len(m.sessions) >= m.cfg.MaxSessions {
+		return SessionInfo{}, fmt.Errorf("too many shell sessions open (max %d)", m.cfg.MaxSessions)
+	}
+
+	account, err := user.Lookup(m.cfg.RunAs)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("failed to look up %s: %w", m.cfg.RunAs, err)
+	}
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return SessionInfo{}, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	m.pruneRecordings()
+	recordingPath := filepath.Join(m.dir, req.SessionID+".cast")
+	rec, err := newRecorder(recordingPath, req)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("failed to start recording: %w", err)
+	}
+
+	cmd := exec.Command(m.cfg.Shell, "-l")
+	cmd.Dir = account.HomeDir
+	cmd.Env = []string{
+		"TERM=xterm-256color",
+		"HOME=" + account.HomeDir,
+		"USER=" + account.Username,
+		"LOGNAME=" + account.Username,
+		"SHELL=" + m.cfg.Shell,
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"EDGE_AGENT_SHELL_USER=" + req.User,
+	}
+	pty, err := startPTY(cmd, account, req.Rows, req.Cols)
+	if err != nil {
+		rec.close()
+		os.Remove(recordingPath)
+		return SessionInfo{}, err
+	}
+
+	s := &session{
+		info: SessionInfo{
+			SessionID: req.SessionID,
+			User:      req.User,
+			RunAs:     account.Username,
+			StartedAt: time.Now().UTC(),
+			Recording: recordingPath,
+		},
+		cmd:       cmd,
+		pty:       pty,
+		recorder:  rec,
+		lastInput: time.Now(),
+	}
+	m.sessions[req.SessionID] = s
+
+	m.logger.WithFields(logrus.Fields{"session_id": req.SessionID, "user": req.User, "run_as": account.Username}).Info("Shell session opened")
+	m.audit("shell_session_opened", s.info)
+
+	go m.pump(s)
+	go m.watch(ctx, s)
+	return s.info, nil
+}
+
+// Input writes keystrokes to a session. They're only recorded with
+// record_input on: what's typed at a password prompt never shows in the
+// output, but would in the input.
+func (m *Manager) Input(sessionID string, data []byte) error {
+	s := m.get(sessionID)
+	if s == nil {
+		return fmt.Errorf("no shell session %s", sessionID)
+	}
+	s.mu.Lock()
+	s.lastInput = time.Now()
+	s.mu.Unlock()
+
+	if m.cfg.RecordInput {
+		s.recorder.write("i", data)
+	}
+	_, err := s.pty.Write(data)
+	return err
+}
+
+func (m *Manager) Resize(sessionID string, rows, cols uint16) error {
+	s := m.get(sessionID)
+	if s == nil {
+		return fmt.Errorf("no shell session %s", sessionID)
+	}
+	s.recorder.resize(rows, cols)
+	return setSize(s.pty, rows, cols)
+}
+
+// Close ends a session. The shell's whole process group is killed, so
+// nothing started from it keeps running unattended.
+func (m *Manager) Close(sessionID string) error {
+	s := m.get(sessionID)
+	if s == nil {
+		return fmt.Errorf("no shell session %s", sessionID)
+	}
+	s.terminate("closed")
+	return nil
+}
+
+func (m *Manager) Sessions() []SessionInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]SessionInfo, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		out = append(out, s.info)
+	}
+	return out
+}
+
+func (m *Manager) get(sessionID string) *session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[sessionID]
+}
+
+func (s *session) terminate(reason string) {
+	s.mu.Lock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+	if s.cmd.Process != nil {
+		killGroup(s.cmd.Process)
+	}
+}
+
+// pump copies terminal output to the recording and the control plane until
+// the shell exits. If the output can't be delivered the session is ended
+// rather than left running with nobody watching.
+func (m *Manager) pump(s *session) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			data := append([]byte(nil), buf[:n]...)
+			s.recorder.write("o", data)
+			if sendErr := m.send(Output{SessionID: s.info.SessionID, Data: data}); sendErr != nil {
+				m.logger.WithError(sendErr).WithField("session_id", s.info.SessionID).Warn("Failed to send shell output, closing session")
+				s.terminate("disconnected")
+			}
+		}
+		if err != nil {
+			// EIO once the shell and everything holding the tty is gone.
+			break
+		}
+	}
+
+	waitErr := s.cmd.Wait()
+	s.pty.Close()
+	s.recorder.close()
+
+	m.mu.Lock()
+	delete(m.sessions, s.info.SessionID)
+	m.mu.Unlock()
+
+	s.mu.Lock()
+	reason := s.reason
+	s.mu.Unlock()
+	if reason == "" {
+		reason = "exited"
+	}
+	exitCode := 0
+	if exitErr, ok := waitErr.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	}
+
+	if err := m.send(Output{SessionID: s.info.SessionID, Closed: true, Reason: reason, ExitCode: &exitCode}); err != nil {
+		m.logger.WithError(err).Debug("Failed to send shell close")
+	}
+	m.logger.WithFields(logrus.Fields{"session_id": s.info.SessionID, "reason": reason}).Info("Shell session closed")
+	m.audit("shell_session_closed", map[string]interface{}{
+		"session_id": s.info.SessionID,
+		"user":       s.info.User,
+		"reason":     reason,
+		"exit_code":  exitCode,
+		"duration":   time.Since(s.info.StartedAt).Round(time.Second).String(),
+		"recording":  s.info.Recording,
+	})
+}
+
+// watch closes the session after the idle timeout, or when ctx ends.
+func (m *Manager) watch(ctx context.Context, s *session) {
+	idle := time.Duration(m.cfg.IdleTimeout) * time.Second
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.terminate("agent_stopping")
+			return
+		case <-ticker.C:
+		}
+
+		if m.get(s.info.SessionID) != s {
+			return
+		}
+		s.mu.Lock()
+		quiet := time.Since(s.lastInput)
+		s.mu.Unlock()
+		if quiet >= idle {
+			s.terminate("idle")
+			return
+		}
+	}
+}
+
+// pruneRecordings deletes recordings past the retention period.
+func (m *Manager) pruneRecordings() {
+	if m.cfg.RecordingDays <= 0 {
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(m.dir, "*.cast"))
+	cutoff := time.Now().Add(-time.Duration(m.cfg.RecordingDays) * 24 * time.Hour)
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
+
+// recorder writes an asciicast v2 file: a header line, then one
+// [seconds, "o"|"i"|"r", data] line per event. asciinema can replay it.
+type recorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	started time.Time
+}
+
+func newRecorder(path string, req Request) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{f: f, started: time.Now()}
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     req.Cols,
+		"height":    req.Rows,
+		"timestamp": r.started.Unix(),
+		"title":     "edge agent shell for " + req.User,
+	})
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) write(kind string, data []byte) {
+	line, _ := json.Marshal([]interface{}{time.Since(r.started).Seconds(), kind, string(data)})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.f.Write(append(line, '\n'))
+	}
+}
+
+func (r *recorder) resize(rows, cols uint16) {
+	r.write("r", []byte(fmt.Sprintf("%dx%d", cols, rows)))
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
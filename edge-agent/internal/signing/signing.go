@@ -0,0 +1,151 @@
+// Package signing signs what the agent reports to the control plane with a
+// per-node key. The control plane holds the public half, so a leaked bearer
+// token alone can't be used to forge heartbeats or events.
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// JWK is the public half of a signing key, as registered with the control
+// plane.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// Key is a P-256 signing key. Its ID is the key's JWK thumbprint (RFC 7638).
+type Key struct {
+	ID        string
+	CreatedAt time.Time
+	private   *ecdsa.PrivateKey
+}
+
+// Generate creates a new key.
+func Generate() (*Key, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(private, time.Now().UTC()), nil
+}
+
+func newKey(private *ecdsa.PrivateKey, createdAt time.Time) *Key {
+	k := &Key{CreatedAt: createdAt, private: private}
+	jwk := k.jwk()
+	// The thumbprint covers the required members only, in this order.
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)))
+	k.ID = b64(sum[:])
+	return k
+}
+
+// Load reads a key written by Save. A missing file gives an error
+// satisfying os.IsNotExist.
+func Load(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("%s holds no EC private key", path)
+	}
+	private, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	if private.Curve != elliptic.P256() {
+		return nil, errors.New("signing key is not a P-256 key")
+	}
+	createdAt, _ := time.Parse(time.RFC3339, block.Headers["Created"])
+	return newKey(private, createdAt), nil
+}
+
+// Save writes the key as PEM, readable only by the agent.
+func (k *Key) Save(path string) error {
+	der, err := x509.MarshalECPrivateKey(k.private)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "EC PRIVATE KEY",
+		Headers: map[string]string{"Created": k.CreatedAt.Format(time.RFC3339)},
+		Bytes:   der,
+	})
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return nil
+}
+
+// PublicJWK returns the key's public half.
+func (k *Key) PublicJWK() *JWK {
+	jwk := k.jwk()
+	jwk.Kid = k.ID
+	return &jwk
+}
+
+func (k *Key) jwk() JWK {
+	return JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   b64(k.private.X.FillBytes(make([]byte, 32))),
+		Y:   b64(k.private.Y.FillBytes(make([]byte, 32))),
+		Alg: "ES256",
+		Use: "sig",
+	}
+}
+
+// Sign returns a JWS over payload with the payload left out (RFC 7515,
+// appendix F): "header..signature". The verifier puts the base64url of the
+// request body back in the middle. The protected header carries the key ID
+// and the signing time, so old messages can't be replayed indefinitely.
+func (k *Key) Sign(payload []byte) (string, error) {
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": "ES256",
+		"kid": k.ID,
+		"iat": time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	protected := b64(header)
+	digest := sha256.Sum256([]byte(protected + "." + b64(payload)))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := append(fixed(r), fixed(s)...)
+	return protected + ".." + b64(signature), nil
+}
+
+// fixed encodes a signature half in the 32 bytes ES256 calls for.
+func fixed(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
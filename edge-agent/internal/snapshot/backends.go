@@ -0,0 +1,170 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// zfsBackend snapshots the dataset mounted at the data directory.
+// Rolling back with -r destroys the snapshots taken after the target.
+type zfsBackend struct {
+	dataset string
+}
+
+func (zfsBackend) Name() string { return "zfs" }
+
+func (z zfsBackend) Create(ctx context.Context, name string) (string, error) {
+	ref := z.dataset + "@" + name
+	_, err := run(ctx, "zfs", "snapshot", ref)
+	return ref, err
+}
+
+func (zfsBackend) Rollback(ctx context.Context, ref string) error {
+	_, err := run(ctx, "zfs", "rollback", "-r", ref)
+	return err
+}
+
+func (zfsBackend) Destroy(ctx context.Context, ref string) error {
+	if !strings.Contains(ref, "@") {
+		return fmt.Errorf("refusing to destroy %s, not a snapshot", ref)
+	}
+	_, err := run(ctx, "zfs", "destroy", ref)
+	return err
+}
+
+// btrfsBackend keeps read-only snapshots of the data directory subvolume
+// next to it. A rollback swaps in a writable copy of the snapshot, which
+// needs the subvolume not to be a mount point of its own.
+type btrfsBackend struct {
+	subvolume string
+	dir       string
+}
+
+func newBtrfs(ctx context.Context, path string, mnt mount) (backend, error) {
+	if _, err := run(ctx, "btrfs", "subvolume", "show", path); err != nil {
+		return nil, fmt.Errorf("%s is not a btrfs subvolume: %w", path, err)
+	}
+	if filepath.Clean(path) == filepath.Clean(mnt.Target) {
+		return nil, fmt.Errorf("%s is mounted as its own subvolume and can't be swapped on rollback", path)
+	}
+	clean := filepath.Clean(path)
+	return btrfsBackend{
+		subvolume: clean,
+		dir:       filepath.Join(filepath.Dir(clean), "."+filepath.Base(clean)+"-snapshots"),
+	}, nil
+}
+
+func (btrfsBackend) Name() string { return "btrfs" }
+
+func (b btrfsBackend) Create(ctx context.Context, name string) (string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", err
+	}
+	ref := filepath.Join(b.dir, name)
+	_, err := run(ctx, "btrfs", "subvolume", "snapshot", "-r", b.subvolume, ref)
+	return ref, err
+}
+
+func (b btrfsBackend) Rollback(ctx context.Context, ref string) error {
+	if filepath.Dir(ref) != b.dir {
+		return fmt.Errorf("snapshot %s is not under %s", ref, b.dir)
+	}
+	old := b.subvolume + ".rollback-" + time.Now().UTC().Format("20060102-150405")
+	if err := os.Rename(b.subvolume, old); err != nil {
+		return fmt.Errorf("failed to move the current data aside: %w", err)
+	}
+	if _, err := run(ctx, "btrfs", "subvolume", "snapshot", ref, b.subvolume); err != nil {
+		if restoreErr := os.Rename(old, b.subvolume); restoreErr != nil {
+			return fmt.Errorf("%w (and failed to restore %s: %v)", err, old, restoreErr)
+		}
+		return err
+	}
+	// The data being rolled away from is only dropped once the swap worked.
+	if _, err := run(ctx, "btrfs", "subvolume", "delete", old); err != nil {
+		return fmt.Errorf("rolled back, but failed to delete %s: %w", old, err)
+	}
+	return nil
+}
+
+func (b btrfsBackend) Destroy(ctx context.Context, ref string) error {
+	if filepath.Dir(ref) != b.dir {
+		return fmt.Errorf("refusing to destroy %s, not under %s", ref, b.dir)
+	}
+	_, err := run(ctx, "btrfs", "subvolume", "delete", ref)
+	return err
+}
+
+// lvmBackend snapshots the logical volume under the data directory's
+// filesystem. A rollback merges the snapshot back into its origin, which
+// LVM only does once the origin is unmounted.
+type lvmBackend struct {
+	vg, lv string
+	thin   bool
+	size   string
+	target string
+}
+
+func newLVM(ctx context.Context, mnt mount, size string) (backend, error) {
+	out, err := run(ctx, "lvs", "--noheadings", "--separator", "|", "-o", "vg_name,lv_name,lv_attr", mnt.Source)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a logical volume: %w", mnt.Source, err)
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), "|")
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected lvs output %q", strings.TrimSpace(string(out)))
+	}
+	return lvmBackend{
+		vg:     strings.TrimSpace(fields[0]),
+		lv:     strings.TrimSpace(fields[1]),
+		thin:   strings.HasPrefix(strings.TrimSpace(fields[2]), "V"),
+		size:   size,
+		target: mnt.Target,
+	}, nil
+}
+
+func (lvmBackend) Name() string { return "lvm" }
+
+func (l lvmBackend) Create(ctx context.Context, name string) (string, error) {
+	args := []string{"--snapshot", "--name", name}
+	switch {
+	case l.thin:
+		// Thin snapshots share the pool and take no size.
+	case strings.Contains(l.size, "%"):
+		args = append(args, "--extents", l.size)
+	default:
+		args = append(args, "--size", l.size)
+	}
+	args = append(args, l.vg+"/"+l.lv)
+	if _, err := run(ctx, "lvcreate", args...); err != nil {
+		return "", err
+	}
+	return l.vg + "/" + name, nil
+}
+
+func (l lvmBackend) Rollback(ctx context.Context, ref string) error {
+	if _, err := run(ctx, "umount", l.target); err != nil {
+		return fmt.Errorf("failed to unmount %s for the merge: %w", l.target, err)
+	}
+	_, mergeErr := run(ctx, "lvconvert", "--merge", ref)
+	if l.thin && mergeErr == nil {
+		// Thin merges need the origin reactivated to take effect.
+		run(ctx, "lvchange", "-an", l.vg+"/"+l.lv)
+		run(ctx, "lvchange", "-ay", l.vg+"/"+l.lv)
+	}
+	if _, err := run(ctx, "mount", l.target); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", l.target, err)
+	}
+	return mergeErr
+}
+
+func (l lvmBackend) Destroy(ctx context.Context, ref string) error {
+	if ref == l.vg+"/"+l.lv {
+		return fmt.Errorf("refusing to remove the origin volume %s", ref)
+	}
+	_, err := run(ctx, "lvremove", "--yes", ref)
+	return err
+}
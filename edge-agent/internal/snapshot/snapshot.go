@@ -0,0 +1,291 @@
+// Package snapshot takes filesystem snapshots of the Wings data directory
+// before risky control plane operations, so a botched mass reinstall or
+// migration can be undone by rolling the whole volume back. LVM, ZFS and
+// Btrfs are supported; the backend is detected from the mount.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const namePrefix = "edge-agent-"
+
+// Snapshot is a tracked snapshot. Ref is what the backend needs to find it
+// again: dataset@name for ZFS, vg/lv for LVM, a subvolume path for Btrfs.
+type Snapshot struct {
+	ID          string    `json:"id"`
+	Backend     string    `json:"backend"`
+	Path        string    `json:"path"`
+	Ref         string    `json:"ref"`
+	CreatedAt   time.Time `json:"created_at"`
+	Reason      string    `json:"reason,omitempty"`
+	TaskID      string    `json:"task_id,omitempty"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+}
+
+// mount is the findmnt view of the filesystem holding a path.
+type mount struct {
+	Source string
+	FSType string
+	Target string
+}
+
+type backend interface {
+	Name() string
+	Create(ctx context.Context, name string) (string, error)
+	// Rollback returns the volume to the snapshot. The data directory must
+	// not be in use; the caller stops Docker and Wings first.
+	Rollback(ctx context.Context, ref string) error
+	Destroy(ctx context.Context, ref string) error
+}
+
+// Manager creates snapshots and keeps track of the ones it created.
+type Manager struct {
+	cfg       config.SnapshotsConfig
+	statePath string
+	logger    *logrus.Entry
+
+	mu        sync.Mutex
+	snapshots []Snapshot
+}
+
+func New(cfg config.SnapshotsConfig, dataDir string, logger *logrus.Entry) *Manager {
+	m := &Manager{
+		cfg:       cfg,
+		statePath: filepath.Join(dataDir, "snapshots.json"),
+		logger:    logger.WithField("component", "snapshot"),
+	}
+	if data, err := os.ReadFile(m.statePath); err == nil {
+		json.Unmarshal(data, &m.snapshots)
+	}
+	return m
+}
+
+// Detect reports which backend would snapshot path.
+func (m *Manager) Detect(ctx context.Context, path string) (string, error) {
+	b, err := m.detect(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return b.Name(), nil
+}
+
+func (m *Manager) detect(ctx context.Context, path string) (backend, error) {
+	mnt, err := findMount(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	switch mnt.FSType {
+	case "zfs":
+		return zfsBackend{dataset: mnt.Source}, nil
+	case "btrfs":
+		return newBtrfs(ctx, path, mnt)
+	case "ext4", "ext3", "xfs":
+		return newLVM(ctx, mnt, m.cfg.LVMSize)
+	}
+	return nil, fmt.Errorf("%s is on %s, which can't be snapshotted (needs LVM, ZFS or Btrfs)", path, mnt.FSType)
+}
+
+// List returns the tracked snapshots, oldest first.
+func (m *Manager) List() []Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Snapshot(nil), m.snapshots...)
+}
+
+func (m *Manager) Get(id string) (Snapshot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.snapshots {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// Create snapshots the volume holding path. Snapshots past the configured
+// count or age are destroyed afterwards; an old snapshot on LVM costs
+// write performance and space.
+func (m *Manager) Create(ctx context.Context, path string, s Snapshot) (Snapshot, error) {
+	b, err := m.detect(ctx, path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	s.CreatedAt = time.Now().UTC()
+	s.ID = namePrefix + s.CreatedAt.Format("20060102-150405")
+	s.Backend = b.Name()
+	s.Path = path
+
+	ref, err := b.Create(ctx, s.ID)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to create %s snapshot: %w", b.Name(), err)
+	}
+	s.Ref = ref
+
+	m.mu.Lock()
+	m.snapshots = append(m.snapshots, s)
+	err = m.save()
+	m.mu.Unlock()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to save snapshot state")
+	}
+	m.logger.WithFields(logrus.Fields{"id": s.ID, "backend": s.Backend, "ref": s.Ref}).Info("Created snapshot")
+
+	m.Prune(ctx)
+	return s, nil
+}
+
+// Rollback returns the data directory to the snapshot. Snapshots taken
+// after it no longer match anything and are dropped; ZFS destroys them as
+// part of the rollback, the others are destroyed here.
+func (m *Manager) Rollback(ctx context.Context, id string) error {
+	s, ok := m.Get(id)
+	if !ok {
+		return fmt.Errorf("no snapshot %s", id)
+	}
+	b, err := m.backendFor(ctx, s)
+	if err != nil {
+		return err
+	}
+	if err := b.Rollback(ctx, s.Ref); err != nil {
+		return fmt.Errorf("failed to roll back to %s: %w", id, err)
+	}
+	m.logger.WithFields(logrus.Fields{"id": s.ID, "backend": s.Backend}).Warn("Rolled back Wings data to snapshot")
+
+	var drop []Snapshot
+	m.mu.Lock()
+	kept := m.snapshots[:0]
+	for _, other := range m.snapshots {
+		switch {
+		case other.ID == id && s.Backend == "lvm":
+			// Merging consumes the snapshot.
+		case other.Backend == s.Backend && other.Path == s.Path && other.CreatedAt.After(s.CreatedAt):
+			drop = append(drop, other)
+		default:
+			kept = append(kept, other)
+		}
+	}
+	m.snapshots = kept
+	m.save()
+	m.mu.Unlock()
+
+	if s.Backend != "zfs" {
+		for _, other := range drop {
+			if err := b.Destroy(ctx, other.Ref); err != nil {
+				m.logger.WithError(err).WithField("id", other.ID).Warn("Failed to destroy snapshot newer than the rollback target")
+			}
+		}
+	}
+	return nil
+}
+
+// Delete destroys a snapshot and stops tracking it.
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	s, ok := m.Get(id)
+	if !ok {
+		return fmt.Errorf("no snapshot %s", id)
+	}
+	b, err := m.backendFor(ctx, s)
+	if err != nil {
+		return err
+	}
+	if err := b.Destroy(ctx, s.Ref); err != nil {
+		return fmt.Errorf("failed to destroy snapshot %s: %w", id, err)
+	}
+	m.forget(id)
+	m.logger.WithField("id", id).Info("Deleted snapshot")
+	return nil
+}
+
+// Prune destroys snapshots beyond snapshots.keep or older than
+// snapshots.max_age, oldest first.
+func (m *Manager) Prune(ctx context.Context) []string {
+	list := m.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	var pruned []string
+	for i, s := range list {
+		tooMany := m.cfg.Keep > 0 && len(list)-i > m.cfg.Keep
+		tooOld := m.cfg.MaxAge > 0 && time.Since(s.CreatedAt) > time.Duration(m.cfg.MaxAge)*time.Hour
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := m.Delete(ctx, s.ID); err != nil {
+			m.logger.WithError(err).WithField("id", s.ID).Warn("Failed to prune snapshot")
+			continue
+		}
+		pruned = append(pruned, s.ID)
+	}
+	return pruned
+}
+
+func (m *Manager) backendFor(ctx context.Context, s Snapshot) (backend, error) {
+	b, err := m.detect(ctx, s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if b.Name() != s.Backend {
+		return nil, fmt.Errorf("snapshot %s was taken with %s but %s is now on %s", s.ID, s.Backend, s.Path, b.Name())
+	}
+	return b, nil
+}
+
+func (m *Manager) forget(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, s := range m.snapshots {
+		if s.ID == id {
+			m.snapshots = append(m.snapshots[:i], m.snapshots[i+1:]...)
+			break
+		}
+	}
+	if err := m.save(); err != nil {
+		m.logger.WithError(err).Warn("Failed to save snapshot state")
+	}
+}
+
+// save must be called with mu held.
+func (m *Manager) save() error {
+	data, err := json.Marshal(m.snapshots)
+	if err != nil {
+		return err
+	}
+	tmp := m.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.statePath)
+}
+
+func findMount(ctx context.Context, path string) (mount, error) {
+	out, err := run(ctx, "findmnt", "-n", "-o", "SOURCE,FSTYPE,TARGET", "--target", path)
+	if err != nil {
+		return mount{}, fmt.Errorf("failed to find the mount for %s: %w", path, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return mount{}, fmt.Errorf("unexpected findmnt output %q", strings.TrimSpace(string(out)))
+	}
+	return mount{Source: fields[0], FSType: fields[1], Target: fields[2]}, nil
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
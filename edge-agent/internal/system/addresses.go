@@ -0,0 +1,117 @@
+package system
+
+import (
+	"encoding/json"
+	"net"
+	"os/exec"
+	"sort"
+)
+
+// AddressBlock is a subnet the node has addresses in, which the panel can
+// turn into allocations.
+type AddressBlock struct {
+	CIDR      string   `json:"cidr"` // e.g. 203.0.113.8/29
+	Family    string   `json:"family"`
+	Public    bool     `json:"public"`
+	Interface string   `json:"interface,omitempty"`
+	Routed    bool     `json:"routed,omitempty"` // routed to the node as a whole, every address in it is usable
+	Bound     []string `json:"bound,omitempty"`  // addresses configured on the interface
+}
+
+// AddressBlocks lists the subnets of every address bound to the node, and
+// the blocks routed to it and answered for as a whole with a local route
+// (ip route add local 203.0.113.0/29 dev lo). Addresses on lo and dummy
+// interfaces count, a common home for additional IPs; Docker's bridges and
+// link-local addresses don't.
+func AddressBlocks() ([]AddressBlock, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make(map[string]*AddressBlock)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || isVirtualInterface(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			network := &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+			block := addressBlock(blocks, network, iface.Name)
+			block.Bound = append(block.Bound, ipnet.IP.String())
+		}
+	}
+
+	for _, route := range localRoutes() {
+		_, network, err := net.ParseCIDR(route.Dst)
+		if err != nil || network.IP.IsLoopback() {
+			continue
+		}
+		if ones, bits := network.Mask.Size(); ones == bits {
+			// Every bound address has a host route of its own.
+			continue
+		}
+		addressBlock(blocks, network, route.Dev).Routed = true
+	}
+
+	out := make([]AddressBlock, 0, len(blocks))
+	for _, block := range blocks {
+		sort.Strings(block.Bound)
+		out = append(out, *block)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Family != out[j].Family {
+			return out[i].Family < out[j].Family
+		}
+		return out[i].CIDR < out[j].CIDR
+	})
+	return out, nil
+}
+
+func addressBlock(blocks map[string]*AddressBlock, network *net.IPNet, iface string) *AddressBlock {
+	key := network.String() + " " + iface
+	if block, ok := blocks[key]; ok {
+		return block
+	}
+	family := "ipv6"
+	if network.IP.To4() != nil {
+		family = "ipv4"
+	}
+	block := &AddressBlock{
+		CIDR:      network.String(),
+		Family:    family,
+		Public:    network.IP.IsGlobalUnicast() && !network.IP.IsPrivate(),
+		Interface: iface,
+	}
+	blocks[key] = block
+	return block
+}
+
+type route struct {
+	Dst string `json:"dst"`
+	Dev string `json:"dev"`
+}
+
+// localRoutes reads the local routing table through iproute2. Without it
+// routed blocks just aren't reported.
+func localRoutes() []route {
+	var routes []route
+	for _, family := range []string{"-4", "-6"} {
+		out, err := exec.Command("ip", "-j", family, "route", "show", "table", "local", "type", "local").Output()
+		if err != nil {
+			continue
+		}
+		var parsed []route
+		if json.Unmarshal(out, &parsed) == nil {
+			routes = append(routes, parsed...)
+		}
+	}
+	return routes
+}
@@ -0,0 +1,89 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capabilities are node attributes the control plane can place servers by,
+// detected rather than configured.
+type Capabilities struct {
+	Virtualization string   `json:"virtualization"` // hypervisor, "none" on bare metal
+	KVM            bool     `json:"kvm"`
+	NestedKVM      bool     `json:"nested_kvm"`
+	CPUFlags       []string `json:"cpu_flags"` // of schedulingCPUFlags, those the CPU has
+	Storage        []string `json:"storage"`   // kinds of local disk: nvme, ssd, hdd
+}
+
+// schedulingCPUFlags are the instruction set extensions games and their
+// mods are known to require or run much faster with.
+var schedulingCPUFlags = []string{"sse4_2", "avx", "avx2", "avx512f", "aes", "sha_ni", "asimd"}
+
+var (
+	capsOnce sync.Once
+	capsInfo Capabilities
+)
+
+// DetectCapabilities inspects the node once; none of it changes without a
+// reboot.
+func DetectCapabilities() Capabilities {
+	capsOnce.Do(func() {
+		virt := DetectVirtualization()
+		capsInfo = Capabilities{
+			Virtualization: virt.Hypervisor,
+			KVM:            virt.KVMAvailable,
+			NestedKVM:      virt.NestedKVM,
+			CPUFlags:       []string{},
+			Storage:        storageKinds("/sys/block"),
+		}
+		flags := cpuFlags()
+		for _, f := range schedulingCPUFlags {
+			if flags[f] {
+				capsInfo.CPUFlags = append(capsInfo.CPUFlags, f)
+			}
+		}
+	})
+	return capsInfo
+}
+
+// storageKinds classifies the node's block devices. Virtual devices (loop,
+// device mapper, RAID, zram) are skipped since they sit on the real ones.
+func storageKinds(sysBlock string) []string {
+	kinds := []string{}
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return kinds
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "dm-") || strings.HasPrefix(name, "md") ||
+			strings.HasPrefix(name, "zram") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "sr") {
+			continue
+		}
+
+		kind := "ssd"
+		switch {
+		case strings.HasPrefix(name, "nvme"):
+			kind = "nvme"
+		default:
+			data, err := os.ReadFile(filepath.Join(sysBlock, name, "queue", "rotational"))
+			if err != nil {
+				continue
+			}
+			if strings.TrimSpace(string(data)) == "1" {
+				kind = "hdd"
+			}
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
@@ -0,0 +1,146 @@
+package system
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ntpEpochOffset is the seconds between the NTP epoch, 1900, and Unix's.
+const ntpEpochOffset = 2208988800
+
+// ClockOffset is how far the node's clock is ahead of true time, negative
+// when it's behind, and who measured it.
+type ClockOffset struct {
+	Offset time.Duration
+	Source string // timesyncd, chrony or the SNTP server asked
+}
+
+// MeasureClockOffset takes the offset the local NTP daemon last measured,
+// and asks server over SNTP when no daemon knows it. An empty server or
+// "none" skips the query.
+func MeasureClockOffset(ctx context.Context, server string) (ClockOffset, error) {
+	if offset, ok := timesyncdOffset(); ok {
+		return ClockOffset{Offset: offset, Source: "timesyncd"}, nil
+	}
+	if offset, ok := chronyOffset(); ok {
+		return ClockOffset{Offset: offset, Source: "chrony"}, nil
+	}
+	if server == "" || server == "none" {
+		return ClockOffset{}, errors.New("no NTP daemon reports an offset and no NTP server is configured")
+	}
+	offset, err := querySNTP(ctx, server)
+	if err != nil {
+		return ClockOffset{}, err
+	}
+	return ClockOffset{Offset: offset, Source: server}, nil
+}
+
+// timesyncdOffset reads systemd-timesyncd's last measurement, e.g.
+// "Offset: +1.234ms". It's the server's time relative to ours.
+func timesyncdOffset() (time.Duration, bool) {
+	out, err := exec.Command("timedatectl", "timesync-status").Output()
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || key != "Offset" {
+			continue
+		}
+		offset, err := time.ParseDuration(strings.TrimPrefix(strings.TrimSpace(value), "+"))
+		if err != nil {
+			return 0, false
+		}
+		return -offset, true
+	}
+	return 0, false
+}
+
+// chronyOffset reads chrony's tracking report, e.g.
+// "System time     : 0.000012345 seconds fast of NTP time".
+func chronyOffset() (time.Duration, bool) {
+	out, err := exec.Command("chronyc", "tracking").Output()
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "System time" {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) < 3 {
+			return 0, false
+		}
+		seconds, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, false
+		}
+		if fields[2] == "slow" {
+			seconds = -seconds
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// querySNTP asks server for the time once, as an SNTP client (RFC 4330)
+// does, and works out the offset with the round trip taken out.
+func querySNTP(ctx context.Context, server string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(server, "123"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach NTP server %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // version 4, client mode
+	sent := time.Now()
+	putNTPTime(req[40:], sent)
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to query NTP server %s: %w", server, err)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query NTP server %s: %w", server, err)
+	}
+	switch {
+	case n < 48 || resp[0]&0x7 != 4:
+		return 0, fmt.Errorf("invalid reply from NTP server %s", server)
+	case resp[1] == 0:
+		return 0, fmt.Errorf("NTP server %s refused the query (%s)", server, strings.TrimRight(string(resp[12:16]), "\x00"))
+	case resp[0]>>6 == 3:
+		return 0, fmt.Errorf("NTP server %s is not synchronized", server)
+	}
+
+	serverReceived, serverSent := ntpTime(resp[32:]), ntpTime(resp[40:])
+	return (sent.Sub(serverReceived) + received.Sub(serverSent)) / 2, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	return time.Unix(int64(seconds)-ntpEpochOffset, int64((uint64(fraction)*1e9)>>32))
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((uint64(t.Nanosecond())<<32)/1e9))
+}
@@ -0,0 +1,94 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileDescriptors is open file usage against the limit that applies.
+type FileDescriptors struct {
+	PID     int     `json:"pid,omitempty"` // unset for the system-wide count
+	Open    uint64  `json:"open"`
+	Limit   uint64  `json:"limit"`
+	Percent float64 `json:"percent"`
+}
+
+func newFileDescriptors(pid int, open, limit uint64) FileDescriptors {
+	fd := FileDescriptors{PID: pid, Open: open, Limit: limit}
+	if limit > 0 {
+		fd.Percent = float64(open) / float64(limit) * 100
+	}
+	return fd
+}
+
+// SystemFileDescriptors reads the kernel-wide count from fs.file-nr, which
+// fs.file-max caps for every process together.
+func SystemFileDescriptors() (FileDescriptors, error) {
+	data, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return FileDescriptors{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return FileDescriptors{}, fmt.Errorf("unexpected file-nr format %q", strings.TrimSpace(string(data)))
+	}
+	allocated, _ := strconv.ParseUint(fields[0], 10, 64)
+	unused, _ := strconv.ParseUint(fields[1], 10, 64)
+	max, _ := strconv.ParseUint(fields[2], 10, 64)
+	return newFileDescriptors(0, allocated-unused, max), nil
+}
+
+// ProcessFileDescriptors counts a process's open files against its soft
+// RLIMIT_NOFILE, the limit it actually runs into.
+func ProcessFileDescriptors(pid int) (FileDescriptors, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	entries, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return FileDescriptors{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "limits"))
+	if err != nil {
+		return FileDescriptors{}, err
+	}
+	var limit uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		// Max open files    <soft>    <hard>    files
+		if fields := strings.Fields(strings.TrimPrefix(line, "Max open files")); len(fields) > 0 {
+			limit, _ = strconv.ParseUint(fields[0], 10, 64)
+		}
+		break
+	}
+	return newFileDescriptors(pid, uint64(len(entries)), limit), nil
+}
+
+// FindProcess returns the pid of the first process running the binary at
+// path, matching on the base name when the path isn't absolute.
+func FindProcess(path string) (int, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, false
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		exe, err := os.Readlink(filepath.Join("/proc", e.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		// An upgraded binary still running from the old inode.
+		exe = strings.TrimSuffix(exe, " (deleted)")
+		if exe == path || (!filepath.IsAbs(path) && filepath.Base(exe) == path) {
+			return pid, true
+		}
+	}
+	return 0, false
+}
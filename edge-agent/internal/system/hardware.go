@@ -0,0 +1,217 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+type CPUInfo struct {
+	Model        string  `json:"model"`
+	LogicalCores int     `json:"logical_cores"`
+	Cores        int     `json:"cores"` // physical
+	Mhz          float64 `json:"mhz"`
+}
+
+type Interface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu"`
+	Addresses []string `json:"addresses"`
+}
+
+func CPU() (CPUInfo, error) {
+	info := CPUInfo{Model: "Unknown"}
+
+	logical, err := cpu.Counts(true)
+	if err != nil {
+		return info, err
+	}
+	info.LogicalCores = logical
+	info.Cores = logical
+	if physical, err := cpu.Counts(false); err == nil && physical > 0 {
+		info.Cores = physical
+	}
+
+	if details, err := cpu.Info(); err == nil && len(details) > 0 {
+		info.Model = strings.TrimSpace(details[0].ModelName)
+		info.Mhz = details[0].Mhz
+	}
+	return info, nil
+}
+
+// MemoryTotal returns installed memory in bytes.
+func MemoryTotal() (uint64, error) {
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return v.Total, nil
+}
+
+// DiskTotal returns the size in bytes of the filesystem holding path.
+func DiskTotal(path string) (uint64, error) {
+	u, err := disk.Usage(path)
+	if err != nil {
+		return 0, err
+	}
+	return u.Total, nil
+}
+
+// virtualInterfacePrefixes are created by Docker and Wings rather than
+// connecting the node to a network.
+var virtualInterfacePrefixes = []string{"docker", "br-", "veth", "pterodactyl", "virbr", "cni", "flannel"}
+
+// Interfaces lists the node's up, non-loopback, physical-ish interfaces.
+func Interfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || isVirtualInterface(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		entry := Interface{Name: iface.Name, MAC: iface.HardwareAddr.String(), MTU: iface.MTU}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+				entry.Addresses = append(entry.Addresses, ipnet.IP.String())
+			}
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+func isVirtualInterface(name string) bool {
+	for _, prefix := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRouteInterface returns the interface carrying the IPv4 default
+// route, read from /proc/net/route.
+func DefaultRouteInterface() (string, error) {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no default route")
+}
+
+// LocalAddresses picks the first private and the first public IPv4 address
+// bound to the given interfaces. Either may be empty.
+func LocalAddresses(ifaces []Interface) (private, public string) {
+	for _, iface := range ifaces {
+		for _, a := range iface.Addresses {
+			ip := net.ParseIP(a)
+			if ip == nil || ip.To4() == nil {
+				continue
+			}
+			if ip.IsPrivate() {
+				if private == "" {
+					private = a
+				}
+			} else if ip.IsGlobalUnicast() && public == "" {
+				public = a
+			}
+		}
+	}
+	return private, public
+}
+
+// LookupPublicIP asks an external resolver for the address the node's
+// traffic appears from, for nodes behind NAT. The resolver must answer with
+// the bare address.
+func LookupPublicIP(ctx context.Context, resolver string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", resolver, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("public IP resolver returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("public IP resolver returned %q", strings.TrimSpace(string(body)))
+	}
+	return ip.String(), nil
+}
+
+// LinkSpeed returns the negotiated speed of an interface in Mbit/s, or 0
+// when the driver doesn't report one, as with most virtio NICs.
+func LinkSpeed(iface string) int {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", iface, "speed"))
+	if err != nil {
+		return 0
+	}
+	speed, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || speed < 0 {
+		return 0
+	}
+	return speed
+}
+
+// TxBytes returns the bytes sent on an interface since boot.
+func TxBytes(iface string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", iface, "statistics", "tx_bytes"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// TCPSendBufferMax is the largest send buffer the kernel autotunes a TCP
+// socket to, which bounds a single stream to buffer/RTT.
+func TCPSendBufferMax() int {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/tcp_wmem")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return 0
+	}
+	size, _ := strconv.Atoi(fields[2])
+	return size
+}
@@ -0,0 +1,82 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Listener is a socket accepting traffic: a listening TCP socket or an
+// unconnected UDP one.
+type Listener struct {
+	Protocol string `json:"protocol"` // tcp or udp
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	PID      int32  `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+func (l Listener) String() string {
+	return fmt.Sprintf("%s/%s", l.Protocol, net.JoinHostPort(l.Address, fmt.Sprint(l.Port)))
+}
+
+// Loopback reports whether the listener is only reachable from the node.
+func (l Listener) Loopback() bool {
+	ip := net.ParseIP(l.Address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Listeners enumerates the node's listening sockets with their owning
+// process, where it can be resolved.
+func Listeners() ([]Listener, error) {
+	conns, err := psnet.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int32]string)
+	seen := make(map[string]bool)
+	var out []Listener
+	for _, c := range conns {
+		var proto string
+		switch {
+		case c.Type == syscall.SOCK_STREAM && c.Status == "LISTEN":
+			proto = "tcp"
+		case c.Type == syscall.SOCK_DGRAM && c.Raddr.Port == 0:
+			proto = "udp"
+		default:
+			continue
+		}
+
+		l := Listener{Protocol: proto, Address: c.Laddr.IP, Port: c.Laddr.Port, PID: c.Pid}
+		// SO_REUSEPORT and multi-process servers show up once per socket.
+		if seen[l.String()] {
+			continue
+		}
+		seen[l.String()] = true
+
+		if c.Pid > 0 {
+			name, ok := names[c.Pid]
+			if !ok {
+				if p, err := process.NewProcess(c.Pid); err == nil {
+					name, _ = p.Name()
+				}
+				names[c.Pid] = name
+			}
+			l.Process = name
+		}
+		out = append(out, l)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Port != out[j].Port {
+			return out[i].Port < out[j].Port
+		}
+		return out[i].String() < out[j].String()
+	})
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// minMTU is the smallest MTU every IPv4 path must carry.
+const minMTU = 576
+
+// ErrNoICMP means the host didn't answer even a minimum size ping, so
+// nothing can be said about the path.
+var ErrNoICMP = errors.New("host doesn't answer ping")
+
+// PathMTU finds the largest packet that reaches host unfragmented, up to
+// max, by pinging with the don't-fragment bit set. Pings that go missing
+// are treated like ones the path rejected, which is how an overlay with a
+// smaller MTU and no ICMP feedback behaves too.
+func PathMTU(ctx context.Context, host string, max int) (int, error) {
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		return 0, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	ip := addrs[0].String()
+
+	if !pingDF(ctx, ip, minMTU) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrNoICMP
+	}
+	if pingDF(ctx, ip, max) {
+		return max, nil
+	}
+
+	lo, hi := minMTU, max
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if pingDF(ctx, ip, mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return lo, nil
+}
+
+// pingDF sends one packet of size bytes, IPv4 and ICMP headers included,
+// with fragmentation prohibited. A second try covers a single lost reply.
+func pingDF(ctx context.Context, ip string, size int) bool {
+	payload := strconv.Itoa(size - 28)
+	for attempt := 0; attempt < 2; attempt++ {
+		pctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		err := exec.CommandContext(pctx, "ping", "-n", "-q", "-c", "1", "-W", "1", "-M", "do", "-s", payload, ip).Run()
+		cancel()
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ErrNoSmartctl means smartmontools isn't installed.
+var ErrNoSmartctl = errors.New("smartctl not found, install smartmontools")
+
+const smartctlTimeout = 30 * time.Second
+
+// DiskHealth is a drive's SMART health. Sector counts are from the ATA
+// attributes, wear and media errors from the NVMe health log; whichever
+// doesn't apply is left zero.
+type DiskHealth struct {
+	Device       string `json:"device"`
+	Type         string `json:"type"` // smartctl device type, e.g. sat, nvme
+	Model        string `json:"model,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	Passed       bool   `json:"passed"` // the drive's own overall assessment
+	Temperature  int    `json:"temperature,omitempty"`
+	PowerOnHours int64  `json:"power_on_hours,omitempty"`
+
+	ReallocatedSectors   int64 `json:"reallocated_sectors"`
+	PendingSectors       int64 `json:"pending_sectors"`
+	UncorrectableSectors int64 `json:"uncorrectable_sectors"`
+
+	WearPercent    int   `json:"wear_percent"` // NVMe percentage used, can pass 100
+	MediaErrors    int64 `json:"media_errors"`
+	AvailableSpare int   `json:"available_spare,omitempty"`
+	SpareThreshold int   `json:"spare_threshold,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+type smartScan struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+}
+
+type smartReport struct {
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATAAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		PercentageUsed          int   `json:"percentage_used"`
+		MediaErrors             int64 `json:"media_errors"`
+		AvailableSpare          int   `json:"available_spare"`
+		AvailableSpareThreshold int   `json:"available_spare_threshold"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// ATA attribute IDs with a raw value that counts bad sectors.
+const (
+	ataReallocated   = 5
+	ataPending       = 197
+	ataUncorrectable = 198
+)
+
+// SMARTHealth reads every drive smartctl can find. A drive that can't be
+// read is still listed, with Error set.
+func SMARTHealth(ctx context.Context) ([]DiskHealth, error) {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil, ErrNoSmartctl
+	}
+
+	var scan smartScan
+	if err := smartctl(ctx, &scan, "--scan", "--json"); err != nil {
+		return nil, fmt.Errorf("failed to scan for drives: %w", err)
+	}
+
+	disks := make([]DiskHealth, 0, len(scan.Devices))
+	for _, dev := range scan.Devices {
+		disk := DiskHealth{Device: dev.Name, Type: dev.Type}
+		var report smartReport
+		if err := smartctl(ctx, &report, "--all", "--json", "--device", dev.Type, dev.Name); err != nil {
+			disk.Error = err.Error()
+			disks = append(disks, disk)
+			continue
+		}
+
+		disk.Model = report.ModelName
+		disk.Serial = report.SerialNumber
+		disk.Passed = report.SmartStatus == nil || report.SmartStatus.Passed
+		disk.Temperature = report.Temperature.Current
+		disk.PowerOnHours = report.PowerOnTime.Hours
+		for _, attr := range report.ATAAttributes.Table {
+			switch attr.ID {
+			case ataReallocated:
+				disk.ReallocatedSectors = attr.Raw.Value
+			case ataPending:
+				disk.PendingSectors = attr.Raw.Value
+			case ataUncorrectable:
+				disk.UncorrectableSectors = attr.Raw.Value
+			}
+		}
+		if nvme := report.NVMeHealth; nvme != nil {
+			disk.WearPercent = nvme.PercentageUsed
+			disk.MediaErrors = nvme.MediaErrors
+			disk.AvailableSpare = nvme.AvailableSpare
+			disk.SpareThreshold = nvme.AvailableSpareThreshold
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// smartctl runs smartctl and decodes its JSON. The exit status is a bit
+// mask; only the low two bits (bad arguments, device open failed) mean
+// there's no report. The others flag a drive problem the report describes.
+func smartctl(ctx context.Context, v interface{}, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, smartctlTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "smartctl", args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode()&0x3 != 0 {
+			return fmt.Errorf("smartctl exited with status %d", exitErr.ExitCode())
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("failed to parse smartctl output: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package system
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	stunMagicCookie      = 0x2112A442
+	stunBindingRequest   = 0x0001
+	stunBindingResponse  = 0x0101
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+)
+
+// LookupPublicIPSTUN asks a STUN server (RFC 5389) which address the node's
+// UDP traffic arrives from. Unlike an HTTP resolver it sees past a proxy,
+// which is what game traffic does too.
+func LookupPublicIPSTUN(ctx context.Context, server string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach STUN server %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return "", fmt.Errorf("failed to query STUN server %s: %w", server, err)
+	}
+
+	resp := make([]byte, 1500)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to query STUN server %s: %w", server, err)
+	}
+	resp = resp[:n]
+	if len(resp) < 20 || binary.BigEndian.Uint16(resp[0:]) != stunBindingResponse || string(resp[8:20]) != string(req[8:20]) {
+		return "", fmt.Errorf("invalid reply from STUN server %s", server)
+	}
+
+	// XOR-MAPPED-ADDRESS is preferred: some NATs rewrite addresses they
+	// find in the clear.
+	var mapped net.IP
+	attrs := resp[20:]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		length := int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+length {
+			break
+		}
+		value := attrs[4 : 4+length]
+		switch typ {
+		case stunXORMappedAddress:
+			if ip := stunAddress(value, resp[4:20]); ip != nil {
+				return ip.String(), nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+		// Attributes are padded to 4 bytes.
+		attrs = attrs[4+(length+3)&^3:]
+	}
+	if mapped != nil {
+		return mapped.String(), nil
+	}
+	return "", fmt.Errorf("STUN server %s returned no address", server)
+}
+
+// stunAddress decodes a (XOR-)MAPPED-ADDRESS value. xor is the magic
+// cookie and transaction ID for the XOR variant, nil otherwise.
+func stunAddress(value, xor []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if xor != nil {
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return ip
+}
@@ -0,0 +1,116 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+)
+
+// TimeSettings is what the node reports about its clock configuration.
+type TimeSettings struct {
+	Timezone        string `json:"timezone"`
+	Locale          string `json:"locale"`
+	NTPSynchronized bool   `json:"ntp_synchronized"`
+	NTPService      string `json:"ntp_service,omitempty"`
+
+	// Filled in from the agent's last clock check.
+	ClockOffsetMs *float64 `json:"clock_offset_ms,omitempty"` // positive when the clock is ahead
+	ClockSource   string   `json:"clock_source,omitempty"`
+	ClockError    string   `json:"clock_error,omitempty"`
+}
+
+func Timezone() string {
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if tz := strings.TrimSpace(string(data)); tz != "" {
+			return tz
+		}
+	}
+
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if idx := strings.Index(target, "zoneinfo/"); idx >= 0 {
+			return target[idx+len("zoneinfo/"):]
+		}
+	}
+
+	if tz := os.Getenv("TZ"); tz != "" {
+		return tz
+	}
+	return time.Local.String()
+}
+
+func Locale() string {
+	for _, key := range []string{"LC_ALL", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+
+	f, err := os.Open("/etc/default/locale")
+	if err != nil {
+		return "C"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "LANG=") {
+			return strings.Trim(strings.TrimPrefix(line, "LANG="), `"`)
+		}
+	}
+	return "C"
+}
+
+// NTPStatus reports whether the clock is synchronized and which daemon is
+// responsible for it. Without timedatectl, as on OpenRC hosts, chrony is
+// asked directly.
+func NTPStatus(services service.Manager) (bool, string) {
+	daemon := ""
+	for _, unit := range []string{"chrony", "chronyd", "systemd-timesyncd", "ntp", "ntpd"} {
+		if services.IsActive(unit) {
+			daemon = unit
+			break
+		}
+	}
+
+	if out, err := exec.Command("timedatectl", "show", "-p", "NTPSynchronized", "--value").Output(); err == nil {
+		return strings.TrimSpace(string(out)) == "yes", daemon
+	}
+	if out, err := exec.Command("chronyc", "tracking").Output(); err == nil {
+		return strings.Contains(string(out), "Leap status     : Normal"), daemon
+	}
+	return false, daemon
+}
+
+func GetTimeSettings(services service.Manager) TimeSettings {
+	synced, daemon := NTPStatus(services)
+	return TimeSettings{
+		Timezone:        Timezone(),
+		Locale:          Locale(),
+		NTPSynchronized: synced,
+		NTPService:      daemon,
+	}
+}
+
+// SetTimezone switches the system timezone and makes sure NTP is enabled.
+func SetTimezone(tz string) error {
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown timezone %q: %w", tz, err)
+	}
+
+	if out, err := exec.Command("timedatectl", "set-timezone", tz).CombinedOutput(); err != nil {
+		return fmt.Errorf("timedatectl set-timezone failed: %s", strings.TrimSpace(string(out)))
+	}
+
+	if out, err := exec.Command("timedatectl", "set-ntp", "true").CombinedOutput(); err != nil {
+		return fmt.Errorf("timedatectl set-ntp failed: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
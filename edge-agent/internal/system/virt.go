@@ -0,0 +1,112 @@
+package system
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Virtualization describes the layers the node runs under and whether it
+// can host workloads that need hardware virtualization themselves.
+type Virtualization struct {
+	Hypervisor        string   `json:"hypervisor"` // "none" on bare metal
+	Container         string   `json:"container"`  // "none" outside a container
+	Layers            []string `json:"layers,omitempty"`
+	Nested            bool     `json:"nested"`
+	CPUVirtExtensions bool     `json:"cpu_virt_extensions"`
+	KVMAvailable      bool     `json:"kvm_available"`
+	NestedKVM         bool     `json:"nested_kvm"`
+}
+
+var (
+	virtOnce sync.Once
+	virtInfo Virtualization
+)
+
+// DetectVirtualization inspects the environment once and caches the result,
+// it can't change without a reboot.
+func DetectVirtualization() Virtualization {
+	virtOnce.Do(func() {
+		virtInfo = detectVirtualization()
+	})
+	return virtInfo
+}
+
+func detectVirtualization() Virtualization {
+	v := Virtualization{
+		Hypervisor: detectVirt("--vm"),
+		Container:  detectVirt("--container"),
+	}
+
+	flags := cpuFlags()
+	v.CPUVirtExtensions = flags["vmx"] || flags["svm"]
+
+	// The hypervisor flag is set by every mainstream VMM even when
+	// systemd-detect-virt is missing.
+	if v.Hypervisor == "none" && flags["hypervisor"] {
+		v.Hypervisor = "unknown"
+	}
+
+	if v.Hypervisor != "none" {
+		v.Layers = append(v.Layers, v.Hypervisor)
+	}
+	if v.Container != "none" {
+		v.Layers = append(v.Layers, v.Container)
+	}
+	// A VM that exposes virtualization extensions is itself hosting (or able
+	// to host) another level.
+	v.Nested = len(v.Layers) > 1 || (v.Hypervisor != "none" && v.CPUVirtExtensions)
+
+	if f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0); err == nil {
+		f.Close()
+		v.KVMAvailable = true
+	}
+
+	for _, param := range []string{
+		"/sys/module/kvm_intel/parameters/nested",
+		"/sys/module/kvm_amd/parameters/nested",
+	} {
+		if data, err := os.ReadFile(param); err == nil {
+			val := strings.TrimSpace(string(data))
+			if val == "Y" || val == "1" {
+				v.NestedKVM = true
+			}
+		}
+	}
+
+	return v
+}
+
+func detectVirt(mode string) string {
+	out, err := exec.Command("systemd-detect-virt", mode).Output()
+	// Exits non-zero and prints "none" when nothing is detected.
+	result := strings.TrimSpace(string(out))
+	if result == "" || (err != nil && result != "none") {
+		return "none"
+	}
+	return result
+}
+
+func cpuFlags() map[string]bool {
+	flags := make(map[string]bool)
+
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return flags
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// "Features" on ARM.
+		if !strings.HasPrefix(line, "flags") && !strings.HasPrefix(line, "Features") {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			for _, f := range strings.Fields(line[idx+1:]) {
+				flags[f] = true
+			}
+		}
+		break
+	}
+	return flags
+}
@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+)
+
+const maxOutputLen = 64 * 1024
+
+// Handler executes one task type and returns its combined output.
+type Handler func(ctx context.Context, task Task) (output string, exitCode int, err error)
+
+var (
+	serviceActions = map[string]bool{
+		"start": true, "stop": true, "restart": true, "reload": true, "enable": true, "disable": true,
+	}
+	dockerActions = map[string]bool{
+		"start": true, "stop": true, "restart": true, "kill": true, "pause": true, "unpause": true,
+	}
+)
+
+func builtinHandlers() map[string]Handler {
+	return map[string]Handler{
+		TypeShell:     runShell,
+		TypeFileWrite: runFileWrite,
+		TypeDocker:    runDocker,
+	}
+}
+
+func runShell(ctx context.Context, task Task) (string, int, error) {
+	var p ShellPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if p.Command == "" {
+		return "", -1, fmt.Errorf("command is required")
+	}
+
+	// Without args the command is a script line for the shell.
+	var cmd *exec.Cmd
+	if len(p.Args) == 0 {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", p.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, p.Command, p.Args...)
+	}
+	cmd.Dir = p.Dir
+	cmd.Env = os.Environ()
+	for k, v := range p.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	return runCommand(cmd)
+}
+
+func runFileWrite(ctx context.Context, task Task) (string, int, error) {
+	var p FileWritePayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if !filepath.IsAbs(p.Path) {
+		return "", -1, fmt.Errorf("path must be absolute")
+	}
+
+	mode := os.FileMode(p.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.Path), 0755); err != nil {
+		return "", -1, err
+	}
+
+	tmp := p.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(p.Content), mode); err != nil {
+		return "", -1, err
+	}
+	if err := os.Rename(tmp, p.Path); err != nil {
+		os.Remove(tmp)
+		return "", -1, err
+	}
+
+	return fmt.Sprintf("wrote %d bytes to %s", len(p.Content), p.Path), 0, nil
+}
+
+// ServiceHandler runs service tasks through the node's init system. It's
+// registered by the agent, which knows which one that is.
+func ServiceHandler(services service.Manager) Handler {
+	return func(ctx context.Context, task Task) (string, int, error) {
+		var p ServicePayload
+		if err := json.Unmarshal(task.Payload, &p); err != nil {
+			return "", -1, fmt.Errorf("invalid payload: %w", err)
+		}
+		if p.Unit == "" || !serviceActions[p.Action] {
+			return "", -1, fmt.Errorf("unsupported service action %q on %q", p.Action, p.Unit)
+		}
+
+		actions := map[string]func(context.Context, string) error{
+			"start": services.Start, "stop": services.Stop, "restart": services.Restart,
+			"reload": services.Reload, "enable": services.Enable, "disable": services.Disable,
+		}
+		if err := actions[p.Action](ctx, p.Unit); err != nil {
+			return "", 1, err
+		}
+		return fmt.Sprintf("%s %s: done", p.Action, p.Unit), 0, nil
+	}
+}
+
+func runDocker(ctx context.Context, task Task) (string, int, error) {
+	var p DockerPayload
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return "", -1, fmt.Errorf("invalid payload: %w", err)
+	}
+	if p.Container == "" || !dockerActions[p.Action] {
+		return "", -1, fmt.Errorf("unsupported docker action %q on %q", p.Action, p.Container)
+	}
+
+	return runCommand(exec.CommandContext(ctx, "docker", p.Action, p.Container))
+}
+
+func runCommand(cmd *exec.Cmd) (string, int, error) {
+	out, err := cmd.CombinedOutput()
+	output := string(out)
+	if len(output) > maxOutputLen {
+		output = output[len(output)-maxOutputLen:]
+	}
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return output, exitErr.ExitCode(), fmt.Errorf("exited with code %d", exitErr.ExitCode())
+		}
+		return output, -1, err
+	}
+	return output, 0, nil
+}
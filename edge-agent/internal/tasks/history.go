@@ -0,0 +1,223 @@
+package tasks
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output kept per history entry. The tail is kept, that's where errors
+// usually are.
+const historyOutputLimit = 4096
+
+// HistoryEntry is a finished task in the node's local history.
+type HistoryEntry struct {
+	TaskID      string    `json:"task_id"`
+	Type        string    `json:"type"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Status      string    `json:"status"`
+	ExitCode    int       `json:"exit_code"`
+	DurationMs  int64     `json:"duration_ms"`
+	Output      string    `json:"output,omitempty"`
+	Truncated   bool      `json:"truncated,omitempty"` // Output lost its beginning
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// HistoryQuery filters the history. Zero values match everything; Search
+// is a case-insensitive substring of the type, requester, output or error.
+type HistoryQuery struct {
+	Type        string
+	Status      string
+	RequestedBy string
+	Search      string
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+func (q HistoryQuery) match(e HistoryEntry) bool {
+	switch {
+	case q.Type != "" && e.Type != q.Type,
+		q.Status != "" && e.Status != q.Status,
+		q.RequestedBy != "" && e.RequestedBy != q.RequestedBy,
+		!q.Since.IsZero() && e.FinishedAt.Before(q.Since),
+		!q.Until.IsZero() && e.FinishedAt.After(q.Until):
+		return false
+	}
+	if q.Search == "" {
+		return true
+	}
+	needle := strings.ToLower(q.Search)
+	for _, field := range []string{e.TaskID, e.Type, e.RequestedBy, e.Output, e.Error} {
+		if strings.Contains(strings.ToLower(field), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+func newHistoryEntry(task Task, result Result) HistoryEntry {
+	e := HistoryEntry{
+		TaskID:      result.TaskID,
+		Type:        result.Type,
+		RequestedBy: task.RequestedBy,
+		Status:      result.Status,
+		ExitCode:    result.ExitCode,
+		Output:      result.Output,
+		Error:       result.Error,
+		StartedAt:   result.StartedAt,
+		FinishedAt:  result.FinishedAt,
+	}
+	if !result.StartedAt.IsZero() {
+		e.DurationMs = result.FinishedAt.Sub(result.StartedAt).Milliseconds()
+	}
+	if len(e.Output) > historyOutputLimit {
+		e.Output = e.Output[len(e.Output)-historyOutputLimit:]
+		e.Truncated = true
+	}
+	return e
+}
+
+// history is an append-only JSON lines file, compacted to the newest max
+// entries once it has grown a tenth past that. The IDs it holds are kept in
+// memory so Submit can tell a finished task from a new one.
+type history struct {
+	path string
+	max  int
+
+	mu    sync.Mutex
+	count int
+	ids   map[string]bool
+}
+
+func openHistory(path string, max int) *history {
+	h := &history{path: path, max: max, ids: make(map[string]bool)}
+	if entries, err := h.read(); err == nil {
+		h.count = len(entries)
+		for _, e := range entries {
+			h.ids[e.TaskID] = true
+		}
+	}
+	return h
+}
+
+func (h *history) contains(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ids[id]
+}
+
+func (h *history) read() ([]HistoryEntry, error) {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (h *history) append(e HistoryEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	h.count++
+	h.ids[e.TaskID] = true
+	if h.count > h.max+h.max/10 {
+		return h.compact()
+	}
+	return nil
+}
+
+// compact rewrites the file with the newest max entries. Callers hold mu.
+func (h *history) compact() error {
+	entries, err := h.read()
+	if err != nil {
+		return err
+	}
+	if len(entries) > h.max {
+		entries = entries[len(entries)-h.max:]
+	}
+
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	h.count = len(entries)
+	h.ids = make(map[string]bool, len(entries))
+	for _, e := range entries {
+		h.ids[e.TaskID] = true
+	}
+	return nil
+}
+
+// query returns matching entries, newest first.
+func (h *history) query(q HistoryQuery) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	entries, err := h.read()
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []HistoryEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !q.match(entries[i]) {
+			continue
+		}
+		out = append(out, entries[i])
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
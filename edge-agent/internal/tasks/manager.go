@@ -0,0 +1,460 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+const resultRetryInterval = 30 * time.Second
+
+// Reporter delivers a result to the control plane.
+type Reporter func(Result) error
+
+// Manager runs tasks from a durable on-disk queue. Each task lives in
+// pending/ until it finishes; its result stays in results/ until reported.
+// A task found in running/ after a restart was interrupted and is reported
+// as failed rather than run again, since tasks aren't assumed idempotent.
+type Manager struct {
+	dir            string
+	defaultTimeout time.Duration
+	report         Reporter
+	events         *events.Bus
+	logger         *logrus.Entry
+
+	queue     chan Task
+	done      chan Task
+	workers   int
+	handlers  map[string]Handler
+	resources map[string][]string // by task type, see SetResources
+	allowed   map[string]bool     // nil allows every registered type
+
+	history *history
+
+	mu      sync.Mutex
+	running map[string]ActiveTask
+	waiting int // tasks the dispatcher is holding back
+}
+
+// ActiveTask is a task currently executing.
+type ActiveTask struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+func NewManager(dir string, cfg config.TasksConfig, report Reporter, bus *events.Bus, logger *logrus.Entry) (*Manager, error) {
+	for _, sub := range []string{"pending", "running", "results"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create task queue: %w", err)
+		}
+	}
+
+	workers := cfg.MaxConcurrent
+	if workers <= 0 {
+		workers = 1
+	}
+	historyEntries := cfg.HistoryEntries
+	if historyEntries <= 0 {
+		historyEntries = 5000
+	}
+
+	return &Manager{
+		dir:            dir,
+		defaultTimeout: time.Duration(cfg.DefaultTimeout) * time.Second,
+		report:         report,
+		events:         bus,
+		logger:         logger.WithField("component", "tasks"),
+		queue:          make(chan Task, 1024),
+		done:           make(chan Task),
+		workers:        workers,
+		handlers:       builtinHandlers(),
+		resources:      map[string][]string{TypeShell: nil},
+		history:        openHistory(filepath.Join(dir, "history.jsonl"), historyEntries),
+		running:        make(map[string]ActiveTask),
+	}, nil
+}
+
+// Register adds or replaces the handler for a task type.
+func (m *Manager) Register(taskType string, handler Handler) {
+	m.handlers[taskType] = handler
+}
+
+// SetResources declares what tasks of a type change. Tasks claiming a
+// common resource never run at the same time; the later one waits for a
+// free slot rather than failing on a lock timeout. A type without a
+// declaration only excludes itself, and declaring nothing lets a type run
+// alongside anything. Like Register, call it before Start.
+func (m *Manager) SetResources(taskType string, resources ...string) {
+	m.resources[taskType] = resources
+}
+
+func (m *Manager) resourcesFor(taskType string) []string {
+	if resources, ok := m.resources[taskType]; ok {
+		return resources
+	}
+	return []string{"task:" + taskType}
+}
+
+// Allow restricts Submit to the given task types. An empty list allows all.
+func (m *Manager) Allow(types []string) {
+	var allowed map[string]bool
+	if len(types) > 0 {
+		allowed = make(map[string]bool, len(types))
+		for _, t := range types {
+			allowed[t] = true
+		}
+	}
+
+	m.mu.Lock()
+	m.allowed = allowed
+	m.mu.Unlock()
+}
+
+// Types lists the task types this node will accept.
+func (m *Manager) Types() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	types := make([]string, 0, len(m.handlers))
+	for t := range m.handlers {
+		if m.allowed == nil || m.allowed[t] {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Permitted reports whether Submit would accept a task of this type.
+func (m *Manager) Permitted(taskType string) bool {
+	if _, ok := m.handlers[taskType]; !ok {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.allowed == nil || m.allowed[taskType]
+}
+
+func (m *Manager) path(state, id string) string {
+	return filepath.Join(m.dir, state, id+".json")
+}
+
+// Submit persists a task and queues it for execution.
+func (m *Manager) Submit(task Task) error {
+	if task.ID == "" || strings.ContainsAny(task.ID, `/\`) {
+		return fmt.Errorf("invalid task id %q", task.ID)
+	}
+	if _, ok := m.handlers[task.Type]; !ok {
+		return fmt.Errorf("unknown task type %q", task.Type)
+	}
+	m.mu.Lock()
+	permitted := m.allowed == nil || m.allowed[task.Type]
+	m.mu.Unlock()
+	if !permitted {
+		return fmt.Errorf("task type %q is not permitted on this node", task.Type)
+	}
+
+	// Duplicate deliveries of the same task are accepted but not run twice,
+	// including ones that arrive after its result was reported.
+	for _, state := range []string{"pending", "running", "results"} {
+		if _, err := os.Stat(m.path(state, task.ID)); err == nil {
+			return nil
+		}
+	}
+	if m.history.contains(task.ID) {
+		return nil
+	}
+
+	if task.ReceivedAt.IsZero() {
+		task.ReceivedAt = time.Now()
+	}
+	if err := writeJSON(m.path("pending", task.ID), task); err != nil {
+		return fmt.Errorf("failed to persist task: %w", err)
+	}
+
+	select {
+	case m.queue <- task:
+	default:
+		// Still on disk, it will be picked up after the backlog drains on next start.
+		return fmt.Errorf("task queue is full")
+	}
+	return nil
+}
+
+// Start recovers the on-disk queue and runs tasks until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	m.recover()
+
+	go m.dispatch(ctx)
+	go m.retryResults(ctx)
+}
+
+func (m *Manager) recover() {
+	interrupted, _ := filepath.Glob(filepath.Join(m.dir, "running", "*.json"))
+	for _, path := range interrupted {
+		var task Task
+		if err := readJSON(path, &task); err != nil {
+			os.Remove(path)
+			continue
+		}
+		m.finish(task, Result{
+			TaskID:     task.ID,
+			Type:       task.Type,
+			Status:     StatusFailed,
+			ExitCode:   -1,
+			Error:      "interrupted by agent restart",
+			FinishedAt: time.Now(),
+		})
+	}
+
+	pending, _ := filepath.Glob(filepath.Join(m.dir, "pending", "*.json"))
+	for _, path := range pending {
+		var task Task
+		if err := readJSON(path, &task); err != nil {
+			os.Remove(path)
+			continue
+		}
+		select {
+		case m.queue <- task:
+		default:
+		}
+	}
+
+	if len(interrupted)+len(pending) > 0 {
+		m.logger.WithFields(logrus.Fields{
+			"interrupted": len(interrupted),
+			"pending":     len(pending),
+		}).Info("Recovered task queue")
+	}
+}
+
+// dispatch runs up to workers tasks at once. A task is held back while a
+// running task claims one of its resources, or while an earlier task that
+// is itself held back wants one: conflicting tasks run in the order they
+// arrived, and independent ones go ahead of them.
+func (m *Manager) dispatch(ctx context.Context) {
+	var waiting []Task
+	claimed := make(map[string]bool)
+	running := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-m.queue:
+			waiting = append(waiting, task)
+		case task := <-m.done:
+			running--
+			for _, r := range m.resourcesFor(task.Type) {
+				delete(claimed, r)
+			}
+		}
+
+		wanted := make(map[string]bool)
+		held := waiting[:0]
+		for _, task := range waiting {
+			resources := m.resourcesFor(task.Type)
+			if running < m.workers && !anyOf(resources, claimed) && !anyOf(resources, wanted) {
+				for _, r := range resources {
+					claimed[r] = true
+				}
+				running++
+				go m.run(ctx, task)
+				continue
+			}
+			for _, r := range resources {
+				wanted[r] = true
+			}
+			held = append(held, task)
+		}
+		waiting = held
+
+		m.mu.Lock()
+		m.waiting = len(waiting)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) run(ctx context.Context, task Task) {
+	m.execute(ctx, task)
+	select {
+	case m.done <- task:
+	case <-ctx.Done():
+	}
+}
+
+func anyOf(resources []string, set map[string]bool) bool {
+	for _, r := range resources {
+		if set[r] {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) execute(ctx context.Context, task Task) {
+	if err := os.Rename(m.path("pending", task.ID), m.path("running", task.ID)); err != nil {
+		// Already taken by another worker or removed.
+		return
+	}
+
+	m.mu.Lock()
+	m.running[task.ID] = ActiveTask{ID: task.ID, Type: task.Type, RequestedBy: task.RequestedBy, StartedAt: time.Now()}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, task.ID)
+		m.mu.Unlock()
+	}()
+
+	timeout := m.defaultTimeout
+	if task.Timeout > 0 {
+		timeout = time.Duration(task.Timeout) * time.Second
+	}
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logger := m.logger.WithFields(logrus.Fields{"task_id": task.ID, "type": task.Type})
+	logger.Info("Running task")
+	m.events.Publish("task_started", map[string]string{"task_id": task.ID, "type": task.Type})
+
+	result := Result{TaskID: task.ID, Type: task.Type, StartedAt: time.Now()}
+	output, exitCode, err := m.handlers[task.Type](taskCtx, task)
+	result.FinishedAt = time.Now()
+	result.Output = output
+	result.ExitCode = exitCode
+
+	switch {
+	case ctx.Err() != nil:
+		// Agent shutting down, leave it in running/ so recovery reports it.
+		return
+	case taskCtx.Err() == context.DeadlineExceeded:
+		result.Status = StatusTimedOut
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	default:
+		result.Status = StatusSucceeded
+	}
+
+	logger.WithField("status", result.Status).Info("Task finished")
+	// Viewers can stream events, so the output stays in the admin-only
+	// task history.
+	published := result
+	published.Output = ""
+	m.events.Publish("task_finished", published)
+	m.finish(task, result)
+}
+
+func (m *Manager) finish(task Task, result Result) {
+	if err := m.history.append(newHistoryEntry(task, result)); err != nil {
+		m.logger.WithError(err).WithField("task_id", task.ID).Warn("Failed to record task history")
+	}
+	if err := writeJSON(m.path("results", task.ID), result); err != nil {
+		m.logger.WithError(err).WithField("task_id", task.ID).Error("Failed to persist task result")
+	}
+	os.Remove(m.path("running", task.ID))
+
+	if err := m.report(result); err != nil {
+		m.logger.WithError(err).WithField("task_id", task.ID).Warn("Failed to report task result, will retry")
+		return
+	}
+	os.Remove(m.path("results", task.ID))
+}
+
+// retryResults resends results that couldn't be reported earlier.
+func (m *Manager) retryResults(ctx context.Context) {
+	ticker := time.NewTicker(resultRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		paths, _ := filepath.Glob(filepath.Join(m.dir, "results", "*.json"))
+		for _, path := range paths {
+			var result Result
+			if err := readJSON(path, &result); err != nil {
+				os.Remove(path)
+				continue
+			}
+			if err := m.report(result); err != nil {
+				break
+			}
+			os.Remove(path)
+		}
+	}
+}
+
+// History searches the tasks this node has finished, newest first.
+func (m *Manager) History(q HistoryQuery) ([]HistoryEntry, error) {
+	return m.history.query(q)
+}
+
+// Queued returns the number of tasks waiting to run.
+func (m *Manager) Queued() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queue) + m.waiting
+}
+
+// Running returns the IDs of tasks currently executing.
+func (m *Manager) Running() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.running))
+	for id := range m.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Active returns the tasks currently executing, longest running first.
+func (m *Manager) Active() []ActiveTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := make([]ActiveTask, 0, len(m.running))
+	for _, t := range m.running {
+		active = append(active, t)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].StartedAt.Before(active[j].StartedAt) })
+	return active
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
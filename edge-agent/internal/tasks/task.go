@@ -0,0 +1,162 @@
+package tasks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	TypeShell     = "shell"
+	TypeFileWrite = "file_write"
+	TypeService   = "service"
+	TypeDocker    = "docker"
+
+	TypeCoordinatedRestart = "coordinated_restart"
+	TypeDockerNetwork      = "docker_network"
+	TypeServerPower        = "server_power"
+	TypeFileLimit          = "file_limit"
+	TypeWingsSnapshot      = "wings_snapshot"
+	TypeDecommission       = "decommission"
+	TypeNodeTuning         = "node_tuning"
+	TypePullImages         = "pull_images"
+	TypePruneImages        = "prune_images"
+
+	// Usually delivered as heartbeat directives.
+	TypeCommand            = "command"
+	TypeSyncWingsConfig    = "sync_wings_config"
+	TypeUpdateAgent        = "update_agent"
+	TypeCollectDiagnostics = "collect_diagnostics"
+	TypeDiagnosticsBundle  = "diagnostics_bundle"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out"
+)
+
+// Task is a unit of remote work pushed by the control plane.
+type Task struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Timeout    int             `json:"timeout,omitempty"` // seconds, falls back to the configured default
+	Payload    json.RawMessage `json:"payload"`
+	ReceivedAt time.Time       `json:"received_at"`
+
+	RequestedBy string `json:"requested_by,omitempty"` // panel user or schedule that asked for it, for the history
+}
+
+type Result struct {
+	TaskID     string    `json:"task_id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type ShellPayload struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+type FileWritePayload struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Mode    uint32 `json:"mode,omitempty"`
+}
+
+// CommandPayload runs an agent command as a task, for control planes that
+// can't reach the node over the command channel.
+type CommandPayload struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type DiagnosticsBundlePayload struct {
+	Upload bool `json:"upload"` // send the bundle to the control plane
+}
+
+type ServicePayload struct {
+	Unit   string `json:"unit"`
+	Action string `json:"action"` // start, stop, restart, reload, enable, disable
+}
+
+type DockerPayload struct {
+	Container string `json:"container"`
+	Action    string `json:"action"` // start, stop, restart, kill, pause, unpause
+}
+
+// CoordinatedRestartPayload restarts a service only once the control plane
+// grants a restart slot, capping how many nodes restart at the same time.
+type CoordinatedRestartPayload struct {
+	Target string `json:"target"` // "wings" or "docker"
+}
+
+// ServerPowerPayload powers game servers through Wings, e.g. from a pair of
+// schedule entries that bring tournament servers up and take them down.
+type ServerPowerPayload struct {
+	Servers []string `json:"servers"`          // server UUIDs
+	Action  string   `json:"action"`           // start, stop, restart, kill
+	Wait    int      `json:"wait,omitempty"`   // seconds to wait for each server to settle, 0 to not wait
+	Reason  string   `json:"reason,omitempty"` // carried into the events, e.g. "tournament"
+}
+
+// FileLimitPayload raises a service's open file limit.
+type FileLimitPayload struct {
+	Unit    string `json:"unit,omitempty"` // defaults to the Wings unit
+	Limit   int    `json:"limit"`
+	Restart bool   `json:"restart,omitempty"` // restart so the limit applies now
+}
+
+// WingsSnapshotPayload manages snapshots of the Wings data directory, e.g.
+// one taken ahead of a mass reinstall and rolled back if it goes wrong.
+type WingsSnapshotPayload struct {
+	Action string `json:"action"`           // create, list, rollback or delete
+	ID     string `json:"id,omitempty"`     // for rollback and delete
+	Reason string `json:"reason,omitempty"` // recorded with the snapshot, e.g. "reinstall batch 12"
+}
+
+// DecommissionPayload retires the node: it is deregistered, its credentials
+// and state are wiped, and the agent stops for good.
+type DecommissionPayload struct {
+	Reason    string `json:"reason,omitempty"`
+	StopWings bool   `json:"stop_wings,omitempty"`
+	KeepData  bool   `json:"keep_data,omitempty"` // leave the agent's data directory
+}
+
+// NodeTuningPayload applies a host tuning profile, or reverts what earlier
+// profiles changed. Unset fields are left as they are.
+type NodeTuningPayload struct {
+	Profile       string            `json:"profile,omitempty"`        // name, carried into the event
+	SwapMB        *int              `json:"swap_mb,omitempty"`        // swapfile size in MiB, 0 removes it
+	Swappiness    *int              `json:"swappiness,omitempty"`     // vm.swappiness
+	Somaxconn     *int              `json:"somaxconn,omitempty"`      // net.core.somaxconn
+	FileMax       *int              `json:"file_max,omitempty"`       // fs.file-max
+	DockerUlimits map[string]Ulimit `json:"docker_ulimits,omitempty"` // container defaults, e.g. "nofile"
+	DryRun        bool              `json:"dry_run,omitempty"`        // report the changes without making them
+	Revert        bool              `json:"revert,omitempty"`         // restore the node's settings from before tuning
+}
+
+// Ulimit is a soft and hard resource limit.
+type Ulimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// PullImagesPayload pulls Docker images ahead of the servers that need
+// them, refreshing ones already cached.
+type PullImagesPayload struct {
+	Images []string `json:"images,omitempty"` // defaults to images.pre_pull
+}
+
+// PruneImagesPayload removes cached images no container uses. Images in
+// images.pre_pull are kept.
+type PruneImagesPayload struct {
+	Keep   []string `json:"keep,omitempty"`    // further images to keep, by tag
+	DryRun bool     `json:"dry_run,omitempty"` // report what would be removed
+}
@@ -0,0 +1,189 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// noisePeriod is how long a count's noise stays the same. Fresh noise on
+// every report would average out over the reports of one install.
+const noisePeriod = 30 * 24 * time.Hour
+
+// Report is the whole of what leaves the node. There is no hostname, node
+// ID, address or server name; sizes are bucketed and counts carry Laplace
+// noise, so a single report can't be tied back to one machine by its shape.
+type Report struct {
+	InstallID    string    `json:"install_id"` // random, not derived from anything on the node
+	Timestamp    time.Time `json:"timestamp"`  // truncated to the hour
+	AgentVersion string    `json:"agent_version"`
+	WingsVersion string    `json:"wings_version,omitempty"`
+	OS           string    `json:"os"`
+	Arch         string    `json:"arch"`
+	Hypervisor   string    `json:"hypervisor,omitempty"`
+	CPUCores     string    `json:"cpu_cores"` // bucket, e.g. "5-8"
+	MemoryGB     string    `json:"memory_gb"` // bucket
+	CPUUsage     int       `json:"cpu_usage"` // percent, rounded to 10
+	MemoryUsage  int       `json:"memory_usage"`
+	DiskUsage    int       `json:"disk_usage"`
+	HealthScore  int       `json:"health_score"`
+	Containers   int       `json:"containers"`  // noised
+	UptimeDays   string    `json:"uptime_days"` // bucket, e.g. "7-29"
+	Features     []string  `json:"features,omitempty"`
+}
+
+// Reporter sends reports to the vendor endpoint. It shares nothing with
+// the control plane client: no token, no client certificate.
+type Reporter struct {
+	cfg       config.TelemetryConfig
+	client    *http.Client
+	installID string
+	noiseKey  string // never sent, seeds each period's noise
+	logger    *logrus.Entry
+}
+
+func New(cfg config.TelemetryConfig, dataDir string, proxy func(*http.Request) (*url.URL, error), logger *logrus.Entry) (*Reporter, error) {
+	id, err := installID(filepath.Join(dataDir, "telemetry-id"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telemetry install ID: %w", err)
+	}
+	key, err := installID(filepath.Join(dataDir, "telemetry-noise-key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telemetry noise key: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &Reporter{
+		cfg:       cfg,
+		client:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		installID: id,
+		noiseKey:  key,
+		logger:    logger.WithField("component", "telemetry"),
+	}, nil
+}
+
+// installID lets the vendor count installs without knowing which they are.
+// Deleting the file starts a new identity. The noise key is made the same
+// way.
+func installID(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+		return string(bytes.TrimSpace(data)), nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	return id, os.WriteFile(path, []byte(id+"\n"), 0600)
+}
+
+// Send fills in the install ID and coarsens the timestamp before posting.
+func (r *Reporter) Send(ctx context.Context, report Report) error {
+	report.InstallID = r.installID
+	report.Timestamp = time.Now().UTC().Truncate(time.Hour)
+	report.Containers = Noise(report.Containers, r.cfg.Epsilon, r.noiseSample(time.Now()))
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send telemetry: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned HTTP %d", resp.StatusCode)
+	}
+	r.logger.Debug("Telemetry report sent")
+	return nil
+}
+
+// Bucket places n into the first range whose upper bound it doesn't
+// exceed, e.g. Bucket(6, 2, 4, 8) is "5-8".
+func Bucket(n int, bounds ...int) string {
+	lower := 0
+	for _, upper := range bounds {
+		if n <= upper {
+			return fmt.Sprintf("%d-%d", lower, upper)
+		}
+		lower = upper + 1
+	}
+	return fmt.Sprintf("%d+", lower)
+}
+
+// Round10 rounds a percentage to the nearest ten.
+func Round10(percent float64) int {
+	return int(math.Round(percent/10)) * 10
+}
+
+// noiseSample is the uniform sample in [-0.5, 0.5) Noise draws from for
+// the period t is in, the same for every report of this install in it.
+func (r *Reporter) noiseSample(t time.Time) float64 {
+	period := t.UTC().Truncate(noisePeriod).Unix()
+	mac := hmac.New(sha256.New, []byte(r.noiseKey))
+	binary.Write(mac, binary.BigEndian, period)
+	sum := mac.Sum(nil)
+	return float64(binary.BigEndian.Uint64(sum)>>11)/(1<<53) - 0.5
+}
+
+// Noise adds Laplace noise, from the uniform sample u in [-0.5, 0.5), to a
+// count with sensitivity one. Drawn once per period, that makes the count
+// epsilon-differentially private within the period; each new period spends
+// another epsilon. Results stay non-negative.
+func Noise(n int, epsilon, u float64) int {
+	if epsilon <= 0 {
+		return n
+	}
+	sign := 1.0
+	if u < 0 {
+		sign = -1
+	}
+	noised := float64(n) - sign/epsilon*math.Log(1-2*math.Abs(u))
+	return int(math.Max(0, math.Round(noised)))
+}
+
+// Features lists the optional settings in use, by name only.
+func Features(cfg *config.Config) []string {
+	var features []string
+	add := func(enabled bool, name string) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	add(cfg.ControlPlane.TLS.Enabled, "mtls")
+	add(len(cfg.ControlPlane.URLs) > 0, "failover")
+	add(cfg.ControlPlane.Proxy != "", "proxy")
+	add(cfg.Metrics.ServerDiskUsage, "server_disk_usage")
+	add(len(cfg.HealthChecks) > 0, "health_checks")
+	add(len(cfg.Hooks) > 0, "hooks")
+	add(cfg.Honeypot.Enabled, "honeypot")
+	add(cfg.ListenerAudit.Interval > 0, "listener_audit")
+	add(cfg.Transfers.RateMbit > 0 || len(cfg.Transfers.Windows) > 0, "transfer_shaping")
+	add(cfg.Secrets.Backend != "config", "secrets_"+strings.ToLower(cfg.Secrets.Backend))
+	return features
+}
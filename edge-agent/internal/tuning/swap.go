@@ -0,0 +1,110 @@
+package tuning
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SwapFile is the swapfile the agent manages. Partitions and other swap
+// files are left alone.
+const SwapFile = "/swapfile"
+
+const fstab = "/etc/fstab"
+
+// SwapFileMB returns the size of the swapfile in MiB, 0 when there is none.
+func SwapFileMB() (int, error) {
+	info, err := os.Stat(SwapFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(info.Size() >> 20), nil
+}
+
+// ResizeSwapFile recreates the swapfile at mb MiB and turns it on, or
+// removes it when mb is 0. Turning the old one off moves its pages back to
+// memory, which fails when there isn't room for them; the old swapfile is
+// then still in use and nothing has changed.
+func ResizeSwapFile(ctx context.Context, mb int) error {
+	active, err := swapActive(SwapFile)
+	if err != nil {
+		return err
+	}
+	if active {
+		if err := run(ctx, "swapoff", SwapFile); err != nil {
+			return fmt.Errorf("failed to turn off %s: %w", SwapFile, err)
+		}
+	}
+	if err := os.Remove(SwapFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if mb == 0 {
+		return setFstabEntry(false)
+	}
+
+	// fallocate is instant, but some filesystems can't swap to the
+	// unwritten extents it leaves.
+	if err := run(ctx, "fallocate", "-l", strconv.Itoa(mb)+"M", SwapFile); err != nil {
+		os.Remove(SwapFile)
+		if err := run(ctx, "dd", "if=/dev/zero", "of="+SwapFile, "bs=1M", "count="+strconv.Itoa(mb)); err != nil {
+			os.Remove(SwapFile)
+			return fmt.Errorf("failed to create %s: %w", SwapFile, err)
+		}
+	}
+	if err := os.Chmod(SwapFile, 0600); err != nil {
+		return err
+	}
+	if err := run(ctx, "mkswap", SwapFile); err != nil {
+		return err
+	}
+	if err := run(ctx, "swapon", SwapFile); err != nil {
+		return err
+	}
+	return setFstabEntry(true)
+}
+
+func swapActive(path string) (bool, error) {
+	data, err := os.ReadFile("/proc/swaps")
+	if err != nil {
+		return false, fmt.Errorf("failed to read /proc/swaps: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setFstabEntry adds or removes the swapfile's line in fstab, so it is
+// turned on at boot.
+func setFstabEntry(present bool) error {
+	data, err := os.ReadFile(fstab)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", fstab, err)
+	}
+
+	var lines []string
+	found := false
+	if text := strings.TrimRight(string(data), "\n"); text != "" {
+		for _, line := range strings.Split(text, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == SwapFile {
+				found = true
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	if found == present {
+		return nil
+	}
+	if present {
+		lines = append(lines, SwapFile+" none swap sw 0 0")
+	}
+	return writeFile(fstab, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
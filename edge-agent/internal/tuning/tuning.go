@@ -0,0 +1,168 @@
+// Package tuning changes kernel parameters and swap on the host. Settings
+// are applied live and persisted, so they survive a reboot.
+package tuning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// sysctlConf holds the parameters the agent manages. The 90 prefix puts it
+// after the distribution's defaults.
+const sysctlConf = "/etc/sysctl.d/90-edge-agent.conf"
+
+// Sysctl reads a kernel parameter, e.g. "vm.swappiness".
+func Sysctl(name string) (string, error) {
+	data, err := os.ReadFile(sysctlPath(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
+
+// SetSysctl changes a kernel parameter on the running system.
+func SetSysctl(name, value string) error {
+	if err := os.WriteFile(sysctlPath(name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
+
+func sysctlPath(name string) string {
+	return filepath.Join("/proc/sys", strings.ReplaceAll(name, ".", "/"))
+}
+
+// PersistSysctls merges values into the agent's sysctl.d file. An empty
+// value takes the parameter out, leaving it to the rest of the system's
+// configuration. The file is removed once nothing is left in it.
+func PersistSysctls(values map[string]string) error {
+	current := make(map[string]string)
+	if data, err := os.ReadFile(sysctlConf); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if name, value, ok := strings.Cut(line, "="); ok {
+				current[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", sysctlConf, err)
+	}
+
+	for name, value := range values {
+		if value == "" {
+			delete(current, name)
+		} else {
+			current[name] = value
+		}
+	}
+	if len(current) == 0 {
+		if err := os.Remove(sysctlConf); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", sysctlConf, err)
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("# Managed by the edge agent, changes are overwritten by node tuning.\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, current[name])
+	}
+	return writeFile(sysctlConf, []byte(b.String()), 0644)
+}
+
+// Paths lists what changing the given kernel parameters, and the swapfile
+// if swap is set, writes to.
+func Paths(sysctls []string, swap bool) []string {
+	var paths []string
+	for _, name := range sysctls {
+		paths = append(paths, sysctlPath(name))
+	}
+	if len(sysctls) > 0 {
+		paths = append(paths, filepath.Dir(sysctlConf))
+	}
+	if swap {
+		paths = append(paths, filepath.Dir(SwapFile), fstab)
+	}
+	return paths
+}
+
+// Writable checks that the agent may write each path, without changing
+// any of them. The shipped systemd unit's ProtectSystem=strict and
+// ProtectKernelTunables=yes make all of them read-only, which is reported
+// as such rather than as whichever write fails first.
+func Writable(paths ...string) error {
+	var blocked []string
+	for _, path := range paths {
+		if errors.Is(probeWrite(path), syscall.EROFS) {
+			blocked = append(blocked, path)
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("%s read-only to the agent: its service sandbox blocks node tuning, set ProtectSystem=yes and ProtectKernelTunables=no in a drop-in for the agent's unit to allow it", strings.Join(blocked, ", "))
+	}
+	return nil
+}
+
+// probeWrite opens a file for writing without writing to it, or creates
+// and removes a file in a directory. A path that doesn't exist yet is
+// checked through its parent.
+func probeWrite(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && filepath.Dir(path) != path {
+		return probeWrite(filepath.Dir(path))
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	f, err := os.CreateTemp(path, ".edge-agent-probe-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
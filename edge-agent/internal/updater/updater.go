@@ -0,0 +1,258 @@
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/downloader"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StateIdle        = "idle"
+	StateUpToDate    = "up_to_date"
+	StatePinned      = "pinned"
+	StateDownloading = "downloading"
+	StateRestarting  = "restarting"
+	StateFailed      = "failed"
+)
+
+// Release describes an agent build published by the control plane.
+type Release struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"` // base64 ed25519 signature of the binary
+}
+
+// Status is reported in heartbeats.
+type Status struct {
+	State            string    `json:"state"`
+	CurrentVersion   string    `json:"current_version"`
+	AvailableVersion string    `json:"available_version,omitempty"`
+	PinnedVersion    string    `json:"pinned_version,omitempty"`
+	LastCheck        time.Time `json:"last_check,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+type Options struct {
+	CurrentVersion string
+	PinnedVersion  string
+	PublicKey      string // base64 ed25519 public key releases must be signed with
+	AllowUnsigned  bool   // install releases without PublicKey, unverified
+	SystemdUnit    string
+	Services       service.Manager
+}
+
+type Updater struct {
+	opts       Options
+	publicKey  ed25519.PublicKey
+	downloader *downloader.Downloader
+	logger     *logrus.Entry
+
+	mu     sync.Mutex
+	status Status
+}
+
+func New(opts Options, dl *downloader.Downloader, logger *logrus.Entry) (*Updater, error) {
+	var publicKey ed25519.PublicKey
+	if opts.PublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(opts.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid update public key")
+		}
+		publicKey = ed25519.PublicKey(key)
+	}
+
+	return &Updater{
+		opts:       opts,
+		publicKey:  publicKey,
+		downloader: dl,
+		logger:     logger.WithField("component", "updater"),
+		status: Status{
+			State:          StateIdle,
+			CurrentVersion: opts.CurrentVersion,
+			PinnedVersion:  opts.PinnedVersion,
+		},
+	}, nil
+}
+
+func (u *Updater) Status() Status {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status
+}
+
+func (u *Updater) setState(state string, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status.State = state
+	if err != nil {
+		u.status.LastError = err.Error()
+	}
+}
+
+// Apply installs rel if it is newer than the running version, or is the
+// pinned version, which is the only way to downgrade. On success the agent
+// is restarted by its service manager, so Apply normally does not get to
+// return before the process exits.
+func (u *Updater) Apply(ctx context.Context, rel Release) error {
+	u.mu.Lock()
+	u.status.LastCheck = time.Now()
+	u.status.AvailableVersion = rel.Version
+	u.status.LastError = ""
+	u.mu.Unlock()
+
+	if rel.Version == "" || rel.Version == u.opts.CurrentVersion {
+		u.setState(StateUpToDate, nil)
+		return nil
+	}
+	if u.opts.PinnedVersion != "" && rel.Version != u.opts.PinnedVersion {
+		u.setState(StatePinned, nil)
+		return nil
+	}
+	if u.opts.PinnedVersion == "" {
+		newer, err := newerVersion(rel.Version, u.opts.CurrentVersion)
+		if err == nil && !newer {
+			err = fmt.Errorf("refusing to downgrade from %s to %s, pin the version to allow it", u.opts.CurrentVersion, rel.Version)
+		}
+		if err != nil {
+			u.setState(StateFailed, err)
+			return err
+		}
+	}
+
+	if err := u.install(ctx, rel); err != nil {
+		u.setState(StateFailed, err)
+		return err
+	}
+
+	u.setState(StateRestarting, nil)
+	u.logger.WithField("version", rel.Version).Info("Agent binary updated, restarting")
+
+	if err := u.opts.Services.RestartDetached(u.opts.SystemdUnit); err != nil {
+		err = fmt.Errorf("failed to restart agent: %w", err)
+		u.setState(StateFailed, err)
+		return err
+	}
+	return nil
+}
+
+func (u *Updater) install(ctx context.Context, rel Release) error {
+	if rel.URL == "" || rel.SHA256 == "" {
+		return fmt.Errorf("release %s is missing url or checksum", rel.Version)
+	}
+	if u.publicKey == nil && !u.opts.AllowUnsigned {
+		return fmt.Errorf("no update_public_key to verify release %s with, set allow_unsigned_update to install it anyway", rel.Version)
+	}
+	if u.publicKey != nil && rel.Signature == "" {
+		return fmt.Errorf("release %s is not signed", rel.Version)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	u.setState(StateDownloading, nil)
+
+	// Stage next to the running binary so the final rename stays on one filesystem.
+	staged := exe + ".new"
+	if err := u.downloader.Download(ctx, downloader.Request{
+		URL:    rel.URL,
+		Dest:   staged,
+		SHA256: rel.SHA256,
+	}); err != nil {
+		return fmt.Errorf("failed to download release: %w", err)
+	}
+
+	if u.publicKey != nil {
+		if err := u.verifySignature(staged, rel.Signature); err != nil {
+			os.Remove(staged)
+			return err
+		}
+	}
+
+	if err := os.Chmod(staged, 0755); err != nil {
+		os.Remove(staged)
+		return err
+	}
+
+	if err := os.Rename(staged, exe); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to swap binary: %w", err)
+	}
+
+	return nil
+}
+
+func (u *Updater) verifySignature(path, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid release signature: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(u.publicKey, data, sig) {
+		return fmt.Errorf("release signature verification failed")
+	}
+	return nil
+}
+
+// newerVersion reports whether version a is newer than b, comparing
+// dotted numbers and ignoring a leading v and any -pre or +build suffix.
+func newerVersion(a, b string) (bool, error) {
+	pa, err := parseVersion(a)
+	if err != nil {
+		return false, err
+	}
+	pb, err := parseVersion(b)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y, nil
+		}
+	}
+	return false, nil
+}
+
+func parseVersion(v string) ([]int, error) {
+	core := strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	var parts []int
+	for _, field := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("can't compare version %q", v)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
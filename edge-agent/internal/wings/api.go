@@ -0,0 +1,130 @@
+package wings
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIClient calls the local Wings API using the credentials in its
+// config.yml, re-read on every call so token changes are picked up.
+type APIClient struct {
+	configPath string
+	client     *http.Client
+}
+
+func NewAPIClient(configPath string) *APIClient {
+	return &APIClient{
+		configPath: configPath,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				// The certificate is issued for the public FQDN, we connect locally.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+// LocalAPIURL is where Wings' API can be reached from the node itself.
+func (c *DaemonConfig) LocalAPIURL() string {
+	host := c.API.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	port := c.API.Port
+	if port == 0 {
+		port = 8080
+	}
+	scheme := "http"
+	if c.API.SSL.Enabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func (c *APIClient) Do(method, path string, body, out interface{}) error {
+	cfg, err := LoadConfig(c.configPath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, cfg.LocalAPIURL()+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("Wings API %s: HTTP %d", req.URL.Path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// CreateBackup asks Wings to archive a server's volume with the local
+// adapter. Wings runs the backup in the background.
+func (c *APIClient) CreateBackup(server, backupUUID, ignore string) error {
+	return c.Do("POST", "/api/servers/"+server+"/backup", map[string]string{
+		"adapter": "wings",
+		"uuid":    backupUUID,
+		"ignore":  ignore,
+	}, nil)
+}
+
+func (c *APIClient) DeleteBackup(server, backupUUID string) error {
+	return c.Do("DELETE", "/api/servers/"+server+"/backup/"+backupUUID, nil, nil)
+}
+
+// ServerState is a server as listed by Wings.
+type ServerState struct {
+	UUID  string `json:"uuid"`
+	State string `json:"state"` // offline, starting, running or stopping
+}
+
+func (c *APIClient) Servers() ([]ServerState, error) {
+	var servers []struct {
+		State         string `json:"state"`
+		Configuration struct {
+			UUID string `json:"uuid"`
+		} `json:"configuration"`
+	}
+	if err := c.Do("GET", "/api/servers", nil, &servers); err != nil {
+		return nil, err
+	}
+
+	out := make([]ServerState, 0, len(servers))
+	for _, s := range servers {
+		out = append(out, ServerState{UUID: s.Configuration.UUID, State: s.State})
+	}
+	return out, nil
+}
+
+// Power sends a power action (start, stop, restart, kill) to a server.
+func (c *APIClient) Power(server, action string) error {
+	return c.Do("POST", "/api/servers/"+server+"/power", map[string]interface{}{
+		"action": action,
+	}, nil)
+}
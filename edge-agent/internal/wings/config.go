@@ -0,0 +1,183 @@
+package wings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Previous Wings configs kept next to config.yml.
+const maxConfigBackups = 5
+
+// DaemonConfig is Wings' config.yml. Only the fields the agent validates or
+// reads are typed; everything else round-trips through Extra untouched.
+type DaemonConfig struct {
+	Debug   bool                   `yaml:"debug"`
+	UUID    string                 `yaml:"uuid"`
+	TokenID string                 `yaml:"token_id"`
+	Token   string                 `yaml:"token"`
+	API     APIConfig              `yaml:"api"`
+	Remote  string                 `yaml:"remote"`
+	Extra   map[string]interface{} `yaml:",inline"`
+}
+
+type APIConfig struct {
+	Host  string                 `yaml:"host"`
+	Port  int                    `yaml:"port"`
+	SSL   SSLConfig              `yaml:"ssl"`
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+type SSLConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Cert    string `yaml:"cert,omitempty"`
+	Key     string `yaml:"key,omitempty"`
+}
+
+// ParseConfig converts the loosely typed config sent by the control plane.
+func ParseConfig(raw map[string]interface{}) (*DaemonConfig, error) {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cfg DaemonConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse Wings config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// LoadConfig reads a Wings config.yml from disk.
+func LoadConfig(path string) (*DaemonConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Wings config: %w", err)
+	}
+	var cfg DaemonConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse Wings config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// BackupDirectory is where Wings' local adapter writes backup archives.
+func (c *DaemonConfig) BackupDirectory() string {
+	if dir, ok := nestedMap(c.Extra, "system")["backup_directory"].(string); ok && dir != "" {
+		return dir
+	}
+	return "/var/lib/pterodactyl/backups"
+}
+
+// SFTPPort is where Wings' built-in SFTP server listens.
+func (c *DaemonConfig) SFTPPort() int {
+	if port, ok := nestedMap(c.Extra, "system", "sftp")["bind_port"].(int); ok && port > 0 {
+		return port
+	}
+	return 2022
+}
+
+// DataDirectory holds one volume directory per server, named by its UUID.
+func (c *DaemonConfig) DataDirectory() string {
+	if dir, ok := nestedMap(c.Extra, "system")["data"].(string); ok && dir != "" {
+		return dir
+	}
+	return "/var/lib/pterodactyl/volumes"
+}
+
+// Validate checks the fields Wings refuses to start without.
+func (c *DaemonConfig) Validate() error {
+	var problems []string
+	if c.UUID == "" {
+		problems = append(problems, "uuid is required")
+	}
+	if c.TokenID == "" || c.Token == "" {
+		problems = append(problems, "token_id and token are required")
+	}
+	if c.Remote == "" {
+		problems = append(problems, "remote is required")
+	}
+	if c.API.Port <= 0 || c.API.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("api.port %d is out of range", c.API.Port))
+	}
+	if c.API.SSL.Enabled && (c.API.SSL.Cert == "" || c.API.SSL.Key == "") {
+		problems = append(problems, "api.ssl.cert and api.ssl.key are required when ssl is enabled")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid Wings config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// WriteConfig validates and atomically replaces the Wings config, keeping a
+// timestamped copy of the previous one. It returns the backup path, empty
+// if there was no previous config.
+func (m *Manager) WriteConfig(cfg *DaemonConfig) (string, error) {
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Wings config: %w", err)
+	}
+
+	path := m.cfg.ConfigPath
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	var backup string
+	if _, err := os.Stat(path); err == nil {
+		backup = fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+		if err := copyFile(path, backup); err != nil {
+			return "", fmt.Errorf("failed to back up Wings config: %w", err)
+		}
+		os.Chmod(backup, 0600)
+		m.pruneConfigBackups()
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write Wings config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write Wings config: %w", err)
+	}
+
+	m.logger.WithField("backup", backup).Info("Wrote Wings config")
+	return backup, nil
+}
+
+// RestoreConfig puts a backup taken by WriteConfig back in place.
+func (m *Manager) RestoreConfig(backup string) error {
+	tmp := m.cfg.ConfigPath + ".tmp"
+	if err := copyFile(backup, tmp); err != nil {
+		return fmt.Errorf("failed to restore Wings config: %w", err)
+	}
+	os.Chmod(tmp, 0600)
+	if err := os.Rename(tmp, m.cfg.ConfigPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to restore Wings config: %w", err)
+	}
+	m.logger.WithField("backup", backup).Warn("Restored previous Wings config")
+	return nil
+}
+
+func (m *Manager) pruneConfigBackups() {
+	backups, _ := filepath.Glob(m.cfg.ConfigPath + ".*.bak")
+	if len(backups) <= maxConfigBackups {
+		return
+	}
+	// The timestamp format sorts chronologically.
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-maxConfigBackups] {
+		os.Remove(old)
+	}
+}
@@ -0,0 +1,182 @@
+package wings
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const consoleProbeTimeout = 15 * time.Second
+
+// ConsoleProbeResult is reported in heartbeats separately from the API
+// probe: Wings can answer its API while consoles fail to connect.
+type ConsoleProbeResult struct {
+	Healthy             bool      `json:"healthy"`
+	Skipped             bool      `json:"skipped,omitempty"` // no servers to open a console for
+	Server              string    `json:"server,omitempty"`
+	Stage               string    `json:"stage,omitempty"` // where it failed: config, dial, auth or frame
+	LatencyMs           float64   `json:"latency_ms"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CheckedAt           time.Time `json:"checked_at"`
+}
+
+// ConsoleProber opens a server console the way the panel does: a
+// websocket to Wings, authenticated with a JWT signed by the node token.
+type ConsoleProber struct {
+	configPath string
+	api        *APIClient
+
+	mu   sync.Mutex
+	last *ConsoleProbeResult
+}
+
+func NewConsoleProber(configPath string) *ConsoleProber {
+	return &ConsoleProber{configPath: configPath, api: NewAPIClient(configPath)}
+}
+
+// Last is nil until the first probe.
+func (p *ConsoleProber) Last() *ConsoleProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+func (p *ConsoleProber) Probe(ctx context.Context) ConsoleProbeResult {
+	result := ConsoleProbeResult{CheckedAt: time.Now()}
+	start := time.Now()
+
+	stage, err := p.probe(ctx, &result)
+	switch {
+	case err != nil:
+		result.Stage = stage
+		result.Error = err.Error()
+	case !result.Skipped:
+		result.Healthy = true
+		result.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	}
+
+	p.mu.Lock()
+	if err != nil && p.last != nil {
+		result.ConsecutiveFailures = p.last.ConsecutiveFailures + 1
+	} else if err != nil {
+		result.ConsecutiveFailures = 1
+	}
+	p.last = &result
+	p.mu.Unlock()
+
+	return result
+}
+
+func (p *ConsoleProber) probe(ctx context.Context, result *ConsoleProbeResult) (string, error) {
+	cfg, err := LoadConfig(p.configPath)
+	if err != nil {
+		return "config", err
+	}
+	servers, err := p.api.Servers()
+	if err != nil {
+		return "config", fmt.Errorf("failed to list servers: %w", err)
+	}
+	if len(servers) == 0 {
+		result.Skipped = true
+		return "", nil
+	}
+	// A running server's console is the one players would be looking at.
+	server := servers[0].UUID
+	for _, s := range servers {
+		if s.State == "running" {
+			server = s.UUID
+			break
+		}
+	}
+	result.Server = server
+
+	token, err := consoleToken(cfg, server)
+	if err != nil {
+		return "config", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, consoleProbeTimeout)
+	defer cancel()
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: consoleProbeTimeout,
+		// The certificate is issued for the public FQDN, we connect locally.
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	url := strings.Replace(cfg.LocalAPIURL(), "http", "ws", 1) + "/api/servers/" + server + "/ws"
+	// Wings only accepts consoles opened from the panel's origin.
+	header := http.Header{"Origin": {strings.TrimSuffix(cfg.Remote, "/")}}
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return "dial", fmt.Errorf("websocket handshake: HTTP %d", resp.StatusCode)
+		}
+		return "dial", err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetWriteDeadline(deadline)
+	conn.SetReadDeadline(deadline)
+
+	if err := conn.WriteJSON(consoleMessage{Event: "auth", Args: []string{token}}); err != nil {
+		return "auth", fmt.Errorf("failed to send auth: %w", err)
+	}
+	for {
+		var msg consoleMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return "frame", fmt.Errorf("no auth response: %w", err)
+		}
+		switch msg.Event {
+		case "auth success":
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return "", nil
+		case "jwt error", "token expired", "daemon error":
+			return "auth", fmt.Errorf("%s: %s", msg.Event, strings.Join(msg.Args, " "))
+		}
+	}
+}
+
+type consoleMessage struct {
+	Event string   `json:"event"`
+	Args  []string `json:"args,omitempty"`
+}
+
+// consoleToken signs a short-lived console JWT with the claims Wings checks.
+func consoleToken(cfg *DaemonConfig, server string) (string, error) {
+	if cfg.Token == "" {
+		return "", fmt.Errorf("wings config has no token")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":         strings.TrimSuffix(cfg.Remote, "/"),
+		"aud":         []string{cfg.LocalAPIURL()},
+		"jti":         hex.EncodeToString(id),
+		"iat":         now.Unix(),
+		"nbf":         now.Add(-5 * time.Second).Unix(),
+		"exp":         now.Add(time.Minute).Unix(),
+		"server_uuid": server,
+		"permissions": []string{"websocket.connect"},
+		"user_uuid":   "00000000-0000-0000-0000-000000000000",
+		"unique_id":   hex.EncodeToString(id),
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Token))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign console token: %w", err)
+	}
+	return signed, nil
+}
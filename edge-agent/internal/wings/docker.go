@@ -0,0 +1,268 @@
+package wings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	dockerUnit       = "docker.service"
+	dockerDaemonJSON = "/etc/docker/daemon.json"
+)
+
+// DockerDaemonSpec holds the daemon.json settings the control plane
+// manages. Empty fields leave the node's current value alone; any other
+// keys in daemon.json are preserved.
+type DockerDaemonSpec struct {
+	LogDriver       string            `json:"log_driver,omitempty"`
+	LogOpts         map[string]string `json:"log_opts,omitempty"`
+	StorageDriver   string            `json:"storage_driver,omitempty"`
+	RegistryMirrors []string          `json:"registry_mirrors,omitempty"`
+
+	// DefaultUlimits apply to every container, keyed by name, e.g. "nofile".
+	// An empty, non-nil map removes them.
+	DefaultUlimits map[string]DockerUlimit `json:"default_ulimits,omitempty"`
+}
+
+// DockerUlimit is a ulimit as daemon.json spells it.
+type DockerUlimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
+}
+
+// DockerStatus describes the Docker daemon as it is running.
+type DockerStatus struct {
+	Installed       bool     `json:"installed"`
+	Active          bool     `json:"active"`
+	Version         string   `json:"version,omitempty"`
+	StorageDriver   string   `json:"storage_driver,omitempty"`
+	LogDriver       string   `json:"log_driver,omitempty"`
+	RegistryMirrors []string `json:"registry_mirrors,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// InstallDocker installs Docker if it's missing and makes sure it runs.
+func (m *Manager) InstallDocker(ctx context.Context) error {
+	return m.ensureDocker(ctx)
+}
+
+// DockerStatus queries the daemon for the settings it actually applied.
+func (m *Manager) DockerStatus() DockerStatus {
+	var status DockerStatus
+	if _, err := exec.LookPath("dockerd"); err != nil {
+		return status
+	}
+	status.Installed = true
+	status.Active = m.services.IsActive(dockerUnit)
+	if !status.Active {
+		return status
+	}
+
+	var info struct {
+		ServerVersion  string `json:"ServerVersion"`
+		Driver         string `json:"Driver"`
+		LoggingDriver  string `json:"LoggingDriver"`
+		RegistryConfig struct {
+			Mirrors []string `json:"Mirrors"`
+		} `json:"RegistryConfig"`
+	}
+	if _, err := dockerRequest("GET", "/info", nil, &info); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Version = info.ServerVersion
+	status.StorageDriver = info.Driver
+	status.LogDriver = info.LoggingDriver
+	status.RegistryMirrors = info.RegistryConfig.Mirrors
+	return status
+}
+
+// ConfigureDocker merges spec into daemon.json and restarts Docker. If the
+// daemon doesn't come back the previous file is restored. Wings is bound to
+// docker.service, so it restarts along with it.
+func (m *Manager) ConfigureDocker(spec DockerDaemonSpec) error {
+	previous, err := os.ReadFile(dockerDaemonJSON)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read daemon.json: %w", err)
+	}
+
+	settings := make(map[string]interface{})
+	if len(previous) > 0 {
+		if err := json.Unmarshal(previous, &settings); err != nil {
+			return fmt.Errorf("failed to parse daemon.json: %w", err)
+		}
+	}
+	if spec.LogDriver != "" {
+		settings["log-driver"] = spec.LogDriver
+	}
+	if spec.LogOpts != nil {
+		settings["log-opts"] = spec.LogOpts
+	}
+	if spec.StorageDriver != "" {
+		settings["storage-driver"] = spec.StorageDriver
+	}
+	if spec.RegistryMirrors != nil {
+		settings["registry-mirrors"] = spec.RegistryMirrors
+	}
+	if spec.DefaultUlimits != nil {
+		if len(spec.DefaultUlimits) == 0 {
+			delete(settings, "default-ulimits")
+		} else {
+			settings["default-ulimits"] = spec.DefaultUlimits
+		}
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeDaemonJSON(data); err != nil {
+		return err
+	}
+
+	// Newer dockerd can check the file without starting, catch typos early.
+	if out, err := exec.Command("dockerd", "--validate", "--config-file", dockerDaemonJSON).CombinedOutput(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && len(out) > 0 && !isUnknownFlag(out) {
+			m.restoreDaemonJSON(previous)
+			return fmt.Errorf("invalid daemon.json: %s", lastLine(out))
+		}
+	}
+
+	if err := m.RestartDocker(); err != nil {
+		m.logger.WithError(err).Warn("Docker failed to start with new daemon.json, rolling back")
+		m.restoreDaemonJSON(previous)
+		if rbErr := m.RestartDocker(); rbErr != nil {
+			return fmt.Errorf("Docker failed to start (%v) and previous config did not come back: %w", err, rbErr)
+		}
+		return fmt.Errorf("Docker failed to start, previous daemon.json restored: %w", err)
+	}
+
+	m.logger.Info("Docker daemon reconfigured")
+	return nil
+}
+
+// DockerDefaultUlimits returns the default-ulimits in daemon.json, nil when
+// there are none.
+func (m *Manager) DockerDefaultUlimits() (map[string]DockerUlimit, error) {
+	data, err := os.ReadFile(dockerDaemonJSON)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daemon.json: %w", err)
+	}
+	var settings struct {
+		DefaultUlimits map[string]DockerUlimit `json:"default-ulimits"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse daemon.json: %w", err)
+	}
+	return settings.DefaultUlimits, nil
+}
+
+// RestartDocker restarts the Docker daemon and waits for its API to answer.
+func (m *Manager) RestartDocker() error {
+	if err := m.services.Restart(context.Background(), dockerUnit); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, err := dockerRequest("GET", "/_ping", nil, nil); err == nil {
+			m.logger.Info("Docker daemon restarted successfully")
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("Docker did not come back after restart: %w", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (m *Manager) restoreDaemonJSON(previous []byte) {
+	var err error
+	if previous == nil {
+		err = os.Remove(dockerDaemonJSON)
+	} else {
+		err = writeDaemonJSON(previous)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		m.logger.WithError(err).Error("Failed to restore daemon.json")
+	}
+}
+
+func writeDaemonJSON(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dockerDaemonJSON), 0755); err != nil {
+		return err
+	}
+	tmp := dockerDaemonJSON + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write daemon.json: %w", err)
+	}
+	if err := os.Rename(tmp, dockerDaemonJSON); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write daemon.json: %w", err)
+	}
+	return nil
+}
+
+// Docker before 23.0 has no --validate.
+func isUnknownFlag(out []byte) bool {
+	return strings.Contains(string(out), "unknown flag")
+}
+
+// PullImage pulls image, or refreshes it if it's already present. Progress
+// is streamed back by Docker; an error part way through only shows up in
+// the stream, not in the status code.
+func (m *Manager) PullImage(ctx context.Context, image string) error {
+	ref, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		ref, tag = image[:i], image[i+1:]
+	}
+	query := url.Values{"fromImage": {ref}, "tag": {tag}}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://docker/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	// Large images take far longer than dockerHTTP's timeout; ctx bounds it.
+	client := &http.Client{Transport: dockerHTTP.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("failed to pull %s: HTTP %d", image, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to pull %s: %w", image, err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, progress.Error)
+		}
+	}
+}
+
+// Installed reports whether the Wings binary is in place.
+func (m *Manager) Installed() bool {
+	_, err := os.Stat(m.cfg.BinaryPath)
+	return err == nil
+}
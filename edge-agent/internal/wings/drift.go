@@ -0,0 +1,131 @@
+package wings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Drift compares Wings' config.yml with the last config the control plane
+// sent. Fields are the dotted paths that differ; values are left out since
+// the config holds the node token.
+type Drift struct {
+	Detected    bool      `json:"detected"`
+	DesiredHash string    `json:"desired_hash"`
+	ActualHash  string    `json:"actual_hash,omitempty"`
+	Fields      []string  `json:"fields,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+	Remediated  time.Time `json:"remediated,omitempty"`
+}
+
+// CompareConfig checks the config at path against desired. Formatting,
+// comments and key order don't count, nor do the ignored dotted paths.
+func CompareConfig(path string, desired *DaemonConfig, ignore []string) Drift {
+	drift := Drift{CheckedAt: time.Now().UTC()}
+
+	want, err := normalize(desired, ignore)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.DesiredHash = digest(want)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		drift.Error = err.Error()
+		drift.Detected = os.IsNotExist(err)
+		return drift
+	}
+	var actual DaemonConfig
+	if err := yaml.Unmarshal(data, &actual); err != nil {
+		drift.Error = fmt.Sprintf("failed to parse Wings config: %v", err)
+		drift.Detected = true
+		return drift
+	}
+	have, err := normalize(&actual, ignore)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.ActualHash = digest(have)
+
+	if drift.ActualHash != drift.DesiredHash {
+		drift.Detected = true
+		drift.Fields = diffPaths("", want, have)
+		sort.Strings(drift.Fields)
+	}
+	return drift
+}
+
+// normalize round-trips the config through a generic map, so both sides
+// are compared in the same shape.
+func normalize(cfg *DaemonConfig, ignore []string) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for _, path := range ignore {
+		deletePath(raw, strings.Split(path, "."))
+	}
+	return raw, nil
+}
+
+// deletePath removes a dotted path, and parents it leaves empty.
+func deletePath(m map[string]interface{}, keys []string) {
+	if len(keys) == 1 {
+		delete(m, keys[0])
+		return
+	}
+	if next, ok := m[keys[0]].(map[string]interface{}); ok {
+		deletePath(next, keys[1:])
+		if len(next) == 0 {
+			delete(m, keys[0])
+		}
+	}
+}
+
+// digest hashes the map; yaml.v3 sorts map keys, so equal maps hash alike.
+func digest(m map[string]interface{}) string {
+	data, _ := yaml.Marshal(m)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func diffPaths(prefix string, want, have map[string]interface{}) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for key, w := range want {
+		seen[key] = true
+		paths = append(paths, diffValue(prefix+key, w, have[key])...)
+	}
+	for key, h := range have {
+		if !seen[key] {
+			paths = append(paths, diffValue(prefix+key, nil, h)...)
+		}
+	}
+	return paths
+}
+
+func diffValue(path string, want, have interface{}) []string {
+	wm, wok := want.(map[string]interface{})
+	hm, hok := have.(map[string]interface{})
+	if wok && hok {
+		return diffPaths(path+".", wm, hm)
+	}
+	if reflect.DeepEqual(want, have) {
+		return nil
+	}
+	return []string{path}
+}
@@ -0,0 +1,88 @@
+package wings
+
+import (
+	"fmt"
+	"time"
+)
+
+// DockerImage is an image in Docker's cache.
+type DockerImage struct {
+	ID      string    `json:"id"`
+	Tags    []string  `json:"tags,omitempty"`
+	Digests []string  `json:"digests,omitempty"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	InUse   bool      `json:"in_use"` // some container, running or not, was created from it
+}
+
+// ListImages lists the cached images. A game server's container exists
+// while the server is stopped, so an image is only unused once no
+// container at all refers to it.
+func (m *Manager) ListImages() ([]DockerImage, error) {
+	var images []struct {
+		ID          string   `json:"Id"`
+		RepoTags    []string `json:"RepoTags"`
+		RepoDigests []string `json:"RepoDigests"`
+		Size        int64    `json:"Size"`
+		Created     int64    `json:"Created"`
+	}
+	if _, err := dockerRequest("GET", "/images/json", nil, &images); err != nil {
+		return nil, err
+	}
+	var containers []struct {
+		ImageID string `json:"ImageID"`
+	}
+	if _, err := dockerRequest("GET", "/containers/json?all=1", nil, &containers); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		used[c.ImageID] = true
+	}
+
+	out := make([]DockerImage, 0, len(images))
+	for _, img := range images {
+		image := DockerImage{
+			ID:      img.ID,
+			Digests: img.RepoDigests,
+			Size:    img.Size,
+			Created: time.Unix(img.Created, 0).UTC(),
+			InUse:   used[img.ID],
+		}
+		for _, tag := range img.RepoTags {
+			if tag != "<none>:<none>" {
+				image.Tags = append(image.Tags, tag)
+			}
+		}
+		out = append(out, image)
+	}
+	return out, nil
+}
+
+// RemoveImage deletes an image. Removing it by ID would need force when
+// it has several tags, which also pulls it out from under containers, so
+// each tag is removed instead and Docker deletes the image with the last.
+// Docker still refuses while a container uses the image.
+func (m *Manager) RemoveImage(image DockerImage) error {
+	refs := image.Tags
+	if len(refs) == 0 {
+		refs = []string{image.ID}
+	}
+	for _, ref := range refs {
+		if _, err := dockerRequest("DELETE", "/images/"+ref, nil, nil); err != nil {
+			return fmt.Errorf("failed to remove image %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// DockerRootDir returns where Docker keeps its images.
+func (m *Manager) DockerRootDir() (string, error) {
+	var info struct {
+		DockerRootDir string `json:"DockerRootDir"`
+	}
+	if _, err := dockerRequest("GET", "/info", nil, &info); err != nil {
+		return "", err
+	}
+	return info.DockerRootDir, nil
+}
@@ -0,0 +1,143 @@
+package wings
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	CauseDownload  = "download_failure"
+	CauseOOM       = "out_of_memory"
+	CauseDiskFull  = "disk_full"
+	CauseScriptErr = "script_error"
+)
+
+// InstallFailure is a classified failed server installation.
+type InstallFailure struct {
+	ServerUUID string    `json:"server_uuid"`
+	Cause      string    `json:"cause"`
+	Line       string    `json:"line"`
+	LogPath    string    `json:"log_path"`
+	Time       time.Time `json:"time"`
+}
+
+// Checked in order, so the more specific causes win over generic errors.
+var installFailurePatterns = []struct {
+	cause string
+	re    *regexp.Regexp
+}{
+	{CauseDiskFull, regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`)},
+	{CauseOOM, regexp.MustCompile(`(?i)out of memory|oomkilled|exit code:? 137|^killed$`)},
+	{CauseDownload, regexp.MustCompile(`(?i)curl: \(\d+\)|could not resolve host|failed to download|wget: .*(error|failed)|404 not found|connection (timed out|refused)`)},
+	{CauseScriptErr, regexp.MustCompile(`(?i)exit code:? [1-9]\d*|^error:`)},
+}
+
+// InstallLogScanner finds failed installations in the Wings install log
+// directory. Logs that were already reported are remembered in a state file
+// so restarts don't resend them.
+type InstallLogScanner struct {
+	dir       string
+	statePath string
+	seen      map[string]time.Time
+	pending   map[string]time.Time
+}
+
+func NewInstallLogScanner(logDir, statePath string) *InstallLogScanner {
+	s := &InstallLogScanner{
+		dir:       logDir,
+		statePath: statePath,
+		seen:      make(map[string]time.Time),
+		pending:   make(map[string]time.Time),
+	}
+
+	if data, err := os.ReadFile(statePath); err == nil {
+		json.Unmarshal(data, &s.seen)
+	}
+
+	return s
+}
+
+// Scan returns failures from logs that are new or changed since the last
+// call. Call Commit once they have been reported.
+func (s *InstallLogScanner) Scan() ([]InstallFailure, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var failures []InstallFailure
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(s.dir, entry.Name())
+		if seen, ok := s.seen[path]; ok && !info.ModTime().After(seen) {
+			continue
+		}
+
+		if failure, ok := classifyInstallLog(path); ok {
+			failure.ServerUUID = strings.TrimSuffix(entry.Name(), ".log")
+			failure.Time = info.ModTime()
+			failures = append(failures, failure)
+		}
+		s.pending[path] = info.ModTime()
+	}
+
+	return failures, nil
+}
+
+func (s *InstallLogScanner) Commit() error {
+	for path, modTime := range s.pending {
+		s.seen[path] = modTime
+	}
+	s.pending = make(map[string]time.Time)
+
+	data, err := json.Marshal(s.seen)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath, data, 0600)
+}
+
+func classifyInstallLog(path string) (InstallFailure, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return InstallFailure{}, false
+	}
+	defer f.Close()
+
+	best := -1
+	var failure InstallFailure
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for i, p := range installFailurePatterns {
+			if best >= 0 && i >= best {
+				break
+			}
+			if p.re.MatchString(line) {
+				best = i
+				failure = InstallFailure{Cause: p.cause, Line: line, LogPath: path}
+				break
+			}
+		}
+	}
+
+	return failure, best >= 0
+}
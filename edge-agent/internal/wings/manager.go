@@ -0,0 +1,257 @@
+package wings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/downloader"
+	"github.com/pterodactyl-cp/edge-agent/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// Release identifies a Wings build to install.
+type Release struct {
+	Version string `json:"version"`
+	URL     string `json:"url,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// Manager installs, upgrades and restarts the Wings daemon.
+type Manager struct {
+	cfg        config.WingsConfig
+	services   service.Manager
+	downloader *downloader.Downloader
+	logger     *logrus.Entry
+}
+
+func NewManager(cfg config.WingsConfig, services service.Manager, dl *downloader.Downloader, logger *logrus.Entry) *Manager {
+	return &Manager{
+		cfg:        cfg,
+		services:   services,
+		downloader: dl,
+		logger:     logger.WithField("component", "wings"),
+	}
+}
+
+func (r Release) downloadURL() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	if r.Version == "" || r.Version == "latest" {
+		return fmt.Sprintf("https://github.com/pterodactyl/wings/releases/latest/download/wings_linux_%s", runtime.GOARCH)
+	}
+	return fmt.Sprintf("https://github.com/pterodactyl/wings/releases/download/v%s/wings_linux_%s",
+		strings.TrimPrefix(r.Version, "v"), runtime.GOARCH)
+}
+
+// Install sets up Wings on a fresh node: Docker, the binary and its service.
+func (m *Manager) Install(ctx context.Context, rel Release) error {
+	m.logger.WithField("version", rel.Version).Info("Installing Wings")
+
+	if err := m.ensureDocker(ctx); err != nil {
+		return fmt.Errorf("failed to set up Docker: %w", err)
+	}
+
+	if err := m.fetchBinary(ctx, rel, m.cfg.BinaryPath); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.cfg.ConfigPath), 0755); err != nil {
+		return err
+	}
+
+	if err := m.services.Install(service.Definition{
+		Name:        m.cfg.SystemdUnit,
+		Description: "Pterodactyl Wings Daemon",
+		Command:     m.cfg.BinaryPath,
+		WorkingDir:  filepath.Dir(m.cfg.ConfigPath),
+		Requires:    []string{dockerUnit},
+		OpenFiles:   4096,
+		PIDFile:     "/var/run/wings/daemon.pid",
+	}); err != nil {
+		return fmt.Errorf("failed to install Wings service: %w", err)
+	}
+
+	if err := m.services.Enable(ctx, m.cfg.SystemdUnit); err != nil {
+		return err
+	}
+
+	// Without a config Wings can't start yet; enrollment delivers one.
+	if _, err := os.Stat(m.cfg.ConfigPath); err != nil {
+		m.logger.Info("Wings installed, waiting for configuration before starting")
+		return nil
+	}
+
+	return m.Restart()
+}
+
+// Upgrade swaps the Wings binary for rel (which may also be an older
+// version) and rolls back if the new build fails its health check.
+func (m *Manager) Upgrade(ctx context.Context, rel Release) error {
+	m.logger.WithField("version", rel.Version).Info("Upgrading Wings")
+
+	staged := m.cfg.BinaryPath + ".new"
+	if err := m.fetchBinary(ctx, rel, staged); err != nil {
+		return err
+	}
+
+	backup := m.cfg.BinaryPath + ".bak"
+	if err := copyFile(m.cfg.BinaryPath, backup); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+
+	if err := os.Rename(staged, m.cfg.BinaryPath); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to swap binary: %w", err)
+	}
+
+	if err := m.Restart(); err != nil {
+		m.logger.WithError(err).Error("New Wings build failed health check, rolling back")
+
+		if rbErr := os.Rename(backup, m.cfg.BinaryPath); rbErr != nil {
+			return fmt.Errorf("upgrade failed (%v) and rollback failed: %w", err, rbErr)
+		}
+		if rbErr := m.Restart(); rbErr != nil {
+			return fmt.Errorf("upgrade failed (%v) and previous version did not come back: %w", err, rbErr)
+		}
+		return fmt.Errorf("upgrade failed, rolled back: %w", err)
+	}
+
+	os.Remove(backup)
+	return nil
+}
+
+// Restart restarts the Wings service and waits to see it come up.
+func (m *Manager) Restart() error {
+	if err := m.services.Restart(context.Background(), m.cfg.SystemdUnit); err != nil {
+		return err
+	}
+
+	// Wait a moment and check if it started successfully
+	time.Sleep(5 * time.Second)
+
+	if !m.IsActive() {
+		return fmt.Errorf("Wings service failed to start")
+	}
+
+	m.logger.Info("Wings service restarted successfully")
+	return nil
+}
+
+// RecentLogs returns the last lines Wings wrote, to explain why it failed
+// to start.
+func (m *Manager) RecentLogs(lines int) string {
+	out, _ := m.services.Logs(context.Background(), m.cfg.SystemdUnit, lines)
+	return strings.TrimSpace(out)
+}
+
+func (m *Manager) IsActive() bool {
+	return m.services.IsActive(m.cfg.SystemdUnit)
+}
+
+func (m *Manager) fetchBinary(ctx context.Context, rel Release, dest string) error {
+	if err := m.downloader.Download(ctx, downloader.Request{
+		URL:    rel.downloadURL(),
+		Dest:   dest,
+		SHA256: rel.SHA256,
+	}); err != nil {
+		return fmt.Errorf("failed to download Wings: %w", err)
+	}
+	return os.Chmod(dest, 0755)
+}
+
+// dockerPackages installs Docker from signed packages with whichever
+// package manager the node has: the distribution's own package where it
+// ships one, Docker's repository on RHEL-likes, whose docker-ce.repo has
+// gpgcheck on.
+var dockerPackages = []struct {
+	tool  string
+	steps [][]string
+}{
+	{"apt-get", [][]string{
+		{"apt-get", "update"},
+		{"apt-get", "install", "-y", "docker.io"},
+	}},
+	{"dnf", [][]string{
+		{"dnf", "install", "-y", "dnf-plugins-core"},
+		{"dnf", "config-manager", "--add-repo", "https://download.docker.com/linux/centos/docker-ce.repo"},
+		{"dnf", "install", "-y", "docker-ce", "docker-ce-cli", "containerd.io"},
+	}},
+	{"yum", [][]string{
+		{"yum", "install", "-y", "yum-utils"},
+		{"yum-config-manager", "--add-repo", "https://download.docker.com/linux/centos/docker-ce.repo"},
+		{"yum", "install", "-y", "docker-ce", "docker-ce-cli", "containerd.io"},
+	}},
+	{"zypper", [][]string{
+		{"zypper", "--non-interactive", "install", "docker"},
+	}},
+	{"apk", [][]string{
+		{"apk", "add", "docker"},
+	}},
+}
+
+func (m *Manager) ensureDocker(ctx context.Context) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		if err := m.installDocker(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := m.services.Enable(ctx, dockerUnit); err != nil {
+		return err
+	}
+	if m.services.IsActive(dockerUnit) {
+		return nil
+	}
+	return m.services.Start(ctx, dockerUnit)
+}
+
+func (m *Manager) installDocker(ctx context.Context) error {
+	for _, pkg := range dockerPackages {
+		if _, err := exec.LookPath(pkg.tool); err != nil {
+			continue
+		}
+		m.logger.WithField("package_manager", pkg.tool).Info("Docker not found, installing")
+		for _, step := range pkg.steps {
+			cmd := exec.CommandContext(ctx, step[0], step[1:]...)
+			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to install Docker, %s: %s", strings.Join(step, " "), lastLine(out))
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("docker is not installed and no supported package manager was found")
+}
+
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return lines[len(lines)-1]
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
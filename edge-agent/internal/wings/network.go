@@ -0,0 +1,278 @@
+package wings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	dockerSocket       = "/var/run/docker.sock"
+	defaultNetworkName = "pterodactyl_nw"
+	// Wings names the bridge for its network explicitly.
+	bridgeNameOption = "com.docker.network.bridge.name"
+	mtuOption        = "com.docker.network.driver.mtu"
+)
+
+// NetworkSpec is the desired shape of the Docker network Wings attaches
+// server containers to.
+type NetworkSpec struct {
+	Name      string `json:"name,omitempty"`
+	Subnet    string `json:"subnet"`
+	Gateway   string `json:"gateway"`
+	MTU       int    `json:"mtu,omitempty"`
+	IPv6      *bool  `json:"ipv6,omitempty"` // nil leaves it as Docker/Wings decide
+	SubnetV6  string `json:"subnet_v6,omitempty"`
+	GatewayV6 string `json:"gateway_v6,omitempty"`
+}
+
+// NetworkState is what Docker actually has, and how it differs from the spec.
+type NetworkState struct {
+	Name       string   `json:"name"`
+	Exists     bool     `json:"exists"`
+	Subnet     string   `json:"subnet,omitempty"`
+	Gateway    string   `json:"gateway,omitempty"`
+	MTU        int      `json:"mtu,omitempty"`
+	IPv6       bool     `json:"ipv6"`
+	Bridge     string   `json:"bridge,omitempty"`
+	BridgeUp   bool     `json:"bridge_up"`
+	Containers int      `json:"containers"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+type dockerNetwork struct {
+	Name       string `json:"Name"`
+	Driver     string `json:"Driver"`
+	EnableIPv6 bool   `json:"EnableIPv6"`
+	IPAM       struct {
+		Config []struct {
+			Subnet  string `json:"Subnet"`
+			Gateway string `json:"Gateway"`
+		} `json:"Config"`
+	} `json:"IPAM"`
+	Options    map[string]string      `json:"Options"`
+	Containers map[string]interface{} `json:"Containers"`
+}
+
+var dockerHTTP = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", dockerSocket)
+		},
+	},
+}
+
+func dockerRequest(method, path string, body, out interface{}) (int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, "http://docker"+path, &buf)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := dockerHTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("docker API %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
+
+// NetworkSpecFromConfig reads the network Wings is configured to create.
+func NetworkSpecFromConfig(cfg *DaemonConfig) NetworkSpec {
+	spec := NetworkSpec{Name: defaultNetworkName}
+
+	network := nestedMap(cfg.Extra, "docker", "network")
+	if name, ok := network["name"].(string); ok && name != "" {
+		spec.Name = name
+	}
+	if mtu, ok := network["network_mtu"].(int); ok {
+		spec.MTU = mtu
+	}
+	if ipv6, ok := network["ipv6"].(bool); ok {
+		spec.IPv6 = &ipv6
+	}
+	v4 := nestedMap(network, "interfaces", "v4")
+	spec.Subnet, _ = v4["subnet"].(string)
+	spec.Gateway, _ = v4["gateway"].(string)
+	v6 := nestedMap(network, "interfaces", "v6")
+	spec.SubnetV6, _ = v6["subnet"].(string)
+	spec.GatewayV6, _ = v6["gateway"].(string)
+
+	return spec
+}
+
+// apply writes the spec into the Wings config so Wings recreates the
+// network with it.
+func (spec NetworkSpec) apply(cfg *DaemonConfig) {
+	if cfg.Extra == nil {
+		cfg.Extra = make(map[string]interface{})
+	}
+	network := ensureMap(ensureMap(cfg.Extra, "docker"), "network")
+	network["name"] = spec.Name
+	network["network_mode"] = spec.Name
+	if spec.MTU > 0 {
+		network["network_mtu"] = spec.MTU
+	}
+	if spec.IPv6 != nil {
+		network["ipv6"] = *spec.IPv6
+	}
+
+	interfaces := ensureMap(network, "interfaces")
+	v4 := ensureMap(interfaces, "v4")
+	v4["subnet"] = spec.Subnet
+	v4["gateway"] = spec.Gateway
+	if spec.SubnetV6 != "" {
+		v6 := ensureMap(interfaces, "v6")
+		v6["subnet"] = spec.SubnetV6
+		v6["gateway"] = spec.GatewayV6
+	}
+}
+
+// InspectNetwork compares Docker's view of the network with the spec.
+func (m *Manager) InspectNetwork(spec NetworkSpec) (NetworkState, error) {
+	if spec.Name == "" {
+		spec.Name = defaultNetworkName
+	}
+	state := NetworkState{Name: spec.Name}
+
+	var nw dockerNetwork
+	status, err := dockerRequest("GET", "/networks/"+spec.Name, nil, &nw)
+	if status == http.StatusNotFound {
+		state.Problems = append(state.Problems, "network does not exist")
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	state.Exists = true
+	state.IPv6 = nw.EnableIPv6
+	state.Containers = len(nw.Containers)
+	for _, c := range nw.IPAM.Config {
+		if ip, _, err := net.ParseCIDR(c.Subnet); err == nil && ip.To4() != nil {
+			state.Subnet = c.Subnet
+			state.Gateway = c.Gateway
+			break
+		}
+	}
+	state.MTU, _ = strconv.Atoi(nw.Options[mtuOption])
+
+	if nw.Driver != "bridge" {
+		state.Problems = append(state.Problems, fmt.Sprintf("driver is %q, expected bridge", nw.Driver))
+	}
+	if spec.Subnet != "" && state.Subnet != spec.Subnet {
+		state.Problems = append(state.Problems, fmt.Sprintf("subnet is %q, expected %q", state.Subnet, spec.Subnet))
+	}
+	if spec.Gateway != "" && state.Gateway != spec.Gateway {
+		state.Problems = append(state.Problems, fmt.Sprintf("gateway is %q, expected %q", state.Gateway, spec.Gateway))
+	}
+	if spec.MTU > 0 && state.MTU != spec.MTU {
+		state.Problems = append(state.Problems, fmt.Sprintf("mtu is %d, expected %d", state.MTU, spec.MTU))
+	}
+	if spec.IPv6 != nil && state.IPv6 != *spec.IPv6 {
+		state.Problems = append(state.Problems, fmt.Sprintf("ipv6 is %t, expected %t", state.IPv6, *spec.IPv6))
+	}
+
+	// A network whose bridge interface vanished or went down silently
+	// breaks connectivity for every server on it.
+	state.Bridge = nw.Options[bridgeNameOption]
+	if state.Bridge != "" {
+		iface, err := net.InterfaceByName(state.Bridge)
+		switch {
+		case err != nil:
+			state.Problems = append(state.Problems, fmt.Sprintf("bridge %s is missing", state.Bridge))
+		case iface.Flags&net.FlagUp == 0:
+			state.Problems = append(state.Problems, fmt.Sprintf("bridge %s is down", state.Bridge))
+		default:
+			state.BridgeUp = true
+		}
+	}
+
+	return state, nil
+}
+
+// RepairNetwork rewrites the network settings in the Wings config, removes
+// the existing network and restarts Wings, which recreates it on boot.
+// Running servers lose connectivity until they are restarted.
+func (m *Manager) RepairNetwork(spec NetworkSpec) (NetworkState, error) {
+	if spec.Name == "" {
+		spec.Name = defaultNetworkName
+	}
+	if _, _, err := net.ParseCIDR(spec.Subnet); err != nil {
+		return NetworkState{}, fmt.Errorf("invalid subnet %q", spec.Subnet)
+	}
+	if net.ParseIP(spec.Gateway) == nil {
+		return NetworkState{}, fmt.Errorf("invalid gateway %q", spec.Gateway)
+	}
+
+	cfg, err := LoadConfig(m.cfg.ConfigPath)
+	if err != nil {
+		return NetworkState{}, err
+	}
+	spec.apply(cfg)
+	if _, err := m.WriteConfig(cfg); err != nil {
+		return NetworkState{}, err
+	}
+
+	if err := m.services.Stop(context.Background(), m.cfg.SystemdUnit); err != nil {
+		return NetworkState{}, err
+	}
+
+	var nw dockerNetwork
+	if status, err := dockerRequest("GET", "/networks/"+spec.Name, nil, &nw); err == nil {
+		for id := range nw.Containers {
+			dockerRequest("POST", "/networks/"+spec.Name+"/disconnect", map[string]interface{}{"Container": id, "Force": true}, nil)
+		}
+		if _, err := dockerRequest("DELETE", "/networks/"+spec.Name, nil, nil); err != nil {
+			return NetworkState{}, fmt.Errorf("failed to remove network: %w", err)
+		}
+	} else if status != http.StatusNotFound {
+		return NetworkState{}, err
+	}
+	m.logger.WithField("network", spec.Name).Warn("Removed Docker network for recreation")
+
+	if err := m.Restart(); err != nil {
+		return NetworkState{}, err
+	}
+	return m.InspectNetwork(spec)
+}
+
+func nestedMap(m map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, k := range keys {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		m = next
+	}
+	return m
+}
+
+func ensureMap(m map[string]interface{}, key string) map[string]interface{} {
+	if next, ok := m[key].(map[string]interface{}); ok {
+		return next
+	}
+	next := make(map[string]interface{})
+	m[key] = next
+	return next
+}
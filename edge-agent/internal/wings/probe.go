@@ -0,0 +1,85 @@
+package wings
+
+import (
+	"sync"
+	"time"
+)
+
+// ProbeResult is reported in heartbeats.
+type ProbeResult struct {
+	Reachable           bool      `json:"reachable"`
+	LatencyMs           float64   `json:"latency_ms"`
+	ServerCount         int       `json:"server_count"`
+	RunningServers      int       `json:"running_servers"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CheckedAt           time.Time `json:"checked_at"`
+}
+
+// Prober checks that the Wings API actually answers, which
+// `systemctl is-active` can't tell.
+type Prober struct {
+	api *APIClient
+
+	mu   sync.Mutex
+	last ProbeResult
+}
+
+func NewProber(configPath string) *Prober {
+	return &Prober{api: NewAPIClient(configPath)}
+}
+
+func (p *Prober) Last() ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// Probe queries the Wings system and servers endpoints and records the result.
+func (p *Prober) Probe() ProbeResult {
+	result := ProbeResult{CheckedAt: time.Now()}
+
+	err := p.probe(&result)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Reachable = true
+	}
+
+	p.mu.Lock()
+	if err != nil {
+		result.ConsecutiveFailures = p.last.ConsecutiveFailures + 1
+	}
+	p.last = result
+	p.mu.Unlock()
+
+	return result
+}
+
+// ResetFailures clears the failure streak, e.g. after a restart.
+func (p *Prober) ResetFailures() {
+	p.mu.Lock()
+	p.last.ConsecutiveFailures = 0
+	p.mu.Unlock()
+}
+
+func (p *Prober) probe(result *ProbeResult) error {
+	start := time.Now()
+	if err := p.api.Do("GET", "/api/system", nil, nil); err != nil {
+		return err
+	}
+	result.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+
+	servers, err := p.api.Servers()
+	if err != nil {
+		return err
+	}
+
+	result.ServerCount = len(servers)
+	for _, s := range servers {
+		if s.State == "running" {
+			result.RunningServers++
+		}
+	}
+	return nil
+}
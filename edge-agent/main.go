@@ -1,108 +1,110 @@
 package main
 
 import (
-	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"path/filepath"
-	"syscall"
+	"strings"
 
-	"github.com/pterodactyl-cp/edge-agent/internal/agent"
-	"github.com/pterodactyl-cp/edge-agent/internal/config"
+	"github.com/pterodactyl-cp/edge-agent/internal/logging"
 	"github.com/sirupsen/logrus"
 )
 
+// Overridden at build time via -ldflags "-X main.Version=..." (see Makefile).
+var (
+	Version   = "1.0.0"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
 const (
-	Version = "1.0.0"
+	defaultConfigPath = "/etc/hosting-agent/config.yaml"
+	defaultSocketPath = "/var/lib/hosting-agent/agent.sock"
 )
 
-func main() {
-	var (
-		configPath    = flag.String("config", "/etc/hosting-agent/config.yaml", "Path to configuration file")
-		logLevel      = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-		version       = flag.Bool("version", false, "Show version information")
-		installMode   = flag.Bool("install", false, "Install mode for initial setup")
-		enrollToken   = flag.String("enroll-token", "", "Enrollment token for registration")
-		controlPlaneURL = flag.String("control-plane", "", "Control plane URL")
-	)
-	flag.Parse()
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-	if *version {
-		logrus.Infof("Pterodactyl Control Plane Edge Agent v%s", Version)
-		os.Exit(0)
-	}
+var commands = []command{
+	{"run", "Run the agent (default when no command is given)", runCommand},
+	{"enroll", "Enroll this node, or activate a pre-registered one, with the control plane", enrollCommand},
+	{"status", "Show the status of the running agent", statusCommand},
+	{"diagnose", "Check the local environment for common problems, or write a support bundle", diagnoseCommand},
+	{"check", "Verify end-to-end connectivity to the control plane", checkCommand},
+	{"config", "Configuration helpers (config validate)", configCommand},
+	{"tasks", "Inspect tasks this node has run (tasks history)", tasksCommand},
+	{"unenroll", "Decommission this node: deregister it and wipe its credentials and state", unenrollCommand},
+	{"uninstall", "Remove the agent service, optionally deregistering and purging its data", uninstallCommand},
+	{"loadtest", "Simulate a fleet of agents against a staging control plane (developer tool)", loadtestCommand},
+	{"version", "Show version information", versionCommand},
+}
 
-	// Configure logging
-	level, err := logrus.ParseLevel(*logLevel)
+func main() {
+	args, err := extractOutputFlag(os.Args[1:])
 	if err != nil {
-		logrus.WithError(err).Fatal("Invalid log level")
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
 	}
-	logrus.SetLevel(level)
-	logrus.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
 
-	logger := logrus.WithFields(logrus.Fields{
-		"component": "main",
-		"version":   Version,
-	})
+	// Flags without a command keep the pre-subcommand invocation working,
+	// e.g. the systemd unit's `hosting-edge-agent --config ...`.
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	logger.Info("Starting Pterodactyl Control Plane Edge Agent")
+	if name == "help" {
+		usage()
+		return
+	}
 
-	// Load configuration
-	cfg, err := config.Load(*configPath)
-	if err != nil {
-		if *installMode && (*enrollToken == "" || *controlPlaneURL == "") {
-			logger.Fatal("Install mode requires --enroll-token and --control-plane flags")
-		} else if *installMode {
-			// Create initial configuration for enrollment
-			cfg = &config.Config{
-				ControlPlane: config.ControlPlaneConfig{
-					URL:         *controlPlaneURL,
-					EnrollToken: *enrollToken,
-				},
-				Agent: config.AgentConfig{
-					LogLevel:        *logLevel,
-					HeartbeatInterval: 30,
-					MetricsInterval:   60,
-				},
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
 			}
-			
-			// Create config directory
-			if err := os.MkdirAll(filepath.Dir(*configPath), 0755); err != nil {
-				logger.WithError(err).Fatal("Failed to create config directory")
-			}
-			
-			// Save initial config
-			if err := config.Save(*configPath, cfg); err != nil {
-				logger.WithError(err).Fatal("Failed to save initial configuration")
-			}
-			logger.Info("Initial configuration saved")
-		} else {
-			logger.WithError(err).Fatal("Failed to load configuration")
+			return
 		}
 	}
 
-	// Create and start agent
-	a, err := agent.New(cfg, logger)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to create agent")
-	}
-
-	// Handle shutdown gracefully
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	go func() {
-		sig := <-sigChan
-		logger.WithField("signal", sig).Info("Received shutdown signal")
-		a.Stop()
-	}()
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: hosting-edge-agent <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Global flags:")
+	fmt.Fprintln(os.Stderr, "  -o, --output  Output format: table (default), json or yaml")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'hosting-edge-agent <command> -h' for command flags.")
+}
 
-	// Start the agent
-	if err := a.Start(); err != nil {
-		logger.WithError(err).Fatal("Agent failed to start")
+func setupLogging(logLevel string) (*logrus.Entry, error) {
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
 	}
+	logging.Init(level)
 
-	logger.Info("Agent stopped")
-}
\ No newline at end of file
+	return logrus.WithFields(logrus.Fields{
+		"component": "main",
+		"version":   Version,
+	}), nil
+}
+
+func versionCommand(args []string) error {
+	info := map[string]string{"version": Version, "commit": Commit, "build_time": BuildTime}
+	return render(info, func() {
+		fmt.Printf("Pterodactyl Control Plane Edge Agent v%s (commit %s, built %s)\n", Version, Commit, BuildTime)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// outputFormat is set by the global --output flag.
+var outputFormat = outputTable
+
+// extractOutputFlag removes --output/-o from anywhere in args, so it works
+// before or after the subcommand name.
+func extractOutputFlag(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--output" || arg == "-output" || arg == "-o":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s needs a value", arg)
+			}
+			outputFormat = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--output=") || strings.HasPrefix(arg, "-output=") || strings.HasPrefix(arg, "-o="):
+			outputFormat = arg[strings.IndexByte(arg, '=')+1:]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	switch outputFormat {
+	case outputTable, outputJSON, outputYAML:
+		return rest, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (json, yaml or table)", outputFormat)
+}
+
+// render writes v in the selected machine-readable format, or calls table
+// for the human one. Keys are the JSON field names in both formats.
+func render(v interface{}, table func()) error {
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		table()
+		return nil
+	}
+}
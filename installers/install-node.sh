@@ -278,7 +278,7 @@ Wants=network.target
 Type=simple
 User=root
 Group=root
-ExecStart=/usr/local/bin/hosting-edge-agent --config /etc/hosting-agent/config.yaml
+ExecStart=/usr/local/bin/hosting-edge-agent run --config /etc/hosting-agent/config.yaml
 ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
 RestartSec=5
@@ -290,7 +290,12 @@ NoNewPrivileges=yes
 PrivateTmp=yes
 ProtectSystem=strict
 ProtectHome=yes
-ReadWritePaths=/etc/hosting-agent /var/lib/hosting-agent /var/log /etc/pterodactyl
+# /run/hosting-agent holds the world-readable heartbeat mirror.
+RuntimeDirectory=hosting-agent
+RuntimeDirectoryMode=0755
+# A Wings data directory other than /var/lib/pterodactyl/volumes needs adding
+# here for restores and snapshot rollbacks.
+ReadWritePaths=/etc/hosting-agent /var/lib/hosting-agent /var/log /etc/pterodactyl -/etc/systemd/system/wings.service -/etc/docker -/etc/ufw -/var/lib/pterodactyl -/etc/lvm -/run/lvm -/run/lock/lvm /usr/local/bin
 ProtectKernelTunables=yes
 ProtectKernelModules=yes
 ProtectControlGroups=yes
@@ -350,28 +355,9 @@ configure_firewall() {
 start_enrollment() {
     log_info "Starting node enrollment process..."
     
-    # Start edge agent in install mode
-    /usr/local/bin/hosting-edge-agent --install --enroll-token="$ENROLLMENT_TOKEN" --control-plane="$CONTROL_PLANE_URL" &
-    AGENT_PID=$!
-    
-    # Wait for enrollment to complete (timeout after 60 seconds)
-    TIMEOUT=60
-    COUNTER=0
-    
-    while [[ $COUNTER -lt $TIMEOUT ]]; do
-        if [[ ! -f /etc/hosting-agent/config.yaml ]] || grep -q "enroll_token" /etc/hosting-agent/config.yaml; then
-            sleep 1
-            ((COUNTER++))
-        else
-            break
-        fi
-    done
-    
-    # Kill the temporary agent process
-    kill $AGENT_PID 2>/dev/null || true
-    
-    if [[ $COUNTER -ge $TIMEOUT ]]; then
-        error_exit "Enrollment process timed out. Please check your enrollment token and control plane connectivity."
+    # Enroll synchronously, the command exits once the node is registered
+    if ! timeout 60 /usr/local/bin/hosting-edge-agent enroll --token="$ENROLLMENT_TOKEN" --control-plane="$CONTROL_PLANE_URL"; then
+        error_exit "Enrollment failed. Please check your enrollment token and control plane connectivity."
     fi
     
     log_success "Node enrollment completed"